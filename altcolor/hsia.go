@@ -57,10 +57,10 @@ func (col HSIA) RGBA() (red, green, blue, alpha uint32) {
 		r = z
 	}
 
-	red = uint32(utils.Truncatef(r*a*255)) << 8
-	green = uint32(utils.Truncatef(g*a*255)) << 8
-	blue = uint32(utils.Truncatef(b*a*255)) << 8
-	alpha = uint32(a*255) << 8
+	red = utils.Ratio16(r * a)
+	green = utils.Ratio16(g * a)
+	blue = utils.Ratio16(b * a)
+	alpha = utils.Ratio16(a)
 
 	return
 }
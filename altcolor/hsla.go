@@ -61,10 +61,10 @@ func (col HSLA) RGBA() (red, green, blue, alpha uint32) {
 
 	m := l - 0.5*c
 
-	red = uint32(utils.Truncatef((r+m)*a*255)) << 8
-	green = uint32(utils.Truncatef((g+m)*a*255)) << 8
-	blue = uint32(utils.Truncatef((b+m)*a*255)) << 8
-	alpha = uint32(a*255) << 8
+	red = utils.Ratio16((r + m) * a)
+	green = utils.Ratio16((g + m) * a)
+	blue = utils.Ratio16((b + m) * a)
+	alpha = utils.Ratio16(a)
 
 	return
 }
@@ -7,6 +7,7 @@ package blend
 import (
 	"image"
 	"image/color"
+	"image/draw"
 	"math"
 	"math/rand"
 
@@ -40,19 +41,28 @@ func BlendPixel(cb, cs color.Color, f Blender) color.Color {
 	// Union function. (Section 7.2.6)
 	alpha := ab + as - (ab * as)
 
-	return color.RGBA{
-		uint8(utils.Truncatef(red * 255)),
-		uint8(utils.Truncatef(green * 255)),
-		uint8(utils.Truncatef(blue * 255)),
-		uint8(utils.Truncatef(alpha * 255)),
+	return color.RGBA64{
+		uint16(utils.Ratio16(red)),
+		uint16(utils.Ratio16(green)),
+		uint16(utils.Ratio16(blue)),
+		uint16(utils.Ratio16(alpha)),
 	}
 }
 
 // BlendPixels takes the base and blend images and applies the given Blender to
-// each of their pixel pairs.
+// each of their pixel pairs. The result has 16 bits per channel if either image
+// does.
+//
+// If a is a *utils.Linear image the colours given to the Blender have linear
+// values, so the blend is done in linear light, and a *utils.Linear image is
+// returned.
 func BlendPixels(a, b image.Image, f Blender) image.Image {
+	if l, ok := a.(*utils.Linear); ok {
+		return blendPixelsLinear(l, utils.ToLinear(b), f)
+	}
+
 	bounds := a.Bounds()
-	result := image.NewRGBA(bounds)
+	result := newImageFor(a, b, bounds)
 
 	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
 		for x := bounds.Min.X; x < bounds.Max.X; x++ {
@@ -65,32 +75,58 @@ func BlendPixels(a, b image.Image, f Blender) image.Image {
 	return result
 }
 
+func blendPixelsLinear(a, b *utils.Linear, f Blender) *utils.Linear {
+	// The linear values are passed as if they were sRGB, so that the Blender
+	// does its arithmetic on them directly.
+	raw := func(c utils.LinearColor) color.Color {
+		return color.RGBA64{
+			uint16(utils.Ratio16(float64(c.R))),
+			uint16(utils.Ratio16(float64(c.G))),
+			uint16(utils.Ratio16(float64(c.B))),
+			uint16(utils.Ratio16(float64(c.A))),
+		}
+	}
+
+	bounds := a.Bounds()
+	result := utils.NewLinear(bounds)
+
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			cr, cg, cb, ca := BlendPixel(raw(a.LinearAt(x, y)), raw(b.LinearAt(x, y)), f).RGBA()
+
+			result.SetLinear(x, y, utils.LinearColor{
+				R: float32(cr) / 0xffff,
+				G: float32(cg) / 0xffff,
+				B: float32(cb) / 0xffff,
+				A: float32(ca) / 0xffff,
+			})
+		}
+	}
+
+	return result
+}
+
 // Fade changes the opacity of the Image given by the amount given. The
 // resulting opacity is the product of the image's opacity and the amount, so a
 // value of 1 has no effect whilst a value of 0 makes the image fully
 // transparent.
 func Fade(img image.Image, amount float64) image.Image {
 	f := func(c color.Color) color.Color {
-		r, g, b, a := utils.NormalisedRGBA(c)
+		r, g, b, a := utils.RatioRGBA(c)
 
-		return color.NRGBA{
-			uint8(float64(r)),
-			uint8(float64(g)),
-			uint8(float64(b)),
-			uint8(float64(a) * amount),
-		}
+		return utils.RatioNRGBA(r, g, b, a*amount)
 	}
 
 	return utils.MapColor(img, f)
 }
 
-func ratioNRGBA(r, g, b, a float64) color.Color {
-	return color.NRGBA{
-		uint8(utils.Truncatef(r * 255)),
-		uint8(utils.Truncatef(g * 255)),
-		uint8(utils.Truncatef(b * 255)),
-		uint8(utils.Truncatef(a * 255)),
+// newImageFor returns an image to hold the result of blending a and b, see
+// utils.NewImageFor.
+func newImageFor(a, b image.Image, bounds image.Rectangle) draw.Image {
+	if utils.Deep(b) {
+		return utils.NewImageFor(b, bounds)
 	}
+	return utils.NewImageFor(a, bounds)
 }
 
 // Normal selects the blend Image.
@@ -108,7 +144,7 @@ func Dissolve(a, b image.Image) image.Image {
 	width := int(utils.Min(uint32(ba.Dx()), uint32(bb.Dx())))
 	height := int(utils.Min(uint32(ba.Dy()), uint32(bb.Dy())))
 
-	result := image.NewRGBA(image.Rect(0, 0, width, height))
+	result := newImageFor(a, b, image.Rect(0, 0, width, height))
 
 	for y := 0; y < height; y++ {
 		for x := 0; x < width; x++ {
@@ -117,10 +153,10 @@ func Dissolve(a, b image.Image) image.Image {
 			// blend colour
 			rs, gs, bs, as := utils.RatioRGBA(b.At(x, y))
 
-			toPaint := ratioNRGBA(rb, gb, bb, ab)
+			toPaint := utils.RatioNRGBA(rb, gb, bb, ab)
 
 			if rand.Float64() < as {
-				toPaint = ratioNRGBA(rs, gs, bs, 1)
+				toPaint = utils.RatioNRGBA(rs, gs, bs, 1)
 			}
 
 			result.Set(x, y, toPaint)
@@ -141,7 +177,7 @@ func Darken(a, b image.Image) image.Image {
 		b := utils.Minf(k, o)
 		a := utils.Minf(l, p)
 
-		return ratioNRGBA(r, g, b, a)
+		return utils.RatioNRGBA(r, g, b, a)
 	})
 }
 
@@ -156,7 +192,7 @@ func Multiply(a, b image.Image) image.Image {
 		b := k * o
 		a := l * p
 
-		return ratioNRGBA(r, g, b, a)
+		return utils.RatioNRGBA(r, g, b, a)
 	})
 }
 
@@ -171,7 +207,7 @@ func Burn(a, b image.Image) image.Image {
 		b := 1 - ((1 - k) / o)
 		a := p + l*(1-p)
 
-		return ratioNRGBA(r, g, b, a)
+		return utils.RatioNRGBA(r, g, b, a)
 	})
 }
 
@@ -187,7 +223,7 @@ func LinearBurn(a, b image.Image) image.Image {
 		b := k + o - 1
 		a := p + l*(1-p)
 
-		return ratioNRGBA(r, g, b, a)
+		return utils.RatioNRGBA(r, g, b, a)
 	})
 }
 
@@ -215,7 +251,7 @@ func Lighten(a, b image.Image) image.Image {
 		b := utils.Maxf(k, o)
 		a := utils.Maxf(l, p)
 
-		return ratioNRGBA(r, g, b, a)
+		return utils.RatioNRGBA(r, g, b, a)
 	})
 }
 
@@ -231,7 +267,7 @@ func Screen(a, b image.Image) image.Image {
 		b := 1 - ((1 - k) * (1 - o))
 		a := p + l*(1-p)
 
-		return ratioNRGBA(r, g, b, a)
+		return utils.RatioNRGBA(r, g, b, a)
 	})
 }
 
@@ -246,7 +282,7 @@ func Dodge(a, b image.Image) image.Image {
 		b := k / (1 - o)
 		a := p + l*(1-p)
 
-		return ratioNRGBA(r, g, b, a)
+		return utils.RatioNRGBA(r, g, b, a)
 	})
 }
 
@@ -272,20 +308,15 @@ func Lighter(a, b image.Image) image.Image {
 // Overlay multiplies or screens the colours, depending on the base colour.
 func Overlay(a, b image.Image) image.Image {
 	return BlendPixels(a, b, func(c, d color.Color) color.Color {
-		i, j, k, l := utils.NormalisedRGBAf(c)
-		m, n, o, p := utils.NormalisedRGBAf(d)
+		i, j, k, l := utils.RatioRGBA(c)
+		m, n, o, p := utils.RatioRGBA(d)
 
-		r := (i / 255) * (i + ((2*m)/255)*(255-i))
-		g := (j / 255) * (j + ((2*n)/255)*(255-j))
-		b := (k / 255) * (k + ((2*o)/255)*(255-k))
+		r := i * (i + 2*m*(1-i))
+		g := j * (j + 2*n*(1-j))
+		b := k * (k + 2*o*(1-k))
 		a := p + l*(1-p)
 
-		return color.NRGBA{
-			uint8(utils.Truncatef(r)),
-			uint8(utils.Truncatef(g)),
-			uint8(utils.Truncatef(b)),
-			uint8(utils.Truncatef(a * 255)),
-		}
+		return utils.RatioNRGBA(r, g, b, a)
 	})
 }
 
@@ -308,7 +339,7 @@ func SoftLight(a, b image.Image) image.Image {
 		b := f(k, o)
 		a := p + l*(1-p)
 
-		return ratioNRGBA(r, g, b, a)
+		return utils.RatioNRGBA(r, g, b, a)
 	})
 }
 
@@ -316,14 +347,14 @@ func SoftLight(a, b image.Image) image.Image {
 // colour. The effect is similar to shining a harsh spotlight on the image.
 func HardLight(a, b image.Image) image.Image {
 	return BlendPixels(a, b, func(c, d color.Color) color.Color {
-		i, j, k, l := utils.NormalisedRGBAf(c)
-		m, n, o, p := utils.NormalisedRGBAf(d)
+		i, j, k, l := utils.RatioRGBA(c)
+		m, n, o, p := utils.RatioRGBA(d)
 
 		f := func(i, j float64) float64 {
-			if j > 128 {
-				return 255 - ((255-2*(j-128))*(255-i))/256
+			if j > 0.5 {
+				return 1 - (1-2*(j-0.5))*(1-i)
 			}
-			return (2 * j * i) / 256
+			return 2 * j * i
 		}
 
 		r := f(i, m)
@@ -331,12 +362,7 @@ func HardLight(a, b image.Image) image.Image {
 		b := f(k, o)
 		a := p + l*(1-p)
 
-		return color.NRGBA{
-			uint8(utils.Truncatef(r)),
-			uint8(utils.Truncatef(g)),
-			uint8(utils.Truncatef(b)),
-			uint8(utils.Truncatef(a * 255)),
-		}
+		return utils.RatioNRGBA(r, g, b, a)
 	})
 }
 
@@ -359,7 +385,7 @@ func VividLight(a, b image.Image) image.Image {
 		b := f(k, o)
 		a := p + l*(1-p)
 
-		return ratioNRGBA(r, g, b, a)
+		return utils.RatioNRGBA(r, g, b, a)
 	})
 }
 
@@ -368,24 +394,34 @@ func VividLight(a, b image.Image) image.Image {
 // darker, the image is darkened. It uses linear burn and linear dodge to darken
 // or lighten.
 func LinearLight(a, b image.Image) image.Image {
-	return BlendPixels(a, b, func(c, d color.Color) color.Color {
-		i, j, k, l := utils.RatioRGBA(c)
-		m, n, o, p := utils.RatioRGBA(d)
+	return BlendPixels(a, b, linearLight)
+}
 
-		f := func(i, j float64) float64 {
-			if j > 0.5 {
-				return i + 2*(j-0.5)
-			}
-			return i + 2*j - 1
+// LinearLightC returns a function that blends each colour with d, in the same
+// way as LinearLight.
+func LinearLightC(d color.Color) utils.Composable {
+	return func(c color.Color) color.Color {
+		return BlendPixel(c, d, linearLight)
+	}
+}
+
+func linearLight(c, d color.Color) color.Color {
+	i, j, k, l := utils.RatioRGBA(c)
+	m, n, o, p := utils.RatioRGBA(d)
+
+	f := func(i, j float64) float64 {
+		if j > 0.5 {
+			return i + 2*(j-0.5)
 		}
+		return i + 2*j - 1
+	}
 
-		r := f(i, m)
-		g := f(j, n)
-		b := f(k, o)
-		a := p + l*(1-p)
+	r := f(i, m)
+	g := f(j, n)
+	b := f(k, o)
+	a := p + l*(1-p)
 
-		return ratioNRGBA(r, g, b, a)
-	})
+	return utils.RatioNRGBA(r, g, b, a)
 }
 
 // PinLight replaces the colours, depending on the blend colour.
@@ -408,7 +444,7 @@ func PinLight(a, b image.Image) image.Image {
 		b := f(k, o)
 		a := p + l*(1-p)
 
-		return ratioNRGBA(r, g, b, a)
+		return utils.RatioNRGBA(r, g, b, a)
 	})
 }
 
@@ -433,7 +469,7 @@ func HardMix(a, b image.Image) image.Image {
 		b := f(k, o)
 		a := p + l*(1-p)
 
-		return ratioNRGBA(r, g, b, a)
+		return utils.RatioNRGBA(r, g, b, a)
 	})
 }
 
@@ -448,7 +484,7 @@ func Difference(a, b image.Image) image.Image {
 		b := math.Abs(o - k)
 		a := p + l*(1-p)
 
-		return ratioNRGBA(r, g, b, a)
+		return utils.RatioNRGBA(r, g, b, a)
 	})
 }
 
@@ -464,48 +500,29 @@ func Exclusion(a, b image.Image) image.Image {
 		b := o + k - (2 * o * k)
 		a := p + l*(1-p)
 
-		return ratioNRGBA(r, g, b, a)
+		return utils.RatioNRGBA(r, g, b, a)
 	})
 }
 
 // Addition adds the blend colour to the base colour. (aka. Linear Dodge)
 func Addition(a, b image.Image) image.Image {
 	return BlendPixels(a, b, func(c, d color.Color) color.Color {
-		i, j, k, l := utils.NormalisedRGBA(c)
-		m, n, o, p := utils.NormalisedRGBA(d)
-
-		r := utils.Min(i+m, 255)
-		g := utils.Min(j+n, 255)
-		b := utils.Min(k+o, 255)
-		a := utils.Min(l+p, 255)
+		i, j, k, l := utils.RatioRGBA(c)
+		m, n, o, p := utils.RatioRGBA(d)
 
-		return color.NRGBA{uint8(r), uint8(g), uint8(b), uint8(a)}
+		return utils.RatioNRGBA(i+m, j+n, k+o, l+p)
 	})
 }
 
 // Subtraction subtracts the blend colour from the base colour.
 func Subtraction(a, b image.Image) image.Image {
 	return BlendPixels(a, b, func(c, d color.Color) color.Color {
-		i, j, k, l := utils.NormalisedRGBA(c)
-		m, n, o, p := utils.NormalisedRGBA(d)
-
-		r := utils.Truncate(i - m)
-		g := utils.Truncate(j - n)
-		b := utils.Truncate(k - o)
-
-		if m > i {
-			r = 0
-		}
-		if n > j {
-			g = 0
-		}
-		if o > k {
-			b = 0
-		}
+		i, j, k, l := utils.RatioRGBA(c)
+		m, n, o, p := utils.RatioRGBA(d)
 
 		a := p + l*(1-p)
 
-		return color.NRGBA{uint8(r), uint8(g), uint8(b), uint8(a)}
+		return utils.RatioNRGBA(i-m, j-n, k-o, a)
 	})
 }
 
@@ -2,20 +2,19 @@
 package blur
 
 import (
+	"errors"
 	"image"
-	"image/color"
 	"math"
-	"os"
-
-	"hawx.me/code/img/utils"
 )
 
+var errKernelSize = errors.New("blur: kernel size must be odd and positive")
+
 type Style float64
 
 const (
 	// Ignore edges, may leave them semi-transparent
 	IGNORE Style = iota
-	// Clamp edges, may leave them looking unblurred
+	// Clamp edges, repeating the pixels at the edge of the image
 	CLAMP
 	// Wrap edges, may change colour of edges
 	WRAP
@@ -38,10 +37,29 @@ func correct(num int) bool {
 // references the first row and kernel[i][0] (for all i) is the first column.
 type Kernel [][]float64
 
-func NewHorizontalKernel(width int, f func(x int) float64) Kernel {
+// SobelX and SobelY are Kernels that find the change in value from left to
+// right, and from top to bottom. As their weights sum to 0 they should be used
+// with ConvolveColor, and as each weight is negated in the other direction they
+// are often applied again Scaled by -1.
+var (
+	SobelX = Kernel{
+		{-1, 0, 1},
+		{-2, 0, 2},
+		{-1, 0, 1},
+	}
+	SobelY = Kernel{
+		{-1, -2, -1},
+		{0, 0, 0},
+		{1, 2, 1},
+	}
+)
+
+// NewHorizontalKernel creates a Kernel one pixel tall, it is populated by the
+// given function which is passed the signed x offset from the mid point. An
+// error is returned if width is not odd and positive.
+func NewHorizontalKernel(width int, f func(x int) float64) (Kernel, error) {
 	if !correct(width) {
-		utils.Warn("Error: kernel size wrong!")
-		os.Exit(2)
+		return nil, errKernelSize
 	}
 
 	mx := (width - 1) / 2
@@ -51,13 +69,15 @@ func NewHorizontalKernel(width int, f func(x int) float64) Kernel {
 		k[0][x] = f(mx - x)
 	}
 
-	return k
+	return k, nil
 }
 
-func NewVerticalKernel(height int, f func(y int) float64) Kernel {
+// NewVerticalKernel creates a Kernel one pixel wide, it is populated by the
+// given function which is passed the signed y offset from the mid point. An
+// error is returned if height is not odd and positive.
+func NewVerticalKernel(height int, f func(y int) float64) (Kernel, error) {
 	if !correct(height) {
-		utils.Warn("Error: kernel size wrong!")
-		os.Exit(2)
+		return nil, errKernelSize
 	}
 
 	my := (height - 1) / 2
@@ -67,17 +87,15 @@ func NewVerticalKernel(height int, f func(y int) float64) Kernel {
 		k[y] = []float64{f(my - y)}
 	}
 
-	return k
+	return k, nil
 }
 
 // NewKernel creates a new Kernel of the dimensions given, it is populated by
 // the given function which itself is passed the signed x and y offsets from the
-// mid point.
-func NewKernel(height, width int, f func(x, y int) float64) Kernel {
+// mid point. An error is returned if either dimension is not odd and positive.
+func NewKernel(height, width int, f func(x, y int) float64) (Kernel, error) {
 	if !correct(width) || !correct(height) {
-		utils.Warn("Error: kernel size wrong!")
-		os.Exit(2)
-		// should return error really!
+		return nil, errKernelSize
 	}
 
 	mx := (width - 1) / 2
@@ -91,7 +109,7 @@ func NewKernel(height, width int, f func(x, y int) float64) Kernel {
 		}
 	}
 
-	return k
+	return k, nil
 }
 
 // Normalised returns a copy of the Kernel where the sum of all entries is 1.
@@ -115,6 +133,20 @@ func (k Kernel) Normalised() Kernel {
 	return nk
 }
 
+// Scaled returns a copy of the Kernel with every entry multiplied by n.
+func (k Kernel) Scaled(n float64) Kernel {
+	nk := make([][]float64, k.Height())
+
+	for y := 0; y < k.Height(); y++ {
+		nk[y] = make([]float64, k.Width())
+		for x := 0; x < k.Width(); x++ {
+			nk[y][x] = k[y][x] * n
+		}
+	}
+
+	return nk
+}
+
 // Height returns the height of the Kernel.
 func (k Kernel) Height() int {
 	return len(k)
@@ -133,103 +165,35 @@ func (k Kernel) Mid() image.Point {
 	return image.Pt((k.Width()-1)/2, (k.Height()-1)/2)
 }
 
-func Convolve(in image.Image, weights Kernel, style Style) image.Image {
-	bnds := in.Bounds()
-	mid := weights.Mid()
-	o := image.NewRGBA(bnds)
-
-	for y := bnds.Min.Y; y < bnds.Max.Y; y++ {
-		for x := bnds.Min.X; x < bnds.Max.X; x++ {
-			var r, g, b, a, offset float64
-
-			for oy := 0; oy < weights.Height(); oy++ {
-				for ox := 0; ox < weights.Width(); ox++ {
-					factor := weights[oy][ox]
-					pt := image.Pt(x+ox-mid.X, y+oy-mid.Y)
-
-					if pt == weights.Mid() {
-						// Ignore!
-
-					} else if pt.In(bnds) {
-						or, og, ob, oa := in.At(pt.X, pt.Y).RGBA()
-
-						r += float64(or) * factor
-						g += float64(og) * factor
-						b += float64(ob) * factor
-						a += float64(oa) * factor
-
-					} else {
-						switch style {
-						case CLAMP:
-							offset += factor
-
-						case WRAP:
-							if pt.X >= bnds.Max.X {
-								pt.X = pt.X - bnds.Max.X
-							} else if pt.X < bnds.Min.X {
-								pt.X = bnds.Dx() + pt.X
-							}
-
-							if pt.Y >= bnds.Max.Y {
-								pt.Y = pt.Y - bnds.Max.Y
-							} else if pt.Y < bnds.Min.Y {
-								pt.Y = bnds.Dy() + pt.Y
-							}
-
-							or, og, ob, oa := in.At(pt.X, pt.Y).RGBA()
-
-							r += float64(or) * factor
-							g += float64(og) * factor
-							b += float64(ob) * factor
-							a += float64(oa) * factor
-						}
-					}
-				}
-			}
-
-			if offset != 0 && style == CLAMP {
-				or, og, ob, oa := in.At(x, y).RGBA()
-				r += float64(or) * offset
-				g += float64(og) * offset
-				b += float64(ob) * offset
-				a += float64(oa) * offset
-			}
-
-			o.Set(x, y, color.RGBA{
-				uint8(utils.Truncatef(r / 255)),
-				uint8(utils.Truncatef(g / 255)),
-				uint8(utils.Truncatef(b / 255)),
-				uint8(utils.Truncatef(a / 255)),
-			})
-		}
-	}
-
-	return o
-}
-
-// Perform a convolution with two Kernels in succession.
-func Convolve2(in image.Image, a, b Kernel, style Style) image.Image {
-	return Convolve(Convolve(in, a, style), b, style)
-}
-
-// Box performs a box blur on the Image given.
-func Box(in image.Image, radius int, style Style) image.Image {
+// Box performs a box blur on the Image given. An error is returned if radius is
+// negative.
+func Box(in image.Image, radius int, style Style) (image.Image, error) {
 	f := func(n int) float64 { return 1.0 }
 
-	tall := NewVerticalKernel(radius*2+1, f).Normalised()
-	wide := NewHorizontalKernel(radius*2+1, f).Normalised()
-
-	return Convolve2(in, tall, wide, style)
+	return separable(in, radius, f, style)
 }
 
-// Gaussian performs a gaussian blur on the Image given.
-func Gaussian(in image.Image, radius int, sigma float64, style Style) image.Image {
+// Gaussian performs a gaussian blur on the Image given. An error is returned if
+// radius is negative.
+func Gaussian(in image.Image, radius int, sigma float64, style Style) (image.Image, error) {
 	f := func(n int) float64 {
 		return math.Exp(-float64(n*n) / (2 * sigma * sigma))
 	}
 
-	tall := NewVerticalKernel(radius*2+1, f).Normalised()
-	wide := NewHorizontalKernel(radius*2+1, f).Normalised()
+	return separable(in, radius, f, style)
+}
+
+// separable convolves the image with the normalised kernels, of the given
+// radius, created from f in each direction.
+func separable(in image.Image, radius int, f func(n int) float64, style Style) (image.Image, error) {
+	tall, err := NewVerticalKernel(radius*2+1, f)
+	if err != nil {
+		return nil, err
+	}
+	wide, err := NewHorizontalKernel(radius*2+1, f)
+	if err != nil {
+		return nil, err
+	}
 
-	return Convolve2(in, tall, wide, style)
+	return Convolve2(in, tall.Normalised(), wide.Normalised(), style), nil
 }
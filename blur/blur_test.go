@@ -0,0 +1,473 @@
+package blur
+
+import (
+	"flag"
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/png"
+	"math"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"hawx.me/code/img/utils"
+)
+
+var update = flag.Bool("update", false, "write the golden images in testdata")
+
+// testImage returns an image with edges, gradients and varying transparency,
+// and bounds that do not start at the origin.
+func testImage() image.Image {
+	img := image.NewNRGBA(image.Rect(3, 5, 40, 28))
+	for y := 5; y < 28; y++ {
+		for x := 3; x < 40; x++ {
+			c := color.NRGBA{uint8(x * 7), uint8(y * 11), uint8((x * y) % 256), 255}
+			if x > 20 {
+				c.R = 255 - c.R
+			}
+			if y > 15 {
+				c.A = uint8(100 + x*4)
+			}
+			img.Set(x, y, c)
+		}
+	}
+	return img
+}
+
+// reference performs a convolution directly, taking each weight of the Kernel
+// in turn for every pixel, as a check for Convolve.
+func reference(in image.Image, weights Kernel, style Style) *image.RGBA {
+	b := in.Bounds()
+	mid := weights.Mid()
+	out := image.NewRGBA(b)
+
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		for x := b.Min.X; x < b.Max.X; x++ {
+			var sum [4]float64
+
+			for ky := range weights {
+				for kx, factor := range weights[ky] {
+					pt := image.Pt(x+kx-mid.X, y+ky-mid.Y)
+
+					if !pt.In(b) {
+						switch style {
+						case IGNORE:
+							continue
+						case CLAMP:
+							pt.X = int(math.Max(float64(b.Min.X), math.Min(float64(b.Max.X-1), float64(pt.X))))
+							pt.Y = int(math.Max(float64(b.Min.Y), math.Min(float64(b.Max.Y-1), float64(pt.Y))))
+						case WRAP:
+							pt.X = b.Min.X + ((pt.X-b.Min.X)%b.Dx()+b.Dx())%b.Dx()
+							pt.Y = b.Min.Y + ((pt.Y-b.Min.Y)%b.Dy()+b.Dy())%b.Dy()
+						}
+					}
+
+					r, g, bl, a := in.At(pt.X, pt.Y).RGBA()
+					for i, v := range []uint32{r, g, bl, a} {
+						sum[i] += float64(v) / 0xffff * factor
+					}
+				}
+			}
+
+			// Colour is clamped to alpha to keep the result premultiplied.
+			var c [4]uint8
+			a := math.Max(0, math.Min(1, sum[3]))
+			for i, v := range sum {
+				max := a
+				if i == 3 {
+					max = 1
+				}
+				c[i] = uint8(math.Max(0, math.Min(max, v))*0xff + 0.5)
+			}
+			out.SetRGBA(x, y, color.RGBA{c[0], c[1], c[2], c[3]})
+		}
+	}
+
+	return out
+}
+
+// square returns the normalised Kernel, of the given radius, populated by f.
+func square(radius int, f func(x, y int) float64) Kernel {
+	k, err := NewKernel(radius*2+1, radius*2+1, f)
+	if err != nil {
+		panic(err)
+	}
+	return k.Normalised()
+}
+
+// gaussian returns the Kernel that Gaussian applies as two passes.
+func gaussian(radius int, sigma float64) Kernel {
+	return square(radius, func(x, y int) float64 {
+		return math.Exp(-float64(x*x+y*y) / (2 * sigma * sigma))
+	})
+}
+
+var convolveCases = []struct {
+	name   string
+	kernel Kernel
+	run    func(image.Image, Style) image.Image
+}{
+	{
+		name:   "box",
+		kernel: square(2, func(x, y int) float64 { return 1 }),
+		run: func(in image.Image, style Style) image.Image {
+			out, _ := Box(in, 2, style)
+			return out
+		},
+	},
+	{
+		name:   "gaussian",
+		kernel: gaussian(4, 2),
+		run: func(in image.Image, style Style) image.Image {
+			out, _ := Gaussian(in, 4, 2, style)
+			return out
+		},
+	},
+	{
+		name:   "sharpen",
+		kernel: Kernel{{0, -1, 0}, {-1, 5, -1}, {0, -1, 0}},
+	},
+	{
+		name:   "sobel",
+		kernel: SobelX,
+	},
+	{
+		name:   "uneven",
+		kernel: Kernel{{0.1, 0, 0.2, 0, 0}, {0, 0.3, 0, 0, 0.1}, {0.2, 0, 0, 0.1, 0}},
+	},
+}
+
+var styles = []struct {
+	name  string
+	style Style
+}{
+	{"ignore", IGNORE},
+	{"clamp", CLAMP},
+	{"wrap", WRAP},
+}
+
+// The golden images hold the premultiplied values of an *image.RGBA, saved as
+// if they were not premultiplied, as PNG would otherwise lose precision in the
+// colour of mostly transparent pixels. They are also moved to the origin.
+
+func readGolden(t *testing.T, path string, bounds image.Rectangle) *image.RGBA {
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	img, err := png.Decode(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	switch img := img.(type) {
+	case *image.NRGBA:
+		return &image.RGBA{Pix: img.Pix, Stride: img.Stride, Rect: bounds}
+	case *image.RGBA:
+		return &image.RGBA{Pix: img.Pix, Stride: img.Stride, Rect: bounds}
+	}
+
+	t.Fatalf("unexpected golden image type %T", img)
+	return nil
+}
+
+func writeGolden(t *testing.T, path string, img *image.RGBA) {
+	f, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	raw := &image.NRGBA{Pix: img.Pix, Stride: img.Stride, Rect: img.Rect.Sub(img.Rect.Min)}
+	if err := png.Encode(f, raw); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// assertSame fails unless each channel of every pixel of got is within 1 of
+// want, allowing for floating point rounding to land either side of a half.
+func assertSame(t *testing.T, got, want image.Image) {
+	t.Helper()
+
+	if got.Bounds() != want.Bounds() {
+		t.Fatalf("expected bounds %v, got %v", want.Bounds(), got.Bounds())
+	}
+
+	b := got.Bounds()
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		for x := b.Min.X; x < b.Max.X; x++ {
+			gr, gg, gb, ga := got.At(x, y).RGBA()
+			wr, wg, wb, wa := want.At(x, y).RGBA()
+
+			for i, v := range [][2]uint32{{gr, wr}, {gg, wg}, {gb, wb}, {ga, wa}} {
+				if d := int(v[0]>>8) - int(v[1]>>8); d < -1 || d > 1 {
+					t.Fatalf("at (%d, %d) channel %d: expected %d, got %d", x, y, i, v[1]>>8, v[0]>>8)
+				}
+			}
+		}
+	}
+}
+
+// rgba returns an *image.RGBA with the pixels of img, to compare with an image
+// from reference.
+func rgba(img image.Image) *image.RGBA {
+	b := img.Bounds()
+	out := image.NewRGBA(b)
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		for x := b.Min.X; x < b.Max.X; x++ {
+			r, g, bl, a := img.At(x, y).RGBA()
+			out.SetRGBA(x, y, color.RGBA{uint8(r >> 8), uint8(g >> 8), uint8(bl >> 8), uint8(a >> 8)})
+		}
+	}
+	return out
+}
+
+func TestConvolveGolden(t *testing.T) {
+	in := testImage()
+
+	for _, c := range convolveCases {
+		for _, s := range styles {
+			t.Run(c.name+"-"+s.name, func(t *testing.T) {
+				path := filepath.Join("testdata", fmt.Sprintf("%s-%s.png", c.name, s.name))
+				if *update {
+					writeGolden(t, path, reference(in, c.kernel, s.style))
+				}
+
+				want := readGolden(t, path, in.Bounds())
+				assertSame(t, Convolve(in, c.kernel, s.style), want)
+				if c.run != nil {
+					assertSame(t, c.run(in, s.style), want)
+				}
+			})
+		}
+	}
+}
+
+func TestConvolveDeep(t *testing.T) {
+	in := image.NewRGBA64(testImage().Bounds())
+	b := in.Bounds()
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		for x := b.Min.X; x < b.Max.X; x++ {
+			in.Set(x, y, testImage().At(x, y))
+		}
+	}
+
+	for _, c := range convolveCases {
+		got := Convolve(in, c.kernel, CLAMP)
+		if _, ok := got.(*image.RGBA64); !ok {
+			t.Fatalf("%s: expected *image.RGBA64, got %T", c.name, got)
+		}
+
+		assertSame(t, rgba(got), reference(in, c.kernel, CLAMP))
+	}
+}
+
+func TestConvolveLinear(t *testing.T) {
+	in := utils.ToLinear(testImage())
+
+	for _, c := range convolveCases {
+		got, ok := Convolve(in, c.kernel, WRAP).(*utils.Linear)
+		if !ok {
+			t.Fatalf("%s: expected *utils.Linear", c.name)
+		}
+
+		want := reference(linearValues(in), c.kernel, WRAP)
+		assertSame(t, rgba(linearValues(got)), want)
+	}
+}
+
+// linearValues returns an image with the linear values of img, clamped as
+// Convolve would for other images, to compare them as if they were sRGB.
+func linearValues(img *utils.Linear) image.Image {
+	b := img.Bounds()
+	out := image.NewRGBA64(b)
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		for x := b.Min.X; x < b.Max.X; x++ {
+			c := img.LinearAt(x, y)
+			a := math.Max(0, math.Min(1, float64(c.A)))
+			v := func(f float32) uint16 {
+				return uint16(math.Max(0, math.Min(a, float64(f)))*0xffff + 0.5)
+			}
+			out.SetRGBA64(x, y, color.RGBA64{v(c.R), v(c.G), v(c.B), uint16(a*0xffff + 0.5)})
+		}
+	}
+	return out
+}
+
+func TestSeparate(t *testing.T) {
+	if _, _, ok := gaussian(3, 1.5).separate(); !ok {
+		t.Error("expected gaussian kernel to be separable")
+	}
+	if _, _, ok := (Kernel{{0, -1, 0}, {-1, 5, -1}, {0, -1, 0}}).separate(); ok {
+		t.Error("expected sharpen kernel not to be separable")
+	}
+}
+
+func TestScaled(t *testing.T) {
+	k := Kernel{{1, -2}, {0.5, 0}}
+	scaled := k.Scaled(-2)
+
+	want := Kernel{{-2, 4}, {-1, 0}}
+	for y := range want {
+		for x := range want[y] {
+			if scaled[y][x] != want[y][x] {
+				t.Errorf("at (%d, %d): expected %v, got %v", x, y, want[y][x], scaled[y][x])
+			}
+		}
+	}
+
+	if k[0][1] != -2 {
+		t.Error("expected original kernel to be unchanged")
+	}
+}
+
+func TestSobel(t *testing.T) {
+	// A ramp that rises by 0.05 to the right and 0.1 downwards. The weights of
+	// each kernel on either side add to 4 and are two pixels apart, so scaled
+	// by an eighth they should find the slope anywhere within it.
+	in := image.NewGray16(image.Rect(0, 0, 5, 5))
+	for y := 0; y < 5; y++ {
+		for x := 0; x < 5; x++ {
+			in.SetGray16(x, y, color.Gray16{uint16((0.05*float64(x) + 0.1*float64(y)) * 0xffff)})
+		}
+	}
+
+	testCases := []struct {
+		name   string
+		kernel Kernel
+		want   float64
+	}{
+		{"x", SobelX, 0.05},
+		{"y", SobelY, 0.1},
+		{"-x", SobelX.Scaled(-1), 0},
+		{"-y", SobelY.Scaled(-1), 0},
+	}
+
+	for _, tc := range testCases {
+		out := ConvolveColor(in, tc.kernel.Scaled(0.125), IGNORE)
+		for y := 1; y < 4; y++ {
+			for x := 1; x < 4; x++ {
+				r, _, _, _ := out.At(x, y).RGBA()
+				if got := float64(r) / 0xffff; math.Abs(got-tc.want) > 0.001 {
+					t.Errorf("%s at (%d, %d): expected %v, got %v", tc.name, x, y, tc.want, got)
+				}
+			}
+		}
+	}
+}
+
+func TestKernelSize(t *testing.T) {
+	f := func(int) float64 { return 1 }
+
+	for _, size := range []int{-1, 0, 2} {
+		if _, err := NewHorizontalKernel(size, f); err == nil {
+			t.Errorf("NewHorizontalKernel(%d): expected error", size)
+		}
+		if _, err := NewVerticalKernel(size, f); err == nil {
+			t.Errorf("NewVerticalKernel(%d): expected error", size)
+		}
+		if _, err := NewKernel(size, 3, func(x, y int) float64 { return 1 }); err == nil {
+			t.Errorf("NewKernel(%d, 3): expected error", size)
+		}
+	}
+
+	if _, err := Box(testImage(), -1, IGNORE); err == nil {
+		t.Error("Box: expected error for negative radius")
+	}
+	if _, err := Gaussian(testImage(), -1, 1, IGNORE); err == nil {
+		t.Error("Gaussian: expected error for negative radius")
+	}
+}
+
+func TestConvolveColor(t *testing.T) {
+	// A single colour with alpha changing from left to right has no edges in
+	// its colour, whatever the alpha.
+	in := image.NewNRGBA(image.Rect(2, 3, 12, 9))
+	b := in.Bounds()
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		for x := b.Min.X; x < b.Max.X; x++ {
+			in.SetNRGBA(x, y, color.NRGBA{200, 100, 50, uint8(x * 20)})
+		}
+	}
+
+	for _, k := range []Kernel{SobelX, SobelX.Scaled(-1), SobelY, SobelY.Scaled(-1)} {
+		out := ConvolveColor(in, k, CLAMP)
+		for y := b.Min.Y; y < b.Max.Y; y++ {
+			for x := b.Min.X; x < b.Max.X; x++ {
+				r, g, bl, a := out.At(x, y).RGBA()
+				if r != 0 || g != 0 || bl != 0 {
+					t.Fatalf("at (%d, %d): expected no colour, got %v %v %v", x, y, r, g, bl)
+				}
+				if _, _, _, want := in.At(x, y).RGBA(); a != want {
+					t.Fatalf("at (%d, %d): expected alpha %v, got %v", x, y, want, a)
+				}
+			}
+		}
+	}
+}
+
+func TestConvolveColorEdges(t *testing.T) {
+	// Half transparent, with white on the left and black on the right.
+	in := image.NewNRGBA(image.Rect(0, 0, 6, 3))
+	for y := 0; y < 3; y++ {
+		for x := 0; x < 6; x++ {
+			v := uint8(255)
+			if x >= 3 {
+				v = 0
+			}
+			in.SetNRGBA(x, y, color.NRGBA{v, v, v, 128})
+		}
+	}
+
+	falling := ConvolveColor(in, SobelX.Scaled(-0.25), CLAMP)
+	rising := ConvolveColor(in, SobelX.Scaled(0.25), CLAMP)
+
+	for x := 0; x < 6; x++ {
+		want := color.NRGBA{0, 0, 0, 128}
+		if x == 2 || x == 3 {
+			want = color.NRGBA{255, 255, 255, 128}
+		}
+
+		if c := color.NRGBAModel.Convert(falling.At(x, 1)); c != want {
+			t.Errorf("at %d: expected %v, got %v", x, want, c)
+		}
+		if c := color.NRGBAModel.Convert(rising.At(x, 1)); c != (color.NRGBA{0, 0, 0, 128}) {
+			t.Errorf("at %d: expected no rising edge, got %v", x, c)
+		}
+	}
+}
+
+func TestConvolveColorIdentity(t *testing.T) {
+	in := testImage()
+	assertSame(t, ConvolveColor(in, Kernel{{0, 0, 0}, {0, 1, 0}, {0, 0, 0}}, IGNORE), in)
+}
+
+func TestConvolvePremultiplied(t *testing.T) {
+	// Sharpening a semi-transparent image pushes colour above alpha before it
+	// is clamped.
+	in := testImage()
+	deep := image.NewRGBA64(in.Bounds())
+	draw.Draw(deep, deep.Bounds(), in, deep.Bounds().Min, draw.Src)
+
+	for _, img := range []image.Image{in, deep} {
+		for _, c := range convolveCases {
+			out := Convolve(img, c.kernel, IGNORE)
+			b := out.Bounds()
+			for y := b.Min.Y; y < b.Max.Y; y++ {
+				for x := b.Min.X; x < b.Max.X; x++ {
+					r, g, bl, a := out.At(x, y).RGBA()
+					if r > a || g > a || bl > a {
+						t.Fatalf("%s at (%d, %d): expected colour no more than alpha, got %v %v %v %v", c.name, x, y, r, g, bl, a)
+					}
+				}
+			}
+
+			// Which can then be converted to linear light.
+			utils.ToLinear(out)
+		}
+	}
+}
@@ -0,0 +1,422 @@
+package blur
+
+import (
+	"encoding/binary"
+	"image"
+	"math"
+
+	"hawx.me/code/img/utils"
+)
+
+// Convolve applies the Kernel to each pixel of the Image, using style to decide
+// what is beyond the edges. If in is a *utils.Linear image the convolution is
+// done in linear light, and a *utils.Linear image is returned. Otherwise the
+// result has 16 bits per channel if in does.
+//
+// A separable Kernel, one that is the product of a column and a row, is applied
+// in two passes of each, which is much quicker for large Kernels.
+func Convolve(in image.Image, weights Kernel, style Style) image.Image {
+	src := read(in)
+
+	if col, row, ok := weights.separate(); ok {
+		return src.convolve(row, style).convolve(col, style).image(in)
+	}
+
+	return src.convolve(weights, style).image(in)
+}
+
+// ConvolveColor is like Convolve, but only the colour of each pixel is
+// convolved and the result keeps the alpha of in. The colour is taken before it
+// is premultiplied by alpha, so that Kernels with weights that sum to 0, such as
+// SobelX, find the edges in the colour of an image rather than in its alpha.
+func ConvolveColor(in image.Image, weights Kernel, style Style) image.Image {
+	src := read(in)
+	colour := src.unpremultiplied()
+
+	if col, row, ok := weights.separate(); ok {
+		colour = colour.convolve(row, style).convolve(col, style)
+	} else {
+		colour = colour.convolve(weights, style)
+	}
+
+	_, linear := in.(*utils.Linear)
+	return colour.premultiplied(src, !linear).image(in)
+}
+
+// Convolve2 performs a convolution with two Kernels in succession. The result
+// is only rounded once, after both.
+func Convolve2(in image.Image, a, b Kernel, style Style) image.Image {
+	return read(in).convolve(a, style).convolve(b, style).image(in)
+}
+
+// separate returns the column and row that the Kernel is the product of, if it
+// has more than one of each and is separable.
+func (k Kernel) separate() (col, row Kernel, ok bool) {
+	if k.Width() < 2 || k.Height() < 2 {
+		return nil, nil, false
+	}
+
+	// The largest weight is used to find the column and row, so that dividing
+	// by it is accurate.
+	var py, px int
+	for y := range k {
+		for x := range k[y] {
+			if math.Abs(k[y][x]) > math.Abs(k[py][px]) {
+				py, px = y, x
+			}
+		}
+	}
+
+	largest := math.Abs(k[py][px])
+	if largest == 0 {
+		return nil, nil, false
+	}
+
+	col = make(Kernel, k.Height())
+	for y := range k {
+		col[y] = []float64{k[y][px]}
+	}
+
+	row = Kernel{make([]float64, k.Width())}
+	for x := range k[py] {
+		row[0][x] = k[py][x] / k[py][px]
+	}
+
+	for y := range k {
+		for x := range k[y] {
+			if math.Abs(k[y][x]-col[y][0]*row[0][x]) > 1e-12*largest {
+				return nil, nil, false
+			}
+		}
+	}
+
+	return col, row, true
+}
+
+// A plane holds the premultiplied red, green, blue and alpha values of each
+// pixel of an image, from 0 to 1, row by row.
+type plane struct {
+	rect image.Rectangle
+	pix  []float32
+}
+
+// read returns the pixels of the image as a plane.
+func read(in image.Image) *plane {
+	b := in.Bounds()
+	p := &plane{b, make([]float32, 4*b.Dx()*b.Dy())}
+
+	utils.Parallel(b.Dy(), func(y int) {
+		row := p.pix[4*y*b.Dx() : 4*(y+1)*b.Dx()]
+
+		switch in := in.(type) {
+		case *utils.Linear:
+			copy(row, in.Pix[in.PixOffset(b.Min.X, b.Min.Y+y):])
+
+		case *image.RGBA:
+			src := in.Pix[in.PixOffset(b.Min.X, b.Min.Y+y):]
+			for i := range row {
+				row[i] = float32(src[i]) / 0xff
+			}
+
+		case *image.RGBA64:
+			src := in.Pix[in.PixOffset(b.Min.X, b.Min.Y+y):]
+			for i := range row {
+				row[i] = float32(binary.BigEndian.Uint16(src[2*i:])) / 0xffff
+			}
+
+		default:
+			for x := 0; x < b.Dx(); x++ {
+				r, g, bl, a := in.At(b.Min.X+x, b.Min.Y+y).RGBA()
+				row[4*x+0] = float32(r) / 0xffff
+				row[4*x+1] = float32(g) / 0xffff
+				row[4*x+2] = float32(bl) / 0xffff
+				row[4*x+3] = float32(a) / 0xffff
+			}
+		}
+	})
+
+	return p
+}
+
+// unpremultiplied returns a copy of the plane with the colour of each pixel
+// divided by its alpha. Transparent pixels are black.
+func (p *plane) unpremultiplied() *plane {
+	out := &plane{p.rect, make([]float32, len(p.pix))}
+
+	utils.Parallel(p.rect.Dy(), func(y int) {
+		w := p.rect.Dx()
+		src := p.pix[4*y*w : 4*(y+1)*w]
+		dst := out.pix[4*y*w : 4*(y+1)*w]
+
+		for i := 0; i < len(src); i += 4 {
+			if a := src[i+3]; a > 0 {
+				dst[i+0] = src[i+0] / a
+				dst[i+1] = src[i+1] / a
+				dst[i+2] = src[i+2] / a
+				dst[i+3] = a
+			}
+		}
+	})
+
+	return out
+}
+
+// premultiplied returns a copy of the plane with the alpha of each pixel taken
+// from alpha, and its colour multiplied by it. If clamp is true the colour is
+// first limited to the range 0 to 1, so that it is no more than the alpha.
+func (p *plane) premultiplied(alpha *plane, clamp bool) *plane {
+	out := &plane{p.rect, make([]float32, len(p.pix))}
+
+	utils.Parallel(p.rect.Dy(), func(y int) {
+		w := p.rect.Dx()
+		src := p.pix[4*y*w : 4*(y+1)*w]
+		dst := out.pix[4*y*w : 4*(y+1)*w]
+
+		for i := 0; i < len(src); i += 4 {
+			a := alpha.pix[4*y*w+i+3]
+			for c := 0; c < 3; c++ {
+				v := src[i+c]
+				if clamp {
+					v = float32(math.Max(0, math.Min(1, float64(v))))
+				}
+				dst[i+c] = v * a
+			}
+			dst[i+3] = a
+		}
+	})
+
+	return out
+}
+
+// image returns the plane as an image. This is a *utils.Linear image if like
+// is, otherwise an *image.RGBA64 if like is utils.Deep, or an *image.RGBA. The
+// alpha is clamped to the range the image can hold, and each colour channel to
+// no more than the alpha, so that the result is validly premultiplied.
+func (p *plane) image(like image.Image) image.Image {
+	b := p.rect
+
+	if _, ok := like.(*utils.Linear); ok {
+		return &utils.Linear{Pix: p.pix, Stride: 4 * b.Dx(), Rect: b}
+	}
+
+	clamp := func(v, max float32) float32 {
+		if v < 0 {
+			return 0
+		}
+		if v > max {
+			return max
+		}
+		return v
+	}
+
+	// pixel returns the clamped channels of the pixel starting at row[i].
+	pixel := func(row []float32, i int) (r, g, b, a float32) {
+		a = clamp(row[i+3], 1)
+		return clamp(row[i], a), clamp(row[i+1], a), clamp(row[i+2], a), a
+	}
+
+	if utils.Deep(like) {
+		o := image.NewRGBA64(b)
+		utils.Parallel(b.Dy(), func(y int) {
+			row := p.pix[4*y*b.Dx() : 4*(y+1)*b.Dx()]
+			dst := o.Pix[o.PixOffset(b.Min.X, b.Min.Y+y):]
+			for i := 0; i < len(row); i += 4 {
+				r, g, bl, a := pixel(row, i)
+				binary.BigEndian.PutUint16(dst[2*i:], uint16(r*0xffff+0.5))
+				binary.BigEndian.PutUint16(dst[2*i+2:], uint16(g*0xffff+0.5))
+				binary.BigEndian.PutUint16(dst[2*i+4:], uint16(bl*0xffff+0.5))
+				binary.BigEndian.PutUint16(dst[2*i+6:], uint16(a*0xffff+0.5))
+			}
+		})
+		return o
+	}
+
+	o := image.NewRGBA(b)
+	utils.Parallel(b.Dy(), func(y int) {
+		row := p.pix[4*y*b.Dx() : 4*(y+1)*b.Dx()]
+		dst := o.Pix[o.PixOffset(b.Min.X, b.Min.Y+y):]
+		for i := 0; i < len(row); i += 4 {
+			r, g, bl, a := pixel(row, i)
+			dst[i+0] = uint8(r*0xff + 0.5)
+			dst[i+1] = uint8(g*0xff + 0.5)
+			dst[i+2] = uint8(bl*0xff + 0.5)
+			dst[i+3] = uint8(a*0xff + 0.5)
+		}
+	})
+	return o
+}
+
+// convolve returns a new plane with the Kernel applied to each pixel.
+func (p *plane) convolve(weights Kernel, style Style) *plane {
+	switch {
+	case weights.Height() == 1:
+		return p.convolveRow(weights[0], weights.Mid().X, style)
+
+	case weights.Width() == 1:
+		col := make([]float64, weights.Height())
+		for y := range weights {
+			col[y] = weights[y][0]
+		}
+		return p.convolveColumn(col, weights.Mid().Y, style)
+	}
+
+	w, h := p.rect.Dx(), p.rect.Dy()
+	kw, kh := weights.Width(), weights.Height()
+	mid := weights.Mid()
+	out := &plane{p.rect, make([]float32, len(p.pix))}
+
+	// The column, or row, of the pixel under each weight is worked out once for
+	// every column, or row, of the image. Those outside of the image that are
+	// ignored are -1.
+	xs := taps(w, kw, mid.X, style)
+	ys := taps(h, kh, mid.Y, style)
+
+	utils.Parallel(h, func(y int) {
+		dst := out.pix[4*y*w : 4*(y+1)*w]
+
+		for x := 0; x < w; x++ {
+			var r, g, b, a float64
+
+			for ky := 0; ky < kh; ky++ {
+				sy := ys[y*kh+ky]
+				if sy < 0 {
+					continue
+				}
+				src := p.pix[4*sy*w : 4*(sy+1)*w]
+
+				for kx, factor := range weights[ky] {
+					sx := xs[x*kw+kx]
+					if sx < 0 || factor == 0 {
+						continue
+					}
+
+					c := src[4*sx : 4*sx+4]
+					r += float64(c[0]) * factor
+					g += float64(c[1]) * factor
+					b += float64(c[2]) * factor
+					a += float64(c[3]) * factor
+				}
+			}
+
+			dst[4*x+0] = float32(r)
+			dst[4*x+1] = float32(g)
+			dst[4*x+2] = float32(b)
+			dst[4*x+3] = float32(a)
+		}
+	})
+
+	return out
+}
+
+// convolveRow returns a new plane with the weights applied across each row.
+func (p *plane) convolveRow(weights []float64, mid int, style Style) *plane {
+	w, h := p.rect.Dx(), p.rect.Dy()
+	out := &plane{p.rect, make([]float32, len(p.pix))}
+	xs := taps(w, len(weights), mid, style)
+
+	utils.Parallel(h, func(y int) {
+		src := p.pix[4*y*w : 4*(y+1)*w]
+		dst := out.pix[4*y*w : 4*(y+1)*w]
+
+		for x := 0; x < w; x++ {
+			var r, g, b, a float64
+
+			// Away from the edges the pixels under the weights are next to each
+			// other, so they don't need looking up.
+			if start := x - mid; start >= 0 && start+len(weights) <= w {
+				s := src[4*start : 4*(start+len(weights))]
+				for i, factor := range weights {
+					c := s[4*i : 4*i+4]
+					r += float64(c[0]) * factor
+					g += float64(c[1]) * factor
+					b += float64(c[2]) * factor
+					a += float64(c[3]) * factor
+				}
+			} else {
+				for i, factor := range weights {
+					sx := xs[x*len(weights)+i]
+					if sx < 0 {
+						continue
+					}
+
+					c := src[4*sx : 4*sx+4]
+					r += float64(c[0]) * factor
+					g += float64(c[1]) * factor
+					b += float64(c[2]) * factor
+					a += float64(c[3]) * factor
+				}
+			}
+
+			dst[4*x+0] = float32(r)
+			dst[4*x+1] = float32(g)
+			dst[4*x+2] = float32(b)
+			dst[4*x+3] = float32(a)
+		}
+	})
+
+	return out
+}
+
+// convolveColumn returns a new plane with the weights applied down each column.
+// Each row of the result is found by adding whole rows of p, which keeps to
+// memory that is next to each other.
+func (p *plane) convolveColumn(weights []float64, mid int, style Style) *plane {
+	w, h := p.rect.Dx(), p.rect.Dy()
+	out := &plane{p.rect, make([]float32, len(p.pix))}
+	ys := taps(h, len(weights), mid, style)
+
+	utils.Parallel(h, func(y int) {
+		sum := make([]float64, 4*w)
+
+		for i, factor := range weights {
+			sy := ys[y*len(weights)+i]
+			if sy < 0 || factor == 0 {
+				continue
+			}
+
+			for j, v := range p.pix[4*sy*w : 4*(sy+1)*w] {
+				sum[j] += float64(v) * factor
+			}
+		}
+
+		dst := out.pix[4*y*w : 4*(y+1)*w]
+		for j, v := range sum {
+			dst[j] = float32(v)
+		}
+	})
+
+	return out
+}
+
+// taps returns, for each of n positions and each of the size weights of a
+// Kernel centred on mid, the position of the pixel it applies to.
+func taps(n, size, mid int, style Style) []int {
+	t := make([]int, n*size)
+
+	for i := 0; i < n; i++ {
+		for k := 0; k < size; k++ {
+			j := i + k - mid
+
+			if j < 0 || j >= n {
+				switch style {
+				case CLAMP:
+					if j < 0 {
+						j = 0
+					} else {
+						j = n - 1
+					}
+
+				case WRAP:
+					j = (j%n + n) % n
+
+				default:
+					j = -1
+				}
+			}
+
+			t[i*size+k] = j
+		}
+	}
+
+	return t
+}
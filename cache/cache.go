@@ -0,0 +1,214 @@
+// Package cache stores the results of commands on disk, so that running the
+// same command on the same image again can return the stored result instead of
+// doing the work. When the cache grows larger than its maximum size the least
+// recently used results are removed.
+package cache
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// A Cache is a directory of results, each named by its key.
+type Cache struct {
+	Dir string
+
+	// MaxSize is the most bytes that the results in the cache can take up.
+	MaxSize int64
+
+	// size is the number of bytes the results take up, found by Prune and then
+	// added to by Put, so that the directory isn't read for every result. As
+	// other processes may also add results it is only an estimate, but it is
+	// corrected whenever the cache is pruned.
+	mu    sync.Mutex
+	size  int64
+	sized bool
+}
+
+// New returns a Cache using the directory and maximum size given.
+func New(dir string, maxSize int64) *Cache {
+	return &Cache{Dir: dir, MaxSize: maxSize}
+}
+
+// Key returns the key for the result of a command, named by name and given
+// args, on the input read from r.
+func Key(r io.Reader, name string, args []string) (string, error) {
+	input := sha256.New()
+	if _, err := io.Copy(input, r); err != nil {
+		return "", err
+	}
+
+	h := sha256.New()
+	h.Write(input.Sum(nil))
+	h.Write([]byte(name))
+
+	for _, arg := range args {
+		// The length prefix stops different arguments giving the same bytes.
+		h.Write([]byte("\x00" + strconv.Itoa(len(arg)) + ":" + arg))
+	}
+
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+func (c *Cache) path(key string) string {
+	return filepath.Join(c.Dir, key[:2], key)
+}
+
+// Get returns the result stored for key, if there is one.
+func (c *Cache) Get(key string) ([]byte, bool) {
+	path := c.path(key)
+
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, false
+	}
+
+	// The modification time records when the result was last used.
+	now := time.Now()
+	os.Chtimes(path, now, now)
+
+	return data, true
+}
+
+// Put stores the result for key, then removes the least recently used results
+// if the cache is larger than MaxSize.
+func (c *Cache) Put(key string, data []byte) error {
+	path := c.path(key)
+
+	var replaced int64
+	if info, err := os.Stat(path); err == nil {
+		replaced = info.Size()
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+
+	// Write to a temporary file first, so that another process never reads a
+	// partially written result.
+	tmp, err := ioutil.TempFile(filepath.Dir(path), key+".tmp")
+	if err != nil {
+		return err
+	}
+	_, err = tmp.Write(data)
+	if cerr := tmp.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = os.Rename(tmp.Name(), path)
+	}
+	if err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+
+	c.mu.Lock()
+	c.size += int64(len(data)) - replaced
+	full := !c.sized || c.size > c.MaxSize
+	c.mu.Unlock()
+
+	if !full {
+		return nil
+	}
+
+	_, _, err = c.Prune(c.MaxSize)
+	return err
+}
+
+// Prune removes the least recently used results until the cache takes up at
+// most size bytes. It returns the number of results removed, and the number
+// of bytes they took up.
+func (c *Cache) Prune(size int64) (removed int, freed int64, err error) {
+	var files []os.FileInfo
+	var paths []string
+	var total int64
+
+	err = filepath.Walk(c.Dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			if os.IsNotExist(err) {
+				return nil
+			}
+			return err
+		}
+		if info.Mode().IsRegular() && !strings.Contains(info.Name(), ".tmp") {
+			files = append(files, info)
+			paths = append(paths, path)
+			total += info.Size()
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, 0, err
+	}
+
+	defer func() {
+		c.mu.Lock()
+		c.size, c.sized = total, true
+		c.mu.Unlock()
+	}()
+
+	if total <= size {
+		return 0, 0, nil
+	}
+
+	order := make([]int, len(files))
+	for i := range order {
+		order[i] = i
+	}
+	sort.Slice(order, func(i, j int) bool {
+		return files[order[i]].ModTime().Before(files[order[j]].ModTime())
+	})
+
+	for _, i := range order {
+		if total <= size {
+			break
+		}
+
+		// Another process may have already removed it.
+		if err := os.Remove(paths[i]); err != nil && !os.IsNotExist(err) {
+			return removed, freed, err
+		}
+		removed++
+		freed += files[i].Size()
+		total -= files[i].Size()
+	}
+
+	return removed, freed, nil
+}
+
+// ParseSize reads a size in bytes, which may have a suffix of K, M or G for
+// kibibytes, mebibytes or gibibytes.
+func ParseSize(size string) (int64, error) {
+	s := strings.ToUpper(strings.TrimSpace(size))
+	s = strings.TrimSuffix(s, "B")
+
+	multiplier := int64(1)
+	switch {
+	case strings.HasSuffix(s, "K"):
+		multiplier = 1 << 10
+	case strings.HasSuffix(s, "M"):
+		multiplier = 1 << 20
+	case strings.HasSuffix(s, "G"):
+		multiplier = 1 << 30
+	}
+	if multiplier != 1 {
+		s = s[:len(s)-1]
+	}
+
+	n, err := strconv.ParseInt(s, 10, 64)
+	if err != nil || n < 0 {
+		return 0, errors.New("cache: invalid size " + strconv.Quote(size))
+	}
+
+	return n * multiplier, nil
+}
@@ -0,0 +1,216 @@
+package cache
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func key(t *testing.T, input, name string, args ...string) string {
+	k, err := Key(strings.NewReader(input), name, args)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return k
+}
+
+func TestKey(t *testing.T) {
+	k := key(t, "image", "blur", "--radius=2", "x")
+	if len(k) != 64 {
+		t.Errorf("expected hex sha256, got %q", k)
+	}
+
+	if again := key(t, "image", "blur", "--radius=2", "x"); again != k {
+		t.Errorf("expected key to be stable, got %q then %q", k, again)
+	}
+
+	for name, other := range map[string]string{
+		"input":      key(t, "other", "blur", "--radius=2", "x"),
+		"name":       key(t, "image", "sharpen", "--radius=2", "x"),
+		"args":       key(t, "image", "blur", "--radius=3", "x"),
+		"boundaries": key(t, "image", "blur", "--radius=2x"),
+		"no args":    key(t, "image", "blur"),
+	} {
+		if other == k {
+			t.Errorf("expected different %s to give a different key", name)
+		}
+	}
+}
+
+func TestGetPut(t *testing.T) {
+	c := New(t.TempDir(), 1<<20)
+	k := key(t, "image", "blur")
+
+	if _, ok := c.Get(k); ok {
+		t.Fatal("expected no result in empty cache")
+	}
+
+	if err := c.Put(k, []byte("result")); err != nil {
+		t.Fatal(err)
+	}
+	if data, ok := c.Get(k); !ok || string(data) != "result" {
+		t.Errorf("expected stored result, got %q %v", data, ok)
+	}
+
+	if err := c.Put(k, []byte("replaced")); err != nil {
+		t.Fatal(err)
+	}
+	if data, ok := c.Get(k); !ok || string(data) != "replaced" {
+		t.Errorf("expected replaced result, got %q %v", data, ok)
+	}
+
+	if _, ok := c.Get(key(t, "image", "sharpen")); ok {
+		t.Error("expected no result for a different key")
+	}
+}
+
+// putAt stores data for key, then marks it as last used at the time given.
+func putAt(t *testing.T, c *Cache, key string, data []byte, at time.Time) {
+	if err := c.Put(key, data); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chtimes(c.path(key), at, at); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestPrune(t *testing.T) {
+	c := New(t.TempDir(), 1<<20)
+	start := time.Now().Add(-time.Hour)
+
+	keys := []string{key(t, "a", "op"), key(t, "b", "op"), key(t, "c", "op"), key(t, "d", "op")}
+	for i, k := range keys {
+		putAt(t, c, k, bytes.Repeat([]byte{'x'}, 10), start.Add(time.Duration(i)*time.Minute))
+	}
+
+	// Using the oldest makes it the most recently used.
+	if _, ok := c.Get(keys[0]); !ok {
+		t.Fatal("expected result")
+	}
+
+	removed, freed, err := c.Prune(25)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if removed != 2 || freed != 20 {
+		t.Errorf("expected 2 results of 20 bytes removed, got %d of %d", removed, freed)
+	}
+
+	for i, want := range []bool{true, false, false, true} {
+		if _, ok := c.Get(keys[i]); ok != want {
+			t.Errorf("result %d: expected kept to be %v", i, want)
+		}
+	}
+
+	if removed, freed, err := c.Prune(25); removed != 0 || freed != 0 || err != nil {
+		t.Errorf("expected nothing to be removed, got %d, %d, %v", removed, freed, err)
+	}
+}
+
+func TestPruneMissingDir(t *testing.T) {
+	c := New(filepath.Join(t.TempDir(), "missing"), 0)
+
+	if removed, freed, err := c.Prune(0); removed != 0 || freed != 0 || err != nil {
+		t.Errorf("expected nothing to be removed, got %d, %d, %v", removed, freed, err)
+	}
+}
+
+func TestPutPrunes(t *testing.T) {
+	c := New(t.TempDir(), 25)
+	start := time.Now().Add(-time.Hour)
+
+	a, b, d := key(t, "a", "op"), key(t, "b", "op"), key(t, "d", "op")
+	putAt(t, c, a, bytes.Repeat([]byte{'x'}, 10), start)
+	putAt(t, c, b, bytes.Repeat([]byte{'x'}, 10), start.Add(time.Minute))
+
+	if _, ok := c.Get(a); !ok {
+		t.Fatal("expected result to be kept while under MaxSize")
+	}
+	os.Chtimes(c.path(a), start, start)
+
+	putAt(t, c, d, bytes.Repeat([]byte{'x'}, 10), time.Now())
+
+	if _, ok := c.Get(a); ok {
+		t.Error("expected least recently used result to be removed")
+	}
+	for _, k := range []string{b, d} {
+		if _, ok := c.Get(k); !ok {
+			t.Errorf("expected %s to be kept", k)
+		}
+	}
+}
+
+func TestPutTracksSize(t *testing.T) {
+	c := New(t.TempDir(), 25)
+
+	// The first result finds the size of the cache.
+	first := key(t, "a", "op")
+	if err := c.Put(first, bytes.Repeat([]byte{'x'}, 10)); err != nil {
+		t.Fatal(err)
+	}
+
+	// Results added by another process are not seen until the cache is next
+	// pruned, as the directory is not read again while under MaxSize.
+	other := New(c.Dir, 1<<20)
+	if err := other.Put(key(t, "b", "op"), bytes.Repeat([]byte{'x'}, 20)); err != nil {
+		t.Fatal(err)
+	}
+
+	second := key(t, "c", "op")
+	if err := c.Put(second, bytes.Repeat([]byte{'x'}, 5)); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := c.Get(key(t, "b", "op")); !ok {
+		t.Fatal("expected other result to be kept while estimate is under MaxSize")
+	}
+
+	// Replacing a result only counts the difference.
+	if err := c.Put(second, bytes.Repeat([]byte{'x'}, 10)); err != nil {
+		t.Fatal(err)
+	}
+	if c.size != 20 {
+		t.Errorf("expected size 20, got %d", c.size)
+	}
+
+	// Going over MaxSize prunes, correcting the size.
+	if err := c.Put(key(t, "d", "op"), bytes.Repeat([]byte{'x'}, 10)); err != nil {
+		t.Fatal(err)
+	}
+	if c.size > 25 {
+		t.Errorf("expected size to be at most 25 after pruning, got %d", c.size)
+	}
+}
+
+func TestParseSize(t *testing.T) {
+	testCases := []struct {
+		in   string
+		size int64
+	}{
+		{"0", 0},
+		{"512", 512},
+		{"10K", 10 << 10},
+		{"10k", 10 << 10},
+		{"10M", 10 << 20},
+		{"10MB", 10 << 20},
+		{"1G", 1 << 30},
+		{" 2g ", 2 << 30},
+	}
+
+	for _, tc := range testCases {
+		size, err := ParseSize(tc.in)
+		if err != nil {
+			t.Errorf("%q: unexpected error %v", tc.in, err)
+		} else if size != tc.size {
+			t.Errorf("%q: expected %d, got %d", tc.in, tc.size, size)
+		}
+	}
+
+	for _, in := range []string{"", "M", "ten", "1.5G", "-1K", "10T", "1GG"} {
+		if _, err := ParseSize(in); err == nil {
+			t.Errorf("%q: expected error", in)
+		}
+	}
+}
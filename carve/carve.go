@@ -0,0 +1,307 @@
+// Package carve provides content-aware resizing by seam carving. A seam is a
+// connected path of pixels from one edge of an image to the other; by removing,
+// or duplicating, the seams that pass through the least noticeable parts the
+// aspect ratio can be changed without stretching or squashing the subject.
+package carve
+
+import (
+	"image"
+	"image/color"
+	"image/draw"
+	"math"
+
+	"hawx.me/code/img/blur"
+	"hawx.me/code/img/resize"
+	"hawx.me/code/img/utils"
+)
+
+// maskWeight is added to, or taken from, the energy of a pixel fully protected,
+// or marked for removal, by a mask. It is large enough that a seam will go far
+// out of its way to avoid, or to pass through, such pixels.
+const maskWeight = 1e5
+
+// Resize returns the image changed to width by height pixels by removing, or
+// inserting, the seams with the least energy. The width is changed first, then
+// the height. If either width or height is 0 that size is kept.
+//
+// The mask, if not nil, marks the parts of the image to protect in green and
+// the parts to remove first in red, other colours have no effect. It is scaled
+// to the size of the image if needed.
+func Resize(img image.Image, width, height int, mask image.Image) image.Image {
+	b := img.Bounds()
+	if b.Empty() {
+		return img
+	}
+	if width <= 0 {
+		width = b.Dx()
+	}
+	if height <= 0 {
+		height = b.Dy()
+	}
+
+	g := newGrid(img, mask)
+	g = g.carve(width)
+	g = g.transpose().carve(height).transpose()
+
+	return g.image(img)
+}
+
+// A grid holds the pixels of an image as it is carved, along with the weight
+// from the mask for each.
+type grid struct {
+	w, h int
+
+	// pix holds the premultiplied red, green, blue and alpha values of each
+	// pixel, from 0 to 1, row by row.
+	pix []float64
+
+	// bias holds the weight of each pixel from the mask, from -1 for removal to
+	// 1 for protection.
+	bias []float64
+}
+
+func newGrid(img image.Image, mask image.Image) grid {
+	b := img.Bounds()
+	g := grid{b.Dx(), b.Dy(), make([]float64, 4*b.Dx()*b.Dy()), make([]float64, b.Dx()*b.Dy())}
+
+	for y := 0; y < g.h; y++ {
+		for x := 0; x < g.w; x++ {
+			r, gr, bl, a := img.At(b.Min.X+x, b.Min.Y+y).RGBA()
+			p := g.pix[4*(y*g.w+x):]
+			p[0], p[1], p[2], p[3] = float64(r)/0xffff, float64(gr)/0xffff, float64(bl)/0xffff, float64(a)/0xffff
+		}
+	}
+
+	if mask != nil {
+		if mask.Bounds().Size() != b.Size() {
+			mask = resize.Resize(mask, b.Dx(), b.Dy(), resize.Bilinear)
+		}
+
+		mb := mask.Bounds()
+		for y := 0; y < g.h; y++ {
+			for x := 0; x < g.w; x++ {
+				r, gr, _, a := utils.RatioRGBA(mask.At(mb.Min.X+x, mb.Min.Y+y))
+				g.bias[y*g.w+x] = (gr - r) * a
+			}
+		}
+	}
+
+	return g
+}
+
+// image returns the grid as an image of the same kind as like.
+func (g grid) image(like image.Image) image.Image {
+	return g.draw(utils.NewImageFor(like, image.Rect(0, 0, g.w, g.h)))
+}
+
+// draw sets the pixels of out, which must be the same size as the grid.
+func (g grid) draw(out draw.Image) draw.Image {
+	for y := 0; y < g.h; y++ {
+		for x := 0; x < g.w; x++ {
+			p := g.pix[4*(y*g.w+x):]
+			out.Set(x, y, color.RGBA64{
+				uint16(p[0]*0xffff + 0.5),
+				uint16(p[1]*0xffff + 0.5),
+				uint16(p[2]*0xffff + 0.5),
+				uint16(p[3]*0xffff + 0.5),
+			})
+		}
+	}
+
+	return out
+}
+
+// transpose returns the grid with its rows and columns swapped, so that
+// carving it changes the height of the image.
+func (g grid) transpose() grid {
+	t := grid{g.h, g.w, make([]float64, len(g.pix)), make([]float64, len(g.bias))}
+
+	for y := 0; y < g.h; y++ {
+		for x := 0; x < g.w; x++ {
+			copy(t.pix[4*(x*t.w+y):4*(x*t.w+y)+4], g.pix[4*(y*g.w+x):])
+			t.bias[x*t.w+y] = g.bias[y*g.w+x]
+		}
+	}
+
+	return t
+}
+
+// energy returns how noticeable the removal of each pixel would be, row by row.
+// This is the size of the gradient found with Sobel kernels, adjusted by the
+// mask.
+func (g grid) energy() []float64 {
+	img := g.draw(image.NewRGBA64(image.Rect(0, 0, g.w, g.h)))
+
+	// The result of blur.ConvolveColor can't be negative, so each kernel is
+	// applied as is and inverted to find both directions of change. Only the
+	// colour is convolved, as the weights of each kernel sum to 0 and would
+	// leave no alpha.
+	var convolved []image.Image
+	for _, k := range []blur.Kernel{blur.SobelX, blur.SobelY} {
+		convolved = append(convolved,
+			blur.ConvolveColor(img, k, blur.CLAMP),
+			blur.ConvolveColor(img, k.Scaled(-1), blur.CLAMP))
+	}
+
+	e := make([]float64, g.w*g.h)
+	for y := 0; y < g.h; y++ {
+		for x := 0; x < g.w; x++ {
+			total := 0.0
+			for _, c := range convolved {
+				r, gr, b, _ := c.At(x, y).RGBA()
+				total += float64(r+gr+b) / 0xffff
+			}
+
+			e[y*g.w+x] = total + g.bias[y*g.w+x]*maskWeight
+		}
+	}
+
+	return e
+}
+
+// carve returns the grid with seams removed or inserted so that it is width
+// pixels wide.
+func (g grid) carve(width int) grid {
+	for g.w > width {
+		g, _ = g.remove(g.w-width, g.energy())
+	}
+
+	for g.w < width {
+		// Inserting more than half of the width again would duplicate the same
+		// seams, so larger changes are made in steps.
+		n := width - g.w
+		if half := (g.w + 1) / 2; n > half {
+			n = half
+		}
+
+		g = g.insert(n)
+	}
+
+	return g
+}
+
+// remove returns the grid with n of its lowest energy seams removed, where e is
+// the energy of each pixel. It also returns, for each row, which of the
+// original columns were removed.
+//
+// The energy is not recalculated as each seam is removed, the values for the
+// pixels that remain are kept instead, which is much quicker and gives similar
+// results.
+func (g grid) remove(n int, e []float64) (grid, [][]bool) {
+	if n >= g.w {
+		n = g.w - 1
+	}
+
+	// columns tracks which original column each remaining pixel came from.
+	columns := make([]int, g.w*g.h)
+	for i := range columns {
+		columns[i] = i % g.w
+	}
+
+	removed := make([][]bool, g.h)
+	for y := range removed {
+		removed[y] = make([]bool, g.w)
+	}
+
+	w := g.w
+	pix := append([]float64(nil), g.pix...)
+	bias := append([]float64(nil), g.bias...)
+	e = append([]float64(nil), e...)
+
+	for i := 0; i < n; i++ {
+		seam := findSeam(e, w, g.h)
+
+		for y, sx := range seam {
+			removed[y][columns[y*g.w+sx]] = true
+
+			row := y * g.w
+			copy(columns[row+sx:row+w-1], columns[row+sx+1:row+w])
+			copy(bias[row+sx:row+w-1], bias[row+sx+1:row+w])
+			copy(e[row+sx:row+w-1], e[row+sx+1:row+w])
+			copy(pix[4*(row+sx):4*(row+w-1)], pix[4*(row+sx+1):4*(row+w)])
+		}
+		w--
+	}
+
+	out := grid{w, g.h, make([]float64, 4*w*g.h), make([]float64, w*g.h)}
+	for y := 0; y < g.h; y++ {
+		copy(out.pix[4*y*w:4*(y+1)*w], pix[4*y*g.w:])
+		copy(out.bias[y*w:(y+1)*w], bias[y*g.w:])
+	}
+
+	return out, removed
+}
+
+// insert returns the grid with n seams added. The seams that would be removed
+// first are found, then each is duplicated by adding a pixel that is the
+// average of it and its neighbour to the right.
+func (g grid) insert(n int) grid {
+	_, dup := g.remove(n, g.energy())
+
+	w := g.w + n
+	out := grid{w, g.h, make([]float64, 0, 4*w*g.h), make([]float64, 0, w*g.h)}
+
+	for y := 0; y < g.h; y++ {
+		for x := 0; x < g.w; x++ {
+			i := y*g.w + x
+			out.pix = append(out.pix, g.pix[4*i:4*i+4]...)
+			out.bias = append(out.bias, g.bias[i])
+
+			if dup[y][x] {
+				j := i
+				if x+1 < g.w {
+					j = i + 1
+				}
+
+				for c := 0; c < 4; c++ {
+					out.pix = append(out.pix, (g.pix[4*i+c]+g.pix[4*j+c])/2)
+				}
+				out.bias = append(out.bias, (g.bias[i]+g.bias[j])/2)
+			}
+		}
+	}
+
+	return out
+}
+
+// findSeam returns the column, for each row, of the connected path from top to
+// bottom with the lowest total energy. The energy is stored with rows of stride
+// pixels, of which the first w are used.
+func findSeam(e []float64, w, h int) []int {
+	stride := len(e) / h
+	cost := make([]float64, w*h)
+	copy(cost[:w], e[:w])
+
+	for y := 1; y < h; y++ {
+		for x := 0; x < w; x++ {
+			best := cost[(y-1)*w+x]
+			if x > 0 {
+				best = math.Min(best, cost[(y-1)*w+x-1])
+			}
+			if x+1 < w {
+				best = math.Min(best, cost[(y-1)*w+x+1])
+			}
+
+			cost[y*w+x] = e[y*stride+x] + best
+		}
+	}
+
+	seam := make([]int, h)
+	for x := 1; x < w; x++ {
+		if cost[(h-1)*w+x] < cost[(h-1)*w+seam[h-1]] {
+			seam[h-1] = x
+		}
+	}
+
+	for y := h - 2; y >= 0; y-- {
+		next := seam[y+1]
+		seam[y] = next
+		for _, x := range []int{next - 1, next + 1} {
+			if x >= 0 && x < w && cost[y*w+x] < cost[y*w+seam[y]] {
+				seam[y] = x
+			}
+		}
+	}
+
+	return seam
+}
@@ -0,0 +1,187 @@
+package carve
+
+import (
+	"image"
+	"image/color"
+	"testing"
+)
+
+// noise returns a colour for the pixel that differs from all of its neighbours.
+func noise(x, y int) color.NRGBA {
+	v := uint8((x*97 + y*59 + x*y*31) % 256)
+	return color.NRGBA{v, 255 - v, uint8(x * 13), 255}
+}
+
+// assertColumns checks that each column of out is the column of in given.
+func assertColumns(t *testing.T, out, in image.Image, columns []int) {
+	t.Helper()
+
+	if w := out.Bounds().Dx(); w != len(columns) {
+		t.Fatalf("expected width %d, got %d", len(columns), w)
+	}
+	if h := out.Bounds().Dy(); h != in.Bounds().Dy() {
+		t.Fatalf("expected height %d, got %d", in.Bounds().Dy(), h)
+	}
+
+	for y := 0; y < in.Bounds().Dy(); y++ {
+		for x, from := range columns {
+			got := color.NRGBAModel.Convert(out.At(x, y))
+			want := color.NRGBAModel.Convert(in.At(in.Bounds().Min.X+from, in.Bounds().Min.Y+y))
+			if got != want {
+				t.Fatalf("at (%d, %d): expected column %d, %v, got %v", x, y, from, want, got)
+			}
+		}
+	}
+}
+
+func TestEnergy(t *testing.T) {
+	img := image.NewNRGBA(image.Rect(0, 0, 8, 4))
+	for y := 0; y < 4; y++ {
+		for x := 0; x < 8; x++ {
+			if x < 4 {
+				img.SetNRGBA(x, y, color.NRGBA{50, 100, 150, 255})
+			} else {
+				img.SetNRGBA(x, y, noise(x, y))
+			}
+		}
+	}
+
+	e := newGrid(img, nil).energy()
+	for y := 0; y < 4; y++ {
+		for x := 0; x < 8; x++ {
+			v := e[y*8+x]
+			if x < 3 && v != 0 {
+				t.Errorf("at (%d, %d): expected no energy in flat region, got %v", x, y, v)
+			}
+			if x >= 3 && v <= 0 {
+				t.Errorf("at (%d, %d): expected energy near edges, got %v", x, y, v)
+			}
+		}
+	}
+}
+
+func TestEnergyOfColour(t *testing.T) {
+	// The energy is found from the colour of each pixel, so a single colour
+	// that fades out has none, apart from rounding, while edges in a
+	// semi-transparent image do.
+	fade := image.NewNRGBA(image.Rect(0, 0, 6, 3))
+	edge := image.NewNRGBA(image.Rect(0, 0, 6, 3))
+	for y := 0; y < 3; y++ {
+		for x := 0; x < 6; x++ {
+			fade.SetNRGBA(x, y, color.NRGBA{200, 100, 50, uint8(255 - x*40)})
+
+			v := uint8(0)
+			if x >= 3 {
+				v = 255
+			}
+			edge.SetNRGBA(x, y, color.NRGBA{v, v, v, 128})
+		}
+	}
+
+	for i, v := range newGrid(fade, nil).energy() {
+		if v > 1e-3 {
+			t.Errorf("at %d: expected no energy, got %v", i, v)
+		}
+	}
+
+	e := newGrid(edge, nil).energy()
+	for y := 0; y < 3; y++ {
+		if e[y*6+2] <= 0 || e[y*6+3] <= 0 {
+			t.Errorf("row %d: expected energy at edge, got %v", y, e[y*6:y*6+6])
+		}
+	}
+}
+
+func TestResizeRemovesFlatRegion(t *testing.T) {
+	img := image.NewNRGBA(image.Rect(5, 5, 25, 15))
+	for y := 5; y < 15; y++ {
+		for x := 5; x < 25; x++ {
+			if x < 15 {
+				img.SetNRGBA(x, y, color.NRGBA{200, 200, 200, 255})
+			} else {
+				img.SetNRGBA(x, y, noise(x, y))
+			}
+		}
+	}
+
+	// The six seams should come from the flat left half, leaving the noisy
+	// right half untouched.
+	out := Resize(img, 14, 0, nil)
+	assertColumns(t, out, img, []int{6, 7, 8, 9, 10, 11, 12, 13, 14, 15, 16, 17, 18, 19})
+}
+
+func TestResizeMaskRemove(t *testing.T) {
+	img := image.NewNRGBA(image.Rect(0, 0, 12, 8))
+	mask := image.NewNRGBA(img.Bounds())
+	for y := 0; y < 8; y++ {
+		for x := 0; x < 12; x++ {
+			img.SetNRGBA(x, y, noise(x, y))
+			if x >= 4 && x < 7 {
+				mask.SetNRGBA(x, y, color.NRGBA{255, 0, 0, 255})
+			}
+		}
+	}
+
+	out := Resize(img, 9, 0, mask)
+	assertColumns(t, out, img, []int{0, 1, 2, 3, 7, 8, 9, 10, 11})
+}
+
+func TestResizeMaskProtect(t *testing.T) {
+	img := image.NewNRGBA(image.Rect(0, 0, 12, 8))
+	mask := image.NewNRGBA(img.Bounds())
+	for y := 0; y < 8; y++ {
+		for x := 0; x < 12; x++ {
+			// Flat everywhere except a noisy band, which would otherwise be
+			// kept, and the flat columns on the right are protected.
+			if x >= 4 && x < 7 {
+				img.SetNRGBA(x, y, noise(x, y))
+			} else {
+				img.SetNRGBA(x, y, color.NRGBA{10, 20, 30, 255})
+			}
+			if x < 4 || x >= 7 {
+				mask.SetNRGBA(x, y, color.NRGBA{0, 255, 0, 255})
+			}
+		}
+	}
+
+	out := Resize(img, 9, 0, mask)
+	assertColumns(t, out, img, []int{0, 1, 2, 3, 7, 8, 9, 10, 11})
+}
+
+func TestResizeHeight(t *testing.T) {
+	img := image.NewNRGBA(image.Rect(0, 0, 10, 12))
+	for y := 0; y < 12; y++ {
+		for x := 0; x < 10; x++ {
+			if y < 6 {
+				img.SetNRGBA(x, y, noise(x, y))
+			} else {
+				img.SetNRGBA(x, y, color.NRGBA{0, 0, 0, 255})
+			}
+		}
+	}
+
+	out := Resize(img, 0, 9, nil)
+	if b := out.Bounds(); b != image.Rect(0, 0, 10, 9) {
+		t.Fatalf("expected bounds (0,0)-(10,9), got %v", b)
+	}
+	for y := 0; y < 6; y++ {
+		for x := 0; x < 10; x++ {
+			if got, want := color.NRGBAModel.Convert(out.At(x, y)), noise(x, y); got != want {
+				t.Fatalf("at (%d, %d): expected %v, got %v", x, y, want, got)
+			}
+		}
+	}
+}
+
+func TestResizeInsert(t *testing.T) {
+	img := image.NewNRGBA(image.Rect(0, 0, 6, 4))
+	for y := 0; y < 4; y++ {
+		for x := 0; x < 6; x++ {
+			img.SetNRGBA(x, y, noise(x, y))
+		}
+	}
+
+	if b := Resize(img, 15, 7, nil).Bounds(); b != image.Rect(0, 0, 15, 7) {
+		t.Errorf("expected bounds (0,0)-(15,7), got %v", b)
+	}
+}
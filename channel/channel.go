@@ -60,10 +60,9 @@ func (_ redCh) Get(c color.Color) float64 {
 }
 
 func (_ redCh) Set(c color.Color, v float64) color.Color {
-	_, g, b, a := utils.NormalisedRGBA(c)
-	v = utils.Truncatef(255 * v)
+	_, g, b, a := utils.RatioRGBA(c)
 
-	return color.NRGBA{uint8(v), uint8(g), uint8(b), uint8(a)}
+	return utils.RatioNRGBA(v, g, b, a)
 }
 
 type greenCh struct{}
@@ -74,10 +73,9 @@ func (_ greenCh) Get(c color.Color) float64 {
 }
 
 func (_ greenCh) Set(c color.Color, v float64) color.Color {
-	r, _, b, a := utils.NormalisedRGBA(c)
-	v = utils.Truncatef(255 * v)
+	r, _, b, a := utils.RatioRGBA(c)
 
-	return color.NRGBA{uint8(r), uint8(v), uint8(b), uint8(a)}
+	return utils.RatioNRGBA(r, v, b, a)
 }
 
 type blueCh struct{}
@@ -88,10 +86,9 @@ func (_ blueCh) Get(c color.Color) float64 {
 }
 
 func (_ blueCh) Set(c color.Color, v float64) color.Color {
-	r, g, _, a := utils.NormalisedRGBA(c)
-	v = utils.Truncatef(255 * v)
+	r, g, _, a := utils.RatioRGBA(c)
 
-	return color.NRGBA{uint8(r), uint8(g), uint8(v), uint8(a)}
+	return utils.RatioNRGBA(r, g, v, a)
 }
 
 type alphaCh struct{}
@@ -102,10 +99,9 @@ func (_ alphaCh) Get(c color.Color) float64 {
 }
 
 func (_ alphaCh) Set(c color.Color, v float64) color.Color {
-	r, g, b, _ := utils.NormalisedRGBA(c)
-	v = utils.Truncatef(255 * v)
+	r, g, b, _ := utils.RatioRGBA(c)
 
-	return color.NRGBA{uint8(r), uint8(g), uint8(b), uint8(v)}
+	return utils.RatioNRGBA(r, g, b, v)
 }
 
 type hueCh struct{}
@@ -0,0 +1,227 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"sync"
+
+	"hawx.me/code/hadfield"
+	"hawx.me/code/img/utils"
+)
+
+var (
+	batchIn, batchOut, batchGlob string
+	batchWorkers                 int
+)
+
+func Batch() *hadfield.Command {
+	cmd := &hadfield.Command{
+		Usage: "batch --in <dir> --out <dir> [options] -- <commands>",
+		Short: "run commands on every image in a directory",
+		Long: `
+  Batch runs a command, or a chain of commands separated by '|' as for pipe, on
+  each image in a directory and its subdirectories. The results are written to
+  the same relative path in the output directory, keeping their exif data. If
+  the output format is different to the input format the file extension is
+  changed to match. For example
+
+    img batch --in photos/ --out small/ --glob '*.jpg' -- pixelate --size 5x5
+
+  Files that fail to be processed are listed, but do not stop the others from
+  being processed. The output directory must be different to the input
+  directory, if it is inside it the results are not processed again.
+
+    --in <dir>         # Directory to read images from
+    --out <dir>        # Directory to write results to
+    --glob <pattern>   # Only process files with names matching (default: *)
+    --workers <n>      # Number of files to process at once (default: number of CPUs)
+`,
+	}
+
+	cmd.Run = runBatch
+
+	cmd.Flag.StringVar(&batchIn, "in", "", "")
+	cmd.Flag.StringVar(&batchOut, "out", "", "")
+	cmd.Flag.StringVar(&batchGlob, "glob", "*", "")
+	cmd.Flag.IntVar(&batchWorkers, "workers", runtime.NumCPU(), "")
+
+	return cmd
+}
+
+func runBatch(cmd *hadfield.Command, args []string) {
+	if batchIn == "" || batchOut == "" {
+		utils.Warn("batch: --in and --out must be given")
+		os.Exit(2)
+	}
+
+	if err := checkBatchDirs(batchIn, batchOut); err != nil {
+		utils.Warn("batch:", err)
+		os.Exit(2)
+	}
+
+	if _, err := filepath.Match(batchGlob, ""); err != nil {
+		utils.Warn("batch: --glob:", err)
+		os.Exit(2)
+	}
+
+	if len(args) == 1 {
+		var err error
+		if args, err = splitPipe(args[0]); err != nil {
+			utils.Warn("batch:", err)
+			os.Exit(2)
+		}
+	}
+
+	steps, err := parsePipe(args)
+	if err != nil {
+		utils.Warn("batch:", err)
+		os.Exit(2)
+	}
+
+	// Don't process the results if they are being written inside the input
+	// directory.
+	out, _ := filepath.Abs(batchOut)
+
+	var mu sync.Mutex
+	var total, failed int
+
+	fail := func(path string, err error) {
+		mu.Lock()
+		failed++
+		mu.Unlock()
+		utils.Warn("batch:", path+":", err)
+	}
+
+	paths := make(chan string)
+	var wg sync.WaitGroup
+
+	workers := batchWorkers
+	if workers < 1 {
+		workers = 1
+	}
+
+	for n := 0; n < workers; n++ {
+		wg.Add(1)
+		go func() {
+			for rel := range paths {
+				if err := batchFile(steps, rel); err != nil {
+					fail(filepath.Join(batchIn, rel), err)
+				}
+			}
+			wg.Done()
+		}()
+	}
+
+	filepath.Walk(batchIn, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			total++
+			fail(path, err)
+			return nil
+		}
+
+		if info.IsDir() {
+			if abs, _ := filepath.Abs(path); abs == out {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+
+		if ok, _ := filepath.Match(batchGlob, info.Name()); !ok {
+			return nil
+		}
+
+		rel, err := filepath.Rel(batchIn, path)
+		if err != nil {
+			total++
+			fail(path, err)
+			return nil
+		}
+
+		total++
+		paths <- rel
+		return nil
+	})
+
+	close(paths)
+	wg.Wait()
+
+	if failed > 0 {
+		utils.Warn(fmt.Sprintf("batch: %d of %d files failed", failed, total))
+		os.Exit(1)
+	}
+}
+
+// checkBatchDirs returns an error if the output directory is the input
+// directory, as every result would replace its original.
+func checkBatchDirs(in, out string) error {
+	resolve := func(dir string) string {
+		if abs, err := filepath.Abs(dir); err == nil {
+			dir = abs
+		}
+		if resolved, err := filepath.EvalSymlinks(dir); err == nil {
+			dir = resolved
+		}
+		return dir
+	}
+
+	if resolve(in) == resolve(out) {
+		return errors.New("--out must be a different directory to --in")
+	}
+	return nil
+}
+
+// batchFile performs the steps on the image at rel in the input directory,
+// writing the result to the output directory.
+func batchFile(steps []pipeStep, rel string) (err error) {
+	// A problem with one image should not stop the rest being processed. Panics
+	// in the goroutines started by utils.Parallel are raised again here, so are
+	// also recovered.
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("%v", r)
+		}
+	}()
+
+	i, data, err := utils.ReadFile(filepath.Join(batchIn, rel))
+	if err != nil {
+		return err
+	}
+
+	if i, err = autoOrient(i, &data); err != nil {
+		return err
+	}
+
+	for _, s := range steps {
+		if i, err = s.op.Apply(i, s.opts, &data); err != nil {
+			return err
+		}
+	}
+
+	if format := utils.OutputFormat(data); format != data.Format {
+		rel = strings.TrimSuffix(rel, filepath.Ext(rel)) + "." + format
+	}
+	path := filepath.Join(batchOut, rel)
+
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+
+	file, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+
+	err = utils.Write(file, i, data)
+	if cerr := file.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		os.Remove(path)
+	}
+
+	return err
+}
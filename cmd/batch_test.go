@@ -0,0 +1,73 @@
+package cmd
+
+import (
+	"image"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"hawx.me/code/img/utils"
+)
+
+func TestCheckBatchDirs(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.Mkdir(filepath.Join(dir, "in"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink(filepath.Join(dir, "in"), filepath.Join(dir, "link")); err != nil {
+		t.Fatal(err)
+	}
+
+	testCases := []struct {
+		in, out string
+		ok      bool
+	}{
+		{"in", "out", true},
+		{"in", "in/out", true},
+		{"in", "in", false},
+		{"in", "in/", false},
+		{"in", "out/../in", false},
+		{"in", "link", false},
+	}
+
+	for _, tc := range testCases {
+		err := checkBatchDirs(filepath.Join(dir, tc.in), filepath.Join(dir, tc.out))
+		if tc.ok && err != nil {
+			t.Errorf("%s, %s: unexpected error %v", tc.in, tc.out, err)
+		}
+		if !tc.ok && err == nil {
+			t.Errorf("%s, %s: expected error", tc.in, tc.out)
+		}
+	}
+}
+
+func TestBatchFileRecoversParallelPanic(t *testing.T) {
+	oldIn, oldOut := batchIn, batchOut
+	defer func() { batchIn, batchOut = oldIn, oldOut }()
+
+	batchIn, batchOut = t.TempDir(), t.TempDir()
+	if err := os.WriteFile(filepath.Join(batchIn, "in.png"), encodePNG(t, testImage()), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	op := &Operation{
+		Name: "panics",
+		Run: func(img image.Image, opts Options) (image.Image, error) {
+			utils.Parallel(4, func(i int) {
+				if i == 2 {
+					panic("bad pixel")
+				}
+			})
+			return img, nil
+		},
+	}
+
+	err := batchFile([]pipeStep{{op: op}}, "in.png")
+	if err == nil || !strings.Contains(err.Error(), "bad pixel") {
+		t.Errorf("expected panic to be returned as an error, got %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(batchOut, "in.png")); !os.IsNotExist(err) {
+		t.Errorf("expected no output to be written, got %v", err)
+	}
+}
@@ -1,31 +1,76 @@
 package cmd
 
 import (
+	"errors"
+	"flag"
 	"fmt"
 	"image"
-	_ "image/gif"
-	_ "image/jpeg"
-	_ "image/png"
 	"os"
-	"strings"
 
-	"github.com/nfnt/resize"
 	"hawx.me/code/hadfield"
 	"hawx.me/code/img/blend"
+	"hawx.me/code/img/resize"
 	"hawx.me/code/img/utils"
 )
 
-var (
-	blendModes, blendFit                                                  bool
-	blendOpacity                                                          float64
-	blendNormal, blendDissolve                                            bool
-	blendDarken, blendMultiply, blendBurn, blendLinearBurn, blendDarker   bool
-	blendLighten, blendScreen, blendDodge, blendLinearDodge, blendLighter bool
-	blendOverlay, blendSoftLight, blendHardLight, blendVividLight         bool
-	blendLinearLight, blendPinLight, blendHardMix                         bool
-	blendDifference, blendExclusion, blendAddition, blendSubtraction      bool
-	blendHue, blendSaturation, blendColor, blendLuminosity                bool
-)
+// BlendOptions are the Options for blend.
+type BlendOptions struct {
+	// Mode is the name of the blend mode to use, for example "multiply". The
+	// names are the same as the flags for each mode, and "" is normal.
+	Mode string
+
+	// Other is the blend image, which is placed over the base image.
+	Other   image.Image
+	Opacity float64
+	Fit     bool
+	Linear  bool
+}
+
+// blendModes lists the modes in the order they are shown by --modes.
+var blendModes = []struct {
+	name string
+	f    func(a, b image.Image) image.Image
+}{
+	{"normal", blend.Normal},
+	{"dissolve", blend.Dissolve},
+
+	{"darken", blend.Darken},
+	{"multiply", blend.Multiply},
+	{"burn", blend.Burn},
+	{"linear-burn", blend.LinearBurn},
+	{"darker", blend.Darker},
+
+	{"lighten", blend.Lighten},
+	{"screen", blend.Screen},
+	{"dodge", blend.Dodge},
+	{"linear-dodge", blend.LinearDodge},
+	{"lighter", blend.Lighter},
+
+	{"overlay", blend.Overlay},
+	{"soft-light", blend.SoftLight},
+	{"hard-light", blend.HardLight},
+	{"vivid-light", blend.VividLight},
+	{"linear-light", blend.LinearLight},
+	{"pin-light", blend.PinLight},
+	{"hard-mix", blend.HardMix},
+
+	{"difference", blend.Difference},
+	{"exclusion", blend.Exclusion},
+	{"addition", blend.Addition},
+	{"subtraction", blend.Subtraction},
+
+	{"hue", blend.Hue},
+	{"saturation", blend.Saturation},
+	{"color", blend.Color},
+	{"luminosity", blend.Luminosity},
+}
+
+var blendOperation = &Operation{
+	Name:       "blend",
+	Run:        runBlend,
+	Composited: true,
+	flags:      blendFlags,
+}
 
 func Blend() *hadfield.Command {
 	cmd := &hadfield.Command{
@@ -40,6 +85,7 @@ func Blend() *hadfield.Command {
     --modes          # List all available modes
     --opacity [n]    # Opacity of blend image layer (default: 1.0)
     --fit            # Fit the blend layer to the base layer, may result in loss of quality
+    --linear         # Blend in linear light, rather than sRGB
 
     BASIC
     --normal         # Selects the blend image (default)
@@ -81,70 +127,44 @@ func Blend() *hadfield.Command {
 `,
 	}
 
-	cmd.Run = runBlend
-
-	cmd.Flag.BoolVar(&blendModes, "modes", false, "")
-	cmd.Flag.Float64Var(&blendOpacity, "opacity", 1.0, "")
-	cmd.Flag.BoolVar(&blendFit, "fit", false, "")
-
-	// BASIC
-	cmd.Flag.BoolVar(&blendNormal, "normal", false, "")
-	cmd.Flag.BoolVar(&blendDissolve, "dissolve", false, "")
-
-	// DARKEN
-	cmd.Flag.BoolVar(&blendDarken, "darken", false, "")
-	cmd.Flag.BoolVar(&blendMultiply, "multiply", false, "")
-	cmd.Flag.BoolVar(&blendBurn, "burn", false, "")
-	cmd.Flag.BoolVar(&blendLinearBurn, "linear-burn", false, "")
-	cmd.Flag.BoolVar(&blendDarker, "darker", false, "")
-
-	// LIGHTEN
-	cmd.Flag.BoolVar(&blendLighten, "lighten", false, "")
-	cmd.Flag.BoolVar(&blendScreen, "screen", false, "")
-	cmd.Flag.BoolVar(&blendDodge, "dodge", false, "")
-	cmd.Flag.BoolVar(&blendLinearDodge, "linear-dodge", false, "")
-	cmd.Flag.BoolVar(&blendLighter, "lighter", false, "")
-
-	// CONTRAST
-	cmd.Flag.BoolVar(&blendOverlay, "overlay", false, "")
-	cmd.Flag.BoolVar(&blendSoftLight, "soft-light", false, "")
-	cmd.Flag.BoolVar(&blendHardLight, "hard-light", false, "")
-	cmd.Flag.BoolVar(&blendVividLight, "vivid-light", false, "")
-	cmd.Flag.BoolVar(&blendLinearLight, "linear-light", false, "")
-	cmd.Flag.BoolVar(&blendPinLight, "pin-light", false, "")
-	cmd.Flag.BoolVar(&blendHardMix, "hard-mix", false, "")
-
-	// COMPARATIVE
-	cmd.Flag.BoolVar(&blendDifference, "difference", false, "")
-	cmd.Flag.BoolVar(&blendExclusion, "exclusion", false, "")
-	cmd.Flag.BoolVar(&blendAddition, "addition", false, "") // leave as alias
-	cmd.Flag.BoolVar(&blendSubtraction, "subtraction", false, "")
-
-	// HSL
-	cmd.Flag.BoolVar(&blendHue, "hue", false, "")
-	cmd.Flag.BoolVar(&blendSaturation, "saturation", false, "")
-	cmd.Flag.BoolVar(&blendColor, "color", false, "")
-	cmd.Flag.BoolVar(&blendLuminosity, "luminosity", false, "")
+	var modes bool
+	cmd.Flag.BoolVar(&modes, "modes", false, "")
+
+	command(cmd, blendOperation)
+
+	run := cmd.Run
+	cmd.Run = func(cmd *hadfield.Command, args []string) {
+		if modes {
+			printModes()
+		}
+		run(cmd, args)
+	}
 
 	return cmd
 }
 
-func runBlend(cmd *hadfield.Command, args []string) {
-	if blendModes {
-		printModes()
+func runBlend(a image.Image, opts Options) (image.Image, error) {
+	o, ok := opts.(BlendOptions)
+	if !ok || o.Other == nil {
+		return nil, optionsError("blend", opts)
 	}
 
-	a, data := utils.ReadStdin()
-
-	path := args[0]
-	file, _ := os.Open(path)
-	defer file.Close()
-	b, _, _ := image.Decode(file)
-	var f (func(a, b image.Image) image.Image)
+	f := blend.Normal
+	if o.Mode != "" {
+		f = nil
+		for _, mode := range blendModes {
+			if mode.name == o.Mode {
+				f = mode.f
+			}
+		}
+		if f == nil {
+			return nil, errors.New("blend: unknown mode " + o.Mode)
+		}
+	}
 
-	b = blend.Fade(b, blendOpacity)
+	b := blend.Fade(o.Other, o.Opacity)
 
-	if blendFit {
+	if o.Fit {
 		ab := a.Bounds()
 		bb := b.Bounds()
 
@@ -152,93 +172,58 @@ func runBlend(cmd *hadfield.Command, args []string) {
 		// http://www.codinghorror.com/blog/2007/07/better-image-resizing.html
 		if bb.Dx() < ab.Dx() || bb.Dy() < ab.Dy() {
 			// b is going to get BIGGER
-			b = resize.Resize(uint(ab.Dx()), uint(ab.Dy()), b, resize.Bilinear)
+			b = resize.Resize(b, ab.Dx(), ab.Dy(), resize.Bilinear)
 		} else {
 			// b is going to get SMALLER
-			b = resize.Resize(uint(ab.Dx()), uint(ab.Dy()), b, resize.Bicubic)
+			b = resize.Resize(b, ab.Dx(), ab.Dy(), resize.Bicubic)
 		}
 	}
 
-	if blendNormal {
-		f = blend.Normal
-	} else if blendDissolve {
-		f = blend.Dissolve
-
-	} else if blendDarken {
-		f = blend.Darken
-	} else if blendMultiply {
-		f = blend.Multiply
-	} else if blendBurn {
-		f = blend.Burn
-	} else if blendLinearBurn {
-		f = blend.LinearBurn
-	} else if blendDarker {
-		f = blend.Darker
-
-	} else if blendLighten {
-		f = blend.Lighten
-	} else if blendScreen {
-		f = blend.Screen
-	} else if blendDodge {
-		f = blend.Dodge
-	} else if blendLinearDodge {
-		f = blend.LinearDodge
-	} else if blendLighter {
-		f = blend.Lighter
-
-	} else if blendOverlay {
-		f = blend.Overlay
-	} else if blendSoftLight {
-		f = blend.SoftLight
-	} else if blendHardLight {
-		f = blend.HardLight
-	} else if blendVividLight {
-		f = blend.VividLight
-	} else if blendLinearLight {
-		f = blend.LinearLight
-	} else if blendPinLight {
-		f = blend.PinLight
-	} else if blendHardMix {
-		f = blend.HardMix
-
-	} else if blendDifference {
-		f = blend.Difference
-	} else if blendExclusion {
-		f = blend.Exclusion
-	} else if blendAddition {
-		f = blend.Addition
-	} else if blendSubtraction {
-		f = blend.Subtraction
-
-	} else if blendHue {
-		f = blend.Hue
-	} else if blendSaturation {
-		f = blend.Saturation
-	} else if blendColor {
-		f = blend.Color
-	} else if blendLuminosity {
-		f = blend.Luminosity
-
-	} else {
-		f = blend.Normal
+	if o.Linear {
+		return utils.WithLinear(a, func(a image.Image) image.Image {
+			return f(a, b)
+		}), nil
 	}
-
-	utils.WriteStdout(f(a, b), data)
+	return f(a, b), nil
 }
 
-func printModes() {
-	modes := []string{
-		"normal", "dissolve",
-		"darken", "multiply", "burn", "linear-burn", "darker",
-		"lighten", "screen", "dodge", "linear-dodge", "lighter",
-		"overlay", "soft-light", "hard-light", "vivid-light", "linear-light",
-		"pin-light", "hard-mix",
-		"difference", "exclusion", "addition", "subtraction",
-		"hue", "saturation", "color", "luminosity",
+func blendFlags(fs *flag.FlagSet) func([]string) (Options, error) {
+	var o BlendOptions
+
+	fs.Float64Var(&o.Opacity, "opacity", 1.0, "")
+	fs.BoolVar(&o.Fit, "fit", false, "")
+	fs.BoolVar(&o.Linear, "linear", false, "")
+
+	set := make([]bool, len(blendModes))
+	for i, mode := range blendModes {
+		fs.BoolVar(&set[i], mode.name, false, "")
 	}
 
-	msg := strings.Join(modes, "\n")
+	return func(args []string) (Options, error) {
+		if len(args) < 1 {
+			return nil, errors.New("blend requires an <other> image to blend with")
+		}
+
+		other, _, err := utils.ReadFile(args[0])
+		if err != nil {
+			return nil, err
+		}
+		o.Other = other
+
+		for i, mode := range blendModes {
+			if set[i] {
+				o.Mode = mode.name
+				break
+			}
+		}
 
-	fmt.Fprintf(os.Stdout, msg+"\n")
+		return o, nil
+	}
+}
+
+func printModes() {
+	for _, mode := range blendModes {
+		fmt.Fprintln(os.Stdout, mode.name)
+	}
 	os.Exit(0)
 }
@@ -1,19 +1,34 @@
 package cmd
 
 import (
-	"os"
+	"errors"
+	"flag"
+	"image"
 
 	"hawx.me/code/hadfield"
 	"hawx.me/code/img/blur"
 	"hawx.me/code/img/utils"
 )
 
-var (
-	blurRadius   int
-	blurStyle    string
-	blurBox      bool
-	blurGaussian float64
-)
+// BlurOptions are the Options for blur.
+type BlurOptions struct {
+	Radius int
+	Style  blur.Style
+
+	// Box performs a box blur, instead of a gaussian blur with the standard
+	// deviation Sigma.
+	Box   bool
+	Sigma float64
+
+	Linear bool
+}
+
+var blurOperation = &Operation{
+	Name:       "blur",
+	Run:        runBlur,
+	Composited: true,
+	flags:      blurFlags,
+}
 
 func Blur() *hadfield.Command {
 	cmd := &hadfield.Command{
@@ -27,42 +42,72 @@ func Blur() *hadfield.Command {
 
     --box                    # Perform box blur
     --gaussian <sigma>       # Perform gaussian blur (default: 5.0)
+
+    --linear                 # Blur in linear light, which is more accurate
 `,
 	}
 
-	cmd.Run = runBlur
-
-	cmd.Flag.IntVar(&blurRadius, "radius", 2.0, "")
-	cmd.Flag.StringVar(&blurStyle, "style", "ignore", "")
-
-	cmd.Flag.BoolVar(&blurBox, "box", false, "")
-	cmd.Flag.Float64Var(&blurGaussian, "gaussian", 5.0, "")
-
-	return cmd
+	return command(cmd, blurOperation)
 }
 
-func runBlur(cmd *hadfield.Command, args []string) {
-	var style blur.Style
-
-	switch blurStyle {
-	case "clamp":
-		style = blur.CLAMP
-	case "ignore":
-		style = blur.IGNORE
-	case "wrap":
-		style = blur.WRAP
-	default:
-		utils.Warn("--style must be one of 'clamp', 'ignore' or 'wrap'")
-		os.Exit(2)
+func runBlur(img image.Image, opts Options) (image.Image, error) {
+	o, ok := opts.(BlurOptions)
+	if !ok {
+		return nil, optionsError("blur", opts)
 	}
 
-	i, data := utils.ReadStdin()
+	var err error
+	f := func(i image.Image) (out image.Image) {
+		if o.Box {
+			out, err = blur.Box(i, o.Radius, o.Style)
+		} else {
+			out, err = blur.Gaussian(i, o.Radius, o.Sigma, o.Style)
+		}
+		return
+	}
 
-	if blurBox {
-		i = blur.Box(i, blurRadius, style)
+	if o.Linear {
+		img = utils.WithLinear(img, f)
 	} else {
-		i = blur.Gaussian(i, blurRadius, blurGaussian, style)
+		img = f(img)
+	}
+
+	if err != nil {
+		return nil, err
 	}
+	return img, nil
+}
+
+func blurFlags(fs *flag.FlagSet) func([]string) (Options, error) {
+	var o BlurOptions
+	var style string
 
-	utils.WriteStdout(i, data)
+	fs.IntVar(&o.Radius, "radius", 2.0, "")
+	fs.StringVar(&style, "style", "ignore", "")
+
+	fs.BoolVar(&o.Box, "box", false, "")
+	fs.Float64Var(&o.Sigma, "gaussian", 5.0, "")
+	fs.BoolVar(&o.Linear, "linear", false, "")
+
+	return func(args []string) (Options, error) {
+		if o.Radius < 0 {
+			return nil, errors.New("--radius must not be negative")
+		}
+		if o.Sigma <= 0 {
+			return nil, errors.New("--gaussian must be positive")
+		}
+
+		switch style {
+		case "clamp":
+			o.Style = blur.CLAMP
+		case "ignore":
+			o.Style = blur.IGNORE
+		case "wrap":
+			o.Style = blur.WRAP
+		default:
+			return nil, errors.New("--style must be one of 'clamp', 'ignore' or 'wrap'")
+		}
+
+		return o, nil
+	}
 }
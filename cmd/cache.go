@@ -0,0 +1,112 @@
+package cmd
+
+import (
+	"crypto/sha256"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+
+	"hawx.me/code/hadfield"
+	"hawx.me/code/img/cache"
+	"hawx.me/code/img/utils"
+)
+
+// ResultCache, if not nil, stores the result of each command so that it can be
+// reused when the command is run again with the same image and options.
+var ResultCache *cache.Cache
+
+// normalise returns the value of every flag in fs, in alphabetical order,
+// followed by args. Arguments which name files are replaced by a hash of their
+// contents, so that changes to the file are noticed.
+func normalise(fs *flag.FlagSet, args []string) []string {
+	var normalised []string
+
+	fs.VisitAll(func(f *flag.Flag) {
+		normalised = append(normalised, "--"+f.Name+"="+f.Value.String())
+	})
+
+	for _, arg := range args {
+		if data, err := ioutil.ReadFile(arg); err == nil {
+			arg = fmt.Sprintf("%x", sha256.Sum256(data))
+		}
+		normalised = append(normalised, arg)
+	}
+
+	return normalised
+}
+
+// normalise is like the function of the same name, for arguments that have not
+// been parsed.
+func (op *Operation) normalise(args []string) []string {
+	fs := flag.NewFlagSet(op.Name, flag.ContinueOnError)
+	fs.SetOutput(ioutil.Discard)
+	op.flags(fs)
+	fs.Parse(args)
+
+	return normalise(fs, fs.Args())
+}
+
+var (
+	cacheSize string
+)
+
+func Cache() *hadfield.Command {
+	cmd := &hadfield.Command{
+		Usage: "cache prune [options]",
+		Short: "manage the result cache",
+		Long: `
+  Commands can store their results in a cache, by giving --cache-dir before the
+  command name, so that running the same command on the same image again is
+  much faster. For example
+
+    img --cache-dir ~/.cache/img blur --radius 20 < in.png > out.png
+
+  The cache removes the least recently used results when it grows larger than
+  --cache-size (default: 1G). Prune removes results from the cache given by
+  --cache-dir until it is smaller than a size.
+
+    --size <n>     # Size to prune to, with K, M or G suffix (default: --cache-size)
+`,
+	}
+
+	cmd.Run = runCache
+
+	cmd.Flag.StringVar(&cacheSize, "size", "", "")
+
+	return cmd
+}
+
+func runCache(cmd *hadfield.Command, args []string) {
+	if len(args) == 0 || args[0] != "prune" {
+		utils.Warn("cache: expected 'prune'")
+		os.Exit(2)
+	}
+
+	// Flags may also be given after prune.
+	if err := cmd.Flag.Parse(args[1:]); err != nil {
+		os.Exit(2)
+	}
+
+	if ResultCache == nil {
+		utils.Warn("cache: --cache-dir must be given")
+		os.Exit(2)
+	}
+
+	size := ResultCache.MaxSize
+	if cacheSize != "" {
+		var err error
+		if size, err = cache.ParseSize(cacheSize); err != nil {
+			utils.Warn(err)
+			os.Exit(2)
+		}
+	}
+
+	removed, freed, err := ResultCache.Prune(size)
+	if err != nil {
+		utils.Warn("cache:", err)
+		os.Exit(1)
+	}
+
+	fmt.Printf("removed %d results, freeing %d bytes\n", removed, freed)
+}
@@ -0,0 +1,86 @@
+package cmd
+
+import (
+	"errors"
+	"flag"
+	"image"
+
+	"hawx.me/code/hadfield"
+	"hawx.me/code/img/carve"
+	"hawx.me/code/img/utils"
+)
+
+// CarveOptions are the Options for carve.
+type CarveOptions struct {
+	// Width and Height are the size of the result. If either is 0 that size is
+	// kept.
+	Width, Height int
+
+	// Mask, if not nil, marks parts of the image to protect in green and parts
+	// to remove first in red.
+	Mask image.Image
+}
+
+var carveOperation = &Operation{
+	Name:       "carve",
+	Run:        runCarve,
+	Composited: true,
+	flags:      carveFlags,
+}
+
+func Carve() *hadfield.Command {
+	cmd := &hadfield.Command{
+		Usage: "carve [<mask>] [options]",
+		Short: "resize an image without distorting its subject",
+		Long: `
+  Carve takes an image from STDIN, and prints a version resized by seam carving
+  to STDOUT. Rather than scaling the whole image it removes, or duplicates,
+  paths of pixels through the least noticeable parts so that the subject keeps
+  its shape.
+
+  A <mask> image can be given to guide this: green areas are protected and red
+  areas are removed first, other colours have no effect. It is scaled to the
+  size of the image if needed.
+
+    --width <pixels>       # Width of the result (default: unchanged)
+    --height <pixels>      # Height of the result (default: unchanged)
+`,
+	}
+
+	return command(cmd, carveOperation)
+}
+
+func runCarve(img image.Image, opts Options) (image.Image, error) {
+	o, ok := opts.(CarveOptions)
+	if !ok {
+		return nil, optionsError("carve", opts)
+	}
+
+	return carve.Resize(img, o.Width, o.Height, o.Mask), nil
+}
+
+func carveFlags(fs *flag.FlagSet) func([]string) (Options, error) {
+	var o CarveOptions
+
+	fs.IntVar(&o.Width, "width", 0, "")
+	fs.IntVar(&o.Height, "height", 0, "")
+
+	return func(args []string) (Options, error) {
+		if o.Width < 0 {
+			return nil, errors.New("--width must not be negative")
+		}
+		if o.Height < 0 {
+			return nil, errors.New("--height must not be negative")
+		}
+
+		if len(args) > 0 {
+			mask, _, err := utils.ReadFile(args[0])
+			if err != nil {
+				return nil, err
+			}
+			o.Mask = mask
+		}
+
+		return o, nil
+	}
+}
@@ -0,0 +1,33 @@
+package cmd
+
+import "testing"
+
+func TestCarveFlags(t *testing.T) {
+	testCases := []struct {
+		args []string
+		opts CarveOptions
+		err  string
+	}{
+		{nil, CarveOptions{}, ""},
+		{[]string{"--width", "5"}, CarveOptions{Width: 5}, ""},
+		{[]string{"--width", "0", "--height", "7"}, CarveOptions{Height: 7}, ""},
+		{[]string{"--width", "-5"}, CarveOptions{}, "--width must not be negative"},
+		{[]string{"--height", "-1"}, CarveOptions{}, "--height must not be negative"},
+	}
+
+	for _, tc := range testCases {
+		opts, err := carveOperation.Parse(tc.args)
+		if tc.err != "" {
+			if err == nil || err.Error() != tc.err {
+				t.Errorf("%v: expected error %q, got %v", tc.args, tc.err, err)
+			}
+			continue
+		}
+
+		if err != nil {
+			t.Errorf("%v: unexpected error %v", tc.args, err)
+		} else if opts != tc.opts {
+			t.Errorf("%v: expected %+v, got %+v", tc.args, tc.opts, opts)
+		}
+	}
+}
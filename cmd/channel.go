@@ -1,17 +1,25 @@
 package cmd
 
 import (
+	"flag"
+
 	"hawx.me/code/hadfield"
 	"hawx.me/code/img/channel"
 	"hawx.me/code/img/utils"
 )
 
-var (
-	channelRed, channelGreen, channelBlue                              bool
-	channelHue, channelSaturation, channelLightness, channelBrightness bool
-	channelAlpha                                                       bool
-	channelBy, channelRatio                                            float64
-)
+// ChannelOptions are the Options for channel.
+type ChannelOptions struct {
+	Channels []channel.Channel
+	Adjuster utils.Adjuster
+}
+
+var channelOperation = &Operation{
+	Name:       "channel",
+	Run:        runComposable("channel", channelComposable),
+	Composable: channelComposable,
+	flags:      channelFlags,
+}
 
 func Channel() *hadfield.Command {
 	cmd := &hadfield.Command{
@@ -38,68 +46,69 @@ func Channel() *hadfield.Command {
 `,
 	}
 
-	cmd.Run = runChannel
-
-	cmd.Flag.BoolVar(&channelRed, "red", false, "")
-	cmd.Flag.BoolVar(&channelGreen, "green", false, "")
-	cmd.Flag.BoolVar(&channelBlue, "blue", false, "")
-
-	cmd.Flag.BoolVar(&channelHue, "hue", false, "")
-	cmd.Flag.BoolVar(&channelSaturation, "saturation", false, "")
-	cmd.Flag.BoolVar(&channelLightness, "lightness", false, "")
-	cmd.Flag.BoolVar(&channelBrightness, "brightness", false, "")
-
-	cmd.Flag.BoolVar(&channelAlpha, "alpha", false, "")
-
-	cmd.Flag.Float64Var(&channelBy, "by", 0.1, "")
-	cmd.Flag.Float64Var(&channelRatio, "ratio", 1.2, "")
-
-	return cmd
+	return command(cmd, channelOperation)
 }
 
-func runChannel(cmd *hadfield.Command, args []string) {
-	i, data := utils.ReadStdin()
-	var adj utils.Adjuster
-
-	if utils.FlagVisited("by", cmd.Flag) {
-		adj = utils.Adder(channelBy)
-	} else {
-		adj = utils.Multiplier(channelRatio)
+func channelComposable(opts Options) utils.Composable {
+	o, ok := opts.(ChannelOptions)
+	if !ok || o.Adjuster == nil {
+		return nil
 	}
 
-	if !(channelRed || channelGreen || channelBlue || channelHue ||
-		channelSaturation || channelLightness || channelBrightness || channelAlpha) {
-		channelRed = true
-		channelGreen = true
-		channelBlue = true
+	fs := make([]utils.Composable, len(o.Channels))
+	for i, ch := range o.Channels {
+		fs[i] = channel.AdjustC(o.Adjuster, ch)
 	}
 
-	if channelRed {
-		i = channel.Adjust(i, adj, channel.Red)
-	}
-	if channelGreen {
-		i = channel.Adjust(i, adj, channel.Green)
-	}
-	if channelBlue {
-		i = channel.Adjust(i, adj, channel.Blue)
-	}
-
-	if channelHue {
-		i = channel.Adjust(i, adj, channel.Hue)
-	}
-	if channelSaturation {
-		i = channel.Adjust(i, adj, channel.Saturation)
-	}
-	if channelLightness {
-		i = channel.Adjust(i, adj, channel.Lightness)
-	}
-	if channelBrightness {
-		i = channel.Adjust(i, adj, channel.Brightness)
-	}
+	return utils.Compose(fs...)
+}
 
-	if channelAlpha {
-		i = channel.Adjust(i, adj, channel.Alpha)
+func channelFlags(fs *flag.FlagSet) func([]string) (Options, error) {
+	var red, green, blue, hue, saturation, lightness, brightness, alpha bool
+	var by, ratio float64
+
+	fs.BoolVar(&red, "red", false, "")
+	fs.BoolVar(&green, "green", false, "")
+	fs.BoolVar(&blue, "blue", false, "")
+	fs.BoolVar(&hue, "hue", false, "")
+	fs.BoolVar(&saturation, "saturation", false, "")
+	fs.BoolVar(&lightness, "lightness", false, "")
+	fs.BoolVar(&brightness, "brightness", false, "")
+	fs.BoolVar(&alpha, "alpha", false, "")
+	fs.Float64Var(&by, "by", 0.1, "")
+	fs.Float64Var(&ratio, "ratio", 1.2, "")
+
+	return func(args []string) (Options, error) {
+		var o ChannelOptions
+
+		if utils.FlagVisited("by", *fs) {
+			o.Adjuster = utils.Adder(by)
+		} else {
+			o.Adjuster = utils.Multiplier(ratio)
+		}
+
+		if !(red || green || blue || hue || saturation || lightness || brightness || alpha) {
+			red, green, blue = true, true, true
+		}
+
+		for _, c := range []struct {
+			set bool
+			ch  channel.Channel
+		}{
+			{red, channel.Red},
+			{green, channel.Green},
+			{blue, channel.Blue},
+			{hue, channel.Hue},
+			{saturation, channel.Saturation},
+			{lightness, channel.Lightness},
+			{brightness, channel.Brightness},
+			{alpha, channel.Alpha},
+		} {
+			if c.set {
+				o.Channels = append(o.Channels, c.ch)
+			}
+		}
+
+		return o, nil
 	}
-
-	utils.WriteStdout(i, data)
 }
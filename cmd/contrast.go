@@ -1,15 +1,25 @@
 package cmd
 
 import (
+	"flag"
+
 	"hawx.me/code/hadfield"
 	"hawx.me/code/img/contrast"
 	"hawx.me/code/img/utils"
 )
 
-var (
-	contrastLinear, contrastSigmoidal bool
-	contrastFactor, contrastMidpoint  float64
-)
+// ContrastOptions are the Options for contrast.
+type ContrastOptions struct {
+	Factor, Midpoint  float64
+	Linear, Sigmoidal bool
+}
+
+var contrastOperation = &Operation{
+	Name:       "contrast",
+	Run:        runComposable("contrast", contrastComposable),
+	Composable: contrastComposable,
+	flags:      contrastFlags,
+}
 
 func Contrast() *hadfield.Command {
 	cmd := &hadfield.Command{
@@ -27,27 +37,33 @@ func Contrast() *hadfield.Command {
 `,
 	}
 
-	cmd.Run = runContrast
-
-	cmd.Flag.Float64Var(&contrastFactor, "factor", 1.0, "")
-	cmd.Flag.Float64Var(&contrastMidpoint, "midpoint", 0.5, "")
+	return command(cmd, contrastOperation)
+}
 
-	cmd.Flag.BoolVar(&contrastLinear, "linear", false, "")
-	cmd.Flag.BoolVar(&contrastSigmoidal, "sigmoidal", false, "")
+func contrastComposable(opts Options) utils.Composable {
+	o, ok := opts.(ContrastOptions)
+	if !ok {
+		return nil
+	}
 
-	return cmd
+	if o.Sigmoidal {
+		return contrast.SigmoidalC(o.Factor, o.Midpoint)
+	} else if o.Linear {
+		return contrast.LinearC(o.Factor)
+	}
+	return contrast.AdjustC(o.Factor)
 }
 
-func runContrast(cmd *hadfield.Command, args []string) {
-	i, data := utils.ReadStdin()
+func contrastFlags(fs *flag.FlagSet) func([]string) (Options, error) {
+	var o ContrastOptions
 
-	if contrastSigmoidal {
-		i = contrast.Sigmoidal(i, contrastFactor, contrastMidpoint)
-	} else if contrastLinear {
-		i = contrast.Linear(i, contrastFactor)
-	} else {
-		i = contrast.Adjust(i, contrastFactor)
-	}
+	fs.Float64Var(&o.Factor, "factor", 1.0, "")
+	fs.Float64Var(&o.Midpoint, "midpoint", 0.5, "")
+
+	fs.BoolVar(&o.Linear, "linear", false, "")
+	fs.BoolVar(&o.Sigmoidal, "sigmoidal", false, "")
 
-	utils.WriteStdout(i, data)
+	return func(args []string) (Options, error) {
+		return o, nil
+	}
 }
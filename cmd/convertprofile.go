@@ -0,0 +1,85 @@
+package cmd
+
+import (
+	"errors"
+	"flag"
+	"image"
+	"strings"
+
+	"hawx.me/code/hadfield"
+	"hawx.me/code/img/icc"
+	"hawx.me/code/img/utils"
+)
+
+// ConvertProfileOptions are the Options for convert-profile.
+type ConvertProfileOptions struct {
+	// To is the profile to convert to, only "srgb" is supported.
+	To string
+
+	// From is the profile of the image, if nil the image is assumed to already
+	// be sRGB. When run as a command it is set from the image read.
+	From *icc.Profile
+}
+
+var convertProfileOperation = &Operation{
+	Name:  "convert-profile",
+	Run:   runConvertProfile,
+	Meta:  convertProfileMeta,
+	flags: convertProfileFlags,
+}
+
+func ConvertProfile() *hadfield.Command {
+	cmd := &hadfield.Command{
+		Usage: "convert-profile [options]",
+		Short: "convert an image to the sRGB colour profile",
+		Long: `
+  Convert-profile takes an image from STDIN with an embedded colour profile
+  (for example Display P3 or Adobe RGB), converts its colours to the profile
+  given, and prints the result to STDOUT. Images without a profile are assumed
+  to already be sRGB, so are not changed.
+
+    --to <profile>     # Profile to convert to, only srgb is supported (default: srgb)
+`,
+	}
+
+	return command(cmd, convertProfileOperation)
+}
+
+func runConvertProfile(img image.Image, opts Options) (image.Image, error) {
+	o, ok := opts.(ConvertProfileOptions)
+	if !ok {
+		return nil, optionsError("convert-profile", opts)
+	}
+
+	if o.From == nil {
+		return img, nil
+	}
+	return icc.ToSRGB(img, o.From)
+}
+
+func convertProfileMeta(opts Options, data *utils.Meta) Options {
+	if o, ok := opts.(ConvertProfileOptions); ok {
+		o.From = data.ICC
+
+		// Images without a profile are assumed to be sRGB. The profile is kept
+		// if the conversion fails, see Operation.Apply.
+		data.ICC = nil
+
+		return o
+	}
+	return opts
+}
+
+func convertProfileFlags(fs *flag.FlagSet) func([]string) (Options, error) {
+	var o ConvertProfileOptions
+
+	fs.StringVar(&o.To, "to", "srgb", "")
+
+	return func(args []string) (Options, error) {
+		if strings.ToLower(o.To) != "srgb" {
+			return nil, errors.New("--to must be 'srgb'")
+		}
+
+		return o, nil
+	}
+}
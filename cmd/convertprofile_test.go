@@ -0,0 +1,33 @@
+package cmd
+
+import (
+	"image"
+	"testing"
+
+	"hawx.me/code/img/icc"
+	"hawx.me/code/img/utils"
+)
+
+func TestConvertProfileKeepsProfileOnError(t *testing.T) {
+	data := make([]byte, 132)
+	copy(data[16:], "GRAY")
+	copy(data[36:], "acsp")
+
+	p, err := icc.Parse(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	opts, err := convertProfileOperation.Parse(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	meta := &utils.Meta{ICC: p}
+	if _, err := convertProfileOperation.Apply(image.NewNRGBA(image.Rect(0, 0, 2, 2)), opts, meta); err == nil {
+		t.Fatal("expected error for unsupported profile")
+	}
+	if meta.ICC != p {
+		t.Error("expected profile to be kept when conversion fails")
+	}
+}
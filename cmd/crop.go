@@ -1,17 +1,67 @@
 package cmd
 
 import (
+	"errors"
+	"flag"
+	"image"
+	"math"
+	"strconv"
+	"strings"
+
 	"hawx.me/code/hadfield"
 	"hawx.me/code/img/crop"
 	"hawx.me/code/img/utils"
 )
 
-var (
-	cropSquare, cropCircle, cropTriangle bool
-	cropSize                             int
-	cropCentre, cropTop, cropTopRight, cropRight, cropBottomRight, cropBottom,
-	cropBottomLeft, cropLeft, cropTopLeft bool
-)
+// CropOptions are the Options for crop.
+type CropOptions struct {
+	// Shape is either "square", "circle", "triangle", "rect", "aspect", "trim",
+	// "polygon", "path", "ellipse", "rounded", "star" or "smart".
+	Shape     string
+	Size      int
+	Direction utils.Direction
+
+	// Geometry is the rectangle to crop to for "rect", or to fit the shape in
+	// for "ellipse" and "rounded". If it is the zero value the whole image is
+	// used. For "smart" only its size is used.
+	Geometry crop.Geometry
+
+	// Points are the corners of the shape for "polygon".
+	Points []crop.Point
+
+	// Path is the SVG path data of the shape for "path".
+	Path string
+
+	// Radius is the radius of the corners for "rounded".
+	Radius int
+
+	// Sides is the number of points of the shape for "star", and Inner is how
+	// far, as a fraction of the outer radius, the inner corners are from the
+	// centre. An Inner of 1 gives a regular polygon.
+	Sides int
+	Inner float64
+
+	// AspectWidth and AspectHeight give the ratio to crop to for "aspect", and
+	// optionally "smart".
+	AspectWidth, AspectHeight float64
+
+	// Tolerance is how different, from 0 to 1, a pixel can be from the border
+	// colour and still be removed by "trim".
+	Tolerance float64
+}
+
+var cropShapes = map[string]func(image.Image, int, utils.Direction) image.Image{
+	"square":   crop.Square,
+	"circle":   crop.Circle,
+	"triangle": crop.Triangle,
+}
+
+var cropOperation = &Operation{
+	Name:       "crop",
+	Run:        runCrop,
+	Composited: true,
+	flags:      cropFlags,
+}
 
 func Crop() *hadfield.Command {
 	cmd := &hadfield.Command{
@@ -25,8 +75,23 @@ func Crop() *hadfield.Command {
     --square               # Crop to a square (default)
     --circle               # Crop to a circle
     --triangle             # Crop to an equilateral triangle
+    --rect <geometry>      # Crop to a rectangle given as WxH+X+Y
+    --aspect <w:h>         # Crop to the largest rectangle with this ratio
+    --trim                 # Remove borders the colour of the top-left pixel
+    --polygon <points>     # Crop to a polygon, given as "x,y x,y x,y ..."
+    --path <data>          # Crop to the shape of an SVG path, using the
+                           # commands M, L, H, V, C, Q, A and Z
+    --ellipse              # Crop to an ellipse
+    --rounded <radius>     # Crop to a rectangle with rounded corners
+    --star <points>        # Crop to a star with this many points
+    --ngon <sides>         # Crop to a regular polygon with this many sides
+    --smart                # Crop to the most interesting part of the image
 
     --size <pixels>        # Size to crop to (default: largest possible)
+    --tolerance <n>        # How different, from 0 to 1, a pixel in a border
+                           # can be when trimming (default: 0)
+    --inner <n>            # Distance of the inner corners of a star from its
+                           # centre, from 0 to 1 (default: 0.5)
 
     --centre               # Centre the image
     --top                  # Centre the image to the top of the frame
@@ -37,60 +102,252 @@ func Crop() *hadfield.Command {
     --bottom-left          # Centre the image to the bottom-left of the frame
     --left                 # Centre the image to the left of the frame
     --top-left             # Centre the image to the top-left of the frame
+
+  Any part of a --rect geometry can be a percentage of the image's size, and the
+  offset can be left out to place it using a direction instead. For example
+
+    img crop --rect 800x600+100+50    # 800 by 600 pixels, 100 in and 50 down
+    img crop --rect 50%x50%           # the middle quarter of the image
+    img crop --rect x75% --top        # the top three-quarters of the image
+    img crop --aspect 16:9 --bottom   # the bottom of a tall image
+
+  The --polygon points can also use percentages, and the ellipse and rounded
+  rectangle fill the --rect geometry if given, otherwise the whole image.
+
+    img crop --polygon "50%,0 100%,100% 0,100%"
+    img crop --path "M 0 0 H 200 A 100 100 0 0 1 0 200 Z"
+    img crop --rounded 20 --rect 400x300+10+10
+
+  With --smart the part kept is chosen by looking for edges, saturated colour
+  and skin tones, rather than by direction. The result is a square of --size,
+  or the size given by --rect WxH, otherwise it is the largest square or
+  --aspect rectangle possible.
+
+    img crop --smart --rect 320x180 < photo.jpg > thumbnail.jpg
 `,
 	}
 
-	cmd.Run = runCrop
+	return command(cmd, cropOperation)
+}
+
+func runCrop(img image.Image, opts Options) (image.Image, error) {
+	o, ok := opts.(CropOptions)
+	if !ok {
+		return nil, optionsError("crop", opts)
+	}
+
+	switch o.Shape {
+	case "rect":
+		r := o.Geometry.Rect(img.Bounds(), o.Direction).Intersect(img.Bounds())
+		if r.Empty() {
+			return nil, errors.New("crop: rectangle is outside of the image")
+		}
+		return crop.Rectangle(img, r), nil
+
+	case "aspect":
+		return crop.Aspect(img, o.AspectWidth, o.AspectHeight, o.Direction), nil
+
+	case "trim":
+		return crop.Trim(img, o.Tolerance), nil
+
+	case "polygon":
+		points := make([]image.Point, len(o.Points))
+		for i, p := range o.Points {
+			points[i] = p.In(img.Bounds())
+		}
+		return crop.Polygon(img, points), nil
+
+	case "path":
+		return crop.Path(img, o.Path)
+
+	case "ellipse":
+		return crop.Ellipse(img, o.shapeRect(img.Bounds())), nil
+
+	case "rounded":
+		return crop.RoundedRect(img, o.shapeRect(img.Bounds()), o.Radius), nil
+
+	case "star":
+		return crop.Star(img, o.Sides, o.Inner, o.Size, o.Direction), nil
+
+	case "smart":
+		width, height := o.smartSize(img.Bounds())
+		return crop.Smart(img, width, height), nil
+	}
+
+	if cropShapes[o.Shape] == nil {
+		return nil, optionsError("crop", opts)
+	}
+
+	return cropShapes[o.Shape](img, o.Size, o.Direction), nil
+}
+
+// shapeRect returns the rectangle to fit a shape in, within b.
+func (o CropOptions) shapeRect(b image.Rectangle) image.Rectangle {
+	if o.Geometry == (crop.Geometry{}) {
+		return b
+	}
+	return o.Geometry.Rect(b, o.Direction)
+}
 
-	cmd.Flag.BoolVar(&cropSquare, "square", false, "")
-	cmd.Flag.BoolVar(&cropCircle, "circle", false, "")
-	cmd.Flag.BoolVar(&cropTriangle, "triangle", false, "")
+// smartSize returns the size to crop an image with bounds b to for "smart".
+func (o CropOptions) smartSize(b image.Rectangle) (int, int) {
+	switch {
+	case o.Geometry != (crop.Geometry{}):
+		return o.Geometry.Width.Of(b.Dx()), o.Geometry.Height.Of(b.Dy())
 
-	cmd.Flag.IntVar(&cropSize, "size", -1, "")
+	case o.AspectWidth > 0 && o.AspectHeight > 0:
+		if float64(b.Dx())/float64(b.Dy()) > o.AspectWidth/o.AspectHeight {
+			return int(math.Round(float64(b.Dy()) * o.AspectWidth / o.AspectHeight)), b.Dy()
+		}
+		return b.Dx(), int(math.Round(float64(b.Dx()) * o.AspectHeight / o.AspectWidth))
 
-	cmd.Flag.BoolVar(&cropCentre, "centre", false, "")
-	cmd.Flag.BoolVar(&cropTop, "top", false, "")
-	cmd.Flag.BoolVar(&cropTopRight, "top-right", false, "")
-	cmd.Flag.BoolVar(&cropRight, "right", false, "")
-	cmd.Flag.BoolVar(&cropBottomRight, "bottom-right", false, "")
-	cmd.Flag.BoolVar(&cropBottom, "bottom", false, "")
-	cmd.Flag.BoolVar(&cropBottomLeft, "bottom-left", false, "")
-	cmd.Flag.BoolVar(&cropLeft, "left", false, "")
-	cmd.Flag.BoolVar(&cropTopLeft, "top-left", false, "")
+	case o.Size > 0:
+		return o.Size, o.Size
+	}
 
-	return cmd
+	if b.Dx() < b.Dy() {
+		return b.Dx(), b.Dx()
+	}
+	return b.Dy(), b.Dy()
 }
 
-func runCrop(cmd *hadfield.Command, args []string) {
-	i, data := utils.ReadStdin()
-
-	direction := utils.Centre
-
-	if cropTop {
-		direction = utils.Top
-	} else if cropTopRight {
-		direction = utils.TopRight
-	} else if cropRight {
-		direction = utils.Right
-	} else if cropBottomRight {
-		direction = utils.BottomRight
-	} else if cropBottom {
-		direction = utils.Bottom
-	} else if cropBottomLeft {
-		direction = utils.BottomLeft
-	} else if cropLeft {
-		direction = utils.Left
-	} else if cropTopLeft {
-		direction = utils.TopLeft
+func cropFlags(fs *flag.FlagSet) func([]string) (Options, error) {
+	var o CropOptions
+	var square, circle, triangle, trim, ellipse, smart bool
+	var rect, aspect, polygon string
+	var star, ngon int
+
+	fs.BoolVar(&square, "square", false, "")
+	fs.BoolVar(&circle, "circle", false, "")
+	fs.BoolVar(&triangle, "triangle", false, "")
+	fs.StringVar(&rect, "rect", "", "")
+	fs.StringVar(&aspect, "aspect", "", "")
+	fs.BoolVar(&trim, "trim", false, "")
+	fs.StringVar(&polygon, "polygon", "", "")
+	fs.StringVar(&o.Path, "path", "", "")
+	fs.BoolVar(&ellipse, "ellipse", false, "")
+	fs.IntVar(&o.Radius, "rounded", 0, "")
+	fs.IntVar(&star, "star", 0, "")
+	fs.IntVar(&ngon, "ngon", 0, "")
+	fs.BoolVar(&smart, "smart", false, "")
+
+	fs.IntVar(&o.Size, "size", -1, "")
+	fs.Float64Var(&o.Tolerance, "tolerance", 0, "")
+	fs.Float64Var(&o.Inner, "inner", 0.5, "")
+
+	direction := directionFlags(fs)
+
+	return func(args []string) (Options, error) {
+		var err error
+		if rect != "" {
+			if o.Geometry, err = crop.ParseGeometry(rect); err != nil {
+				return nil, errors.New("--rect " + err.Error())
+			}
+		}
+		if aspect != "" {
+			if o.AspectWidth, o.AspectHeight, err = parseRatio(aspect); err != nil {
+				return nil, err
+			}
+		}
+
+		o.Shape = "square"
+		if smart {
+			o.Shape = "smart"
+		} else if circle {
+			o.Shape = "circle"
+		} else if triangle {
+			o.Shape = "triangle"
+		} else if polygon != "" {
+			o.Shape = "polygon"
+
+			if o.Points, err = crop.ParsePoints(polygon); err != nil {
+				return nil, errors.New("--polygon " + err.Error())
+			}
+		} else if o.Path != "" {
+			o.Shape = "path"
+		} else if ellipse {
+			o.Shape = "ellipse"
+		} else if o.Radius > 0 {
+			o.Shape = "rounded"
+		} else if star > 0 || ngon > 0 {
+			o.Shape = "star"
+			o.Sides = star
+
+			if ngon > 0 {
+				o.Sides = ngon
+				o.Inner = 1
+			}
+			if o.Sides < 3 {
+				return nil, errors.New("--star and --ngon must be at least 3")
+			}
+		} else if rect != "" {
+			o.Shape = "rect"
+		} else if aspect != "" {
+			o.Shape = "aspect"
+		} else if trim {
+			o.Shape = "trim"
+		}
+
+		if o.Tolerance < 0 || o.Tolerance > 1 {
+			return nil, errors.New("--tolerance must be between 0 and 1")
+		}
+		if o.Inner < 0 || o.Inner > 1 {
+			return nil, errors.New("--inner must be between 0 and 1")
+		}
+
+		o.Direction = direction()
+
+		return o, nil
 	}
+}
 
-	if cropCircle {
-		i = crop.Circle(i, cropSize, direction)
-	} else if cropTriangle {
-		i = crop.Triangle(i, cropSize, direction)
-	} else {
-		i = crop.Square(i, cropSize, direction)
+// parseRatio reads a ratio given as "w:h", such as "16:9".
+func parseRatio(s string) (float64, float64, error) {
+	err := errors.New("--aspect must be of the form w:h")
+
+	w, h, ok := strings.Cut(s, ":")
+	if !ok {
+		return 0, 0, err
 	}
 
-	utils.WriteStdout(i, data)
+	width, werr := strconv.ParseFloat(w, 64)
+	height, herr := strconv.ParseFloat(h, 64)
+	if werr != nil || herr != nil || width <= 0 || height <= 0 {
+		return 0, 0, err
+	}
+
+	return width, height, nil
+}
+
+// directionFlags defines a flag on fs for each Direction, and returns a
+// function giving the one selected. If more than one is given the first in the
+// list wins, Centre is the default so does not need checking.
+func directionFlags(fs *flag.FlagSet) func() utils.Direction {
+	directions := []struct {
+		name      string
+		direction utils.Direction
+		set       bool
+	}{
+		{"centre", utils.Centre, false},
+		{"top", utils.Top, false},
+		{"top-right", utils.TopRight, false},
+		{"right", utils.Right, false},
+		{"bottom-right", utils.BottomRight, false},
+		{"bottom", utils.Bottom, false},
+		{"bottom-left", utils.BottomLeft, false},
+		{"left", utils.Left, false},
+		{"top-left", utils.TopLeft, false},
+	}
+	for i := range directions {
+		fs.BoolVar(&directions[i].set, directions[i].name, false, "")
+	}
+
+	return func() utils.Direction {
+		for _, d := range directions[1:] {
+			if d.set {
+				return d.direction
+			}
+		}
+		return utils.Centre
+	}
 }
@@ -0,0 +1,77 @@
+package cmd
+
+import (
+	"flag"
+	"image"
+
+	"hawx.me/code/hadfield"
+	"hawx.me/code/img/transform"
+)
+
+// FlipOptions are the Options for flip.
+type FlipOptions struct {
+	// Axis is either "horizontal", "vertical", "transpose" or "transverse".
+	Axis string
+}
+
+var flipAxes = map[string]func(image.Image) image.Image{
+	"horizontal": transform.FlipHorizontal,
+	"vertical":   transform.FlipVertical,
+	"transpose":  transform.Transpose,
+	"transverse": transform.Transverse,
+}
+
+var flipOperation = &Operation{
+	Name:       "flip",
+	Run:        runFlip,
+	Composited: true,
+	flags:      flipFlags,
+}
+
+func Flip() *hadfield.Command {
+	cmd := &hadfield.Command{
+		Usage: "flip [options]",
+		Short: "mirror an image",
+		Long: `
+  Flip takes an image from STDIN, and prints a mirrored version to STDOUT.
+
+    --horizontal           # Mirror from left to right (default)
+    --vertical             # Mirror from top to bottom
+    --transpose            # Mirror along the diagonal from the top-left corner
+    --transverse           # Mirror along the diagonal from the top-right corner
+`,
+	}
+
+	return command(cmd, flipOperation)
+}
+
+func runFlip(img image.Image, opts Options) (image.Image, error) {
+	o, ok := opts.(FlipOptions)
+	if !ok || flipAxes[o.Axis] == nil {
+		return nil, optionsError("flip", opts)
+	}
+
+	return flipAxes[o.Axis](img), nil
+}
+
+func flipFlags(fs *flag.FlagSet) func([]string) (Options, error) {
+	var horizontal, vertical, transpose, transverse bool
+
+	fs.BoolVar(&horizontal, "horizontal", false, "")
+	fs.BoolVar(&vertical, "vertical", false, "")
+	fs.BoolVar(&transpose, "transpose", false, "")
+	fs.BoolVar(&transverse, "transverse", false, "")
+
+	return func(args []string) (Options, error) {
+		o := FlipOptions{Axis: "horizontal"}
+		if vertical {
+			o.Axis = "vertical"
+		} else if transpose {
+			o.Axis = "transpose"
+		} else if transverse {
+			o.Axis = "transverse"
+		}
+
+		return o, nil
+	}
+}
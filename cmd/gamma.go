@@ -1,15 +1,28 @@
 package cmd
 
 import (
+	"flag"
+	"image"
+
 	"hawx.me/code/hadfield"
 	"hawx.me/code/img/gamma"
 	"hawx.me/code/img/utils"
 )
 
-var (
-	gammaAuto, gammaUndo bool
-	gammaBy              float64
-)
+// GammaOptions are the Options for gamma.
+type GammaOptions struct {
+	// Auto adjusts the gamma so that the mean value is half, instead of by the
+	// amount given.
+	Auto bool
+	By   float64
+}
+
+var gammaOperation = &Operation{
+	Name:       "gamma",
+	Run:        runGamma,
+	Composable: gammaComposable,
+	flags:      gammaFlags,
+}
 
 func Gamma() *hadfield.Command {
 	cmd := &hadfield.Command{
@@ -25,27 +38,44 @@ func Gamma() *hadfield.Command {
 `,
 	}
 
-	cmd.Run = runGamma
-
-	cmd.Flag.BoolVar(&gammaAuto, "auto", false, "")
-	cmd.Flag.Float64Var(&gammaBy, "by", 1.8, "")
-	cmd.Flag.BoolVar(&gammaUndo, "undo", false, "")
-
-	return cmd
+	return command(cmd, gammaOperation)
 }
 
-func runGamma(cmd *hadfield.Command, args []string) {
-	i, data := utils.ReadStdin()
+func runGamma(img image.Image, opts Options) (image.Image, error) {
+	o, ok := opts.(GammaOptions)
+	if !ok {
+		return nil, optionsError("gamma", opts)
+	}
 
-	if gammaUndo {
-		gammaBy = 1.0 / gammaBy
+	if o.Auto {
+		return gamma.Auto(img), nil
 	}
+	return gamma.Adjust(img, o.By), nil
+}
 
-	if utils.FlagVisited("by", cmd.Flag) {
-		i = gamma.Adjust(i, gammaBy)
-	} else {
-		i = gamma.Auto(i)
+// The automatic adjustment depends on the values in the image, so can't be
+// composed.
+func gammaComposable(opts Options) utils.Composable {
+	o, ok := opts.(GammaOptions)
+	if !ok || o.Auto {
+		return nil
 	}
+	return gamma.AdjustC(o.By)
+}
 
-	utils.WriteStdout(i, data)
+func gammaFlags(fs *flag.FlagSet) func([]string) (Options, error) {
+	var o GammaOptions
+	var auto, undo bool
+
+	fs.BoolVar(&auto, "auto", false, "")
+	fs.Float64Var(&o.By, "by", 1.8, "")
+	fs.BoolVar(&undo, "undo", false, "")
+
+	return func(args []string) (Options, error) {
+		o.Auto = !utils.FlagVisited("by", *fs)
+		if undo {
+			o.By = 1.0 / o.By
+		}
+		return o, nil
+	}
 }
@@ -1,16 +1,38 @@
 package cmd
 
 import (
+	"flag"
+
 	"hawx.me/code/hadfield"
 	"hawx.me/code/img/greyscale"
 	"hawx.me/code/img/utils"
 )
 
-var (
-	greyscaleAverage, greyscaleLightness, greyscaleLuminosity bool
-	greyscaleRed, greyscaleGreen, greyscaleBlue               bool
-	greyscaleMaximal, greyscaleMinimal, greyscalePhotoshop    bool
-)
+// GreyscaleOptions are the Options for greyscale.
+type GreyscaleOptions struct {
+	// Method is the name of the flag selecting the method to use, for example
+	// "luminosity", or "" for the default.
+	Method string
+}
+
+var greyscaleMethods = map[string]func() utils.Composable{
+	"":           greyscale.GreyscaleC,
+	"average":    greyscale.AverageC,
+	"lightness":  greyscale.LightnessC,
+	"luminosity": greyscale.LuminosityC,
+	"maximal":    greyscale.MaximalC,
+	"minimal":    greyscale.MinimalC,
+	"red":        greyscale.RedC,
+	"green":      greyscale.GreenC,
+	"blue":       greyscale.BlueC,
+}
+
+var greyscaleOperation = &Operation{
+	Name:       "greyscale",
+	Run:        runComposable("greyscale", greyscaleComposable),
+	Composable: greyscaleComposable,
+	flags:      greyscaleFlags,
+}
 
 func Greyscale() *hadfield.Command {
 	cmd := &hadfield.Command{
@@ -30,42 +52,34 @@ func Greyscale() *hadfield.Command {
 `,
 	}
 
-	cmd.Run = runGreyscale
-
-	cmd.Flag.BoolVar(&greyscaleAverage, "average", false, "")
-	cmd.Flag.BoolVar(&greyscaleLightness, "lightness", false, "")
-	cmd.Flag.BoolVar(&greyscaleLuminosity, "luminosity", false, "")
-	cmd.Flag.BoolVar(&greyscaleMaximal, "maximal", false, "")
-	cmd.Flag.BoolVar(&greyscaleMinimal, "minimal", false, "")
-	cmd.Flag.BoolVar(&greyscaleRed, "red", false, "")
-	cmd.Flag.BoolVar(&greyscaleGreen, "green", false, "")
-	cmd.Flag.BoolVar(&greyscaleBlue, "blue", false, "")
+	return command(cmd, greyscaleOperation)
+}
 
-	return cmd
+func greyscaleComposable(opts Options) utils.Composable {
+	o, ok := opts.(GreyscaleOptions)
+	if !ok || greyscaleMethods[o.Method] == nil {
+		return nil
+	}
+	return greyscaleMethods[o.Method]()
 }
 
-func runGreyscale(cmd *hadfield.Command, args []string) {
-	i, data := utils.ReadStdin()
+func greyscaleFlags(fs *flag.FlagSet) func([]string) (Options, error) {
+	methods := []string{
+		"average", "lightness", "luminosity", "maximal", "minimal",
+		"red", "green", "blue",
+	}
 
-	if greyscaleAverage {
-		i = greyscale.Average(i)
-	} else if greyscaleLightness {
-		i = greyscale.Lightness(i)
-	} else if greyscaleLuminosity {
-		i = greyscale.Luminosity(i)
-	} else if greyscaleMaximal {
-		i = greyscale.Maximal(i)
-	} else if greyscaleMinimal {
-		i = greyscale.Minimal(i)
-	} else if greyscaleRed {
-		i = greyscale.Red(i)
-	} else if greyscaleGreen {
-		i = greyscale.Green(i)
-	} else if greyscaleBlue {
-		i = greyscale.Blue(i)
-	} else {
-		i = greyscale.Greyscale(i)
+	set := make([]bool, len(methods))
+	for i, method := range methods {
+		fs.BoolVar(&set[i], method, false, "")
 	}
 
-	utils.WriteStdout(i, data)
+	return func(args []string) (Options, error) {
+		for i, method := range methods {
+			if set[i] {
+				return GreyscaleOptions{Method: method}, nil
+			}
+		}
+		return GreyscaleOptions{}, nil
+	}
 }
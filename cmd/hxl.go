@@ -1,14 +1,26 @@
 package cmd
 
 import (
+	"flag"
+	"image"
+
 	"hawx.me/code/hadfield"
 	"hawx.me/code/img/pixelate"
 	"hawx.me/code/img/utils"
 )
 
-var (
-	hxlWidth, hxlCols int
-)
+// HxlOptions are the Options for hxl. If Cols is greater than 0 it is used to
+// calculate the width, instead of Width.
+type HxlOptions struct {
+	Width, Cols int
+}
+
+var hxlOperation = &Operation{
+	Name:       "hxl",
+	Run:        runHxl,
+	Composited: true,
+	flags:      hxlFlags,
+}
 
 func Hxl() *hadfield.Command {
 	cmd := &hadfield.Command{
@@ -23,21 +35,29 @@ func Hxl() *hadfield.Command {
 `,
 	}
 
-	cmd.Run = runHxl
+	return command(cmd, hxlOperation)
+}
 
-	cmd.Flag.IntVar(&hxlCols, "cols", -1, "")
-	cmd.Flag.IntVar(&hxlWidth, "width", 20, "")
+func runHxl(img image.Image, opts Options) (image.Image, error) {
+	o, ok := opts.(HxlOptions)
+	if !ok {
+		return nil, optionsError("hxl", opts)
+	}
+
+	if o.Cols > 0 {
+		o.Width = utils.SizeForCols(img, o.Cols).W
+	}
 
-	return cmd
+	return pixelate.Hxl(img, o.Width), nil
 }
 
-func runHxl(cmd *hadfield.Command, args []string) {
-	i, data := utils.ReadStdin()
+func hxlFlags(fs *flag.FlagSet) func([]string) (Options, error) {
+	var o HxlOptions
 
-	if hxlCols > 0 {
-		hxlWidth = utils.SizeForCols(i, hxlCols).W
-	}
+	fs.IntVar(&o.Cols, "cols", -1, "")
+	fs.IntVar(&o.Width, "width", 20, "")
 
-	i = pixelate.Hxl(i, hxlWidth)
-	utils.WriteStdout(i, data)
+	return func(args []string) (Options, error) {
+		return o, nil
+	}
 }
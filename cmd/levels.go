@@ -1,6 +1,7 @@
 package cmd
 
 import (
+	"flag"
 	"image"
 
 	"hawx.me/code/hadfield"
@@ -9,12 +10,21 @@ import (
 	"hawx.me/code/img/utils"
 )
 
-var (
-	levelsRed, levelsGreen, levelsBlue           bool
-	levelsAuto, levelsAutoBlack, levelsAutoWhite bool
-	levelsBlack, levelsWhite                     float64
-	levelsCurve                                  string
-)
+// LevelsOptions are the Options for levels. Only one adjustment is made, in
+// the order of the fields; Black and White have no effect at 0 and 100.
+type LevelsOptions struct {
+	Channels                   []channel.Channel
+	Auto, AutoBlack, AutoWhite bool
+	Black, White               float64
+	Curve                      *levels.Curve
+}
+
+var levelsOperation = &Operation{
+	Name:       "levels",
+	Run:        runLevels,
+	Composable: levelsComposable,
+	flags:      levelsFlags,
+}
 
 func Levels() *hadfield.Command {
 	cmd := &hadfield.Command{
@@ -41,69 +51,90 @@ func Levels() *hadfield.Command {
 `,
 	}
 
-	cmd.Run = runLevels
-
-	cmd.Flag.BoolVar(&levelsRed, "red", false, "")
-	cmd.Flag.BoolVar(&levelsGreen, "green", false, "")
-	cmd.Flag.BoolVar(&levelsBlue, "blue", false, "")
-
-	cmd.Flag.BoolVar(&levelsAuto, "auto", false, "")
-	cmd.Flag.BoolVar(&levelsAutoBlack, "auto-black", false, "")
-	cmd.Flag.BoolVar(&levelsAutoWhite, "auto-white", false, "")
-
-	cmd.Flag.Float64Var(&levelsBlack, "black", 0, "")
-	cmd.Flag.Float64Var(&levelsWhite, "white", 100, "")
-
-	cmd.Flag.StringVar(&levelsCurve, "curve", "", "")
-
-	return cmd
+	return command(cmd, levelsOperation)
 }
 
-func runLevels(cmd *hadfield.Command, args []string) {
-	i, data := utils.ReadStdin()
-
-	if !levelsRed && !levelsGreen && !levelsBlue {
-		levelsRed = true
-		levelsGreen = true
-		levelsBlue = true
+func runLevels(img image.Image, opts Options) (image.Image, error) {
+	o, ok := opts.(LevelsOptions)
+	if !ok {
+		return nil, optionsError("levels", opts)
 	}
 
-	if levelsRed {
-		i = runLevelsOnChannel(cmd, args, i, channel.Red)
+	var auto func(image.Image, channel.Channel) image.Image
+	if o.Auto {
+		auto = levels.Auto
+	} else if o.AutoBlack {
+		auto = levels.AutoBlack
+	} else if o.AutoWhite {
+		auto = levels.AutoWhite
 	}
 
-	if levelsGreen {
-		i = runLevelsOnChannel(cmd, args, i, channel.Green)
+	if auto == nil {
+		return utils.MapColor(img, levelsComposable(o)), nil
 	}
 
-	if levelsBlue {
-		i = runLevelsOnChannel(cmd, args, i, channel.Blue)
+	for _, ch := range o.Channels {
+		img = auto(img, ch)
 	}
-
-	utils.WriteStdout(i, data)
+	return img, nil
 }
 
-func runLevelsOnChannel(cmd *hadfield.Command, args []string, img image.Image,
-	ch channel.Channel) image.Image {
-
-	if levelsAuto {
-		img = levels.Auto(img, ch)
-
-	} else if levelsAutoBlack {
-		img = levels.AutoBlack(img, ch)
-
-	} else if levelsAutoWhite {
-		img = levels.AutoWhite(img, ch)
+// The automatic adjustments depend on the values in the image, so can't be
+// composed.
+func levelsComposable(opts Options) utils.Composable {
+	o, ok := opts.(LevelsOptions)
+	if !ok || o.Auto || o.AutoBlack || o.AutoWhite {
+		return nil
+	}
 
-	} else if utils.FlagVisited("black", cmd.Flag) {
-		img = levels.SetBlack(img, ch, levelsBlack)
+	fs := []utils.Composable{}
+	for _, ch := range o.Channels {
+		if o.Black != 0 {
+			fs = append(fs, levels.SetBlackC(ch, o.Black))
+		} else if o.White != 100 {
+			fs = append(fs, levels.SetWhiteC(ch, o.White))
+		} else if o.Curve != nil {
+			fs = append(fs, levels.SetCurveC(ch, o.Curve))
+		}
+	}
 
-	} else if utils.FlagVisited("white", cmd.Flag) {
-		img = levels.SetWhite(img, ch, levelsWhite)
+	return utils.Compose(fs...)
+}
 
-	} else if utils.FlagVisited("curve", cmd.Flag) {
-		img = levels.SetCurve(img, ch, levels.ParseCurveString(levelsCurve))
+func levelsFlags(fs *flag.FlagSet) func([]string) (Options, error) {
+	var o LevelsOptions
+	var red, green, blue bool
+	var curve string
+
+	fs.BoolVar(&red, "red", false, "")
+	fs.BoolVar(&green, "green", false, "")
+	fs.BoolVar(&blue, "blue", false, "")
+	fs.BoolVar(&o.Auto, "auto", false, "")
+	fs.BoolVar(&o.AutoBlack, "auto-black", false, "")
+	fs.BoolVar(&o.AutoWhite, "auto-white", false, "")
+	fs.Float64Var(&o.Black, "black", 0, "")
+	fs.Float64Var(&o.White, "white", 100, "")
+	fs.StringVar(&curve, "curve", "", "")
+
+	return func(args []string) (Options, error) {
+		if !red && !green && !blue {
+			red, green, blue = true, true, true
+		}
+
+		if red {
+			o.Channels = append(o.Channels, channel.Red)
+		}
+		if green {
+			o.Channels = append(o.Channels, channel.Green)
+		}
+		if blue {
+			o.Channels = append(o.Channels, channel.Blue)
+		}
+
+		if utils.FlagVisited("curve", *fs) {
+			o.Curve = levels.ParseCurveString(curve)
+		}
+
+		return o, nil
 	}
-
-	return img
 }
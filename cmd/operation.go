@@ -0,0 +1,299 @@
+// Package cmd implements the builtin commands of img. The work done by each
+// command is also available as an Operation, so that it can be used from Go
+// without reading from STDIN or writing to STDOUT, for example
+//
+//	img, _, _ := utils.ReadFile("in.png")
+//	img, err := cmd.Lookup("blur").Run(img, cmd.BlurOptions{Radius: 3, Sigma: 2})
+package cmd
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"image"
+	"io"
+	"io/ioutil"
+	"os"
+	"sort"
+	"strconv"
+
+	"hawx.me/code/hadfield"
+	"hawx.me/code/img/cache"
+	"hawx.me/code/img/utils"
+)
+
+// Options are the settings for an Operation. Each command has its own type of
+// Options, for example blur uses BlurOptions.
+type Options interface{}
+
+// An Operation is the work done by a command, separate from reading the image
+// from STDIN and writing the result to STDOUT, so that it can be used from Go.
+type Operation struct {
+	// Name is the name of the command.
+	Name string
+
+	// Run performs the operation on an image, or a frame of an animation.
+	Run func(image.Image, Options) (image.Image, error)
+
+	// Composited is true if Run must be given whole frames of an animation,
+	// rather than just the part that changes, because it moves pixels or looks
+	// at their neighbours.
+	Composited bool
+
+	// Composable, if not nil, returns the operation as a function on each pixel
+	// so that it can be performed in the same pass as other operations. It
+	// returns nil if this isn't possible with the options given.
+	Composable func(Options) utils.Composable
+
+	// Meta, if not nil, sets any options that depend on the metadata of the
+	// image, and updates the metadata to match the result. Changes to the
+	// fields of the metadata are only kept if Run succeeds.
+	Meta func(Options, *utils.Meta) Options
+
+	// flags defines the flags of the command on fs, and returns a function to
+	// create the Options once they have been parsed.
+	flags func(fs *flag.FlagSet) func(args []string) (Options, error)
+}
+
+// Parse creates the Options for the operation from the arguments that would be
+// given to the command.
+func (op *Operation) Parse(args []string) (Options, error) {
+	fs := flag.NewFlagSet(op.Name, flag.ContinueOnError)
+	fs.SetOutput(ioutil.Discard)
+
+	options := op.flags(fs)
+	if err := fs.Parse(args); err != nil {
+		return nil, err
+	}
+
+	return options(fs.Args())
+}
+
+// parseFlags parses args as the flags of the command, without creating the
+// Options, so that a bad value can be found before the flags are checked
+// together.
+func (op *Operation) parseFlags(args []string) error {
+	fs := flag.NewFlagSet(op.Name, flag.ContinueOnError)
+	fs.SetOutput(ioutil.Discard)
+	op.flags(fs)
+
+	return fs.Parse(args)
+}
+
+// Args converts named parameters, such as those from a query string, to the
+// arguments expected by Parse. A parameter without a value is given as the flag
+// on its own if it is boolean. An error is returned if a parameter is not a
+// flag of the command, or is missing a value that it requires.
+func (op *Operation) Args(params map[string][]string) ([]string, error) {
+	fs := flag.NewFlagSet(op.Name, flag.ContinueOnError)
+	op.flags(fs)
+
+	names := make([]string, 0, len(params))
+	for name := range params {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var args []string
+	for _, name := range names {
+		f := fs.Lookup(name)
+		if f == nil {
+			return nil, fmt.Errorf("%s: unknown option %q", op.Name, name)
+		}
+
+		for _, value := range params[name] {
+			if value == "" {
+				if b, ok := f.Value.(interface{ IsBoolFlag() bool }); ok && b.IsBoolFlag() {
+					args = append(args, "--"+name)
+					continue
+				}
+				return nil, fmt.Errorf("%s: missing value for %q", op.Name, name)
+			}
+			args = append(args, "--"+name+"="+value)
+		}
+	}
+
+	return args, nil
+}
+
+// Apply performs the operation on an image read with utils.Read. If the image
+// is animated the operation is performed on each frame.
+func (op *Operation) Apply(img image.Image, opts Options, data *utils.Meta) (image.Image, error) {
+	updated := *data
+	if op.Meta != nil {
+		opts = op.Meta(opts, &updated)
+	}
+
+	var err error
+	f := func(i image.Image) image.Image {
+		if err != nil {
+			return i
+		}
+
+		out, ferr := op.Run(i, opts)
+		if ferr != nil {
+			err = ferr
+			return i
+		}
+		return out
+	}
+
+	if op.Composited {
+		img = data.ApplyComposited(img, f)
+	} else {
+		img = data.Apply(img, f)
+	}
+
+	if err == nil {
+		*data = updated
+	}
+	return img, err
+}
+
+// runComposable returns a function, suitable for Operation.Run, that applies the
+// Composable returned by f to every pixel.
+func runComposable(name string, f func(Options) utils.Composable) func(image.Image, Options) (image.Image, error) {
+	return func(img image.Image, opts Options) (image.Image, error) {
+		c := f(opts)
+		if c == nil {
+			return nil, optionsError(name, opts)
+		}
+		return utils.MapColor(img, c), nil
+	}
+}
+
+// optionsError is returned by Run when given Options of the wrong type.
+func optionsError(name string, opts Options) error {
+	return fmt.Errorf("%s: unexpected options of type %T", name, opts)
+}
+
+var operations = map[string]*Operation{}
+
+func init() {
+	for _, op := range []*Operation{
+		blendOperation,
+		blurOperation,
+		carveOperation,
+		channelOperation,
+		contrastOperation,
+		convertProfileOperation,
+		cropOperation,
+		flipOperation,
+		gammaOperation,
+		greyscaleOperation,
+		hxlOperation,
+		levelsOperation,
+		orientOperation,
+		pixelateOperation,
+		pxlOperation,
+		resizeOperation,
+		rotateOperation,
+		sharpenOperation,
+		shuffleOperation,
+		tintOperation,
+		vibranceOperation,
+		vxlOperation,
+	} {
+		operations[op.Name] = op
+	}
+}
+
+// Lookup returns the Operation for the named builtin command, or nil if there
+// is no such command.
+func Lookup(name string) *Operation {
+	return operations[name]
+}
+
+// Names returns the names of all of the builtin commands with an Operation, in
+// alphabetical order.
+func Names() []string {
+	names := make([]string, 0, len(operations))
+	for name := range operations {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	return names
+}
+
+// run reads an image from STDIN, passes it to f, then prints the result to
+// STDOUT. If ResultCache is set the result is stored under the command's name
+// and normalised arguments, and a stored result is printed instead of calling f
+// if there is one.
+func run(name string, args []string, f func(image.Image, *utils.Meta) (image.Image, error)) {
+	var input io.Reader = os.Stdin
+
+	var key string
+	if ResultCache != nil {
+		// The input is buffered so that it can be read again after finding the
+		// key.
+		buf, err := utils.NewBuffer(os.Stdin)
+		if err != nil {
+			utils.Fatal(err)
+		}
+		defer buf.Close()
+
+		// The output format and options change the result, so are part of the
+		// key.
+		key, err = cache.Key(buf, name, append(args, utils.OutputArg(), strconv.FormatBool(AutoOrient)))
+		if err != nil {
+			utils.Fatal(err)
+		}
+
+		if result, ok := ResultCache.Get(key); ok {
+			os.Stdout.Write(result)
+			return
+		}
+
+		if err = buf.Rewind(); err != nil {
+			utils.Fatal(err)
+		}
+		input = buf
+	}
+
+	i, data, err := utils.Read(input)
+	if err != nil {
+		utils.Fatal(err)
+	}
+
+	if i, err = autoOrient(i, &data); err != nil {
+		utils.Fatal(err)
+	}
+
+	if i, err = f(i, &data); err != nil {
+		utils.Fatal(err)
+	}
+
+	var result bytes.Buffer
+	if err := utils.Write(&result, i, data); err != nil {
+		utils.Fatal(err)
+	}
+
+	if ResultCache != nil {
+		if err := ResultCache.Put(key, result.Bytes()); err != nil {
+			utils.Warn("img: cache:", err)
+		}
+	}
+
+	os.Stdout.Write(result.Bytes())
+}
+
+// command sets cmd to parse its flags into Options for op, then perform it on
+// the image read from STDIN, printing the result to STDOUT; see run.
+func command(cmd *hadfield.Command, op *Operation) *hadfield.Command {
+	options := op.flags(&cmd.Flag)
+
+	cmd.Run = func(cmd *hadfield.Command, args []string) {
+		opts, err := options(args)
+		if err != nil {
+			utils.Warn(err)
+			os.Exit(2)
+		}
+
+		run(op.Name, normalise(&cmd.Flag, args), func(i image.Image, data *utils.Meta) (image.Image, error) {
+			return op.Apply(i, opts, data)
+		})
+	}
+
+	return cmd
+}
@@ -0,0 +1,99 @@
+package cmd
+
+import (
+	"flag"
+	"image"
+	"strconv"
+
+	"hawx.me/code/hadfield"
+	"hawx.me/code/img/transform"
+	"hawx.me/code/img/utils"
+)
+
+// AutoOrient, if true, turns each image the right way up, as orient does,
+// before a command is run on it.
+var AutoOrient bool
+
+// OrientOptions are the Options for orient.
+type OrientOptions struct {
+	// Orientation is the exif orientation the image was stored with, from 1 to
+	// 8. It is read from the metadata of the image by Apply.
+	Orientation int
+}
+
+var orientOperation = &Operation{
+	Name:       "orient",
+	Run:        runOrient,
+	Composited: true,
+	Meta:       orientMeta,
+	flags:      orientFlags,
+}
+
+func Orient() *hadfield.Command {
+	cmd := &hadfield.Command{
+		Usage: "orient",
+		Short: "turn an image the right way up",
+		Long: `
+  Orient takes an image from STDIN, rotates and flips it so that it is the right
+  way up according to the Orientation in its exif data, and prints the result
+  to STDOUT. The Orientation is then reset so that the image is not turned
+  again when displayed.
+
+  Give --auto-orient before any command to do this first, for example
+
+    img --auto-orient resize --width 800 < photo.jpg > small.jpg
+`,
+	}
+
+	return command(cmd, orientOperation)
+}
+
+func runOrient(img image.Image, opts Options) (image.Image, error) {
+	o, ok := opts.(OrientOptions)
+	if !ok {
+		return nil, optionsError("orient", opts)
+	}
+
+	return transform.Orient(img, o.Orientation), nil
+}
+
+// orientMeta reads the orientation from the exif data, then resets it as the
+// image will be the right way up.
+func orientMeta(opts Options, data *utils.Meta) Options {
+	o, ok := opts.(OrientOptions)
+	if !ok || data.Exif == nil {
+		return opts
+	}
+
+	o.Orientation, _ = strconv.Atoi(data.Exif.Get("Orientation"))
+	if o.Orientation <= 1 || o.Orientation > 8 {
+		return o
+	}
+
+	data.Exif.Set("Orientation", "1")
+
+	if transform.Swaps(o.Orientation) {
+		width, height := data.Exif.Get("ExifImageWidth"), data.Exif.Get("ExifImageHeight")
+		if width != "" && height != "" {
+			data.Exif.Set("ExifImageWidth", height)
+			data.Exif.Set("ExifImageHeight", width)
+		}
+	}
+
+	return o
+}
+
+func orientFlags(fs *flag.FlagSet) func([]string) (Options, error) {
+	return func(args []string) (Options, error) {
+		return OrientOptions{}, nil
+	}
+}
+
+// autoOrient turns the image the right way up if AutoOrient is set.
+func autoOrient(img image.Image, data *utils.Meta) (image.Image, error) {
+	if !AutoOrient {
+		return img, nil
+	}
+
+	return orientOperation.Apply(img, OrientOptions{}, data)
+}
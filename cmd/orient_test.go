@@ -0,0 +1,39 @@
+package cmd
+
+import (
+	"image"
+	"strconv"
+	"testing"
+
+	"hawx.me/code/img/exif"
+	"hawx.me/code/img/utils"
+)
+
+func TestOrientMeta(t *testing.T) {
+	for orientation := 1; orientation <= 8; orientation++ {
+		data := &utils.Meta{Exif: exif.New()}
+		data.Exif.Set("Orientation", strconv.Itoa(orientation))
+		data.Exif.Set("ExifImageWidth", "2")
+		data.Exif.Set("ExifImageHeight", "3")
+
+		out, err := orientOperation.Apply(image.NewGray(image.Rect(0, 0, 2, 3)), OrientOptions{}, data)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if got := data.Exif.Get("Orientation"); got != "1" {
+			t.Errorf("orientation %d: expected Orientation reset to 1, got %q", orientation, got)
+		}
+
+		wantW, wantH := "2", "3"
+		if orientation >= 5 {
+			wantW, wantH = "3", "2"
+		}
+		if w, h := data.Exif.Get("ExifImageWidth"), data.Exif.Get("ExifImageHeight"); w != wantW || h != wantH {
+			t.Errorf("orientation %d: expected exif size %sx%s, got %sx%s", orientation, wantW, wantH, w, h)
+		}
+		if size := out.Bounds().Size(); strconv.Itoa(size.X) != wantW || strconv.Itoa(size.Y) != wantH {
+			t.Errorf("orientation %d: expected image size %sx%s, got %v", orientation, wantW, wantH, size)
+		}
+	}
+}
@@ -0,0 +1,210 @@
+package cmd
+
+import (
+	"errors"
+	"image"
+	"os"
+	"strings"
+	"unicode"
+
+	"hawx.me/code/hadfield"
+	"hawx.me/code/img/utils"
+)
+
+func Pipe() *hadfield.Command {
+	cmd := &hadfield.Command{
+		Usage: "pipe <commands>",
+		Short: "run a chain of commands",
+		Long: `
+  Pipe takes an image from STDIN, runs each of the commands given on it in turn,
+  and prints the result to STDOUT. It is the same as piping the image through
+  each command separately, but the image is only decoded and encoded once, so
+  no precision or metadata is lost between steps. Commands that only change the
+  colour of each pixel, such as greyscale or contrast, are run in a single pass.
+
+  The commands are separated by '|' and take the same options as when run on
+  their own, for example
+
+    img pipe 'greyscale --red | contrast --linear --factor 1.5 | tint --with #83121344'
+
+  Only the builtin commands can be used.
+`,
+	}
+
+	cmd.Run = runPipe
+
+	return cmd
+}
+
+func runPipe(cmd *hadfield.Command, args []string) {
+	// Allow the whole pipe to be given as a single quoted argument, or as
+	// separate arguments with '|' between each command.
+	if len(args) == 1 {
+		var err error
+		if args, err = splitPipe(args[0]); err != nil {
+			utils.Warn("pipe:", err)
+			os.Exit(2)
+		}
+	}
+
+	if err := runSteps("pipe", args); err != nil {
+		utils.Warn("pipe:", err)
+		os.Exit(2)
+	}
+}
+
+// runSteps runs the commands in args, separated by "|", on the image read from
+// STDIN, printing the result to STDOUT; see run. An error is returned, before
+// reading the image, if the commands are not valid.
+func runSteps(name string, args []string) error {
+	steps, err := parsePipe(args)
+	if err != nil {
+		return err
+	}
+
+	// The key for the cache is made of the normalised arguments of each
+	// command.
+	var key []string
+	for _, part := range splitArgs(args, "|") {
+		key = append(key, part[0])
+		key = append(key, Lookup(part[0]).normalise(part[1:])...)
+		key = append(key, "|")
+	}
+
+	run(name, key, func(i image.Image, data *utils.Meta) (image.Image, error) {
+		var err error
+		for _, s := range steps {
+			if i, err = s.op.Apply(i, s.opts, data); err != nil {
+				return nil, err
+			}
+		}
+		return i, nil
+	})
+
+	return nil
+}
+
+// A pipeStep is an operation in a pipe, along with its options.
+type pipeStep struct {
+	op   *Operation
+	opts Options
+}
+
+// parsePipe creates the steps for the commands in args, which are separated by
+// "|". Consecutive composable operations are joined together into a single
+// step.
+func parsePipe(args []string) ([]pipeStep, error) {
+	var steps []pipeStep
+	var composables []utils.Composable
+
+	// Joins the pending composable operations, if there are any.
+	flush := func() {
+		if len(composables) > 0 {
+			steps = append(steps, composedStep(utils.Compose(composables...)))
+			composables = nil
+		}
+	}
+
+	for _, part := range splitArgs(args, "|") {
+		if len(part) == 0 {
+			return nil, errors.New("empty command")
+		}
+
+		op := Lookup(part[0])
+		if op == nil {
+			return nil, errors.New("unknown command " + part[0])
+		}
+
+		opts, err := op.Parse(part[1:])
+		if err != nil {
+			return nil, errors.New(op.Name + ": " + err.Error())
+		}
+
+		if op.Composable != nil {
+			if f := op.Composable(opts); f != nil {
+				composables = append(composables, f)
+				continue
+			}
+		}
+
+		flush()
+		steps = append(steps, pipeStep{op, opts})
+	}
+	flush()
+
+	return steps, nil
+}
+
+// composedStep returns a step that applies f to every pixel.
+func composedStep(f utils.Composable) pipeStep {
+	op := &Operation{
+		Name: "pipe",
+		Run: func(img image.Image, opts Options) (image.Image, error) {
+			return utils.MapColor(img, f), nil
+		},
+	}
+
+	return pipeStep{op, nil}
+}
+
+// splitArgs splits args into groups separated by sep.
+func splitArgs(args []string, sep string) [][]string {
+	groups := [][]string{{}}
+
+	for _, arg := range args {
+		if arg == sep {
+			groups = append(groups, []string{})
+			continue
+		}
+		groups[len(groups)-1] = append(groups[len(groups)-1], arg)
+	}
+
+	return groups
+}
+
+// splitPipe splits a pipe given as a single string into arguments, in the same
+// way as a shell would. Arguments can be quoted with ' or ", and an unquoted |
+// is always returned as a separate argument.
+func splitPipe(s string) ([]string, error) {
+	var args []string
+	var arg strings.Builder
+	var quote rune
+	inArg := false
+
+	end := func() {
+		if inArg {
+			args = append(args, arg.String())
+			arg.Reset()
+			inArg = false
+		}
+	}
+
+	for _, r := range s {
+		switch {
+		case quote != 0:
+			if r == quote {
+				quote = 0
+			} else {
+				arg.WriteRune(r)
+			}
+		case r == '\'' || r == '"':
+			quote = r
+			inArg = true
+		case r == '|':
+			end()
+			args = append(args, "|")
+		case unicode.IsSpace(r):
+			end()
+		default:
+			arg.WriteRune(r)
+			inArg = true
+		}
+	}
+
+	if quote != 0 {
+		return nil, errors.New("unterminated quote")
+	}
+	end()
+
+	return args, nil
+}
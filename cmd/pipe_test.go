@@ -0,0 +1,135 @@
+package cmd
+
+import (
+	"image"
+	"image/color"
+	"reflect"
+	"strings"
+	"testing"
+
+	"hawx.me/code/img/tint"
+)
+
+func TestSplitPipe(t *testing.T) {
+	testCases := []struct {
+		in   string
+		args []string
+		err  string
+	}{
+		{"", nil, ""},
+		{"greyscale", []string{"greyscale"}, ""},
+		{"  greyscale   --red ", []string{"greyscale", "--red"}, ""},
+		{"greyscale|tint", []string{"greyscale", "|", "tint"}, ""},
+		{"greyscale | tint --with #fff", []string{"greyscale", "|", "tint", "--with", "#fff"}, ""},
+		{"tint --with 'rgb(1, 2, 3)'", []string{"tint", "--with", "rgb(1, 2, 3)"}, ""},
+		{`tint --with "rgb(1, 2, 3)"`, []string{"tint", "--with", "rgb(1, 2, 3)"}, ""},
+		{`a 'b | c' "d|e"`, []string{"a", "b | c", "d|e"}, ""},
+		{`a "it's" 'say "hi"'`, []string{"a", "it's", `say "hi"`}, ""},
+		{`a --x='' b`, []string{"a", "--x=", "b"}, ""},
+		{`a ''`, []string{"a", ""}, ""},
+		{"| |", []string{"|", "|"}, ""},
+		{"a 'b", nil, "unterminated quote"},
+		{`a "b | c`, nil, "unterminated quote"},
+	}
+
+	for _, tc := range testCases {
+		args, err := splitPipe(tc.in)
+		if tc.err != "" {
+			if err == nil || err.Error() != tc.err {
+				t.Errorf("%q: expected error %q, got %v", tc.in, tc.err, err)
+			}
+			continue
+		}
+
+		if err != nil {
+			t.Errorf("%q: unexpected error %v", tc.in, err)
+		} else if !reflect.DeepEqual(args, tc.args) {
+			t.Errorf("%q: expected %q, got %q", tc.in, tc.args, args)
+		}
+	}
+}
+
+func TestParsePipe(t *testing.T) {
+	testCases := []struct {
+		in    string
+		steps []string
+		err   string
+	}{
+		{"greyscale", []string{"pipe"}, ""},
+		{"blur", []string{"blur"}, ""},
+		{"greyscale | contrast | tint", []string{"pipe"}, ""},
+		{"greyscale | blur | tint", []string{"pipe", "blur", "pipe"}, ""},
+		{"blur --radius 3 | greyscale | contrast | blur", []string{"blur", "pipe", "blur"}, ""},
+		{"", nil, "empty command"},
+		{"greyscale |", nil, "empty command"},
+		{"| greyscale", nil, "empty command"},
+		{"greyscale | | tint", nil, "empty command"},
+		{"spin", nil, "unknown command spin"},
+		{"greyscale | spin --fast", nil, "unknown command spin"},
+		{"blur --nope", nil, "blur: "},
+		{"greyscale | tint --with nope", nil, "tint: "},
+	}
+
+	for _, tc := range testCases {
+		args, err := splitPipe(tc.in)
+		if err != nil {
+			t.Fatalf("%q: %v", tc.in, err)
+		}
+
+		steps, err := parsePipe(args)
+		if tc.err != "" {
+			if err == nil || !strings.HasPrefix(err.Error(), tc.err) {
+				t.Errorf("%q: expected error %q, got %v", tc.in, tc.err, err)
+			}
+			continue
+		}
+
+		if err != nil {
+			t.Errorf("%q: unexpected error %v", tc.in, err)
+			continue
+		}
+
+		var names []string
+		for _, s := range steps {
+			names = append(names, s.op.Name)
+		}
+		if !reflect.DeepEqual(names, tc.steps) {
+			t.Errorf("%q: expected steps %v, got %v", tc.in, tc.steps, names)
+		}
+	}
+}
+
+func TestPipeTint(t *testing.T) {
+	img := image.NewRGBA(image.Rect(0, 0, 4, 4))
+	for y := 0; y < 4; y++ {
+		for x := 0; x < 4; x++ {
+			img.Set(x, y, color.RGBA{uint8(x * 60), uint8(y * 60), 100, 255})
+		}
+	}
+
+	args := []string{"tint", "--with", "rgba(32,64,128,128)"}
+
+	opts, err := tintOperation.Parse(args[1:])
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	steps, err := parsePipe(args)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := steps[0].op.Run(img, steps[0].opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := tint.Tint(img, opts.(TintOptions).With)
+	for y := 0; y < 4; y++ {
+		for x := 0; x < 4; x++ {
+			if g, e := got.At(x, y), expected.At(x, y); g != e {
+				t.Errorf("(%d, %d): expected %v, got %v", x, y, e, g)
+			}
+		}
+	}
+}
@@ -1,16 +1,28 @@
 package cmd
 
 import (
+	"flag"
+	"image"
+
 	"hawx.me/code/hadfield"
 	"hawx.me/code/img/pixelate"
 	"hawx.me/code/img/utils"
 )
 
-var (
-	pixelateCrop               bool
-	pixelateSize               utils.Dimension = utils.Dimension{20, 20}
-	pixelateRows, pixelateCols int
-)
+// PixelateOptions are the Options for pixelate. If Rows or Cols are greater
+// than 0 they are used to calculate the size, instead of Size.
+type PixelateOptions struct {
+	Size       utils.Dimension
+	Rows, Cols int
+	Style      pixelate.Style
+}
+
+var pixelateOperation = &Operation{
+	Name:       "pixelate",
+	Run:        runPixelate,
+	Composited: true,
+	flags:      pixelateFlags,
+}
 
 func Pixelate() *hadfield.Command {
 	cmd := &hadfield.Command{
@@ -27,34 +39,43 @@ func Pixelate() *hadfield.Command {
 `,
 	}
 
-	cmd.Run = runPixelate
+	return command(cmd, pixelateOperation)
+}
+
+func runPixelate(img image.Image, opts Options) (image.Image, error) {
+	o, ok := opts.(PixelateOptions)
+	if !ok {
+		return nil, optionsError("pixelate", opts)
+	}
 
-	cmd.Flag.BoolVar(&pixelateCrop, "crop", false, "")
-	cmd.Flag.Var(&pixelateSize, "size", "")
-	cmd.Flag.IntVar(&pixelateRows, "rows", -1, "")
-	cmd.Flag.IntVar(&pixelateCols, "cols", -1, "")
+	if o.Rows > 0 && o.Cols > 0 {
+		o.Size = utils.SizeForRowsAndCols(img, o.Rows, o.Cols)
+	} else if o.Rows > 0 {
+		o.Size = utils.SizeForRows(img, o.Rows)
+	} else if o.Cols > 0 {
+		o.Size = utils.SizeForCols(img, o.Cols)
+	}
 
-	return cmd
+	return pixelate.Pixelate(img, o.Size, o.Style), nil
 }
 
-func runPixelate(cmd *hadfield.Command, args []string) {
-	i, data := utils.ReadStdin()
+func pixelateFlags(fs *flag.FlagSet) func([]string) (Options, error) {
+	o := PixelateOptions{Size: utils.Dimension{H: 20, W: 20}}
+	var crop bool
 
-	// Default
-	style := pixelate.FITTED
+	fs.BoolVar(&crop, "crop", false, "")
+	fs.Var(&o.Size, "size", "")
+	fs.IntVar(&o.Rows, "rows", -1, "")
+	fs.IntVar(&o.Cols, "cols", -1, "")
 
-	if pixelateCrop {
-		style = pixelate.CROPPED
-	}
+	return func(args []string) (Options, error) {
+		// Default
+		o.Style = pixelate.FITTED
 
-	if pixelateRows > 0 && pixelateCols > 0 {
-		pixelateSize = utils.SizeForRowsAndCols(i, pixelateRows, pixelateCols)
-	} else if pixelateRows > 0 {
-		pixelateSize = utils.SizeForRows(i, pixelateRows)
-	} else if pixelateCols > 0 {
-		pixelateSize = utils.SizeForCols(i, pixelateCols)
-	}
+		if crop {
+			o.Style = pixelate.CROPPED
+		}
 
-	i = pixelate.Pixelate(i, pixelateSize, style)
-	utils.WriteStdout(i, data)
+		return o, nil
+	}
 }
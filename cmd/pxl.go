@@ -1,16 +1,31 @@
 package cmd
 
 import (
+	"flag"
+	"image"
+
 	"hawx.me/code/hadfield"
 	"hawx.me/code/img/pixelate"
 	"hawx.me/code/img/utils"
 )
 
-var (
-	pxlAlias, pxlCrop, pxlLeft, pxlRight, pxlBoth bool
-	pxlSize                                       utils.Dimension = utils.Dimension{-1, -1}
-	pxlRows, pxlCols                              int
-)
+// PxlOptions are the Options for pxl. If Rows or Cols are greater than 0 they
+// are used to calculate the size, instead of Size. If none are given a size is
+// guessed.
+type PxlOptions struct {
+	Size       utils.Dimension
+	Rows, Cols int
+	Triangle   pixelate.Triangle
+	Style      pixelate.Style
+	Alias      bool
+}
+
+var pxlOperation = &Operation{
+	Name:       "pxl",
+	Run:        runPxl,
+	Composited: true,
+	flags:      pxlFlags,
+}
 
 func Pxl() *hadfield.Command {
 	cmd := &hadfield.Command{
@@ -31,60 +46,69 @@ func Pxl() *hadfield.Command {
 `,
 	}
 
-	cmd.Run = runPxl
-
-	cmd.Flag.BoolVar(&pxlAlias, "alias", false, "")
-	cmd.Flag.BoolVar(&pxlCrop, "crop", false, "")
-	cmd.Flag.BoolVar(&pxlLeft, "left", false, "")
-	cmd.Flag.BoolVar(&pxlRight, "right", false, "")
-
-	cmd.Flag.Var(&pxlSize, "size", "")
-	cmd.Flag.IntVar(&pxlRows, "rows", -1, "")
-	cmd.Flag.IntVar(&pxlCols, "cols", -1, "")
-
-	return cmd
+	return command(cmd, pxlOperation)
 }
 
-func runPxl(cmd *hadfield.Command, args []string) {
-	i, data := utils.ReadStdin()
-
-	triangle := pixelate.BOTH
-	if pxlLeft {
-		triangle = pixelate.LEFT
-	}
-	if pxlRight {
-		triangle = pixelate.RIGHT
-	}
-
-	style := pixelate.FITTED
-	if pxlCrop {
-		style = pixelate.CROPPED
+func runPxl(img image.Image, opts Options) (image.Image, error) {
+	o, ok := opts.(PxlOptions)
+	if !ok {
+		return nil, optionsError("pxl", opts)
 	}
 
-	if pxlRows > 0 && pxlCols > 0 {
-		pxlSize = utils.SizeForRowsAndCols(i, pxlRows, pxlCols)
-	} else if pxlRows > 0 {
-		pxlSize = utils.SizeForRows(i, pxlRows)
-	} else if pxlCols > 0 {
-		pxlSize = utils.SizeForCols(i, pxlCols)
+	if o.Rows > 0 && o.Cols > 0 {
+		o.Size = utils.SizeForRowsAndCols(img, o.Rows, o.Cols)
+	} else if o.Rows > 0 {
+		o.Size = utils.SizeForRows(img, o.Rows)
+	} else if o.Cols > 0 {
+		o.Size = utils.SizeForCols(img, o.Cols)
 	}
 
 	// If no sizes given, guess
-	if pxlSize.H == -1 && pxlSize.W == -1 {
-		bounds := i.Bounds()
+	if o.Size.H <= 0 && o.Size.W <= 0 {
+		bounds := img.Bounds()
 
 		if bounds.Dx() > bounds.Dy() {
-			pxlSize = utils.SizeForCols(i, 20)
+			o.Size = utils.SizeForCols(img, 20)
 		} else {
-			pxlSize = utils.SizeForRows(i, 20)
+			o.Size = utils.SizeForRows(img, 20)
 		}
 	}
 
-	if pxlAlias {
-		i = pixelate.AliasedPxl(i, pxlSize, triangle, style)
-	} else {
-		i = pixelate.Pxl(i, pxlSize, triangle, style)
+	f := pixelate.Pxl
+	if o.Alias {
+		f = pixelate.AliasedPxl
 	}
 
-	utils.WriteStdout(i, data)
+	return f(img, o.Size, o.Triangle, o.Style), nil
+}
+
+func pxlFlags(fs *flag.FlagSet) func([]string) (Options, error) {
+	o := PxlOptions{Size: utils.Dimension{H: -1, W: -1}}
+	var crop, left, right bool
+
+	fs.BoolVar(&o.Alias, "alias", false, "")
+	fs.BoolVar(&crop, "crop", false, "")
+	fs.BoolVar(&left, "left", false, "")
+	fs.BoolVar(&right, "right", false, "")
+
+	fs.Var(&o.Size, "size", "")
+	fs.IntVar(&o.Rows, "rows", -1, "")
+	fs.IntVar(&o.Cols, "cols", -1, "")
+
+	return func(args []string) (Options, error) {
+		o.Triangle = pixelate.BOTH
+		if left {
+			o.Triangle = pixelate.LEFT
+		}
+		if right {
+			o.Triangle = pixelate.RIGHT
+		}
+
+		o.Style = pixelate.FITTED
+		if crop {
+			o.Style = pixelate.CROPPED
+		}
+
+		return o, nil
+	}
 }
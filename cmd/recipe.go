@@ -0,0 +1,172 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"sort"
+	"strings"
+
+	"hawx.me/code/hadfield"
+	"hawx.me/code/img/recipe"
+	"hawx.me/code/img/utils"
+)
+
+func Recipe() *hadfield.Command {
+	cmd := &hadfield.Command{
+		Usage: "recipe <file> [<name>=<value>...]",
+		Short: "run the steps of a recipe file",
+		Long: `
+  Recipe takes an image from STDIN, runs each of the steps listed in the recipe
+  file on it in turn, and prints the result to STDOUT. This is the same as using
+  pipe, but the steps can be kept in a file so that they are easy to repeat.
+
+  A recipe is written in YAML or JSON. Each step gives the command to run as
+  'op', and its options by the names of the command's flags,
+
+    vars:
+      amount: 0.4
+
+    steps:
+      - op: levels
+        red: true
+        curve: "0,0 50,60 100,100"
+      - op: vibrance
+        by: $amount
+
+  Arguments that are not flags, such as the image to blend with, are given as a
+  list with 'args'. Variables are declared with 'vars' and used as $name or
+  ${name}, their values can be changed when running the recipe,
+
+    img recipe look.yaml amount=0.6 < in.jpg > out.jpg
+
+  The steps are checked before the image is read, and any errors are reported
+  with the line of the recipe they were found on. Only the builtin commands can
+  be used.
+`,
+	}
+
+	cmd.Run = runRecipe
+
+	return cmd
+}
+
+func runRecipe(cmd *hadfield.Command, args []string) {
+	if len(args) < 1 {
+		utils.Warn("recipe: no recipe file given")
+		os.Exit(2)
+	}
+
+	file := args[0]
+
+	vars := map[string]string{}
+	for _, arg := range args[1:] {
+		i := strings.Index(arg, "=")
+		if i < 1 {
+			utils.Warn(fmt.Sprintf("recipe: expected <name>=<value>, got %q", arg))
+			os.Exit(2)
+		}
+		vars[arg[:i]] = arg[i+1:]
+	}
+
+	data, err := ioutil.ReadFile(file)
+	if err != nil {
+		utils.Warn("recipe:", err)
+		os.Exit(2)
+	}
+
+	stepArgs, err := recipeArgs(data, vars)
+	if err != nil {
+		var rerr *recipe.Error
+		if errors.As(err, &rerr) {
+			utils.Warn(fmt.Sprintf("recipe: %s:%d: %v", file, rerr.Line, rerr.Err))
+		} else {
+			utils.Warn("recipe:", err)
+		}
+		os.Exit(2)
+	}
+
+	if err := runSteps("recipe", stepArgs); err != nil {
+		utils.Warn("recipe:", err)
+		os.Exit(2)
+	}
+}
+
+// recipeArgs reads the recipe in data and returns the arguments for each of its
+// steps, separated by "|" as for pipe. Each step is checked against the command
+// it names, so that an error can give the line it is on.
+func recipeArgs(data []byte, vars map[string]string) ([]string, error) {
+	r, err := recipe.Parse(data)
+	if err != nil {
+		return nil, err
+	}
+
+	steps, err := r.Expand(vars)
+	if err != nil {
+		return nil, err
+	}
+	if len(steps) == 0 {
+		return nil, errors.New("no steps")
+	}
+
+	var args []string
+	for i, step := range steps {
+		op := Lookup(step.Op)
+		if op == nil {
+			return nil, &recipe.Error{Line: step.Lines["op"], Err: errors.New("unknown command " + step.Op)}
+		}
+
+		// Each option is checked alone first, so that a bad value is reported
+		// on the line it is given.
+		if err := checkParams(op, step); err != nil {
+			return nil, err
+		}
+
+		stepArgs, err := op.Args(step.Params)
+		if err != nil {
+			return nil, &recipe.Error{Line: step.Line, Err: err}
+		}
+		if len(step.Args) > 0 {
+			stepArgs = append(append(stepArgs, "--"), step.Args...)
+		}
+
+		if _, err := op.Parse(stepArgs); err != nil {
+			return nil, &recipe.Error{Line: step.Line, Err: errors.New(op.Name + ": " + err.Error())}
+		}
+
+		if i > 0 {
+			args = append(args, "|")
+		}
+		args = append(args, op.Name)
+		args = append(args, stepArgs...)
+	}
+
+	return args, nil
+}
+
+// checkParams returns an error, with the line it is on, for the first option of
+// the step that is not a flag of op or has a value the flag can't be set to.
+func checkParams(op *Operation, step recipe.Step) error {
+	names := make([]string, 0, len(step.Params))
+	for name := range step.Params {
+		names = append(names, name)
+	}
+	sort.Slice(names, func(i, j int) bool {
+		return step.Lines[names[i]] < step.Lines[names[j]]
+	})
+
+	for _, name := range names {
+		args, err := op.Args(map[string][]string{name: step.Params[name]})
+		if err == nil {
+			if err = op.parseFlags(args); err != nil {
+				err = errors.New(op.Name + ": " + err.Error())
+			}
+		}
+		if err != nil {
+			return &recipe.Error{Line: step.Lines[name], Err: err}
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,50 @@
+package cmd
+
+import (
+	"strings"
+	"testing"
+
+	"hawx.me/code/img/recipe"
+)
+
+func TestRecipeArgs(t *testing.T) {
+	args, err := recipeArgs([]byte(`steps:
+  - op: blur
+    radius: 3
+    box:
+  - op: greyscale
+    red: true
+`), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got := strings.Join(args, " "); got != "blur --box --radius=3 | greyscale --red=true" {
+		t.Errorf("unexpected args: %s", got)
+	}
+}
+
+func TestRecipeArgsErrorLine(t *testing.T) {
+	for _, tc := range []struct {
+		data string
+		line int
+	}{
+		{"steps:\n  - op: spin\n", 2},
+		{"steps:\n  - op: blur\n    box: true\n    radius: lots\n", 4},
+		{"steps:\n  - op: blur\n    colour: red\n    radius: 2\n", 3},
+		{"steps:\n  - op: blur\n    style: spiral\n", 2},
+		{"steps:\n  - op: blur\n\n    radius:\n", 4},
+		{"[\n  {\"op\": \"blur\",\n   \"radius\": \"x\"}\n]", 3},
+	} {
+		_, err := recipeArgs([]byte(tc.data), nil)
+
+		e, ok := err.(*recipe.Error)
+		if !ok {
+			t.Errorf("%q: expected *recipe.Error, got %v", tc.data, err)
+			continue
+		}
+		if e.Line != tc.line {
+			t.Errorf("%q: expected error on line %d, got %v", tc.data, tc.line, e)
+		}
+	}
+}
@@ -0,0 +1,160 @@
+package cmd
+
+import (
+	"errors"
+	"flag"
+	"image"
+	"math"
+
+	"hawx.me/code/hadfield"
+	"hawx.me/code/img/resize"
+	"hawx.me/code/img/utils"
+)
+
+// ResizeOptions are the Options for resize.
+type ResizeOptions struct {
+	// Width and Height are the size of the result. If either is 0 it is chosen
+	// to keep the aspect ratio of the image.
+	Width, Height int
+
+	// Percent, if not 0, is used instead of Width and Height to scale the image
+	// by that percentage.
+	Percent float64
+
+	// Mode is "fit" to fit the image within Width and Height, "fill" to cover
+	// them and crop the rest, keeping the part given by Direction, or "" to
+	// resize to exactly that size.
+	Mode      string
+	Direction utils.Direction
+
+	Filter resize.Filter
+	Linear bool
+}
+
+var resizeFilters = map[string]resize.Filter{
+	"nearest":  resize.Nearest,
+	"bilinear": resize.Bilinear,
+	"bicubic":  resize.Bicubic,
+	"mitchell": resize.Mitchell,
+	"lanczos2": resize.Lanczos2,
+	"lanczos3": resize.Lanczos3,
+}
+
+// parseFilter returns the resize.Filter named by the --filter flag.
+func parseFilter(name string) (resize.Filter, error) {
+	filter, ok := resizeFilters[name]
+	if !ok {
+		return filter, errors.New("--filter must be one of 'nearest', 'bilinear', 'bicubic', 'mitchell', 'lanczos2' or 'lanczos3'")
+	}
+	return filter, nil
+}
+
+var resizeOperation = &Operation{
+	Name:       "resize",
+	Run:        runResize,
+	Composited: true,
+	flags:      resizeFlags,
+}
+
+func Resize() *hadfield.Command {
+	cmd := &hadfield.Command{
+		Usage: "resize [options]",
+		Short: "resize an image",
+		Long: `
+  Resize takes an image from STDIN, and prints a resized version to STDOUT. If
+  only one of width or height is given the other is chosen to keep the aspect
+  ratio of the image.
+
+    --width <pixels>       # Width of the result
+    --height <pixels>      # Height of the result
+    --percent <n>          # Scale by a percentage, instead of to a size
+
+    --fit                  # Fit within the width and height, keeping the aspect ratio
+    --fill                 # Fill the width and height, keeping the aspect ratio,
+                           # then crop the rest
+
+    --filter <name>        # One of nearest, bilinear, bicubic, mitchell,
+                           # lanczos2 or lanczos3 (default: lanczos3)
+    --linear               # Resize in linear light, which is more accurate
+
+  When using --fill the part of the image to keep can be chosen with one of
+  --centre (the default), --top, --top-right, --right, --bottom-right, --bottom,
+  --bottom-left, --left or --top-left.
+`,
+	}
+
+	return command(cmd, resizeOperation)
+}
+
+func runResize(img image.Image, opts Options) (image.Image, error) {
+	o, ok := opts.(ResizeOptions)
+	if !ok {
+		return nil, optionsError("resize", opts)
+	}
+
+	f := func(i image.Image) image.Image {
+		if o.Percent != 0 {
+			b := i.Bounds()
+			width := int(math.Max(1, math.Round(float64(b.Dx())*o.Percent/100)))
+			return resize.Resize(i, width, 0, o.Filter)
+		}
+
+		switch o.Mode {
+		case "fit":
+			return resize.Fit(i, o.Width, o.Height, o.Filter)
+		case "fill":
+			return resize.Fill(i, o.Width, o.Height, o.Direction, o.Filter)
+		}
+		return resize.Resize(i, o.Width, o.Height, o.Filter)
+	}
+
+	if o.Linear {
+		return utils.WithLinear(img, f), nil
+	}
+	return f(img), nil
+}
+
+func resizeFlags(fs *flag.FlagSet) func([]string) (Options, error) {
+	var o ResizeOptions
+	var fit, fill bool
+	var filter string
+
+	fs.IntVar(&o.Width, "width", 0, "")
+	fs.IntVar(&o.Height, "height", 0, "")
+	fs.Float64Var(&o.Percent, "percent", 0, "")
+
+	fs.BoolVar(&fit, "fit", false, "")
+	fs.BoolVar(&fill, "fill", false, "")
+	direction := directionFlags(fs)
+
+	fs.StringVar(&filter, "filter", "lanczos3", "")
+	fs.BoolVar(&o.Linear, "linear", false, "")
+
+	return func(args []string) (Options, error) {
+		var err error
+		if o.Filter, err = parseFilter(filter); err != nil {
+			return nil, err
+		}
+
+		if o.Width < 0 || o.Height < 0 || o.Percent < 0 {
+			return nil, errors.New("--width, --height and --percent must not be negative")
+		}
+		if o.Width == 0 && o.Height == 0 && o.Percent == 0 {
+			return nil, errors.New("one of --width, --height or --percent must be given")
+		}
+
+		if fit || fill {
+			if o.Width == 0 || o.Height == 0 {
+				return nil, errors.New("--fit and --fill need both --width and --height")
+			}
+
+			o.Mode = "fit"
+			if fill {
+				o.Mode = "fill"
+			}
+		}
+		o.Direction = direction()
+
+		return o, nil
+	}
+}
@@ -0,0 +1,83 @@
+package cmd
+
+import (
+	"flag"
+	"image"
+	"image/color"
+
+	"hawx.me/code/hadfield"
+	"hawx.me/code/img/resize"
+	"hawx.me/code/img/transform"
+)
+
+// RotateOptions are the Options for rotate.
+type RotateOptions struct {
+	// Angle is the number of degrees to turn the image clockwise.
+	Angle float64
+
+	// Background fills the corners left uncovered, when Angle is not a multiple
+	// of 90.
+	Background color.Color
+	Filter     resize.Filter
+}
+
+var rotateOperation = &Operation{
+	Name:       "rotate",
+	Run:        runRotate,
+	Composited: true,
+	flags:      rotateFlags,
+}
+
+func Rotate() *hadfield.Command {
+	cmd := &hadfield.Command{
+		Usage: "rotate [options]",
+		Short: "rotate an image",
+		Long: `
+  Rotate takes an image from STDIN, and prints a version turned clockwise to
+  STDOUT. The result is made large enough to hold the whole image, any corners
+  left uncovered are filled with the background colour.
+
+    --by <degrees>         # Angle to rotate by (default: 90)
+    --background [colour]  # Colour to fill the corners with (default: #0000)
+    --filter <name>        # One of nearest, bilinear, bicubic, mitchell,
+                           # lanczos2 or lanczos3 (default: bicubic)
+`,
+	}
+
+	return command(cmd, rotateOperation)
+}
+
+func runRotate(img image.Image, opts Options) (image.Image, error) {
+	o, ok := opts.(RotateOptions)
+	if !ok {
+		return nil, optionsError("rotate", opts)
+	}
+
+	background := o.Background
+	if background == nil {
+		background = color.Transparent
+	}
+
+	return transform.Rotate(img, o.Angle, background, o.Filter), nil
+}
+
+func rotateFlags(fs *flag.FlagSet) func([]string) (Options, error) {
+	var o RotateOptions
+	var filter string
+	var background localNRGBA
+
+	fs.Float64Var(&o.Angle, "by", 90, "")
+	fs.Var(&background, "background", "")
+	fs.StringVar(&filter, "filter", "bicubic", "")
+
+	return func(args []string) (Options, error) {
+		var err error
+		if o.Filter, err = parseFilter(filter); err != nil {
+			return nil, err
+		}
+
+		o.Background = color.NRGBA(background)
+
+		return o, nil
+	}
+}
@@ -0,0 +1,313 @@
+package cmd
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"image"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"hawx.me/code/hadfield"
+	"hawx.me/code/img/utils"
+)
+
+var (
+	serveAddr, serveRoot string
+	serveMaxBytes        int64
+	serveMaxPixels       int
+)
+
+// The default limits on the images a server will work with.
+const (
+	defaultMaxBytes  = 32 << 20
+	defaultMaxPixels = 50 * 1000 * 1000
+)
+
+var (
+	errNoRoot      = errors.New("src and other can only be used with --root")
+	errOutsideRoot = errors.New("file is outside of --root")
+)
+
+func Serve() *hadfield.Command {
+	cmd := &hadfield.Command{
+		Usage: "serve [options]",
+		Short: "serve commands over HTTP",
+		Long: `
+  Serve starts a HTTP server with an endpoint for each builtin command. The
+  options for the command are given in the query string, and the processed
+  image is returned in the same format as the original, unless a different
+  output format was chosen when starting the server.
+
+  Send the image as the body of a POST request,
+
+    curl --data-binary @in.jpg 'localhost:8080/blur?linear&radius=3' > out.jpg
+
+  or, if --root is given, name an image under it in a GET request,
+
+    curl 'localhost:8080/tint?with=%23ff0000&src=photos/in.jpg' > out.jpg
+
+  The image to blend with, or the mask for carve, is named by 'other', which
+  must be under --root.
+
+    --addr <addr>         # Address to listen on (default: :8080)
+    --root <dir>          # Directory to read images from for GET requests
+
+    --max-bytes <n>       # Largest image file accepted (default: 32MiB)
+    --max-pixels <n>      # Largest image, or result, in pixels (default: 50000000)
+`,
+	}
+
+	cmd.Run = runServe
+
+	cmd.Flag.StringVar(&serveAddr, "addr", ":8080", "")
+	cmd.Flag.StringVar(&serveRoot, "root", "", "")
+	cmd.Flag.Int64Var(&serveMaxBytes, "max-bytes", defaultMaxBytes, "")
+	cmd.Flag.IntVar(&serveMaxPixels, "max-pixels", defaultMaxPixels, "")
+
+	return cmd
+}
+
+func runServe(cmd *hadfield.Command, args []string) {
+	utils.Warn("serve: listening on", serveAddr)
+
+	s := &server{
+		root:      serveRoot,
+		maxBytes:  serveMaxBytes,
+		maxPixels: serveMaxPixels,
+	}
+
+	if err := http.ListenAndServe(serveAddr, s); err != nil {
+		utils.Warn("serve:", err)
+		os.Exit(1)
+	}
+}
+
+// A server performs the operation named by the path of each request on the
+// image given, and responds with the result.
+type server struct {
+	// root is the directory that images can be read from, if empty only
+	// images sent in the request body can be used.
+	root string
+
+	// maxBytes is the largest image file, and maxPixels the largest image or
+	// result, that will be processed. If 0 the defaults are used.
+	maxBytes  int64
+	maxPixels int
+}
+
+func (s *server) limits() (maxBytes int64, maxPixels int) {
+	maxBytes, maxPixels = s.maxBytes, s.maxPixels
+	if maxBytes <= 0 {
+		maxBytes = defaultMaxBytes
+	}
+	if maxPixels <= 0 {
+		maxPixels = defaultMaxPixels
+	}
+	return
+}
+
+func (s *server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	op := Lookup(strings.Trim(r.URL.Path, "/"))
+	if op == nil {
+		http.NotFound(w, r)
+		return
+	}
+
+	params := r.URL.Query()
+	src := params.Get("src")
+	other := params.Get("other")
+	params.Del("src")
+	params.Del("other")
+
+	args, err := op.Args(params)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if other != "" {
+		name, err := s.resolve(other)
+		if err != nil {
+			fileError(w, r, err)
+			return
+		}
+		args = append(args, name)
+	}
+
+	opts, err := op.Parse(args)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	maxBytes, maxPixels := s.limits()
+
+	var body io.Reader
+	switch r.Method {
+	case "POST":
+		body = http.MaxBytesReader(w, r.Body, maxBytes)
+
+	case "GET":
+		if src == "" {
+			http.Error(w, "src must be given", http.StatusForbidden)
+			return
+		}
+
+		name, err := s.resolve(src)
+		if err != nil {
+			fileError(w, r, err)
+			return
+		}
+
+		file, err := os.Open(name)
+		if err != nil {
+			http.NotFound(w, r)
+			return
+		}
+		defer file.Close()
+		body = io.LimitReader(file, maxBytes+1)
+
+	default:
+		w.Header().Set("Allow", "GET, POST")
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	b, err := ioutil.ReadAll(body)
+	if err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			http.Error(w, err.Error(), http.StatusRequestEntityTooLarge)
+		} else {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+		}
+		return
+	}
+	if int64(len(b)) > maxBytes {
+		http.Error(w, fmt.Sprintf("image is larger than %d bytes", maxBytes), http.StatusRequestEntityTooLarge)
+		return
+	}
+
+	// Check the size before decoding, as a small file can hold a very large
+	// image. Errors are left to be reported by utils.Read.
+	if config, _, err := image.DecodeConfig(bytes.NewReader(b)); err == nil {
+		if int64(config.Width)*int64(config.Height) > int64(maxPixels) {
+			http.Error(w, fmt.Sprintf("image is larger than %d pixels", maxPixels), http.StatusRequestEntityTooLarge)
+			return
+		}
+	}
+
+	i, data, err := utils.Read(bytes.NewReader(b))
+	if err != nil {
+		status := http.StatusBadRequest
+		if errors.Is(err, utils.ErrUnsupportedFormat) {
+			status = http.StatusUnsupportedMediaType
+		}
+		http.Error(w, err.Error(), status)
+		return
+	}
+
+	if resultPixels(opts, i.Bounds().Size()) > float64(maxPixels) {
+		http.Error(w, fmt.Sprintf("result would be larger than %d pixels", maxPixels), http.StatusBadRequest)
+		return
+	}
+
+	if i, err = autoOrient(i, &data); err == nil {
+		i, err = op.Apply(i, opts, &data)
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	var buf bytes.Buffer
+	if err := utils.Write(&buf, i, data); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "image/"+utils.OutputFormat(data))
+	w.Write(buf.Bytes())
+}
+
+// resultPixels estimates the number of pixels in the result of performing the
+// operation with opts on an image of the size given. Only the operations that
+// can make an image much larger are considered.
+func resultPixels(opts Options, size image.Point) float64 {
+	width, height := float64(size.X), float64(size.Y)
+
+	switch o := opts.(type) {
+	case ResizeOptions:
+		if o.Percent != 0 {
+			return width * height * (o.Percent / 100) * (o.Percent / 100)
+		}
+
+		w, h := float64(o.Width), float64(o.Height)
+		switch {
+		case w == 0 && h == 0:
+			return width * height
+		case w == 0:
+			return h * h * width / height
+		case h == 0:
+			return w * w * height / width
+		}
+		return w * h
+
+	case CarveOptions:
+		if o.Width != 0 {
+			width = float64(o.Width)
+		}
+		if o.Height != 0 {
+			height = float64(o.Height)
+		}
+	}
+
+	return width * height
+}
+
+// resolve returns the path of the file named by name in the root directory. It
+// returns errNoRoot if there is no root directory, and errOutsideRoot if the
+// file is a link to somewhere outside of it.
+func (s *server) resolve(name string) (string, error) {
+	if s.root == "" {
+		return "", errNoRoot
+	}
+
+	root, err := filepath.Abs(s.root)
+	if err != nil {
+		return "", err
+	}
+	if root, err = filepath.EvalSymlinks(root); err != nil {
+		return "", err
+	}
+
+	// Cleaning the name as an absolute path removes any "..", but links must
+	// also be followed to be sure that the file is inside root.
+	name = filepath.Join(root, filepath.FromSlash(path.Clean("/"+name)))
+
+	name, err = filepath.EvalSymlinks(name)
+	if err != nil {
+		return "", err
+	}
+	if name != root && !strings.HasPrefix(name, root+string(filepath.Separator)) {
+		return "", errOutsideRoot
+	}
+
+	return name, nil
+}
+
+// fileError responds with the error returned by resolve.
+func fileError(w http.ResponseWriter, r *http.Request, err error) {
+	switch err {
+	case errNoRoot, errOutsideRoot:
+		http.Error(w, err.Error(), http.StatusForbidden)
+	default:
+		http.NotFound(w, r)
+	}
+}
@@ -0,0 +1,227 @@
+package cmd
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/png"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func testImage() image.Image {
+	img := image.NewNRGBA(image.Rect(0, 0, 8, 8))
+	for y := 0; y < 8; y++ {
+		for x := 0; x < 8; x++ {
+			img.Set(x, y, color.NRGBA{uint8(x * 30), uint8(y * 30), 200, 255})
+		}
+	}
+	return img
+}
+
+func encodePNG(t *testing.T, img image.Image) []byte {
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestServePost(t *testing.T) {
+	s := httptest.NewServer(&server{})
+	defer s.Close()
+
+	resp, err := http.Post(s.URL+"/greyscale?red", "image/png", bytes.NewReader(encodePNG(t, testImage())))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("expected status 200, got %d", resp.StatusCode)
+	}
+	if ct := resp.Header.Get("Content-Type"); ct != "image/png" {
+		t.Errorf("expected Content-Type image/png, got %q", ct)
+	}
+
+	img, err := png.Decode(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	r, g, b, _ := img.At(5, 2).RGBA()
+	if r != g || g != b || r>>8 != 150 {
+		t.Errorf("expected grey from red channel of 150, got %d %d %d", r>>8, g>>8, b>>8)
+	}
+}
+
+func TestServePostBareFlag(t *testing.T) {
+	s := httptest.NewServer(&server{})
+	defer s.Close()
+
+	resp, err := http.Post(s.URL+"/blur?linear&radius=3", "image/png", bytes.NewReader(encodePNG(t, testImage())))
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("expected status 200, got %d", resp.StatusCode)
+	}
+}
+
+func TestServeGet(t *testing.T) {
+	root := t.TempDir()
+	if err := os.WriteFile(filepath.Join(root, "in.png"), encodePNG(t, testImage()), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	s := httptest.NewServer(&server{root: root})
+	defer s.Close()
+
+	resp, err := http.Get(s.URL + "/tint?with=%23ff0000&src=in.png")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("expected status 200, got %d", resp.StatusCode)
+	}
+	if _, err := png.Decode(resp.Body); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestServeErrors(t *testing.T) {
+	root := t.TempDir()
+	s := httptest.NewServer(&server{root: filepath.Join(root, "public")})
+	defer s.Close()
+
+	// A file outside of the root that should not be readable.
+	if err := os.WriteFile(filepath.Join(root, "secret.png"), encodePNG(t, testImage()), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	noRoot := httptest.NewServer(&server{})
+	defer noRoot.Close()
+
+	for _, tc := range []struct {
+		method, url string
+		body        []byte
+		status      int
+	}{
+		{"POST", s.URL + "/unknown", encodePNG(t, testImage()), http.StatusNotFound},
+		{"POST", s.URL + "/blur?style=spiral", encodePNG(t, testImage()), http.StatusBadRequest},
+		{"POST", s.URL + "/blur?colour=red", encodePNG(t, testImage()), http.StatusBadRequest},
+		{"POST", s.URL + "/blur?radius=-1", encodePNG(t, testImage()), http.StatusBadRequest},
+		{"POST", s.URL + "/blur?gaussian=0", encodePNG(t, testImage()), http.StatusBadRequest},
+		{"POST", s.URL + "/sharpen?radius=-1", encodePNG(t, testImage()), http.StatusBadRequest},
+		{"POST", s.URL + "/blur", []byte("not an image"), http.StatusUnsupportedMediaType},
+		{"GET", s.URL + "/blur?src=../secret.png", nil, http.StatusNotFound},
+		{"GET", noRoot.URL + "/blur?src=in.png", nil, http.StatusForbidden},
+		{"DELETE", s.URL + "/blur", nil, http.StatusMethodNotAllowed},
+	} {
+		req, err := http.NewRequest(tc.method, tc.url, bytes.NewReader(tc.body))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+
+		if resp.StatusCode != tc.status {
+			t.Errorf("%s %s: expected status %d, got %d", tc.method, tc.url, tc.status, resp.StatusCode)
+		}
+	}
+}
+
+func TestServeLimits(t *testing.T) {
+	root := t.TempDir()
+	public := filepath.Join(root, "public")
+	if err := os.Mkdir(public, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(root, "secret.png"), encodePNG(t, testImage()), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink(filepath.Join(root, "secret.png"), filepath.Join(public, "link.png")); err != nil {
+		t.Fatal(err)
+	}
+
+	s := httptest.NewServer(&server{root: public})
+	defer s.Close()
+	small := httptest.NewServer(&server{maxBytes: 64})
+	defer small.Close()
+	few := httptest.NewServer(&server{maxPixels: 32})
+	defer few.Close()
+
+	large := encodePNG(t, image.NewGray(image.Rect(0, 0, 1000, 1000)))
+
+	for _, tc := range []struct {
+		method, url string
+		body        []byte
+		status      int
+	}{
+		{"GET", s.URL + "/blur?src=link.png", nil, http.StatusForbidden},
+		{"POST", small.URL + "/blur", encodePNG(t, testImage()), http.StatusRequestEntityTooLarge},
+		{"POST", few.URL + "/blur", encodePNG(t, testImage()), http.StatusRequestEntityTooLarge},
+		{"POST", s.URL + "/resize?width=100000&height=100000", large, http.StatusBadRequest},
+		{"POST", s.URL + "/resize?percent=10000", large, http.StatusBadRequest},
+		{"POST", s.URL + "/resize?width=100000", large, http.StatusBadRequest},
+		{"POST", s.URL + "/carve?width=100000", large, http.StatusBadRequest},
+		{"POST", s.URL + "/resize?width=10", large, http.StatusOK},
+	} {
+		req, err := http.NewRequest(tc.method, tc.url, bytes.NewReader(tc.body))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+
+		if resp.StatusCode != tc.status {
+			t.Errorf("%s %s: expected status %d, got %d", tc.method, tc.url, tc.status, resp.StatusCode)
+		}
+	}
+}
+
+func TestOperationArgs(t *testing.T) {
+	for _, tc := range []struct {
+		op     *Operation
+		params map[string][]string
+		args   []string
+		err    bool
+	}{
+		{blurOperation, map[string][]string{"box": {""}, "radius": {"3"}}, []string{"--box", "--radius=3"}, false},
+		{blurOperation, map[string][]string{"radius": {""}}, nil, true},
+		{tintOperation, map[string][]string{"with": {""}}, nil, true},
+		{pixelateOperation, map[string][]string{"size": {""}}, nil, true},
+		{blurOperation, map[string][]string{"colour": {"red"}}, nil, true},
+	} {
+		args, err := tc.op.Args(tc.params)
+		if tc.err {
+			if err == nil {
+				t.Errorf("%s %v: expected error, got %v", tc.op.Name, tc.params, args)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s %v: %v", tc.op.Name, tc.params, err)
+			continue
+		}
+		if strings.Join(args, " ") != strings.Join(tc.args, " ") {
+			t.Errorf("%s %v: expected %v, got %v", tc.op.Name, tc.params, tc.args, args)
+		}
+	}
+}
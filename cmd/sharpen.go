@@ -1,16 +1,28 @@
 package cmd
 
 import (
+	"errors"
+	"flag"
+	"image"
+
 	"hawx.me/code/hadfield"
 	"hawx.me/code/img/sharpen"
 	"hawx.me/code/img/utils"
 )
 
-var (
-	sharpenRadius                                 int
-	sharpenSigma, sharpenAmount, sharpenThreshold float64
-	sharpenUnsharp                                bool
-)
+// SharpenOptions are the Options for sharpen.
+type SharpenOptions struct {
+	Radius                   int
+	Sigma, Amount, Threshold float64
+	Unsharp, Linear          bool
+}
+
+var sharpenOperation = &Operation{
+	Name:       "sharpen",
+	Run:        runSharpen,
+	Composited: true,
+	flags:      sharpenFlags,
+}
 
 func Sharpen() *hadfield.Command {
 	cmd := &hadfield.Command{
@@ -25,31 +37,59 @@ func Sharpen() *hadfield.Command {
     --threshold <num>   # Fraction difference required to apply sharpen
 
     --unsharp
+    --linear            # Sharpen in linear light, which is more accurate
 `,
 	}
 
-	cmd.Run = runSharpen
+	return command(cmd, sharpenOperation)
+}
 
-	// width=GetOptimalKernelWidth2D(radius,sigma);
+func runSharpen(img image.Image, opts Options) (image.Image, error) {
+	o, ok := opts.(SharpenOptions)
+	if !ok {
+		return nil, optionsError("sharpen", opts)
+	}
 
-	cmd.Flag.IntVar(&sharpenRadius, "radius", 1, "")
-	cmd.Flag.Float64Var(&sharpenSigma, "sigma", 1.0, "")
-	cmd.Flag.Float64Var(&sharpenAmount, "amount", 1.0, "")
-	cmd.Flag.Float64Var(&sharpenThreshold, "threshold", 0.05, "")
+	var err error
+	f := func(i image.Image) (out image.Image) {
+		if o.Unsharp {
+			out, err = sharpen.UnsharpMask(i, o.Radius, o.Sigma, o.Amount, o.Threshold)
+		} else {
+			out, err = sharpen.Sharpen(i, o.Radius, o.Sigma)
+		}
+		return
+	}
 
-	cmd.Flag.BoolVar(&sharpenUnsharp, "unsharp", false, "")
+	if o.Linear {
+		img = utils.WithLinear(img, f)
+	} else {
+		img = f(img)
+	}
 
-	return cmd
+	if err != nil {
+		return nil, err
+	}
+	return img, nil
 }
 
-func runSharpen(cmd *hadfield.Command, args []string) {
-	i, data := utils.ReadStdin()
+func sharpenFlags(fs *flag.FlagSet) func([]string) (Options, error) {
+	var o SharpenOptions
 
-	if sharpenUnsharp {
-		i = sharpen.UnsharpMask(i, sharpenRadius, sharpenSigma, sharpenAmount, sharpenThreshold)
-	} else {
-		i = sharpen.Sharpen(i, sharpenRadius, sharpenSigma)
-	}
+	fs.IntVar(&o.Radius, "radius", 1, "")
+	fs.Float64Var(&o.Sigma, "sigma", 1.0, "")
+	fs.Float64Var(&o.Amount, "amount", 1.0, "")
+	fs.Float64Var(&o.Threshold, "threshold", 0.05, "")
+	fs.BoolVar(&o.Unsharp, "unsharp", false, "")
+	fs.BoolVar(&o.Linear, "linear", false, "")
+
+	return func(args []string) (Options, error) {
+		if o.Radius < 0 {
+			return nil, errors.New("--radius must not be negative")
+		}
+		if o.Sigma <= 0 {
+			return nil, errors.New("--sigma must be positive")
+		}
 
-	utils.WriteStdout(i, data)
+		return o, nil
+	}
 }
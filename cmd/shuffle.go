@@ -1,14 +1,25 @@
 package cmd
 
 import (
+	"flag"
+	"image"
+
 	"hawx.me/code/hadfield"
 	"hawx.me/code/img/shuffle"
-	"hawx.me/code/img/utils"
 )
 
-var (
-	shuffleVertical, shuffleHorizontal bool
-)
+// ShuffleOptions are the Options for shuffle. Pixels are shuffled in both
+// directions unless only one of Vertical or Horizontal is set.
+type ShuffleOptions struct {
+	Vertical, Horizontal bool
+}
+
+var shuffleOperation = &Operation{
+	Name:       "shuffle",
+	Run:        runShuffle,
+	Composited: true,
+	flags:      shuffleFlags,
+}
 
 func Shuffle() *hadfield.Command {
 	cmd := &hadfield.Command{
@@ -23,24 +34,30 @@ func Shuffle() *hadfield.Command {
 `,
 	}
 
-	cmd.Run = runShuffle
+	return command(cmd, shuffleOperation)
+}
 
-	cmd.Flag.BoolVar(&shuffleVertical, "vertical", false, "")
-	cmd.Flag.BoolVar(&shuffleHorizontal, "horizontal", false, "")
+func runShuffle(img image.Image, opts Options) (image.Image, error) {
+	o, ok := opts.(ShuffleOptions)
+	if !ok {
+		return nil, optionsError("shuffle", opts)
+	}
 
-	return cmd
+	if o.Vertical && !o.Horizontal {
+		return shuffle.Vertically(img), nil
+	} else if o.Horizontal && !o.Vertical {
+		return shuffle.Horizontally(img), nil
+	}
+	return shuffle.Shuffle(img), nil
 }
 
-func runShuffle(cmd *hadfield.Command, args []string) {
-	i, data := utils.ReadStdin()
+func shuffleFlags(fs *flag.FlagSet) func([]string) (Options, error) {
+	var o ShuffleOptions
 
-	if shuffleVertical && !shuffleHorizontal {
-		i = shuffle.Vertically(i)
-	} else if shuffleHorizontal && !shuffleVertical {
-		i = shuffle.Horizontally(i)
-	} else {
-		i = shuffle.Shuffle(i)
-	}
+	fs.BoolVar(&o.Vertical, "vertical", false, "")
+	fs.BoolVar(&o.Horizontal, "horizontal", false, "")
 
-	utils.WriteStdout(i, data)
+	return func(args []string) (Options, error) {
+		return o, nil
+	}
 }
@@ -2,6 +2,7 @@ package cmd
 
 import (
 	"errors"
+	"flag"
 	"fmt"
 	"image/color"
 
@@ -11,9 +12,17 @@ import (
 	"hawx.me/code/img/utils"
 )
 
-var (
-	tintWith localNRGBA = localNRGBA{255, 0, 0, 160}
-)
+// TintOptions are the Options for tint.
+type TintOptions struct {
+	With color.Color
+}
+
+var tintOperation = &Operation{
+	Name:       "tint",
+	Run:        runComposable("tint", tintComposable),
+	Composable: tintComposable,
+	flags:      tintFlags,
+}
 
 func Tint() *hadfield.Command {
 	cmd := &hadfield.Command{
@@ -27,25 +36,26 @@ func Tint() *hadfield.Command {
 `,
 	}
 
-	cmd.Run = runTint
+	return command(cmd, tintOperation)
+}
 
-	cmd.Flag.Var(&tintWith, "with", "")
+func tintComposable(opts Options) utils.Composable {
+	o, ok := opts.(TintOptions)
+	if !ok {
+		return nil
+	}
 
-	return cmd
+	return tint.TintC(o.With)
 }
 
-func runTint(cmd *hadfield.Command, args []string) {
-	i, data := utils.ReadStdin()
+func tintFlags(fs *flag.FlagSet) func([]string) (Options, error) {
+	with := localNRGBA{255, 0, 0, 160}
 
-	tintColor := color.NRGBA{
-		uint8(tintWith.R),
-		uint8(tintWith.G),
-		uint8(tintWith.B),
-		uint8(tintWith.A),
-	}
-	i = tint.Tint(i, tintColor)
+	fs.Var(&with, "with", "")
 
-	utils.WriteStdout(i, data)
+	return func(args []string) (Options, error) {
+		return TintOptions{With: color.NRGBA(with)}, nil
+	}
 }
 
 type localNRGBA struct {
@@ -53,7 +63,7 @@ type localNRGBA struct {
 }
 
 func (c *localNRGBA) String() string {
-	return fmt.Sprint(*c)
+	return fmt.Sprintf("#%02x%02x%02x%02x", c.R, c.G, c.B, c.A)
 }
 
 func (c *localNRGBA) Set(value string) error {
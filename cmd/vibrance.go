@@ -1,15 +1,25 @@
 package cmd
 
 import (
+	"flag"
+
 	"hawx.me/code/hadfield"
 	"hawx.me/code/img/utils"
 	"hawx.me/code/img/vibrance"
 )
 
-var (
-	vibranceExp bool
-	vibranceBy  float64
-)
+// VibranceOptions are the Options for vibrance.
+type VibranceOptions struct {
+	By  float64
+	Exp bool
+}
+
+var vibranceOperation = &Operation{
+	Name:       "vibrance",
+	Run:        runComposable("vibrance", vibranceComposable),
+	Composable: vibranceComposable,
+	flags:      vibranceFlags,
+}
 
 func Vibrance() *hadfield.Command {
 	cmd := &hadfield.Command{
@@ -25,22 +35,28 @@ func Vibrance() *hadfield.Command {
 `,
 	}
 
-	cmd.Run = runVibrance
+	return command(cmd, vibranceOperation)
+}
 
-	cmd.Flag.BoolVar(&vibranceExp, "exp", false, "")
-	cmd.Flag.Float64Var(&vibranceBy, "by", 0.5, "")
+func vibranceComposable(opts Options) utils.Composable {
+	o, ok := opts.(VibranceOptions)
+	if !ok {
+		return nil
+	}
 
-	return cmd
+	if o.Exp {
+		return vibrance.ExpC(o.By)
+	}
+	return vibrance.AdjustC(o.By)
 }
 
-func runVibrance(cmd *hadfield.Command, args []string) {
-	image, exif := utils.ReadStdin()
+func vibranceFlags(fs *flag.FlagSet) func([]string) (Options, error) {
+	var o VibranceOptions
 
-	if vibranceExp {
-		image = vibrance.Exp(image, vibranceBy)
-	} else {
-		image = vibrance.Adjust(image, vibranceBy)
-	}
+	fs.BoolVar(&o.Exp, "exp", false, "")
+	fs.Float64Var(&o.By, "by", 0.5, "")
 
-	utils.WriteStdout(image, exif)
+	return func(args []string) (Options, error) {
+		return o, nil
+	}
 }
@@ -1,16 +1,28 @@
 package cmd
 
 import (
+	"flag"
+	"image"
+
 	"hawx.me/code/hadfield"
 	"hawx.me/code/img/pixelate"
 	"hawx.me/code/img/utils"
 )
 
-var (
-	vxlHeight, vxlRows        int
-	vxlFlip                   bool
-	vxlTop, vxlLeft, vxlRight float64
-)
+// VxlOptions are the Options for vxl. If Rows is greater than 0 it is used to
+// calculate the height, instead of Height.
+type VxlOptions struct {
+	Height, Rows     int
+	Flip             bool
+	Top, Left, Right float64
+}
+
+var vxlOperation = &Operation{
+	Name:       "vxl",
+	Run:        runVxl,
+	Composited: true,
+	flags:      vxlFlags,
+}
 
 func Vxl() *hadfield.Command {
 	cmd := &hadfield.Command{
@@ -31,27 +43,33 @@ func Vxl() *hadfield.Command {
 `,
 	}
 
-	cmd.Run = runVxl
-
-	cmd.Flag.IntVar(&vxlRows, "rows", -1, "")
-	cmd.Flag.IntVar(&vxlHeight, "height", 20, "")
+	return command(cmd, vxlOperation)
+}
 
-	cmd.Flag.BoolVar(&vxlFlip, "flip", false, "")
+func runVxl(img image.Image, opts Options) (image.Image, error) {
+	o, ok := opts.(VxlOptions)
+	if !ok {
+		return nil, optionsError("vxl", opts)
+	}
 
-	cmd.Flag.Float64Var(&vxlTop, "top", 1.0, "")
-	cmd.Flag.Float64Var(&vxlLeft, "left", 2.0, "")
-	cmd.Flag.Float64Var(&vxlRight, "right", 0.5, "")
+	if o.Rows > 0 {
+		o.Height = utils.SizeForRows(img, o.Rows).H
+	}
 
-	return cmd
+	return pixelate.Vxl(img, o.Height, o.Flip, o.Top, o.Left, o.Right), nil
 }
 
-func runVxl(cmd *hadfield.Command, args []string) {
-	i, data := utils.ReadStdin()
+func vxlFlags(fs *flag.FlagSet) func([]string) (Options, error) {
+	var o VxlOptions
 
-	if vxlRows > 0 {
-		vxlHeight = utils.SizeForRows(i, vxlRows).H
-	}
+	fs.IntVar(&o.Rows, "rows", -1, "")
+	fs.IntVar(&o.Height, "height", 20, "")
+	fs.BoolVar(&o.Flip, "flip", false, "")
+	fs.Float64Var(&o.Top, "top", 1.0, "")
+	fs.Float64Var(&o.Left, "left", 2.0, "")
+	fs.Float64Var(&o.Right, "right", 0.5, "")
 
-	i = pixelate.Vxl(i, vxlHeight, vxlFlip, vxlTop, vxlLeft, vxlRight)
-	utils.WriteStdout(i, data)
+	return func(args []string) (Options, error) {
+		return o, nil
+	}
 }
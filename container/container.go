@@ -0,0 +1,195 @@
+// Package container reads and rewrites the structure of JPEG and PNG files, so
+// that metadata such as exif data or colour profiles can be found and replaced
+// without decoding the image.
+package container
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"hash/crc32"
+	"io"
+)
+
+// Signatures found at the start of each type of file.
+var (
+	JPEGSOI      = []byte{0xff, 0xd8}
+	PNGSignature = []byte("\x89PNG\r\n\x1a\n")
+)
+
+// JPEG markers.
+const (
+	MarkerAPP0 = 0xe0
+	MarkerAPP1 = 0xe1
+	MarkerAPP2 = 0xe2
+	MarkerSOS  = 0xda
+	MarkerEOI  = 0xd9
+)
+
+var (
+	ErrBadJPEG = errors.New("container: malformed JPEG")
+	ErrBadPNG  = errors.New("container: malformed PNG")
+)
+
+// A Segment is a JPEG marker segment, Start and End are the offsets of the
+// whole segment (including the marker) in the original data.
+type Segment struct {
+	Marker     byte
+	Data       []byte
+	Start, End int
+}
+
+// JPEGSegments returns the marker segments preceding the entropy-coded data of
+// the JPEG in b, along with the offset of the first byte not in a segment.
+func JPEGSegments(b []byte) ([]Segment, int, error) {
+	if !bytes.HasPrefix(b, JPEGSOI) {
+		return nil, 0, ErrBadJPEG
+	}
+
+	segments := []Segment{}
+	i := len(JPEGSOI)
+
+	for i+1 < len(b) {
+		if b[i] != 0xff {
+			return nil, 0, ErrBadJPEG
+		}
+
+		marker := b[i+1]
+		switch {
+		case marker == 0xff:
+			// Fill byte
+			i++
+			continue
+		case marker == MarkerSOS || marker == MarkerEOI:
+			return segments, i, nil
+		case marker == 0x01 || (marker >= 0xd0 && marker <= 0xd7):
+			// Standalone markers have no length
+			i += 2
+			continue
+		}
+
+		if i+4 > len(b) {
+			return nil, 0, ErrBadJPEG
+		}
+		end := i + 2 + int(binary.BigEndian.Uint16(b[i+2:]))
+		if end > len(b) || end < i+4 {
+			return nil, 0, ErrBadJPEG
+		}
+
+		segments = append(segments, Segment{marker, b[i+4 : end], i, end})
+		i = end
+	}
+
+	return segments, len(b), nil
+}
+
+// NewSegment returns the bytes of a JPEG segment with the marker and data
+// given.
+func NewSegment(marker byte, data []byte) ([]byte, error) {
+	length := 2 + len(data)
+	if length > 0xffff {
+		return nil, errors.New("container: data too large for JPEG segment")
+	}
+
+	segment := []byte{0xff, marker, byte(length >> 8), byte(length)}
+	return append(segment, data...), nil
+}
+
+// RewriteJPEG writes the JPEG in b to w, without the segments for which drop
+// returns true. The extra segments, created with NewSegment, are inserted after
+// the APP0 and APP1 segments which must come first.
+func RewriteJPEG(w io.Writer, b []byte, drop func(Segment) bool, extra ...[]byte) error {
+	segments, rest, err := JPEGSegments(b)
+	if err != nil {
+		return err
+	}
+
+	var buf bytes.Buffer
+	buf.Write(JPEGSOI)
+
+	for _, s := range segments {
+		if drop(s) {
+			continue
+		}
+		if extra != nil && s.Marker != MarkerAPP0 && s.Marker != MarkerAPP1 {
+			buf.Write(bytes.Join(extra, nil))
+			extra = nil
+		}
+		buf.Write(b[s.Start:s.End])
+	}
+	if extra != nil {
+		buf.Write(bytes.Join(extra, nil))
+	}
+	buf.Write(b[rest:])
+
+	_, err = w.Write(buf.Bytes())
+	return err
+}
+
+// A Chunk is a PNG chunk, Start and End are the offsets of the whole chunk
+// (including length, type and CRC) in the original data.
+type Chunk struct {
+	Type       string
+	Data       []byte
+	Start, End int
+}
+
+// PNGChunks returns all of the chunks of the PNG in b.
+func PNGChunks(b []byte) ([]Chunk, error) {
+	if !bytes.HasPrefix(b, PNGSignature) {
+		return nil, ErrBadPNG
+	}
+
+	chunks := []Chunk{}
+	i := len(PNGSignature)
+
+	for i+12 <= len(b) {
+		length := int(binary.BigEndian.Uint32(b[i:]))
+		end := i + 12 + length
+		if length < 0 || end > len(b) {
+			return nil, ErrBadPNG
+		}
+
+		chunks = append(chunks, Chunk{string(b[i+4 : i+8]), b[i+8 : i+8+length], i, end})
+		i = end
+	}
+
+	return chunks, nil
+}
+
+// NewChunk returns the bytes of a PNG chunk with the type and data given.
+func NewChunk(typ string, data []byte) []byte {
+	chunk := make([]byte, 8, 12+len(data))
+	binary.BigEndian.PutUint32(chunk[:4], uint32(len(data)))
+	copy(chunk[4:], typ)
+	chunk = append(chunk, data...)
+
+	return binary.BigEndian.AppendUint32(chunk, crc32.ChecksumIEEE(chunk[4:]))
+}
+
+// RewritePNG writes the PNG in b to w, without the chunks for which drop
+// returns true. The extra chunks, created with NewChunk, are inserted before
+// the palette and image data.
+func RewritePNG(w io.Writer, b []byte, drop func(Chunk) bool, extra ...[]byte) error {
+	chunks, err := PNGChunks(b)
+	if err != nil {
+		return err
+	}
+
+	var buf bytes.Buffer
+	buf.Write(PNGSignature)
+
+	for _, c := range chunks {
+		if drop(c) {
+			continue
+		}
+		if extra != nil && (c.Type == "PLTE" || c.Type == "IDAT") {
+			buf.Write(bytes.Join(extra, nil))
+			extra = nil
+		}
+		buf.Write(b[c.Start:c.End])
+	}
+
+	_, err = w.Write(buf.Bytes())
+	return err
+}
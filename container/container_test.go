@@ -0,0 +1,132 @@
+package container
+
+import (
+	"bytes"
+	"image"
+	"image/jpeg"
+	"image/png"
+	"testing"
+)
+
+func testJPEG(t *testing.T) []byte {
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, image.NewGray(image.Rect(0, 0, 4, 3)), nil); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func testPNG(t *testing.T) []byte {
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, image.NewGray(image.Rect(0, 0, 4, 3))); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestRewriteJPEG(t *testing.T) {
+	b := testJPEG(t)
+
+	app1, err := NewSegment(MarkerAPP1, []byte("hello"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	app2, _ := NewSegment(MarkerAPP2, []byte("world"))
+
+	var buf bytes.Buffer
+	if err := RewriteJPEG(&buf, b, func(Segment) bool { return false }, app1, app2); err != nil {
+		t.Fatal(err)
+	}
+
+	segments, _, err := JPEGSegments(buf.Bytes())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var found []string
+	for _, s := range segments {
+		if s.Marker == MarkerAPP1 || s.Marker == MarkerAPP2 {
+			found = append(found, string(s.Data))
+		}
+	}
+	if len(found) != 2 || found[0] != "hello" || found[1] != "world" {
+		t.Errorf("expected extra segments in order, got %q", found)
+	}
+
+	img, err := jpeg.Decode(bytes.NewReader(buf.Bytes()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if img.Bounds() != image.Rect(0, 0, 4, 3) {
+		t.Errorf("expected 4x3 image, got %v", img.Bounds())
+	}
+
+	// and then dropping them gives back the original
+	var again bytes.Buffer
+	drop := func(s Segment) bool { return s.Marker == MarkerAPP1 || s.Marker == MarkerAPP2 }
+	if err := RewriteJPEG(&again, buf.Bytes(), drop); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(again.Bytes(), b) {
+		t.Error("expected dropping segments to restore the original")
+	}
+}
+
+func TestNewSegmentTooLarge(t *testing.T) {
+	if _, err := NewSegment(MarkerAPP1, make([]byte, 0xffff)); err == nil {
+		t.Error("expected error")
+	}
+}
+
+func TestRewritePNG(t *testing.T) {
+	b := testPNG(t)
+
+	var buf bytes.Buffer
+	if err := RewritePNG(&buf, b, func(Chunk) bool { return false }, NewChunk("tEXt", []byte("a\x00b"))); err != nil {
+		t.Fatal(err)
+	}
+
+	chunks, err := PNGChunks(buf.Bytes())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var types []string
+	for _, c := range chunks {
+		types = append(types, c.Type)
+	}
+	if len(types) < 3 || types[0] != "IHDR" || types[1] != "tEXt" {
+		t.Errorf("expected tEXt after IHDR, got %v", types)
+	}
+
+	// png.Decode checks the CRC of each chunk
+	if _, err := png.Decode(bytes.NewReader(buf.Bytes())); err != nil {
+		t.Fatal(err)
+	}
+
+	var again bytes.Buffer
+	if err := RewritePNG(&again, buf.Bytes(), func(c Chunk) bool { return c.Type == "tEXt" }); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(again.Bytes(), b) {
+		t.Error("expected dropping chunks to restore the original")
+	}
+}
+
+func TestMalformed(t *testing.T) {
+	for _, b := range [][]byte{testJPEG(t), testPNG(t)} {
+		for i := range b {
+			JPEGSegments(b[:i])
+			PNGChunks(b[:i])
+			RewriteJPEG(&bytes.Buffer{}, b[:i], func(Segment) bool { return false })
+			RewritePNG(&bytes.Buffer{}, b[:i], func(Chunk) bool { return false })
+		}
+	}
+
+	if _, _, err := JPEGSegments([]byte{0xff, 0xd8, 0xff, 0xe1, 0x00, 0x01}); err != ErrBadJPEG {
+		t.Errorf("expected ErrBadJPEG for short segment length, got %v", err)
+	}
+	if _, err := PNGChunks(append(append([]byte{}, PNGSignature...), 0xff, 0xff, 0xff, 0xff, 'I', 'D', 'A', 'T', 0, 0, 0, 0)); err != ErrBadPNG {
+		t.Errorf("expected ErrBadPNG for overlong chunk, got %v", err)
+	}
+}
@@ -43,12 +43,11 @@ func LinearC(value float64) utils.Composable {
 	return func(c color.Color) color.Color {
 		r, g, b, a := utils.RatioRGBA(c)
 
-		r = utils.Truncatef((((r - 0.5) * value) + 0.5) * 255)
-		g = utils.Truncatef((((g - 0.5) * value) + 0.5) * 255)
-		b = utils.Truncatef((((b - 0.5) * value) + 0.5) * 255)
-		a = a * 255
+		r = ((r - 0.5) * value) + 0.5
+		g = ((g - 0.5) * value) + 0.5
+		b = ((b - 0.5) * value) + 0.5
 
-		return color.NRGBA{uint8(r), uint8(g), uint8(b), uint8(a)}
+		return utils.RatioNRGBA(r, g, b, a)
 	}
 }
 
@@ -101,11 +100,10 @@ func SigmoidalC(factor, midpoint float64) utils.Composable {
 	return func(c color.Color) color.Color {
 		r, g, b, a := utils.RatioRGBA(c)
 
-		r = utils.Truncatef(scaledSigmoidal(r) * 255)
-		g = utils.Truncatef(scaledSigmoidal(g) * 255)
-		b = utils.Truncatef(scaledSigmoidal(b) * 255)
-		a = a * 255
+		r = scaledSigmoidal(r)
+		g = scaledSigmoidal(g)
+		b = scaledSigmoidal(b)
 
-		return color.NRGBA{uint8(r), uint8(g), uint8(b), uint8(a)}
+		return utils.RatioNRGBA(r, g, b, a)
 	}
 }
@@ -0,0 +1,161 @@
+package crop
+
+import (
+	"errors"
+	"image"
+	"math"
+	"strconv"
+	"strings"
+
+	"hawx.me/code/img/utils"
+)
+
+// A Length is a number of pixels, or a percentage of the size of the image.
+type Length struct {
+	Value   float64
+	Percent bool
+}
+
+// Of returns the number of pixels the Length is for an image size pixels long.
+func (l Length) Of(size int) int {
+	if l.Percent {
+		return int(math.Round(l.Value * float64(size) / 100))
+	}
+	return int(l.Value)
+}
+
+// A Geometry describes a rectangle as WxH+X+Y, where X and Y are the offset of
+// its top-left corner from that of the image. Each value can be given as a
+// percentage, so 50%x50%+25%+25% is the middle of an image.
+type Geometry struct {
+	Width, Height Length
+	X, Y          Length
+
+	// Offset is false when no X and Y were given, the rectangle is then placed
+	// by direction instead.
+	Offset bool
+}
+
+var errGeometry = errors.New("geometry must be of the form WxH+X+Y")
+
+// ParseGeometry reads a Geometry from a string like "200x100+10+20",
+// "50%x100%" or "x100". A missing width or height is the full size of the
+// image.
+func ParseGeometry(s string) (Geometry, error) {
+	var g Geometry
+
+	size, offset := s, ""
+	if i := strings.IndexByte(s, '+'); i >= 0 {
+		size, offset = s[:i], s[i+1:]
+		g.Offset = true
+	}
+
+	w, h, ok := strings.Cut(size, "x")
+	if !ok {
+		return g, errGeometry
+	}
+
+	var err error
+	if g.Width, err = parseLength(w, true); err != nil {
+		return g, err
+	}
+	if g.Height, err = parseLength(h, true); err != nil {
+		return g, err
+	}
+
+	if g.Offset {
+		x, y, ok := strings.Cut(offset, "+")
+		if !ok {
+			return g, errGeometry
+		}
+
+		if g.X, err = parseLength(x, false); err != nil {
+			return g, err
+		}
+		if g.Y, err = parseLength(y, false); err != nil {
+			return g, err
+		}
+	}
+
+	return g, nil
+}
+
+func parseLength(s string, size bool) (Length, error) {
+	if s == "" {
+		if size {
+			return Length{100, true}, nil
+		}
+		return Length{}, errGeometry
+	}
+
+	l := Length{}
+	if strings.HasSuffix(s, "%") {
+		s = strings.TrimSuffix(s, "%")
+		l.Percent = true
+	}
+
+	v, err := strconv.ParseFloat(s, 64)
+	if err != nil || v < 0 {
+		return l, errGeometry
+	}
+
+	l.Value = v
+	return l, nil
+}
+
+// Rect returns the rectangle the Geometry describes within b. If no offset was
+// given it is placed by direction.
+func (g Geometry) Rect(b image.Rectangle, direction utils.Direction) image.Rectangle {
+	w, h := g.Width.Of(b.Dx()), g.Height.Of(b.Dy())
+
+	if !g.Offset {
+		return utils.Anchor(b, w, h, direction)
+	}
+
+	min := b.Min.Add(image.Pt(g.X.Of(b.Dx()), g.Y.Of(b.Dy())))
+	return image.Rectangle{min, min.Add(image.Pt(w, h))}
+}
+
+// A Point is a position from the top-left corner of an image, where either
+// coordinate can be a percentage of the image's size.
+type Point struct {
+	X, Y Length
+}
+
+// In returns the position of the Point in the coordinates of an image with
+// bounds b.
+func (p Point) In(b image.Rectangle) image.Point {
+	return b.Min.Add(image.Pt(p.X.Of(b.Dx()), p.Y.Of(b.Dy())))
+}
+
+// ParsePoints reads a list of Points separated by spaces, each given as "x,y",
+// such as "0,0 100,0 50%,80".
+func ParsePoints(s string) ([]Point, error) {
+	var points []Point
+
+	for _, field := range strings.Fields(s) {
+		x, y, ok := strings.Cut(field, ",")
+		if !ok {
+			return nil, errPoints
+		}
+
+		var p Point
+		var err error
+		if p.X, err = parseLength(x, false); err != nil {
+			return nil, errPoints
+		}
+		if p.Y, err = parseLength(y, false); err != nil {
+			return nil, errPoints
+		}
+
+		points = append(points, p)
+	}
+
+	if len(points) < 3 {
+		return nil, errors.New("points must include at least 3 of the form x,y")
+	}
+
+	return points, nil
+}
+
+var errPoints = errors.New("points must be of the form x,y")
@@ -0,0 +1,114 @@
+package crop
+
+import (
+	"image"
+	"reflect"
+	"testing"
+
+	"hawx.me/code/img/utils"
+)
+
+func TestParseGeometry(t *testing.T) {
+	testCases := []struct {
+		in string
+		g  Geometry
+	}{
+		{"200x100+10+20", Geometry{Length{200, false}, Length{100, false}, Length{10, false}, Length{20, false}, true}},
+		{"50%x50%+25%+25%", Geometry{Length{50, true}, Length{50, true}, Length{25, true}, Length{25, true}, true}},
+		{"50%x100", Geometry{Length{50, true}, Length{100, false}, Length{}, Length{}, false}},
+		{"x100", Geometry{Length{100, true}, Length{100, false}, Length{}, Length{}, false}},
+		{"100x", Geometry{Length{100, false}, Length{100, true}, Length{}, Length{}, false}},
+		{"x+0+5", Geometry{Length{100, true}, Length{100, true}, Length{0, false}, Length{5, false}, true}},
+		{"1.5x2.5", Geometry{Length{1.5, false}, Length{2.5, false}, Length{}, Length{}, false}},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.in, func(t *testing.T) {
+			g, err := ParseGeometry(tc.in)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if g != tc.g {
+				t.Errorf("expected %+v, got %+v", tc.g, g)
+			}
+		})
+	}
+}
+
+func TestParseGeometryInvalid(t *testing.T) {
+	for _, in := range []string{
+		"",
+		"100",
+		"100+10+10",
+		"axb",
+		"-10x10",
+		"10x-10",
+		"10x10+5",
+		"10x10+5+",
+		"10x10++5",
+		"10x10+-5+0",
+		"10x10+5+5+5",
+		"10%%x10",
+	} {
+		if _, err := ParseGeometry(in); err != errGeometry {
+			t.Errorf("%q: expected %v, got %v", in, errGeometry, err)
+		}
+	}
+}
+
+func TestGeometryRect(t *testing.T) {
+	b := image.Rect(10, 20, 210, 120)
+
+	testCases := []struct {
+		in        string
+		direction utils.Direction
+		r         image.Rectangle
+	}{
+		{"50x40+10+20", utils.Centre, image.Rect(20, 40, 70, 80)},
+		{"50%x50%+25%+25%", utils.Centre, image.Rect(60, 45, 160, 95)},
+		{"x", utils.Centre, b},
+		{"50x40", utils.Centre, image.Rect(85, 50, 135, 90)},
+		{"50x40", utils.TopLeft, image.Rect(10, 20, 60, 60)},
+		{"50x40", utils.BottomRight, image.Rect(160, 80, 210, 120)},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.in, func(t *testing.T) {
+			g, err := ParseGeometry(tc.in)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if r := g.Rect(b, tc.direction); r != tc.r {
+				t.Errorf("expected %v, got %v", tc.r, r)
+			}
+		})
+	}
+}
+
+func TestParsePoints(t *testing.T) {
+	points, err := ParsePoints(" 0,0  100,0\t50%,80 ")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []Point{
+		{Length{0, false}, Length{0, false}},
+		{Length{100, false}, Length{0, false}},
+		{Length{50, true}, Length{80, false}},
+	}
+	if !reflect.DeepEqual(points, expected) {
+		t.Errorf("expected %v, got %v", expected, points)
+	}
+
+	if p := points[2].In(image.Rect(10, 10, 110, 110)); p != image.Pt(60, 90) {
+		t.Errorf("expected (60,90), got %v", p)
+	}
+}
+
+func TestParsePointsInvalid(t *testing.T) {
+	for _, in := range []string{"", "0,0 1,1", "0,0 1,1 2", "0,0 1,1 a,2", "0,0 1,1 2,", "0,0 1,1 -2,2"} {
+		if _, err := ParsePoints(in); err == nil {
+			t.Errorf("%q: expected error", in)
+		}
+	}
+}
@@ -0,0 +1,194 @@
+package crop
+
+import (
+	"image"
+	"image/color"
+	"math"
+
+	"golang.org/x/image/vector"
+	"hawx.me/code/img/utils"
+)
+
+// kappa is the distance, as a fraction of the radius, to place the control
+// points of a cubic Bézier curve that approximates a quarter of a circle.
+const kappa = 0.5522847498
+
+// A pen draws the outline of a shape. It is satisfied by *vector.Rasterizer,
+// which fills the outline with anti-aliased coverage.
+type pen interface {
+	MoveTo(ax, ay float32)
+	LineTo(bx, by float32)
+	QuadTo(bx, by, cx, cy float32)
+	CubeTo(bx, by, cx, cy, dx, dy float32)
+	ClosePath()
+}
+
+// cropToShape crops an Image to the shape drawn by f, which is given a pen with
+// coordinates relative to the top-left corner of the image. Pixels on the edge
+// of the shape are made partly transparent by how much of them it covers.
+func cropToShape(img image.Image, f func(p pen)) image.Image {
+	b := img.Bounds()
+
+	z := vector.NewRasterizer(b.Dx(), b.Dy())
+	f(z)
+
+	mask := image.NewAlpha(z.Bounds())
+	z.Draw(mask, mask.Bounds(), image.Opaque, image.Point{})
+
+	return cropToMask(img, mask)
+}
+
+// cropToMask draws a new Image with the pixels of img, made transparent by the
+// mask, which has its origin at the top-left corner of img. The result is
+// cropped to the pixels that the mask does not completely hide.
+func cropToMask(img image.Image, mask *image.Alpha) image.Image {
+	b := img.Bounds()
+	o := utils.NewImageFor(img, b)
+
+	var r image.Rectangle
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		for x := b.Min.X; x < b.Max.X; x++ {
+			m := uint32(mask.AlphaAt(x-b.Min.X, y-b.Min.Y).A) * 0x101
+			if m == 0 {
+				continue
+			}
+
+			r = r.Union(image.Rect(x, y, x+1, y+1))
+
+			cr, cg, cb, ca := img.At(x, y).RGBA()
+			o.Set(x, y, color.RGBA64{
+				uint16(cr * m / 0xffff),
+				uint16(cg * m / 0xffff),
+				uint16(cb * m / 0xffff),
+				uint16(ca * m / 0xffff),
+			})
+		}
+	}
+
+	return Rectangle(o, r)
+}
+
+// Polygon crops an Image to the polygon with the points given, in the
+// coordinates of the image. Where the outline crosses itself, parts that it
+// surrounds more than once are kept.
+func Polygon(img image.Image, points []image.Point) image.Image {
+	b := img.Bounds()
+
+	return cropToShape(img, func(p pen) {
+		if len(points) < 3 {
+			return
+		}
+
+		for i, pt := range points {
+			pt = pt.Sub(b.Min)
+			if i == 0 {
+				p.MoveTo(float32(pt.X), float32(pt.Y))
+			} else {
+				p.LineTo(float32(pt.X), float32(pt.Y))
+			}
+		}
+		p.ClosePath()
+	})
+}
+
+// RoundedRect crops an Image to the rectangle r, in the coordinates of the
+// image, with its corners rounded to the radius given. A negative radius is
+// treated as 0, giving square corners.
+func RoundedRect(img image.Image, r image.Rectangle, radius int) image.Image {
+	r = r.Sub(img.Bounds().Min)
+	if radius < 0 {
+		radius = 0
+	}
+
+	return cropToShape(img, func(p pen) {
+		minX, minY := float32(r.Min.X), float32(r.Min.Y)
+		maxX, maxY := float32(r.Max.X), float32(r.Max.Y)
+
+		rad := float32(radius)
+		rad = float32(math.Min(float64(rad), math.Min(float64(maxX-minX), float64(maxY-minY))/2))
+		k := rad * (1 - kappa)
+
+		p.MoveTo(minX+rad, minY)
+		p.LineTo(maxX-rad, minY)
+		p.CubeTo(maxX-k, minY, maxX, minY+k, maxX, minY+rad)
+		p.LineTo(maxX, maxY-rad)
+		p.CubeTo(maxX, maxY-k, maxX-k, maxY, maxX-rad, maxY)
+		p.LineTo(minX+rad, maxY)
+		p.CubeTo(minX+k, maxY, minX, maxY-k, minX, maxY-rad)
+		p.LineTo(minX, minY+rad)
+		p.CubeTo(minX, minY+k, minX+k, minY, minX+rad, minY)
+		p.ClosePath()
+	})
+}
+
+// Ellipse crops an Image to the ellipse that fits within r, in the coordinates
+// of the image.
+func Ellipse(img image.Image, r image.Rectangle) image.Image {
+	r = r.Sub(img.Bounds().Min)
+
+	return cropToShape(img, func(p pen) {
+		cx := float32(r.Min.X+r.Max.X) / 2
+		cy := float32(r.Min.Y+r.Max.Y) / 2
+		rx, ry := float32(r.Dx())/2, float32(r.Dy())/2
+		kx, ky := rx*kappa, ry*kappa
+
+		p.MoveTo(cx, cy-ry)
+		p.CubeTo(cx+kx, cy-ry, cx+rx, cy-ky, cx+rx, cy)
+		p.CubeTo(cx+rx, cy+ky, cx+kx, cy+ry, cx, cy+ry)
+		p.CubeTo(cx-kx, cy+ry, cx-rx, cy+ky, cx-rx, cy)
+		p.CubeTo(cx-rx, cy-ky, cx-kx, cy-ry, cx, cy-ry)
+		p.ClosePath()
+	})
+}
+
+// RegularPolygon crops an Image to a polygon with the number of sides given,
+// pointing upwards, that fits in a square of size pixels. It will use the
+// widest possible size if the given size is negative.
+func RegularPolygon(img image.Image, sides, size int, direction utils.Direction) image.Image {
+	return Star(img, sides, 1, size, direction)
+}
+
+// Star crops an Image to a star with the number of points given, pointing
+// upwards, that fits in a square of size pixels. The inner corners are placed at
+// inner times the distance of the points from the centre, so an inner of 1 gives
+// a regular polygon. It will use the widest possible size if the given size is
+// negative.
+func Star(img image.Image, points int, inner float64, size int, direction utils.Direction) image.Image {
+	b := img.Bounds()
+
+	if size < 0 {
+		size = b.Dx()
+		if b.Dy() < b.Dx() {
+			size = b.Dy()
+		}
+	}
+
+	r := utils.Anchor(b, size, size, direction).Sub(b.Min)
+	cx := float64(r.Min.X+r.Max.X) / 2
+	cy := float64(r.Min.Y+r.Max.Y) / 2
+	outer := float64(size) / 2
+
+	return cropToShape(img, func(p pen) {
+		if points < 3 {
+			return
+		}
+
+		for i := 0; i < 2*points; i++ {
+			radius := outer
+			if i%2 == 1 {
+				radius *= inner
+			}
+
+			angle := float64(i) * math.Pi / float64(points)
+			x := float32(cx + radius*math.Sin(angle))
+			y := float32(cy - radius*math.Cos(angle))
+
+			if i == 0 {
+				p.MoveTo(x, y)
+			} else {
+				p.LineTo(x, y)
+			}
+		}
+		p.ClosePath()
+	})
+}
@@ -0,0 +1,112 @@
+package crop
+
+import (
+	"image"
+	"image/color"
+	"image/draw"
+	"testing"
+
+	"hawx.me/code/img/utils"
+)
+
+func opaqueImage(r image.Rectangle) *image.NRGBA {
+	img := image.NewNRGBA(r)
+	draw.Draw(img, r, image.NewUniform(color.NRGBA{200, 100, 50, 255}), image.Point{}, draw.Src)
+	return img
+}
+
+func alphaAt(img image.Image, x, y int) uint32 {
+	_, _, _, a := img.At(x, y).RGBA()
+	return a
+}
+
+func TestShapeBounds(t *testing.T) {
+	img := opaqueImage(image.Rect(10, 10, 50, 40))
+
+	testCases := []struct {
+		name   string
+		out    image.Image
+		bounds image.Rectangle
+	}{
+		{"polygon", Polygon(img, []image.Point{{15, 15}, {35, 15}, {15, 30}}), image.Rect(0, 0, 20, 15)},
+		{"polygon outside", Polygon(img, []image.Point{{0, 0}, {40, 0}, {0, 40}}), image.Rect(0, 0, 20, 20)},
+		{"rounded rect", RoundedRect(img, image.Rect(12, 13, 22, 23), 3), image.Rect(0, 0, 10, 10)},
+		{"rounded rect large radius", RoundedRect(img, image.Rect(12, 13, 22, 23), 100), image.Rect(0, 0, 10, 10)},
+		{"rounded rect negative radius", RoundedRect(img, image.Rect(12, 13, 22, 23), -5), image.Rect(0, 0, 10, 10)},
+		{"ellipse", Ellipse(img, image.Rect(10, 10, 50, 30)), image.Rect(0, 0, 40, 20)},
+		{"regular polygon", RegularPolygon(img, 4, 20, utils.TopLeft), image.Rect(0, 0, 20, 20)},
+		{"star", Star(img, 5, 0.5, -1, utils.Centre), image.Rect(0, 0, 30, 28)},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			if b := tc.out.Bounds(); b != tc.bounds {
+				t.Errorf("expected bounds %v, got %v", tc.bounds, b)
+			}
+		})
+	}
+}
+
+func TestRoundedRect(t *testing.T) {
+	img := opaqueImage(image.Rect(0, 0, 20, 20))
+
+	square := RoundedRect(img, image.Rect(2, 2, 12, 12), -5)
+	for _, p := range []image.Point{{0, 0}, {9, 0}, {0, 9}, {9, 9}, {5, 5}} {
+		if a := alphaAt(square, p.X, p.Y); a != 0xffff {
+			t.Errorf("expected square corner %v to be opaque, got %v", p, a)
+		}
+	}
+
+	rounded := RoundedRect(img, image.Rect(2, 2, 12, 12), 4)
+	if a := alphaAt(rounded, 0, 0); a != 0 {
+		t.Errorf("expected rounded corner to be transparent, got %v", a)
+	}
+	if a := alphaAt(rounded, 5, 5); a != 0xffff {
+		t.Errorf("expected middle to be opaque, got %v", a)
+	}
+}
+
+func TestEllipse(t *testing.T) {
+	img := opaqueImage(image.Rect(0, 0, 40, 20))
+	out := Ellipse(img, img.Bounds())
+
+	if a := alphaAt(out, 20, 10); a != 0xffff {
+		t.Errorf("expected centre to be opaque, got %v", a)
+	}
+	for _, p := range []image.Point{{0, 0}, {39, 0}, {0, 19}, {39, 19}} {
+		if a := alphaAt(out, p.X, p.Y); a != 0 {
+			t.Errorf("expected corner %v to be transparent, got %v", p, a)
+		}
+	}
+
+	// Pixels on the edge are partly covered.
+	partial := false
+	for x := 0; x < 40; x++ {
+		if a := alphaAt(out, x, 0); a > 0 && a < 0xffff {
+			partial = true
+		}
+	}
+	if !partial {
+		t.Error("expected edge of ellipse to be anti-aliased")
+	}
+}
+
+func TestShapeColours(t *testing.T) {
+	img := opaqueImage(image.Rect(0, 0, 20, 20))
+	out := Polygon(img, []image.Point{{0, 0}, {20, 0}, {20, 20}, {0, 20}})
+
+	if c := color.NRGBAModel.Convert(out.At(7, 7)); c != (color.NRGBA{200, 100, 50, 255}) {
+		t.Errorf("expected colour to be kept, got %v", c)
+	}
+}
+
+func TestTooFewPoints(t *testing.T) {
+	img := opaqueImage(image.Rect(0, 0, 20, 20))
+
+	if b := Polygon(img, []image.Point{{0, 0}, {10, 10}}).Bounds(); !b.Empty() {
+		t.Errorf("expected empty polygon, got %v", b)
+	}
+	if b := Star(img, 2, 0.5, 10, utils.Centre).Bounds(); !b.Empty() {
+		t.Errorf("expected empty star, got %v", b)
+	}
+}
@@ -0,0 +1,335 @@
+package crop
+
+import (
+	"errors"
+	"fmt"
+	"image"
+	"math"
+	"strconv"
+)
+
+// Path crops an Image to the shape outlined by an SVG path, such as
+// "M 10 10 L 90 10 Q 50 50 10 10 Z", with coordinates relative to the top-left
+// corner of the image. The commands M, L, H, V, C, Q, A and Z are supported,
+// along with their relative lowercase forms. Any shape left open is closed.
+func Path(img image.Image, d string) (image.Image, error) {
+	o, err := parsePath(d)
+	if err != nil {
+		return nil, err
+	}
+
+	return cropToShape(img, o.draw), nil
+}
+
+// A segment is one part of an outline. Op is one of 'M', 'L', 'Q', 'C' or 'Z',
+// and Args holds the coordinates it needs in order.
+type segment struct {
+	Op   byte
+	Args []float64
+}
+
+type outline []segment
+
+func (o outline) draw(p pen) {
+	for _, s := range o {
+		a := make([]float32, len(s.Args))
+		for i, v := range s.Args {
+			a[i] = float32(v)
+		}
+
+		switch s.Op {
+		case 'M':
+			p.MoveTo(a[0], a[1])
+		case 'L':
+			p.LineTo(a[0], a[1])
+		case 'Q':
+			p.QuadTo(a[0], a[1], a[2], a[3])
+		case 'C':
+			p.CubeTo(a[0], a[1], a[2], a[3], a[4], a[5])
+		case 'Z':
+			p.ClosePath()
+		}
+	}
+}
+
+// parsePath reads the path data given into an outline of absolute segments.
+// Arcs are converted to cubic curves.
+func parsePath(d string) (outline, error) {
+	var (
+		o              outline
+		s              = pathScanner{d: d}
+		cmd            byte
+		x, y           float64
+		startX, startY float64
+		open           bool
+	)
+
+	// begin starts a new shape at the current point, if one is not already
+	// being drawn, as happens when a command follows Z.
+	begin := func() {
+		if !open {
+			o = append(o, segment{'M', []float64{x, y}})
+			startX, startY = x, y
+			open = true
+		}
+	}
+
+	for {
+		s.skip()
+		if s.done() {
+			break
+		}
+
+		if c := s.peek(); isLetter(c) {
+			cmd = c
+			s.i++
+		} else if cmd == 0 {
+			return nil, errors.New("path must start with a command")
+		} else if cmd == 'Z' || cmd == 'z' {
+			return nil, fmt.Errorf("path has unexpected number at %d", s.i)
+		}
+
+		relative := cmd >= 'a'
+		var dx, dy float64
+		if relative {
+			dx, dy = x, y
+		}
+
+		switch cmd {
+		case 'M', 'm':
+			a, err := s.numbers(2)
+			if err != nil {
+				return nil, err
+			}
+			if open {
+				o = append(o, segment{'Z', nil})
+			}
+
+			x, y = a[0]+dx, a[1]+dy
+			startX, startY = x, y
+			o = append(o, segment{'M', []float64{x, y}})
+			open = true
+
+			// Any further pairs of coordinates are lines.
+			if relative {
+				cmd = 'l'
+			} else {
+				cmd = 'L'
+			}
+
+		case 'L', 'l':
+			a, err := s.numbers(2)
+			if err != nil {
+				return nil, err
+			}
+			begin()
+			x, y = a[0]+dx, a[1]+dy
+			o = append(o, segment{'L', []float64{x, y}})
+
+		case 'H', 'h':
+			a, err := s.numbers(1)
+			if err != nil {
+				return nil, err
+			}
+			begin()
+			x = a[0] + dx
+			o = append(o, segment{'L', []float64{x, y}})
+
+		case 'V', 'v':
+			a, err := s.numbers(1)
+			if err != nil {
+				return nil, err
+			}
+			begin()
+			y = a[0] + dy
+			o = append(o, segment{'L', []float64{x, y}})
+
+		case 'Q', 'q':
+			a, err := s.numbers(4)
+			if err != nil {
+				return nil, err
+			}
+			begin()
+			o = append(o, segment{'Q', []float64{a[0] + dx, a[1] + dy, a[2] + dx, a[3] + dy}})
+			x, y = a[2]+dx, a[3]+dy
+
+		case 'C', 'c':
+			a, err := s.numbers(6)
+			if err != nil {
+				return nil, err
+			}
+			begin()
+			o = append(o, segment{'C', []float64{a[0] + dx, a[1] + dy, a[2] + dx, a[3] + dy, a[4] + dx, a[5] + dy}})
+			x, y = a[4]+dx, a[5]+dy
+
+		case 'A', 'a':
+			a, err := s.numbers(7)
+			if err != nil {
+				return nil, err
+			}
+			if (a[3] != 0 && a[3] != 1) || (a[4] != 0 && a[4] != 1) {
+				return nil, errors.New("path has arc flags that are not 0 or 1")
+			}
+			begin()
+			o = append(o, arc(x, y, a[0], a[1], a[2], a[3] == 1, a[4] == 1, a[5]+dx, a[6]+dy)...)
+			x, y = a[5]+dx, a[6]+dy
+
+		case 'Z', 'z':
+			if open {
+				o = append(o, segment{'Z', nil})
+				open = false
+			}
+			x, y = startX, startY
+
+		default:
+			return nil, fmt.Errorf("path has unsupported command %q", cmd)
+		}
+	}
+
+	if open {
+		o = append(o, segment{'Z', nil})
+	}
+
+	return o, nil
+}
+
+// arc returns the segments for an elliptical arc from (x1, y1) to (x2, y2), as
+// described by the SVG A command, where phi is in degrees.
+func arc(x1, y1, rx, ry, phi float64, large, sweep bool, x2, y2 float64) []segment {
+	if x1 == x2 && y1 == y2 {
+		return nil
+	}
+
+	rx, ry = math.Abs(rx), math.Abs(ry)
+	if rx == 0 || ry == 0 {
+		return []segment{{'L', []float64{x2, y2}}}
+	}
+
+	sin, cos := math.Sincos(phi * math.Pi / 180)
+
+	// Find the centre of the ellipse, following the SVG specification's
+	// conversion from endpoint to centre parameterization.
+	hx, hy := (x1-x2)/2, (y1-y2)/2
+	px := cos*hx + sin*hy
+	py := -sin*hx + cos*hy
+
+	if l := px*px/(rx*rx) + py*py/(ry*ry); l > 1 {
+		rx *= math.Sqrt(l)
+		ry *= math.Sqrt(l)
+	}
+
+	num := rx*rx*ry*ry - rx*rx*py*py - ry*ry*px*px
+	den := rx*rx*py*py + ry*ry*px*px
+	coef := math.Sqrt(math.Max(0, num/den))
+	if large == sweep {
+		coef = -coef
+	}
+
+	pcx, pcy := coef*rx*py/ry, -coef*ry*px/rx
+	cx := cos*pcx - sin*pcy + (x1+x2)/2
+	cy := sin*pcx + cos*pcy + (y1+y2)/2
+
+	theta := math.Atan2((py-pcy)/ry, (px-pcx)/rx)
+	delta := math.Atan2((-py-pcy)/ry, (-px-pcx)/rx) - theta
+	if sweep && delta < 0 {
+		delta += 2 * math.Pi
+	} else if !sweep && delta > 0 {
+		delta -= 2 * math.Pi
+	}
+
+	point := func(t float64) (float64, float64) {
+		st, ct := math.Sincos(t)
+		return cx + rx*ct*cos - ry*st*sin, cy + rx*ct*sin + ry*st*cos
+	}
+	tangent := func(t float64) (float64, float64) {
+		st, ct := math.Sincos(t)
+		return -rx*st*cos - ry*ct*sin, -rx*st*sin + ry*ct*cos
+	}
+
+	// Each part of no more than a quarter turn is drawn as a cubic curve.
+	n := int(math.Ceil(math.Abs(delta) / (math.Pi / 2)))
+	step := delta / float64(n)
+	k := 4.0 / 3 * math.Tan(step/4)
+
+	segments := make([]segment, n)
+	for i := range segments {
+		t1, t2 := theta+float64(i)*step, theta+float64(i+1)*step
+
+		ax, ay := point(t1)
+		adx, ady := tangent(t1)
+		bx, by := point(t2)
+		bdx, bdy := tangent(t2)
+		if i == n-1 {
+			bx, by = x2, y2
+		}
+
+		segments[i] = segment{'C', []float64{ax + k*adx, ay + k*ady, bx - k*bdx, by - k*bdy, bx, by}}
+	}
+
+	return segments
+}
+
+// A pathScanner reads the commands and numbers of SVG path data.
+type pathScanner struct {
+	d string
+	i int
+}
+
+func (s *pathScanner) done() bool { return s.i >= len(s.d) }
+func (s *pathScanner) peek() byte { return s.d[s.i] }
+
+// skip moves past any whitespace and commas.
+func (s *pathScanner) skip() {
+	for !s.done() {
+		switch s.peek() {
+		case ' ', '\t', '\n', '\r', ',':
+			s.i++
+		default:
+			return
+		}
+	}
+}
+
+// numbers reads the next n numbers.
+func (s *pathScanner) numbers(n int) ([]float64, error) {
+	a := make([]float64, n)
+
+	for j := range a {
+		s.skip()
+		start := s.i
+
+		if !s.done() && (s.peek() == '+' || s.peek() == '-') {
+			s.i++
+		}
+		dot, exp := false, false
+		for !s.done() {
+			c := s.peek()
+			if c >= '0' && c <= '9' {
+				s.i++
+			} else if c == '.' && !dot && !exp {
+				dot = true
+				s.i++
+			} else if (c == 'e' || c == 'E') && !exp && s.i > start {
+				exp = true
+				s.i++
+				if !s.done() && (s.peek() == '+' || s.peek() == '-') {
+					s.i++
+				}
+			} else {
+				break
+			}
+		}
+
+		v, err := strconv.ParseFloat(s.d[start:s.i], 64)
+		if err != nil {
+			return nil, fmt.Errorf("path expected a number at %d", start)
+		}
+		a[j] = v
+	}
+
+	return a, nil
+}
+
+func isLetter(c byte) bool {
+	return (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z')
+}
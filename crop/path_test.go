@@ -0,0 +1,129 @@
+package crop
+
+import (
+	"image"
+	"image/color"
+	"image/draw"
+	"math"
+	"reflect"
+	"testing"
+)
+
+func TestParsePath(t *testing.T) {
+	testCases := []struct {
+		name string
+		d    string
+		o    outline
+	}{
+		{"lines", "M 10 10 L 90 10 L 50 50 Z", outline{
+			{'M', []float64{10, 10}}, {'L', []float64{90, 10}}, {'L', []float64{50, 50}}, {'Z', nil},
+		}},
+		{"implicit lines", "M10,10 90,10 50,50", outline{
+			{'M', []float64{10, 10}}, {'L', []float64{90, 10}}, {'L', []float64{50, 50}}, {'Z', nil},
+		}},
+		{"relative", "m10 10 l80 0 -40 40z", outline{
+			{'M', []float64{10, 10}}, {'L', []float64{90, 10}}, {'L', []float64{50, 50}}, {'Z', nil},
+		}},
+		{"horizontal and vertical", "M1 2 H5 V6 h-2 v-1", outline{
+			{'M', []float64{1, 2}}, {'L', []float64{5, 2}}, {'L', []float64{5, 6}}, {'L', []float64{3, 6}}, {'L', []float64{3, 5}}, {'Z', nil},
+		}},
+		{"curves", "M0 0 Q5 10 10 0 c1 1 2 2 3 3", outline{
+			{'M', []float64{0, 0}}, {'Q', []float64{5, 10, 10, 0}}, {'C', []float64{11, 1, 12, 2, 13, 3}}, {'Z', nil},
+		}},
+		{"numbers", "M-1.5e1+2 L.5.5 L1e-1-3", outline{
+			{'M', []float64{-15, 2}}, {'L', []float64{0.5, 0.5}}, {'L', []float64{0.1, -3}}, {'Z', nil},
+		}},
+		{"after close", "M10 10 L20 10 L20 20 Z l0 5 l5 0", outline{
+			{'M', []float64{10, 10}}, {'L', []float64{20, 10}}, {'L', []float64{20, 20}}, {'Z', nil},
+			{'M', []float64{10, 10}}, {'L', []float64{10, 15}}, {'L', []float64{15, 15}}, {'Z', nil},
+		}},
+		{"moves", "M0 0 L1 1 M5 5 L6 6", outline{
+			{'M', []float64{0, 0}}, {'L', []float64{1, 1}}, {'Z', nil},
+			{'M', []float64{5, 5}}, {'L', []float64{6, 6}}, {'Z', nil},
+		}},
+		{"empty", "  ", nil},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			o, err := parsePath(tc.d)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(o, tc.o) {
+				t.Errorf("expected %v, got %v", tc.o, o)
+			}
+		})
+	}
+}
+
+func TestParsePathArc(t *testing.T) {
+	o, err := parsePath("M 0 50 A 50 50 0 0 1 100 50")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(o) < 3 || o[0].Op != 'M' || o[len(o)-1].Op != 'Z' {
+		t.Fatalf("expected move, curves and close, got %v", o)
+	}
+
+	for _, s := range o[1 : len(o)-1] {
+		if s.Op != 'C' {
+			t.Fatalf("expected arc to be made of cubic curves, got %v", o)
+		}
+
+		// The ends of each curve should lie on the circle.
+		x, y := s.Args[4], s.Args[5]
+		if d := math.Hypot(x-50, y-50); math.Abs(d-50) > 1e-6 {
+			t.Errorf("expected (%v,%v) to be 50 from the centre, got %v", x, y, d)
+		}
+		if y > 50+1e-6 {
+			t.Errorf("expected sweep to go through the top half, got (%v,%v)", x, y)
+		}
+	}
+
+	if end := o[len(o)-2].Args; math.Abs(end[4]-100) > 1e-6 || math.Abs(end[5]-50) > 1e-6 {
+		t.Errorf("expected arc to end at (100,50), got (%v,%v)", end[4], end[5])
+	}
+}
+
+func TestParsePathInvalid(t *testing.T) {
+	testCases := []struct {
+		d   string
+		err string
+	}{
+		{"10 10 L 20 20", "path must start with a command"},
+		{"M 10 10 B 20 20", `path has unsupported command 'B'`},
+		{"M 10", "path expected a number at 4"},
+		{"M 10 x", "path expected a number at 5"},
+		{"M 10 10 Z 5", "path has unexpected number at 10"},
+		{"M 0 0 A 5 5 0 2 0 10 10", "path has arc flags that are not 0 or 1"},
+	}
+
+	for _, tc := range testCases {
+		if _, err := parsePath(tc.d); err == nil || err.Error() != tc.err {
+			t.Errorf("%q: expected error %q, got %v", tc.d, tc.err, err)
+		}
+	}
+}
+
+func TestPath(t *testing.T) {
+	img := image.NewNRGBA(image.Rect(10, 10, 110, 110))
+	draw.Draw(img, img.Bounds(), image.NewUniform(color.NRGBA{0, 0, 255, 255}), image.Point{}, draw.Src)
+
+	out, err := Path(img, "M 20 20 h 40 v 30 h -40 z")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if b := out.Bounds(); b != image.Rect(0, 0, 40, 30) {
+		t.Errorf("expected bounds (0,0)-(40,30), got %v", b)
+	}
+	if _, _, _, a := out.At(20, 15).RGBA(); a != 0xffff {
+		t.Errorf("expected inside of path to be opaque, got %v", a)
+	}
+
+	if _, err := Path(img, "M 10"); err == nil {
+		t.Error("expected error for bad path")
+	}
+}
@@ -0,0 +1,38 @@
+package crop
+
+import (
+	"image"
+	"image/draw"
+
+	"hawx.me/code/img/utils"
+)
+
+// Rectangle crops an Image to the part within r, given in the coordinates of the
+// image. The result is moved so that its top-left corner is at the origin. Any
+// part of r outside of the image is dropped.
+func Rectangle(img image.Image, r image.Rectangle) image.Image {
+	r = r.Intersect(img.Bounds())
+	bounds := r.Sub(r.Min)
+
+	if l, ok := img.(*utils.Linear); ok {
+		out := utils.NewLinear(bounds)
+		for y := 0; y < bounds.Dy(); y++ {
+			from := l.PixOffset(r.Min.X, r.Min.Y+y)
+			copy(out.Pix[out.PixOffset(0, y):out.PixOffset(0, y+1)], l.Pix[from:])
+		}
+		return out
+	}
+
+	out := utils.NewImageFor(img, bounds)
+	draw.Draw(out, bounds, img, r.Min, draw.Src)
+	return out
+}
+
+// Aspect crops an Image to the largest rectangle with a width to height ratio of
+// width:height, placed within the image by direction.
+func Aspect(img image.Image, width, height float64, direction utils.Direction) image.Image {
+	b := img.Bounds()
+	w, h := fitRatio(b.Dx(), b.Dy(), width, height)
+
+	return Rectangle(img, utils.Anchor(b, w, h, direction))
+}
@@ -0,0 +1,202 @@
+package crop
+
+import (
+	"image"
+	"image/color"
+	"math"
+
+	"hawx.me/code/img/blur"
+	"hawx.me/code/img/channel"
+	"hawx.me/code/img/resize"
+	"hawx.me/code/img/utils"
+)
+
+// smartSize is the length of the longest side of the copy of the image that is
+// looked at to find the interesting parts. Larger images are scaled down first
+// as detail smaller than this is not needed.
+const smartSize = 256
+
+// The weights given to each measure of how interesting a pixel is.
+const (
+	edgeWeight       = 1.0
+	saturationWeight = 0.5
+	skinWeight       = 1.5
+)
+
+// skinColour is the direction, of a vector of red, green and blue, that skin
+// tones lie close to.
+var skinColour = [3]float64{0.78, 0.57, 0.44}
+
+// Smart crops an Image to width by height pixels, keeping the part that is most
+// likely to be interesting. The largest window with the same aspect ratio is
+// moved across the image to find where it covers the most edges, saturated
+// colour and skin tones, favouring those near its centre, then it is scaled to
+// the size given. Where nothing stands out the centre is kept.
+func Smart(img image.Image, width, height int) image.Image {
+	b := img.Bounds()
+	if b.Empty() || width <= 0 || height <= 0 {
+		return img
+	}
+
+	w, h := fitRatio(b.Dx(), b.Dy(), float64(width), float64(height))
+
+	small, scale := img, 1.0
+	if long := math.Max(float64(b.Dx()), float64(b.Dy())); long > smartSize {
+		scale = smartSize / long
+		small = resize.Resize(img,
+			int(math.Max(1, math.Round(float64(b.Dx())*scale))),
+			int(math.Max(1, math.Round(float64(b.Dy())*scale))),
+			resize.Bilinear)
+	}
+
+	sb := small.Bounds()
+	sw := int(math.Min(float64(sb.Dx()), math.Round(float64(w)*scale)))
+	sh := int(math.Min(float64(sb.Dy()), math.Round(float64(h)*scale)))
+
+	table := newSummedArea(interest(small), sb.Dx(), sb.Dy())
+	// The window is scored by the sum of three nested rectangles, of the whole,
+	// two-thirds and one-third of its size, so that the interesting parts are
+	// kept away from its edges.
+	score := func(x, y int) float64 {
+		total := 0.0
+		for i := 0; i < 3; i++ {
+			dx, dy := i*sw/6, i*sh/6
+			total += table.sum(image.Rect(x+dx, y+dy, x+sw-dx, y+sh-dy))
+		}
+		return total
+	}
+
+	// Start at the centre so that it is kept unless somewhere else scores
+	// better, then prefer the closest to the centre for equal scores.
+	cx, cy := (sb.Dx()-sw)/2, (sb.Dy()-sh)/2
+	bestX, bestY, best := cx, cy, score(cx, cy)
+	distance := func(x, y int) int { return abs(x-cx) + abs(y-cy) }
+
+	for y := 0; y <= sb.Dy()-sh; y++ {
+		for x := 0; x <= sb.Dx()-sw; x++ {
+			s := score(x, y)
+			if s > best+1e-9 || (s > best-1e-9 && distance(x, y) < distance(bestX, bestY)) {
+				bestX, bestY, best = x, y, s
+			}
+		}
+	}
+
+	x := int(math.Round(float64(bestX) / scale))
+	y := int(math.Round(float64(bestY) / scale))
+	x = int(math.Max(0, math.Min(float64(b.Dx()-w), float64(x))))
+	y = int(math.Max(0, math.Min(float64(b.Dy()-h), float64(y))))
+
+	out := Rectangle(img, image.Rect(x, y, x+w, y+h).Add(b.Min))
+	if w != width || h != height {
+		out = resize.Resize(out, width, height, resize.Lanczos3)
+	}
+
+	return out
+}
+
+// fitRatio returns the size of the largest rectangle with a width to height
+// ratio of width:height that fits within dx by dy.
+func fitRatio(dx, dy int, width, height float64) (int, int) {
+	if float64(dx)/float64(dy) > width/height {
+		return int(math.Max(1, math.Round(float64(dy)*width/height))), dy
+	}
+	return dx, int(math.Max(1, math.Round(float64(dx)*height/width)))
+}
+
+// interest returns a score for each pixel of the image, row by row, of how
+// likely it is to be part of something interesting.
+func interest(img image.Image) []float64 {
+	b := img.Bounds()
+	w, h := b.Dx(), b.Dy()
+
+	lum := image.NewGray16(image.Rect(0, 0, w, h))
+	out := make([]float64, w*h)
+
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			c := img.At(b.Min.X+x, b.Min.Y+y)
+			r, g, bl, a := utils.RatioRGBA(c)
+			lum.SetGray16(x, y, color.Gray16{uint16((0.2126*r+0.7152*g+0.0722*bl)*a*0xffff + 0.5)})
+
+			l := channel.Lightness.Get(c)
+			lightness := 1 - math.Abs(2*l-1)
+
+			out[y*w+x] = a * (saturationWeight*channel.Saturation.Get(c)*lightness +
+				skinWeight*skin(r, g, bl)*math.Min(1, 2*lightness))
+		}
+	}
+
+	// The result of blur.ConvolveColor can't be negative, so each kernel is
+	// applied as is and inverted to find both directions of change. They are
+	// scaled by a quarter so that the largest change is 1.
+	var edges []image.Image
+	for _, k := range []blur.Kernel{blur.SobelX, blur.SobelY} {
+		edges = append(edges,
+			blur.ConvolveColor(lum, k.Scaled(0.25), blur.CLAMP),
+			blur.ConvolveColor(lum, k.Scaled(-0.25), blur.CLAMP))
+	}
+
+	value := func(img image.Image, x, y int) float64 {
+		v, _, _, _ := img.At(x, y).RGBA()
+		return float64(v) / 0xffff
+	}
+
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			gx := value(edges[0], x, y) - value(edges[1], x, y)
+			gy := value(edges[2], x, y) - value(edges[3], x, y)
+
+			out[y*w+x] += edgeWeight * math.Min(1, math.Hypot(gx, gy))
+		}
+	}
+
+	return out
+}
+
+// skin returns from 0 to 1 how close the colour is to a skin tone, ignoring its
+// brightness.
+func skin(r, g, b float64) float64 {
+	length := math.Sqrt(r*r + g*g + b*b)
+	if length == 0 {
+		return 0
+	}
+
+	d := math.Sqrt(math.Pow(r/length-skinColour[0], 2) +
+		math.Pow(g/length-skinColour[1], 2) +
+		math.Pow(b/length-skinColour[2], 2))
+
+	return math.Max(0, 1-d/0.1)
+}
+
+// A summedArea table gives the sum of the values within any rectangle quickly.
+type summedArea struct {
+	w    int
+	sums []float64
+}
+
+func newSummedArea(values []float64, w, h int) summedArea {
+	t := summedArea{w + 1, make([]float64, (w+1)*(h+1))}
+
+	for y := 0; y < h; y++ {
+		row := 0.0
+		for x := 0; x < w; x++ {
+			row += values[y*w+x]
+			t.sums[(y+1)*t.w+x+1] = t.sums[y*t.w+x+1] + row
+		}
+	}
+
+	return t
+}
+
+// sum returns the total of the values within r, which must be within the table.
+func (t summedArea) sum(r image.Rectangle) float64 {
+	at := func(x, y int) float64 { return t.sums[y*t.w+x] }
+	return at(r.Max.X, r.Max.Y) - at(r.Min.X, r.Max.Y) - at(r.Max.X, r.Min.Y) + at(r.Min.X, r.Min.Y)
+}
+
+func abs(n int) int {
+	if n < 0 {
+		return -n
+	}
+	return n
+}
@@ -0,0 +1,93 @@
+package crop
+
+import (
+	"image"
+	"image/color"
+	"image/draw"
+	"testing"
+)
+
+// subjectImage returns a flat grey image with a red square off to the right.
+func subjectImage() *image.NRGBA {
+	img := image.NewNRGBA(image.Rect(10, 10, 210, 110))
+	draw.Draw(img, img.Bounds(), image.NewUniform(color.NRGBA{128, 128, 128, 255}), image.Point{}, draw.Src)
+	draw.Draw(img, image.Rect(160, 50, 180, 70), image.NewUniform(color.NRGBA{220, 20, 20, 255}), image.Point{}, draw.Src)
+	return img
+}
+
+func countRed(img image.Image) int {
+	n := 0
+	b := img.Bounds()
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		for x := b.Min.X; x < b.Max.X; x++ {
+			if color.NRGBAModel.Convert(img.At(x, y)) == (color.NRGBA{220, 20, 20, 255}) {
+				n++
+			}
+		}
+	}
+	return n
+}
+
+func TestSmartKeepsSubject(t *testing.T) {
+	out := Smart(subjectImage(), 100, 100)
+
+	if b := out.Bounds(); b != image.Rect(0, 0, 100, 100) {
+		t.Fatalf("expected bounds (0,0)-(100,100), got %v", b)
+	}
+	if n := countRed(out); n != 400 {
+		t.Errorf("expected all 400 pixels of the subject to be kept, got %d", n)
+	}
+}
+
+func TestSmartResizes(t *testing.T) {
+	out := Smart(subjectImage(), 40, 20)
+
+	if b := out.Bounds(); b != image.Rect(0, 0, 40, 20) {
+		t.Fatalf("expected bounds (0,0)-(40,20), got %v", b)
+	}
+
+	// The subject is 20 pixels of 100, so about 4 pixels across after scaling.
+	reddish := 0
+	for y := 0; y < 20; y++ {
+		for x := 0; x < 40; x++ {
+			if c := color.NRGBAModel.Convert(out.At(x, y)).(color.NRGBA); c.R > 200 && c.G < 50 {
+				reddish++
+			}
+		}
+	}
+	if reddish == 0 {
+		t.Error("expected subject to be kept")
+	}
+}
+
+func TestSmartDeterministic(t *testing.T) {
+	img := subjectImage()
+	first := Smart(img, 100, 100)
+
+	for i := 0; i < 3; i++ {
+		again := Smart(img, 100, 100)
+		if again.Bounds() != first.Bounds() {
+			t.Fatalf("expected bounds %v, got %v", first.Bounds(), again.Bounds())
+		}
+
+		b := first.Bounds()
+		for y := b.Min.Y; y < b.Max.Y; y++ {
+			for x := b.Min.X; x < b.Max.X; x++ {
+				if first.At(x, y) != again.At(x, y) {
+					t.Fatalf("at (%d, %d): expected %v, got %v", x, y, first.At(x, y), again.At(x, y))
+				}
+			}
+		}
+	}
+}
+
+func TestSmartLargeImage(t *testing.T) {
+	// Images larger than smartSize are scaled down to find the subject.
+	img := image.NewNRGBA(image.Rect(0, 0, 1000, 500))
+	draw.Draw(img, img.Bounds(), image.NewUniform(color.NRGBA{128, 128, 128, 255}), image.Point{}, draw.Src)
+	draw.Draw(img, image.Rect(850, 200, 950, 300), image.NewUniform(color.NRGBA{220, 20, 20, 255}), image.Point{}, draw.Src)
+
+	if n := countRed(Smart(img, 500, 500)); n != 100*100 {
+		t.Errorf("expected all of the subject to be kept, got %d pixels", n)
+	}
+}
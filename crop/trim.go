@@ -0,0 +1,74 @@
+package crop
+
+import (
+	"image"
+	"image/color"
+)
+
+// Trim crops an Image to remove any border that is the same colour as its
+// top-left corner, which for most images will be a plain background or
+// transparent. Pixels count as the same colour if none of their premultiplied
+// channels differ by more than tolerance, from 0 to 1. If the whole image is the
+// same colour it is returned unchanged.
+func Trim(img image.Image, tolerance float64) image.Image {
+	b := img.Bounds()
+	if b.Empty() {
+		return img
+	}
+
+	border := img.At(b.Min.X, b.Min.Y)
+	limit := uint32(tolerance * 0xffff)
+
+	rowSame := func(y, minX, maxX int) bool {
+		for x := minX; x < maxX; x++ {
+			if !similar(img.At(x, y), border, limit) {
+				return false
+			}
+		}
+		return true
+	}
+
+	colSame := func(x, minY, maxY int) bool {
+		for y := minY; y < maxY; y++ {
+			if !similar(img.At(x, y), border, limit) {
+				return false
+			}
+		}
+		return true
+	}
+
+	r := b
+	for r.Min.Y < r.Max.Y && rowSame(r.Min.Y, r.Min.X, r.Max.X) {
+		r.Min.Y++
+	}
+	if r.Empty() {
+		return img
+	}
+	for rowSame(r.Max.Y-1, r.Min.X, r.Max.X) {
+		r.Max.Y--
+	}
+	for colSame(r.Min.X, r.Min.Y, r.Max.Y) {
+		r.Min.X++
+	}
+	for colSame(r.Max.X-1, r.Min.Y, r.Max.Y) {
+		r.Max.X--
+	}
+
+	return Rectangle(img, r)
+}
+
+// similar returns true if no channel of a differs from b by more than limit.
+func similar(a, b color.Color, limit uint32) bool {
+	ar, ag, ab, aa := a.RGBA()
+	br, bg, bb, ba := b.RGBA()
+
+	return diff(ar, br) <= limit && diff(ag, bg) <= limit &&
+		diff(ab, bb) <= limit && diff(aa, ba) <= limit
+}
+
+func diff(a, b uint32) uint32 {
+	if a > b {
+		return a - b
+	}
+	return b - a
+}
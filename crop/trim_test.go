@@ -0,0 +1,80 @@
+package crop
+
+import (
+	"image"
+	"image/color"
+	"image/draw"
+	"testing"
+)
+
+func TestTrim(t *testing.T) {
+	white := color.NRGBA{255, 255, 255, 255}
+	red := color.NRGBA{255, 0, 0, 255}
+
+	img := image.NewNRGBA(image.Rect(5, 5, 25, 20))
+	draw.Draw(img, img.Bounds(), image.NewUniform(white), image.Point{}, draw.Src)
+	draw.Draw(img, image.Rect(8, 10, 12, 13), image.NewUniform(red), image.Point{}, draw.Src)
+
+	out := Trim(img, 0)
+	if b := out.Bounds(); b != image.Rect(0, 0, 4, 3) {
+		t.Fatalf("expected bounds (0,0)-(4,3), got %v", b)
+	}
+	for y := 0; y < 3; y++ {
+		for x := 0; x < 4; x++ {
+			if c := color.NRGBAModel.Convert(out.At(x, y)); c != red {
+				t.Errorf("expected (%d,%d) to be red, got %v", x, y, c)
+			}
+		}
+	}
+}
+
+func TestTrimTransparent(t *testing.T) {
+	img := image.NewNRGBA(image.Rect(0, 0, 10, 10))
+	img.SetNRGBA(3, 2, color.NRGBA{0, 0, 255, 255})
+	img.SetNRGBA(6, 7, color.NRGBA{0, 255, 0, 128})
+
+	if b := Trim(img, 0).Bounds(); b != image.Rect(0, 0, 4, 6) {
+		t.Errorf("expected bounds (0,0)-(4,6), got %v", b)
+	}
+}
+
+func TestTrimTolerance(t *testing.T) {
+	// A noisy grey border, with a black square in the middle.
+	img := image.NewGray(image.Rect(0, 0, 10, 10))
+	for y := 0; y < 10; y++ {
+		for x := 0; x < 10; x++ {
+			img.SetGray(x, y, color.Gray{uint8(200 + (x*7+y*3)%10)})
+		}
+	}
+	draw.Draw(img, image.Rect(4, 4, 6, 6), image.Black, image.Point{}, draw.Src)
+
+	testCases := []struct {
+		tolerance float64
+		bounds    image.Rectangle
+	}{
+		{0, image.Rect(0, 0, 10, 10)},
+		{0.01, image.Rect(0, 0, 10, 10)},
+		{0.05, image.Rect(0, 0, 2, 2)},
+		{1, image.Rect(0, 0, 10, 10)},
+	}
+
+	for _, tc := range testCases {
+		if b := Trim(img, tc.tolerance).Bounds(); b != tc.bounds {
+			t.Errorf("%v: expected bounds %v, got %v", tc.tolerance, tc.bounds, b)
+		}
+	}
+}
+
+func TestTrimUniform(t *testing.T) {
+	img := image.NewGray(image.Rect(2, 3, 12, 13))
+	draw.Draw(img, img.Bounds(), image.White, image.Point{}, draw.Src)
+
+	if out := Trim(img, 0); out != image.Image(img) {
+		t.Errorf("expected uniform image to be returned unchanged, got %v", out.Bounds())
+	}
+
+	empty := image.NewGray(image.Rectangle{})
+	if out := Trim(empty, 0); out != image.Image(empty) {
+		t.Errorf("expected empty image to be returned unchanged, got %v", out.Bounds())
+	}
+}
@@ -0,0 +1,79 @@
+package exif
+
+import (
+	"bytes"
+	"io"
+
+	"hawx.me/code/img/container"
+)
+
+var (
+	tiffLE = []byte("II*\x00")
+	tiffBE = []byte("MM\x00*")
+
+	// exifHeader prefixes the TIFF structure in a JPEG APP1 segment.
+	exifHeader = []byte("Exif\x00\x00")
+)
+
+func isExifSegment(s container.Segment) bool {
+	return s.Marker == container.MarkerAPP1 && bytes.HasPrefix(s.Data, exifHeader)
+}
+
+func isExifChunk(c container.Chunk) bool {
+	return c.Type == "eXIf"
+}
+
+// extract finds the TIFF structure holding the exif data of the image in b. It
+// understands JPEG, PNG and TIFF files, and returns nil if nothing is found.
+func extract(b []byte) []byte {
+	switch {
+	case bytes.HasPrefix(b, container.JPEGSOI):
+		segments, _, _ := container.JPEGSegments(b)
+		for _, s := range segments {
+			if isExifSegment(s) {
+				return s.Data[len(exifHeader):]
+			}
+		}
+
+	case bytes.HasPrefix(b, container.PNGSignature):
+		chunks, _ := container.PNGChunks(b)
+		for _, c := range chunks {
+			if isExifChunk(c) {
+				return c.Data
+			}
+		}
+
+	case bytes.HasPrefix(b, tiffLE), bytes.HasPrefix(b, tiffBE):
+		return b
+	}
+
+	return nil
+}
+
+// embed writes the image in b to w with its exif data replaced by tiff. If tiff
+// is nil any existing exif data is removed. Formats other than JPEG and PNG are
+// copied unchanged.
+func embed(w io.Writer, b []byte, tiff []byte) error {
+	switch {
+	case bytes.HasPrefix(b, container.JPEGSOI):
+		var extra [][]byte
+		if tiff != nil {
+			app1, err := container.NewSegment(container.MarkerAPP1, append(append([]byte{}, exifHeader...), tiff...))
+			if err != nil {
+				return err
+			}
+			extra = append(extra, app1)
+		}
+		return container.RewriteJPEG(w, b, isExifSegment, extra...)
+
+	case bytes.HasPrefix(b, container.PNGSignature):
+		var extra [][]byte
+		if tiff != nil {
+			extra = append(extra, container.NewChunk("eXIf", tiff))
+		}
+		return container.RewritePNG(w, b, isExifChunk, extra...)
+	}
+
+	_, err := w.Write(b)
+	return err
+}
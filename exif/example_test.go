@@ -1,4 +1,4 @@
-package exif
+package exif_test
 
 import (
 	"fmt"
@@ -6,17 +6,17 @@ import (
 	"hawx.me/code/img/exif"
 )
 
-func ExampleReading() {
+func Example_reading() {
 	data := exif.Load("test.jpg")
-	fmt.Println(exif.Get("UserComment"))
+	fmt.Println(data.Get("UserComment"))
 }
 
-func ExampleModification() {
+func Example_modification() {
 	data := exif.Load("test.jpg")
-	exif.Set("UserComment", "Nice test photo")
-	exif.Save()
+	data.Set("UserComment", "Nice test photo")
+	data.Save()
 }
 
-func ExampleCopying() {
+func Example_copying() {
 	exif.Load("test.jpg").Write("other.jpg")
 }
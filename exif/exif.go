@@ -1,48 +1,22 @@
-// Package exif provides a go interface for exiftool.
+// Package exif reads and writes the exif data of JPEG, PNG and TIFF images. The
+// tags of IFD0, and the Exif and GPS IFDs, are supported; other data (such as
+// maker notes and thumbnails) is dropped.
 package exif
 
 import (
+	"bytes"
 	"errors"
 	"io"
 	"io/ioutil"
 	"os"
-	"os/exec"
-	"strings"
 )
 
-const EXIFTOOL = "exiftool"
-
-// Set of all writable tags
-var writable = map[string]bool{}
-
-// Set of tags exiftool reports are writable, but aren't/shouldn't be!
-var stupidUnwritableWritableTags = map[string]bool{
-	"PreviewImageLength": true,
-	"PreviewImageStart":  true,
-	"ThumbnailLength":    true,
-	"ThumbnailOffset":    true,
-	"Directory":          true,
-	"FileName":           true,
-}
-
-// This needs working out! Though this seems to be working for now...
-func shellEscape(s string) string {
-	// return strings.Replace(s, " ", "\\ ", -1)
-	return s
-}
-
 type Exif struct {
 	path    string
 	data    map[string]string
 	changed map[string]bool // a poor man's set
 }
 
-// Exists returns true if "exiftool" is installed anywhere on the user's $PATH.
-func Exists() bool {
-	_, err := exec.LookPath(EXIFTOOL)
-	return err == nil
-}
-
 // New creates an empty Exif object. To initialize with the exif data of an
 // existing image use Load.
 func New() *Exif {
@@ -53,70 +27,52 @@ func New() *Exif {
 	}
 }
 
-func getWritableTags() {
-	if len(writable) == 0 {
-		// Get the writable tags then
-		out, _ := exec.Command("exiftool", "-listw").Output()
-		for _, tag := range strings.Split(string(out), " ") {
-			key := strings.TrimSpace(tag)
-			if _, ok := stupidUnwritableWritableTags[key]; !ok {
-				writable[key] = true
-			}
-		}
-	}
-}
-
 // Load creates a new Exif object, populated with the exif data of the file at
 // the path given. It will silently fail if any errors are encountered.
 func Load(path string) *Exif {
-	if !Exists() {
-		return New()
-	}
-
-	out, err := exec.Command("exiftool", "-s", path).Output()
+	b, err := ioutil.ReadFile(path)
 	if err != nil {
 		return New()
 	}
 
-	getWritableTags()
-
-	lines := strings.Split(string(out), "\n")
-	exif := New()
+	exif := parse(b)
 	exif.path = path
-
-	for _, line := range lines[:len(lines)-1] {
-		parts := strings.SplitN(line, ":", 2)
-		key := strings.Replace(parts[0], " ", "", -1)
-		if _, ok := writable[key]; ok {
-			val := strings.TrimSpace(parts[1])
-			if !strings.Contains(val, "use -b option to extract") {
-				exif.data[key] = val
-			}
-		}
-	}
-
 	return exif
 }
 
 // Decode can be used for unnamed files, for example STDIN. It loads the exif
 // data from the file given.
 func Decode(r io.Reader) *Exif {
-	if !Exists() {
+	b, err := ioutil.ReadAll(r)
+	if err != nil {
 		return New()
 	}
 
-	// Create a temporary file for exiftool to read
-	tmp, _ := ioutil.TempFile("", "img-exif-")
-	path := tmp.Name()
-	// Make sure the file is deleted after
-	defer func() { os.Remove(path) }()
-	// Copy the file to it
-	io.Copy(tmp, r)
-	// Load normally
-	return Load(path)
+	return parse(b)
+}
+
+func parse(b []byte) *Exif {
+	exif := New()
+
+	tiff := extract(b)
+	if tiff == nil {
+		return exif
+	}
+
+	data, err := parseTIFF(tiff)
+	if err != nil {
+		return exif
+	}
+
+	exif.data = data
+	return exif
 }
 
 // Get returns the value for the key given. The key should be in CamelCase form.
+//
+// Numeric values are given in decimal, with multiple values separated by
+// spaces. Rational values are given as fractions, for example an ExposureTime
+// of "1/250".
 func (e Exif) Get(key string) string {
 	val, ok := e.data[key]
 	if !ok {
@@ -125,9 +81,11 @@ func (e Exif) Get(key string) string {
 	return val
 }
 
-// Set changes the value of the key. The key should be in CamelCase form.
+// Set changes the value of the key. The key should be in CamelCase form. Keys
+// that are not known are ignored. Rational values may be given as fractions or
+// decimals.
 func (e Exif) Set(key, val string) {
-	if _, ok := writable[key]; ok {
+	if _, ok := tagsByName[key]; ok {
 		e.changed[key] = true
 		e.data[key] = val
 	}
@@ -155,40 +113,54 @@ func (e Exif) String() string {
 	return s[:len(s)-1]
 }
 
-// Save will write the changed (and only the changed) exif data to the path that
-// was initially given.
+// Save will write the exif data to the path that was initially given.
 func (e Exif) Save() error {
 	if e.path == "" {
 		return errors.New("exif.Exif does not have path to save to")
 	}
-	args := make([]string, len(e.changed)+2)
-	args[0] = "-overwrite_original"
-
-	i := 1
-	for k, _ := range e.changed {
-		args[i] = "-" + k + "=" + shellEscape(e.Get(k))
-		i++
-	}
-
-	args[i] = e.path
-	return exec.Command("exiftool", args...).Run()
+	return e.Write(e.path)
 }
 
 // Write will write to the path given all of the exif data (changed or unchanged).
 func (e Exif) Write(path string) error {
-	if !Exists() {
-		return errors.New("exif package requires 'exiftool' to load/write exif data")
+	info, err := os.Stat(path)
+	if err != nil {
+		return err
+	}
+
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return err
 	}
 
-	args := make([]string, len(e.data)+3)
-	args[0] = "-overwrite_original"
+	var buf bytes.Buffer
+	if err := e.Embed(&buf, bytes.NewReader(b)); err != nil {
+		return err
+	}
 
-	i := 1
-	for k, v := range e.data {
-		args[i] = "-" + k + "=" + shellEscape(v)
-		i++
+	return ioutil.WriteFile(path, buf.Bytes(), info.Mode())
+}
+
+// Embed copies the JPEG or PNG image read from r to w, replacing any exif data
+// it contains with this. Images in other formats are copied unchanged.
+func (e Exif) Embed(w io.Writer, r io.Reader) error {
+	b, err := ioutil.ReadAll(r)
+	if err != nil {
+		return err
 	}
 
-	args[i] = path
-	return exec.Command("exiftool", args...).Run()
+	var tiff []byte
+	if len(e.data) > 0 {
+		if tiff, err = serializeTIFF(e.data); err != nil {
+			return err
+		}
+	}
+
+	return embed(w, b, tiff)
+}
+
+// Exists is kept for compatibility, the exif package no longer requires any
+// external tools so it always returns true.
+func Exists() bool {
+	return true
 }
@@ -0,0 +1,150 @@
+package exif
+
+import (
+	"bytes"
+	"encoding/binary"
+	"image"
+	"image/jpeg"
+	"image/png"
+	"io/ioutil"
+	"testing"
+)
+
+// testdata/orientation.jpg is a 3x2 JPEG with big endian exif data.
+var fixture = map[string]string{
+	"Make":            "hawx",
+	"Orientation":     "6",
+	"XResolution":     "72/1",
+	"YResolution":     "300/1",
+	"ExposureTime":    "1/250",
+	"FNumber":         "28/10",
+	"ExifImageWidth":  "3",
+	"ExifImageHeight": "2",
+}
+
+func readFixture(t *testing.T) []byte {
+	b, err := ioutil.ReadFile("testdata/orientation.jpg")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return b
+}
+
+func assertData(t *testing.T, e *Exif, want map[string]string) {
+	t.Helper()
+
+	if len(e.Keys()) != len(want) {
+		t.Errorf("expected %d keys, got %v", len(want), e.Keys())
+	}
+	for k, v := range want {
+		if got := e.Get(k); got != v {
+			t.Errorf("%s: expected %q, got %q", k, v, got)
+		}
+	}
+}
+
+func TestDecode(t *testing.T) {
+	assertData(t, Decode(bytes.NewReader(readFixture(t))), fixture)
+}
+
+func TestRoundTripJPEG(t *testing.T) {
+	b := readFixture(t)
+
+	e := Decode(bytes.NewReader(b))
+	e.Set("Orientation", "1")
+	e.Set("ExposureTime", "0.5")
+	e.Set("UserComment", "a test")
+	e.Set("NotATag", "ignored")
+
+	var buf bytes.Buffer
+	if err := e.Embed(&buf, bytes.NewReader(b)); err != nil {
+		t.Fatal(err)
+	}
+
+	want := map[string]string{}
+	for k, v := range fixture {
+		want[k] = v
+	}
+	want["Orientation"] = "1"
+	want["ExposureTime"] = "5000/10000"
+	want["UserComment"] = "a test"
+	assertData(t, Decode(bytes.NewReader(buf.Bytes())), want)
+
+	img, err := jpeg.Decode(bytes.NewReader(buf.Bytes()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if img.Bounds() != image.Rect(0, 0, 3, 2) {
+		t.Errorf("expected image to be unchanged, got bounds %v", img.Bounds())
+	}
+}
+
+func TestRoundTripPNG(t *testing.T) {
+	var src bytes.Buffer
+	png.Encode(&src, image.NewGray(image.Rect(0, 0, 2, 2)))
+
+	e := Decode(bytes.NewReader(readFixture(t)))
+	var buf bytes.Buffer
+	if err := e.Embed(&buf, bytes.NewReader(src.Bytes())); err != nil {
+		t.Fatal(err)
+	}
+
+	assertData(t, Decode(bytes.NewReader(buf.Bytes())), fixture)
+
+	if _, err := png.Decode(bytes.NewReader(buf.Bytes())); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestEmbedRemoves(t *testing.T) {
+	var buf bytes.Buffer
+	if err := New().Embed(&buf, bytes.NewReader(readFixture(t))); err != nil {
+		t.Fatal(err)
+	}
+
+	assertData(t, Decode(bytes.NewReader(buf.Bytes())), map[string]string{})
+}
+
+func TestSetBadValue(t *testing.T) {
+	e := New()
+	e.Set("XResolution", "seventy-two")
+
+	if err := e.Embed(ioutil.Discard, bytes.NewReader(readFixture(t))); err == nil {
+		t.Error("expected error for bad rational")
+	}
+}
+
+func TestDecodeTruncated(t *testing.T) {
+	b := readFixture(t)
+
+	for i := range b {
+		Decode(bytes.NewReader(b[:i]))
+	}
+
+	tiff := extract(b)
+	for i := range tiff {
+		parseTIFF(tiff[:i])
+	}
+}
+
+func TestDecodeBadOffsets(t *testing.T) {
+	tiff := append([]byte{}, extract(readFixture(t))...)
+	order := binary.BigEndian
+
+	// each 4 byte word may be an offset or count, so try setting every aligned
+	// word to values that point beyond the data
+	for _, v := range []uint32{uint32(len(tiff)), uint32(len(tiff)) - 1, 0xfffffff0, 0xffffffff} {
+		for i := 4; i+4 <= len(tiff); i += 2 {
+			b := append([]byte{}, tiff...)
+			order.PutUint32(b[i:], v)
+			parseTIFF(b)
+		}
+	}
+
+	// IFD counts that claim more entries than exist
+	b := append([]byte{}, tiff...)
+	order.PutUint16(b[8:], 0xffff)
+	if _, err := parseTIFF(b); err == nil {
+		t.Error("expected error for overlong IFD")
+	}
+}
@@ -0,0 +1,371 @@
+package exif
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+var errBadTIFF = errors.New("exif: malformed TIFF structure")
+
+// parseTIFF reads the known tags from IFD0, and the Exif and GPS IFDs it points
+// to, of the TIFF structure in b.
+func parseTIFF(b []byte) (map[string]string, error) {
+	if len(b) < 8 {
+		return nil, errBadTIFF
+	}
+
+	var order binary.ByteOrder
+	switch string(b[:2]) {
+	case "II":
+		order = binary.LittleEndian
+	case "MM":
+		order = binary.BigEndian
+	default:
+		return nil, errBadTIFF
+	}
+
+	if order.Uint16(b[2:]) != 42 {
+		return nil, errBadTIFF
+	}
+
+	data := map[string]string{}
+	pointers, err := readIFD(b, order, order.Uint32(b[4:]), ifd0, data)
+	if err != nil {
+		return nil, err
+	}
+
+	// Errors in the sub-IFDs are ignored, so that a broken GPS block doesn't
+	// lose everything else.
+	if offset, ok := pointers[exifPointer]; ok {
+		readIFD(b, order, offset, exifIFD, data)
+	}
+	if offset, ok := pointers[gpsPointer]; ok {
+		readIFD(b, order, offset, gpsIFD, data)
+	}
+
+	return data, nil
+}
+
+// readIFD reads the entries of the IFD at offset into data, returning the
+// values of any pointers to other IFDs that were found.
+func readIFD(b []byte, order binary.ByteOrder, offset uint32, dir ifd, data map[string]string) (map[uint16]uint32, error) {
+	if int64(offset)+2 > int64(len(b)) {
+		return nil, errBadTIFF
+	}
+
+	n := int(order.Uint16(b[offset:]))
+	start := int(offset) + 2
+	if start+n*12 > len(b) {
+		return nil, errBadTIFF
+	}
+
+	pointers := map[uint16]uint32{}
+
+	for i := 0; i < n; i++ {
+		entry := b[start+i*12 : start+(i+1)*12]
+		id := order.Uint16(entry)
+		typ := format(order.Uint16(entry[2:]))
+		count := order.Uint32(entry[4:])
+
+		if dir == ifd0 && (id == exifPointer || id == gpsPointer) {
+			pointers[id] = order.Uint32(entry[8:])
+			continue
+		}
+
+		t, ok := tagsByID[dir][id]
+		if !ok || typ.size() == 0 {
+			continue
+		}
+
+		size := int64(typ.size()) * int64(count)
+		value := entry[8:12]
+		if size > 4 {
+			at := int64(order.Uint32(entry[8:]))
+			if at+size > int64(len(b)) {
+				continue
+			}
+			value = b[at : at+size]
+		}
+
+		data[t.Name] = decodeValue(t, typ, int(count), value[:size], order)
+	}
+
+	return pointers, nil
+}
+
+// decodeValue formats a raw value as a string. Numbers are separated by spaces,
+// and rationals are given as a fraction.
+func decodeValue(t tag, typ format, count int, b []byte, order binary.ByteOrder) string {
+	switch typ {
+	case formatASCII:
+		return strings.TrimRight(string(b), "\x00")
+
+	case formatUndefined:
+		switch t.Undef {
+		case undefinedText:
+			return strings.TrimRight(string(b), "\x00")
+		case undefinedComment:
+			if len(b) < 8 {
+				return ""
+			}
+			return strings.TrimRight(string(b[8:]), "\x00 ")
+		}
+	}
+
+	parts := make([]string, count)
+	for i := range parts {
+		v := b[i*typ.size():]
+
+		switch typ {
+		case formatByte, formatUndefined:
+			parts[i] = strconv.Itoa(int(v[0]))
+		case formatSByte:
+			parts[i] = strconv.Itoa(int(int8(v[0])))
+		case formatShort:
+			parts[i] = strconv.Itoa(int(order.Uint16(v)))
+		case formatSShort:
+			parts[i] = strconv.Itoa(int(int16(order.Uint16(v))))
+		case formatLong:
+			parts[i] = strconv.FormatUint(uint64(order.Uint32(v)), 10)
+		case formatSLong:
+			parts[i] = strconv.Itoa(int(int32(order.Uint32(v))))
+		case formatRational:
+			parts[i] = fmt.Sprintf("%d/%d", order.Uint32(v), order.Uint32(v[4:]))
+		case formatSRational:
+			parts[i] = fmt.Sprintf("%d/%d", int32(order.Uint32(v)), int32(order.Uint32(v[4:])))
+		case formatFloat:
+			parts[i] = strconv.FormatFloat(float64(math.Float32frombits(order.Uint32(v))), 'g', -1, 32)
+		case formatDouble:
+			parts[i] = strconv.FormatFloat(math.Float64frombits(order.Uint64(v)), 'g', -1, 64)
+		}
+	}
+
+	return strings.Join(parts, " ")
+}
+
+// encodeValue is the inverse of decodeValue, it always encodes using the type
+// given for the tag.
+func encodeValue(t tag, s string, order binary.ByteOrder) (count uint32, b []byte, err error) {
+	switch t.Type {
+	case formatASCII:
+		b = append([]byte(s), 0)
+		return uint32(len(b)), b, nil
+
+	case formatUndefined:
+		switch t.Undef {
+		case undefinedText:
+			return uint32(len(s)), []byte(s), nil
+		case undefinedComment:
+			b = append([]byte("ASCII\x00\x00\x00"), s...)
+			return uint32(len(b)), b, nil
+		}
+	}
+
+	fields := strings.Fields(s)
+	buf := make([]byte, len(fields)*t.Type.size())
+
+	for i, field := range fields {
+		v := buf[i*t.Type.size():]
+
+		switch t.Type {
+		case formatByte, formatUndefined:
+			n, err := strconv.ParseUint(field, 10, 8)
+			if err != nil {
+				return 0, nil, badValue(t, s)
+			}
+			v[0] = byte(n)
+
+		case formatShort:
+			n, err := strconv.ParseUint(field, 10, 16)
+			if err != nil {
+				return 0, nil, badValue(t, s)
+			}
+			order.PutUint16(v, uint16(n))
+
+		case formatLong:
+			n, err := strconv.ParseUint(field, 10, 32)
+			if err != nil {
+				return 0, nil, badValue(t, s)
+			}
+			order.PutUint32(v, uint32(n))
+
+		case formatRational, formatSRational:
+			num, den, err := parseRational(field, t.Type == formatSRational)
+			if err != nil {
+				return 0, nil, badValue(t, s)
+			}
+			order.PutUint32(v, num)
+			order.PutUint32(v[4:], den)
+		}
+	}
+
+	return uint32(len(fields)), buf, nil
+}
+
+// parseRational parses a value such as "1/250" or "2.8" into a numerator and
+// denominator.
+func parseRational(s string, signed bool) (num, den uint32, err error) {
+	parse := func(p string) (uint32, error) {
+		if signed {
+			n, err := strconv.ParseInt(p, 10, 32)
+			return uint32(int32(n)), err
+		}
+		n, err := strconv.ParseUint(p, 10, 32)
+		return uint32(n), err
+	}
+
+	if i := strings.Index(s, "/"); i >= 0 {
+		if num, err = parse(s[:i]); err != nil {
+			return
+		}
+		den, err = parse(s[i+1:])
+		return
+	}
+
+	f, err := strconv.ParseFloat(s, 64)
+	if err != nil {
+		return
+	}
+	if !signed && f < 0 {
+		return 0, 0, strconv.ErrRange
+	}
+
+	den = 10000
+	if signed {
+		num = uint32(int32(math.Round(f * float64(den))))
+	} else {
+		num = uint32(math.Round(f * float64(den)))
+	}
+	return
+}
+
+func badValue(t tag, s string) error {
+	return fmt.Errorf("exif: invalid value %q for %s", s, t.Name)
+}
+
+// An entry is a single encoded field, ready to be written to an IFD.
+type entry struct {
+	id    uint16
+	typ   format
+	count uint32
+	value []byte
+}
+
+// ifdSize returns the number of bytes needed to write the entries, including
+// the out-of-line values.
+func ifdSize(entries []entry) uint32 {
+	size := uint32(2 + 12*len(entries) + 4)
+	for _, e := range entries {
+		if len(e.value) > 4 {
+			size += uint32(len(e.value) + len(e.value)%2)
+		}
+	}
+	return size
+}
+
+// writeIFD appends the entries to buf. Offsets are relative to the start of buf,
+// which should begin with the TIFF header.
+func writeIFD(buf *bytes.Buffer, order binary.ByteOrder, entries []entry) {
+	offset := uint32(buf.Len())
+	dataAt := offset + uint32(2+12*len(entries)+4)
+
+	var data bytes.Buffer
+	binary.Write(buf, order, uint16(len(entries)))
+
+	for _, e := range entries {
+		binary.Write(buf, order, e.id)
+		binary.Write(buf, order, uint16(e.typ))
+		binary.Write(buf, order, e.count)
+
+		if len(e.value) > 4 {
+			binary.Write(buf, order, dataAt+uint32(data.Len()))
+			data.Write(e.value)
+			if len(e.value)%2 == 1 {
+				data.WriteByte(0)
+			}
+		} else {
+			var inline [4]byte
+			copy(inline[:], e.value)
+			buf.Write(inline[:])
+		}
+	}
+
+	// No next IFD.
+	binary.Write(buf, order, uint32(0))
+	buf.Write(data.Bytes())
+}
+
+// serializeTIFF creates a TIFF structure, without any image data, holding the
+// values given.
+func serializeTIFF(data map[string]string) ([]byte, error) {
+	order := binary.LittleEndian
+	dirs := map[ifd][]entry{}
+
+	for name, value := range data {
+		t, ok := tagsByName[name]
+		if !ok {
+			continue
+		}
+
+		count, b, err := encodeValue(t, value, order)
+		if err != nil {
+			return nil, err
+		}
+		if count == 0 {
+			continue
+		}
+
+		dirs[t.IFD] = append(dirs[t.IFD], entry{t.ID, t.Type, count, b})
+	}
+
+	// Pointers are added to IFD0 before its size is calculated; their values
+	// are filled in once the offsets are known.
+	pointer := func(id uint16) {
+		dirs[ifd0] = append(dirs[ifd0], entry{id, formatLong, 1, make([]byte, 4)})
+	}
+
+	hasExif := len(dirs[exifIFD]) > 0
+	hasGPS := len(dirs[gpsIFD]) > 0
+	if hasExif {
+		pointer(exifPointer)
+	}
+	if hasGPS {
+		pointer(gpsPointer)
+	}
+
+	for _, entries := range dirs {
+		sort.Slice(entries, func(i, j int) bool { return entries[i].id < entries[j].id })
+	}
+
+	offset := uint32(8) + ifdSize(dirs[ifd0])
+	for i, e := range dirs[ifd0] {
+		switch e.id {
+		case exifPointer:
+			order.PutUint32(dirs[ifd0][i].value, offset)
+			offset += ifdSize(dirs[exifIFD])
+		case gpsPointer:
+			order.PutUint32(dirs[ifd0][i].value, offset)
+		}
+	}
+
+	var buf bytes.Buffer
+	buf.WriteString("II")
+	binary.Write(&buf, order, uint16(42))
+	binary.Write(&buf, order, uint32(8))
+
+	writeIFD(&buf, order, dirs[ifd0])
+	if hasExif {
+		writeIFD(&buf, order, dirs[exifIFD])
+	}
+	if hasGPS {
+		writeIFD(&buf, order, dirs[gpsIFD])
+	}
+
+	return buf.Bytes(), nil
+}
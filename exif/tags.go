@@ -0,0 +1,195 @@
+package exif
+
+// A format is one of the TIFF field types, it determines how the bytes of a
+// value are to be interpreted.
+type format uint16
+
+const (
+	formatByte      format = 1
+	formatASCII     format = 2
+	formatShort     format = 3
+	formatLong      format = 4
+	formatRational  format = 5
+	formatSByte     format = 6
+	formatUndefined format = 7
+	formatSShort    format = 8
+	formatSLong     format = 9
+	formatSRational format = 10
+	formatFloat     format = 11
+	formatDouble    format = 12
+)
+
+// size returns the number of bytes used by a single value of the format.
+func (f format) size() int {
+	switch f {
+	case formatByte, formatASCII, formatSByte, formatUndefined:
+		return 1
+	case formatShort, formatSShort:
+		return 2
+	case formatLong, formatSLong, formatFloat:
+		return 4
+	case formatRational, formatSRational, formatDouble:
+		return 8
+	}
+	return 0
+}
+
+// An ifd identifies which Image File Directory a tag belongs in.
+type ifd int
+
+const (
+	ifd0 ifd = iota
+	exifIFD
+	gpsIFD
+)
+
+// Tags that point to other IFDs. These are never exposed, they are written as
+// needed when serializing.
+const (
+	exifPointer uint16 = 0x8769
+	gpsPointer  uint16 = 0x8825
+)
+
+// An undefined value may hold text (such as ExifVersion), a comment with an
+// 8 byte character code prefix (such as UserComment) or plain bytes.
+type undefinedKind int
+
+const (
+	undefinedBytes undefinedKind = iota
+	undefinedText
+	undefinedComment
+)
+
+type tag struct {
+	ID    uint16
+	Name  string
+	IFD   ifd
+	Type  format
+	Undef undefinedKind
+}
+
+// knownTags lists every tag that can be read and written. The names match
+// those used by exiftool, so that existing scripts continue to work.
+var knownTags = []tag{
+	{0x010e, "ImageDescription", ifd0, formatASCII, 0},
+	{0x010f, "Make", ifd0, formatASCII, 0},
+	{0x0110, "Model", ifd0, formatASCII, 0},
+	{0x0112, "Orientation", ifd0, formatShort, 0},
+	{0x011a, "XResolution", ifd0, formatRational, 0},
+	{0x011b, "YResolution", ifd0, formatRational, 0},
+	{0x0128, "ResolutionUnit", ifd0, formatShort, 0},
+	{0x0131, "Software", ifd0, formatASCII, 0},
+	{0x0132, "ModifyDate", ifd0, formatASCII, 0},
+	{0x013b, "Artist", ifd0, formatASCII, 0},
+	{0x013e, "WhitePoint", ifd0, formatRational, 0},
+	{0x013f, "PrimaryChromaticities", ifd0, formatRational, 0},
+	{0x0211, "YCbCrCoefficients", ifd0, formatRational, 0},
+	{0x0213, "YCbCrPositioning", ifd0, formatShort, 0},
+	{0x0214, "ReferenceBlackWhite", ifd0, formatRational, 0},
+	{0x8298, "Copyright", ifd0, formatASCII, 0},
+
+	{0x829a, "ExposureTime", exifIFD, formatRational, 0},
+	{0x829d, "FNumber", exifIFD, formatRational, 0},
+	{0x8822, "ExposureProgram", exifIFD, formatShort, 0},
+	{0x8824, "SpectralSensitivity", exifIFD, formatASCII, 0},
+	{0x8827, "ISO", exifIFD, formatShort, 0},
+	{0x8830, "SensitivityType", exifIFD, formatShort, 0},
+	{0x9000, "ExifVersion", exifIFD, formatUndefined, undefinedText},
+	{0x9003, "DateTimeOriginal", exifIFD, formatASCII, 0},
+	{0x9004, "CreateDate", exifIFD, formatASCII, 0},
+	{0x9010, "OffsetTime", exifIFD, formatASCII, 0},
+	{0x9011, "OffsetTimeOriginal", exifIFD, formatASCII, 0},
+	{0x9012, "OffsetTimeDigitized", exifIFD, formatASCII, 0},
+	{0x9101, "ComponentsConfiguration", exifIFD, formatUndefined, undefinedBytes},
+	{0x9102, "CompressedBitsPerPixel", exifIFD, formatRational, 0},
+	{0x9201, "ShutterSpeedValue", exifIFD, formatSRational, 0},
+	{0x9202, "ApertureValue", exifIFD, formatRational, 0},
+	{0x9203, "BrightnessValue", exifIFD, formatSRational, 0},
+	{0x9204, "ExposureCompensation", exifIFD, formatSRational, 0},
+	{0x9205, "MaxApertureValue", exifIFD, formatRational, 0},
+	{0x9206, "SubjectDistance", exifIFD, formatRational, 0},
+	{0x9207, "MeteringMode", exifIFD, formatShort, 0},
+	{0x9208, "LightSource", exifIFD, formatShort, 0},
+	{0x9209, "Flash", exifIFD, formatShort, 0},
+	{0x920a, "FocalLength", exifIFD, formatRational, 0},
+	{0x9214, "SubjectArea", exifIFD, formatShort, 0},
+	{0x9286, "UserComment", exifIFD, formatUndefined, undefinedComment},
+	{0x9290, "SubSecTime", exifIFD, formatASCII, 0},
+	{0x9291, "SubSecTimeOriginal", exifIFD, formatASCII, 0},
+	{0x9292, "SubSecTimeDigitized", exifIFD, formatASCII, 0},
+	{0xa000, "FlashpixVersion", exifIFD, formatUndefined, undefinedText},
+	{0xa001, "ColorSpace", exifIFD, formatShort, 0},
+	{0xa002, "ExifImageWidth", exifIFD, formatLong, 0},
+	{0xa003, "ExifImageHeight", exifIFD, formatLong, 0},
+	{0xa20e, "FocalPlaneXResolution", exifIFD, formatRational, 0},
+	{0xa20f, "FocalPlaneYResolution", exifIFD, formatRational, 0},
+	{0xa210, "FocalPlaneResolutionUnit", exifIFD, formatShort, 0},
+	{0xa217, "SensingMethod", exifIFD, formatShort, 0},
+	{0xa300, "FileSource", exifIFD, formatUndefined, undefinedBytes},
+	{0xa301, "SceneType", exifIFD, formatUndefined, undefinedBytes},
+	{0xa401, "CustomRendered", exifIFD, formatShort, 0},
+	{0xa402, "ExposureMode", exifIFD, formatShort, 0},
+	{0xa403, "WhiteBalance", exifIFD, formatShort, 0},
+	{0xa404, "DigitalZoomRatio", exifIFD, formatRational, 0},
+	{0xa405, "FocalLengthIn35mmFormat", exifIFD, formatShort, 0},
+	{0xa406, "SceneCaptureType", exifIFD, formatShort, 0},
+	{0xa407, "GainControl", exifIFD, formatShort, 0},
+	{0xa408, "Contrast", exifIFD, formatShort, 0},
+	{0xa409, "Saturation", exifIFD, formatShort, 0},
+	{0xa40a, "Sharpness", exifIFD, formatShort, 0},
+	{0xa40c, "SubjectDistanceRange", exifIFD, formatShort, 0},
+	{0xa420, "ImageUniqueID", exifIFD, formatASCII, 0},
+	{0xa430, "OwnerName", exifIFD, formatASCII, 0},
+	{0xa431, "SerialNumber", exifIFD, formatASCII, 0},
+	{0xa432, "LensInfo", exifIFD, formatRational, 0},
+	{0xa433, "LensMake", exifIFD, formatASCII, 0},
+	{0xa434, "LensModel", exifIFD, formatASCII, 0},
+	{0xa435, "LensSerialNumber", exifIFD, formatASCII, 0},
+
+	{0x0000, "GPSVersionID", gpsIFD, formatByte, 0},
+	{0x0001, "GPSLatitudeRef", gpsIFD, formatASCII, 0},
+	{0x0002, "GPSLatitude", gpsIFD, formatRational, 0},
+	{0x0003, "GPSLongitudeRef", gpsIFD, formatASCII, 0},
+	{0x0004, "GPSLongitude", gpsIFD, formatRational, 0},
+	{0x0005, "GPSAltitudeRef", gpsIFD, formatByte, 0},
+	{0x0006, "GPSAltitude", gpsIFD, formatRational, 0},
+	{0x0007, "GPSTimeStamp", gpsIFD, formatRational, 0},
+	{0x0008, "GPSSatellites", gpsIFD, formatASCII, 0},
+	{0x0009, "GPSStatus", gpsIFD, formatASCII, 0},
+	{0x000a, "GPSMeasureMode", gpsIFD, formatASCII, 0},
+	{0x000b, "GPSDOP", gpsIFD, formatRational, 0},
+	{0x000c, "GPSSpeedRef", gpsIFD, formatASCII, 0},
+	{0x000d, "GPSSpeed", gpsIFD, formatRational, 0},
+	{0x000e, "GPSTrackRef", gpsIFD, formatASCII, 0},
+	{0x000f, "GPSTrack", gpsIFD, formatRational, 0},
+	{0x0010, "GPSImgDirectionRef", gpsIFD, formatASCII, 0},
+	{0x0011, "GPSImgDirection", gpsIFD, formatRational, 0},
+	{0x0012, "GPSMapDatum", gpsIFD, formatASCII, 0},
+	{0x0013, "GPSDestLatitudeRef", gpsIFD, formatASCII, 0},
+	{0x0014, "GPSDestLatitude", gpsIFD, formatRational, 0},
+	{0x0015, "GPSDestLongitudeRef", gpsIFD, formatASCII, 0},
+	{0x0016, "GPSDestLongitude", gpsIFD, formatRational, 0},
+	{0x0017, "GPSDestBearingRef", gpsIFD, formatASCII, 0},
+	{0x0018, "GPSDestBearing", gpsIFD, formatRational, 0},
+	{0x0019, "GPSDestDistanceRef", gpsIFD, formatASCII, 0},
+	{0x001a, "GPSDestDistance", gpsIFD, formatRational, 0},
+	{0x001d, "GPSDateStamp", gpsIFD, formatASCII, 0},
+	{0x001e, "GPSDifferential", gpsIFD, formatShort, 0},
+}
+
+// Lookup tables for knownTags, by name and by (IFD, ID) pair.
+var (
+	tagsByName = map[string]tag{}
+	tagsByID   = map[ifd]map[uint16]tag{
+		ifd0:    {},
+		exifIFD: {},
+		gpsIFD:  {},
+	}
+)
+
+func init() {
+	for _, t := range knownTags {
+		tagsByName[t.Name] = t
+		tagsByID[t.IFD][t.ID] = t
+	}
+}
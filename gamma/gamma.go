@@ -20,11 +20,11 @@ func AdjustC(value float64) utils.Composable {
 	return func(c color.Color) color.Color {
 		r, g, b, a := utils.RatioRGBA(c)
 
-		r = utils.Truncatef(math.Pow(r, 1/value) * 255)
-		g = utils.Truncatef(math.Pow(g, 1/value) * 255)
-		b = utils.Truncatef(math.Pow(b, 1/value) * 255)
+		r = math.Pow(r, 1/value)
+		g = math.Pow(g, 1/value)
+		b = math.Pow(b, 1/value)
 
-		return color.NRGBA{uint8(r), uint8(g), uint8(b), uint8(a * 255)}
+		return utils.RatioNRGBA(r, g, b, a)
 	}
 }
 
@@ -0,0 +1,145 @@
+package icc
+
+import (
+	"bytes"
+	"compress/zlib"
+	"io"
+	"io/ioutil"
+	"sort"
+
+	"hawx.me/code/img/container"
+)
+
+// iccHeader prefixes each part of a profile in a JPEG APP2 segment, it is
+// followed by the sequence number of the part and the total number of parts.
+var iccHeader = []byte("ICC_PROFILE\x00")
+
+// maxPart is the most profile data that fits in one APP2 segment.
+const maxPart = 0xffff - 2 - 14
+
+func isProfileSegment(s container.Segment) bool {
+	return s.Marker == container.MarkerAPP2 && bytes.HasPrefix(s.Data, iccHeader)
+}
+
+// An image should not have both an iCCP and sRGB chunk, so both are removed.
+func isProfileChunk(c container.Chunk) bool {
+	return c.Type == "iCCP" || c.Type == "sRGB"
+}
+
+// extract finds the profile embedded in the image in b, it returns nil if there
+// is not one.
+func extract(b []byte) ([]byte, error) {
+	switch {
+	case bytes.HasPrefix(b, container.JPEGSOI):
+		segments, _, err := container.JPEGSegments(b)
+		if err != nil {
+			return nil, err
+		}
+
+		parts := []container.Segment{}
+		for _, s := range segments {
+			if isProfileSegment(s) && len(s.Data) >= len(iccHeader)+2 {
+				parts = append(parts, s)
+			}
+		}
+		if len(parts) == 0 {
+			return nil, nil
+		}
+
+		sort.SliceStable(parts, func(i, j int) bool {
+			return parts[i].Data[len(iccHeader)] < parts[j].Data[len(iccHeader)]
+		})
+
+		var data []byte
+		for _, s := range parts {
+			data = append(data, s.Data[len(iccHeader)+2:]...)
+		}
+		return data, nil
+
+	case bytes.HasPrefix(b, container.PNGSignature):
+		chunks, err := container.PNGChunks(b)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, c := range chunks {
+			if c.Type != "iCCP" {
+				continue
+			}
+
+			// The name is followed by a null byte, then the compression method
+			// which is always 0 for zlib.
+			i := bytes.IndexByte(c.Data, 0)
+			if i < 0 || i+2 > len(c.Data) {
+				return nil, errBadProfile
+			}
+
+			zr, err := zlib.NewReader(bytes.NewReader(c.Data[i+2:]))
+			if err != nil {
+				return nil, err
+			}
+			return ioutil.ReadAll(zr)
+		}
+	}
+
+	return nil, nil
+}
+
+// Embed writes the image read from r to w with the profile embedded, replacing
+// any existing profile. If p is nil any existing profile is removed. Formats
+// other than JPEG and PNG are copied unchanged.
+func Embed(w io.Writer, r io.Reader, p *Profile) error {
+	b, err := ioutil.ReadAll(r)
+	if err != nil {
+		return err
+	}
+
+	switch {
+	case bytes.HasPrefix(b, container.JPEGSOI):
+		var extra [][]byte
+		if p != nil {
+			count := (len(p.Data) + maxPart - 1) / maxPart
+			if count > 255 {
+				return errBadProfile
+			}
+
+			for i := 0; i < count; i++ {
+				end := (i + 1) * maxPart
+				if end > len(p.Data) {
+					end = len(p.Data)
+				}
+
+				data := append([]byte{}, iccHeader...)
+				data = append(data, byte(i+1), byte(count))
+				data = append(data, p.Data[i*maxPart:end]...)
+
+				segment, err := container.NewSegment(container.MarkerAPP2, data)
+				if err != nil {
+					return err
+				}
+				extra = append(extra, segment)
+			}
+		}
+		return container.RewriteJPEG(w, b, isProfileSegment, extra...)
+
+	case bytes.HasPrefix(b, container.PNGSignature):
+		var extra [][]byte
+		if p != nil {
+			var data bytes.Buffer
+			data.Write(p.name())
+			data.Write([]byte{0, 0})
+
+			zw := zlib.NewWriter(&data)
+			zw.Write(p.Data)
+			if err := zw.Close(); err != nil {
+				return err
+			}
+
+			extra = append(extra, container.NewChunk("iCCP", data.Bytes()))
+		}
+		return container.RewritePNG(w, b, isProfileChunk, extra...)
+	}
+
+	_, err = w.Write(b)
+	return err
+}
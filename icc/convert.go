@@ -0,0 +1,155 @@
+package icc
+
+import (
+	"image"
+	"image/color"
+	"image/draw"
+	"math"
+)
+
+// srgbToXYZ converts linear sRGB values to XYZ relative to the D50 white point
+// used by ICC profiles. It includes the Bradford adaptation from sRGB's D65
+// white point, in the same way as the colorants of a profile.
+var srgbToXYZ = [3][3]float64{
+	{0.4360747, 0.3850649, 0.1430804},
+	{0.2225045, 0.7168786, 0.0606169},
+	{0.0139322, 0.0971045, 0.7141733},
+}
+
+func pow(x, y float64) float64 {
+	if x <= 0 {
+		return 0
+	}
+	return math.Pow(x, y)
+}
+
+func multiply(a, b [3][3]float64) (m [3][3]float64) {
+	for i := 0; i < 3; i++ {
+		for j := 0; j < 3; j++ {
+			for k := 0; k < 3; k++ {
+				m[i][j] += a[i][k] * b[k][j]
+			}
+		}
+	}
+	return
+}
+
+func invert(m [3][3]float64) (inv [3][3]float64) {
+	det := m[0][0]*(m[1][1]*m[2][2]-m[1][2]*m[2][1]) -
+		m[0][1]*(m[1][0]*m[2][2]-m[1][2]*m[2][0]) +
+		m[0][2]*(m[1][0]*m[2][1]-m[1][1]*m[2][0])
+
+	inv[0][0] = (m[1][1]*m[2][2] - m[1][2]*m[2][1]) / det
+	inv[0][1] = (m[0][2]*m[2][1] - m[0][1]*m[2][2]) / det
+	inv[0][2] = (m[0][1]*m[1][2] - m[0][2]*m[1][1]) / det
+	inv[1][0] = (m[1][2]*m[2][0] - m[1][0]*m[2][2]) / det
+	inv[1][1] = (m[0][0]*m[2][2] - m[0][2]*m[2][0]) / det
+	inv[1][2] = (m[0][2]*m[1][0] - m[0][0]*m[1][2]) / det
+	inv[2][0] = (m[1][0]*m[2][1] - m[1][1]*m[2][0]) / det
+	inv[2][1] = (m[0][1]*m[2][0] - m[0][0]*m[2][1]) / det
+	inv[2][2] = (m[0][0]*m[1][1] - m[0][1]*m[1][0]) / det
+	return
+}
+
+func encodeSRGB(v float64) float64 {
+	if v <= 0.0031308 {
+		return v * 12.92
+	}
+	return 1.055*math.Pow(v, 1/2.4) - 0.055
+}
+
+// A transform converts 16-bit values from one RGB colour space to another.
+type transform struct {
+	curves [3][]float64
+	matrix [3][3]float64
+	encode []uint16
+}
+
+// toSRGB creates the transform from the profile's colour space to sRGB.
+func (p *Profile) toSRGB() (*transform, error) {
+	if p.ColorSpace() != "RGB" || string(p.Data[20:24]) != "XYZ " {
+		return nil, errUnsupported
+	}
+
+	t := &transform{}
+
+	// The colorants form the columns of the matrix converting linear values to
+	// XYZ.
+	var toXYZ [3][3]float64
+	for i, sig := range []string{"rXYZ", "gXYZ", "bXYZ"} {
+		v, err := p.xyz(sig)
+		if err != nil {
+			return nil, err
+		}
+		for j := range v {
+			toXYZ[j][i] = v[j]
+		}
+	}
+	t.matrix = multiply(invert(srgbToXYZ), toXYZ)
+
+	for i, sig := range []string{"rTRC", "gTRC", "bTRC"} {
+		f, err := p.trc(sig)
+		if err != nil {
+			return nil, err
+		}
+
+		t.curves[i] = make([]float64, 0x10000)
+		for v := range t.curves[i] {
+			t.curves[i][v] = f(float64(v) / 0xffff)
+		}
+	}
+
+	t.encode = make([]uint16, 0x10000)
+	for v := range t.encode {
+		t.encode[v] = uint16(encodeSRGB(float64(v)/0xffff)*0xffff + 0.5)
+	}
+
+	return t, nil
+}
+
+func (t *transform) convert(c color.NRGBA64) color.NRGBA64 {
+	in := [3]float64{
+		t.curves[0][c.R],
+		t.curves[1][c.G],
+		t.curves[2][c.B],
+	}
+
+	var out [3]uint16
+	for i := range out {
+		v := t.matrix[i][0]*in[0] + t.matrix[i][1]*in[1] + t.matrix[i][2]*in[2]
+		v = math.Max(0, math.Min(1, v))
+		out[i] = t.encode[int(v*0xffff+0.5)]
+	}
+
+	return color.NRGBA64{out[0], out[1], out[2], c.A}
+}
+
+// ToSRGB converts the image from the colour space described by the profile to
+// sRGB. Only RGB profiles defined by colorants and tone reproduction curves,
+// such as Display P3 and Adobe RGB, are supported. The result has 16 bits per
+// channel only if img does.
+func ToSRGB(img image.Image, p *Profile) (image.Image, error) {
+	t, err := p.toSRGB()
+	if err != nil {
+		return nil, err
+	}
+
+	bounds := img.Bounds()
+
+	var out draw.Image
+	switch img.ColorModel() {
+	case color.RGBA64Model, color.NRGBA64Model, color.Gray16Model:
+		out = image.NewNRGBA64(bounds)
+	default:
+		out = image.NewNRGBA(bounds)
+	}
+
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			c := color.NRGBA64Model.Convert(img.At(x, y)).(color.NRGBA64)
+			out.Set(x, y, t.convert(c))
+		}
+	}
+
+	return out, nil
+}
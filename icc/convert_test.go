@@ -0,0 +1,78 @@
+package icc
+
+import (
+	"image"
+	"image/color"
+	"testing"
+)
+
+func TestToSRGB(t *testing.T) {
+	p, err := Parse(testProfile("Display P3", displayP3, 0))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Display P3 values of sRGB colours, the greys are the same in each as they
+	// share a white point and tone curve.
+	cases := []struct{ p3, srgb color.NRGBA }{
+		{color.NRGBA{234, 51, 35, 255}, color.NRGBA{255, 0, 0, 255}},
+		{color.NRGBA{117, 251, 76, 255}, color.NRGBA{0, 255, 0, 255}},
+		{color.NRGBA{0, 0, 245, 255}, color.NRGBA{0, 0, 255, 255}},
+		{color.NRGBA{128, 128, 128, 100}, color.NRGBA{128, 128, 128, 100}},
+		{color.NRGBA{255, 255, 255, 255}, color.NRGBA{255, 255, 255, 255}},
+		{color.NRGBA{0, 0, 0, 0}, color.NRGBA{0, 0, 0, 0}},
+	}
+
+	img := image.NewNRGBA(image.Rect(0, 0, len(cases), 1))
+	for i, c := range cases {
+		img.SetNRGBA(i, 0, c.p3)
+	}
+
+	out, err := ToSRGB(img, p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := out.(*image.NRGBA); !ok {
+		t.Errorf("expected 8-bit result, got %T", out)
+	}
+
+	// The P3 values are rounded, which is magnified near zero by the steep
+	// start of the sRGB curve.
+	const tolerance = 4
+
+	for i, c := range cases {
+		got := color.NRGBAModel.Convert(out.At(i, 0)).(color.NRGBA)
+		if diff(got.R, c.srgb.R) > tolerance || diff(got.G, c.srgb.G) > tolerance || diff(got.B, c.srgb.B) > tolerance || got.A != c.srgb.A {
+			t.Errorf("%v: expected %v, got %v", c.p3, c.srgb, got)
+		}
+	}
+}
+
+func TestToSRGBDeep(t *testing.T) {
+	p, _ := Parse(testProfile("Display P3", displayP3, 0))
+
+	out, err := ToSRGB(image.NewNRGBA64(image.Rect(0, 0, 1, 1)), p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := out.(*image.NRGBA64); !ok {
+		t.Errorf("expected 16-bit result, got %T", out)
+	}
+}
+
+func TestToSRGBUnsupported(t *testing.T) {
+	data := testProfile("Gray", displayP3, 0)
+	copy(data[16:], "GRAY")
+	p, _ := Parse(data)
+
+	if _, err := ToSRGB(image.NewNRGBA(image.Rect(0, 0, 1, 1)), p); err != errUnsupported {
+		t.Errorf("expected errUnsupported, got %v", err)
+	}
+}
+
+func diff(a, b uint8) int {
+	if a > b {
+		return int(a - b)
+	}
+	return int(b - a)
+}
@@ -0,0 +1,252 @@
+// Package icc reads and writes ICC colour profiles embedded in JPEG and PNG
+// files, and converts images described by RGB matrix/TRC profiles, such as
+// Display P3 or Adobe RGB, to sRGB.
+package icc
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+	"io/ioutil"
+	"strings"
+	"unicode/utf16"
+)
+
+var (
+	errBadProfile  = errors.New("icc: malformed profile")
+	errUnsupported = errors.New("icc: only RGB matrix/TRC profiles are supported")
+)
+
+var be = binary.BigEndian
+
+// A Profile is an ICC colour profile.
+type Profile struct {
+	// Data is the whole profile, as it would be embedded in an image.
+	Data []byte
+
+	tags map[string][]byte
+}
+
+// Parse reads the header and tag table of the profile in data.
+func Parse(data []byte) (*Profile, error) {
+	if len(data) < 132 || string(data[36:40]) != "acsp" {
+		return nil, errBadProfile
+	}
+
+	p := &Profile{Data: data, tags: map[string][]byte{}}
+
+	count := int(be.Uint32(data[128:]))
+	if 132+12*count > len(data) {
+		return nil, errBadProfile
+	}
+
+	for i := 0; i < count; i++ {
+		entry := data[132+12*i:]
+		offset := int(be.Uint32(entry[4:]))
+		size := int(be.Uint32(entry[8:]))
+
+		if offset < 0 || size < 0 || offset+size > len(data) {
+			return nil, errBadProfile
+		}
+		p.tags[string(entry[:4])] = data[offset : offset+size]
+	}
+
+	return p, nil
+}
+
+// Decode reads the profile embedded in an image (either JPEG or PNG). It returns
+// nil if no profile is found.
+func Decode(r io.Reader) (*Profile, error) {
+	b, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := extract(b)
+	if data == nil || err != nil {
+		return nil, err
+	}
+
+	return Parse(data)
+}
+
+// ColorSpace returns the colour space of the data the profile describes, for
+// example "RGB" or "GRAY".
+func (p *Profile) ColorSpace() string {
+	return strings.TrimSpace(string(p.Data[16:20]))
+}
+
+// Description returns the name of the profile, for example "Display P3".
+func (p *Profile) Description() string {
+	tag := p.tags["desc"]
+	if len(tag) < 12 {
+		return ""
+	}
+
+	switch string(tag[:4]) {
+	case "desc":
+		n := int(be.Uint32(tag[8:]))
+		if 12+n > len(tag) {
+			return ""
+		}
+		return strings.TrimRight(string(tag[12:12+n]), "\x00")
+
+	case "mluc":
+		if len(tag) < 28 {
+			return ""
+		}
+		// Use the first record, whatever the language.
+		length := int(be.Uint32(tag[20:]))
+		offset := int(be.Uint32(tag[24:]))
+		if offset+length > len(tag) {
+			return ""
+		}
+
+		units := make([]uint16, length/2)
+		for i := range units {
+			units[i] = be.Uint16(tag[offset+2*i:])
+		}
+		return string(utf16.Decode(units))
+	}
+
+	return ""
+}
+
+// xyz reads an XYZType tag.
+func (p *Profile) xyz(sig string) ([3]float64, error) {
+	tag := p.tags[sig]
+	if len(tag) < 20 || string(tag[:4]) != "XYZ " {
+		return [3]float64{}, errUnsupported
+	}
+
+	return [3]float64{
+		s15Fixed16(tag[8:]),
+		s15Fixed16(tag[12:]),
+		s15Fixed16(tag[16:]),
+	}, nil
+}
+
+func s15Fixed16(b []byte) float64 {
+	return float64(int32(be.Uint32(b))) / 65536
+}
+
+// A curve maps an encoded value from 0 to 1 to a linear value.
+type curve func(float64) float64
+
+// trc reads a curveType or parametricCurveType tag.
+func (p *Profile) trc(sig string) (curve, error) {
+	tag := p.tags[sig]
+	if len(tag) < 12 {
+		return nil, errUnsupported
+	}
+
+	switch string(tag[:4]) {
+	case "curv":
+		n := int(be.Uint32(tag[8:]))
+		if 12+2*n > len(tag) {
+			return nil, errBadProfile
+		}
+
+		switch n {
+		case 0:
+			return func(x float64) float64 { return x }, nil
+		case 1:
+			gamma := float64(be.Uint16(tag[12:])) / 256
+			return func(x float64) float64 { return pow(x, gamma) }, nil
+		}
+
+		table := make([]float64, n)
+		for i := range table {
+			table[i] = float64(be.Uint16(tag[12+2*i:])) / 0xffff
+		}
+		return func(x float64) float64 { return interpolate(table, x) }, nil
+
+	case "para":
+		return parametric(tag)
+	}
+
+	return nil, errUnsupported
+}
+
+// parametric reads a parametricCurveType tag, see section 10.18 of the ICC
+// specification.
+func parametric(tag []byte) (curve, error) {
+	counts := []int{1, 3, 4, 5, 7}
+
+	kind := int(be.Uint16(tag[8:]))
+	if kind >= len(counts) || 12+4*counts[kind] > len(tag) {
+		return nil, errBadProfile
+	}
+
+	// Missing parameters are set so that each type is a special case of the
+	// last.
+	v := []float64{1, 1, 0, 0, 0, 0, 0}
+	for i := 0; i < counts[kind]; i++ {
+		v[i] = s15Fixed16(tag[12+4*i:])
+	}
+	g, a, b, c, d, e, f := v[0], v[1], v[2], v[3], v[4], v[5], v[6]
+
+	switch kind {
+	case 0:
+		return func(x float64) float64 { return pow(x, g) }, nil
+	case 1:
+		return func(x float64) float64 {
+			if x >= -b/a {
+				return pow(a*x+b, g)
+			}
+			return 0
+		}, nil
+	case 2:
+		return func(x float64) float64 {
+			if x >= -b/a {
+				return pow(a*x+b, g) + c
+			}
+			return c
+		}, nil
+	}
+
+	// Types 3 and 4 differ only by e and f, which are 0 for type 3.
+	return func(x float64) float64 {
+		if x >= d {
+			return pow(a*x+b, g) + e
+		}
+		return c*x + f
+	}, nil
+}
+
+// interpolate finds the value at x, from 0 to 1, of the evenly spaced table.
+func interpolate(table []float64, x float64) float64 {
+	if x <= 0 {
+		return table[0]
+	}
+	if x >= 1 {
+		return table[len(table)-1]
+	}
+
+	pos := x * float64(len(table)-1)
+	i := int(pos)
+	frac := pos - float64(i)
+
+	return table[i]*(1-frac) + table[i+1]*frac
+}
+
+// name returns a name for the profile suitable for a PNG iCCP chunk, which
+// must be 1 to 79 printable Latin-1 characters.
+func (p *Profile) name() []byte {
+	var name bytes.Buffer
+
+	for _, r := range p.Description() {
+		if name.Len() == 79 {
+			break
+		}
+		if r >= 0x20 && r <= 0x7e {
+			name.WriteRune(r)
+		}
+	}
+
+	if strings.TrimSpace(name.String()) == "" {
+		return []byte("ICC profile")
+	}
+	return bytes.TrimSpace(name.Bytes())
+}
@@ -0,0 +1,189 @@
+package icc
+
+import (
+	"bytes"
+	"encoding/binary"
+	"image"
+	"image/jpeg"
+	"image/png"
+	"math"
+	"testing"
+)
+
+// Colorants of Display P3, adapted to D50.
+var displayP3 = [3][3]float64{
+	{0.515102, 0.241182, -0.001050},
+	{0.291965, 0.692236, 0.041882},
+	{0.157153, 0.066582, 0.784378},
+}
+
+// testProfile builds an RGB matrix/TRC profile with the colorants given and
+// the sRGB tone curve, described by desc as an mluc tag. padding adds a tag of
+// that many bytes, to make large profiles.
+func testProfile(desc string, colorants [3][3]float64, padding int) []byte {
+	fixed := func(v float64) []byte {
+		return binary.BigEndian.AppendUint32(nil, uint32(int32(math.Round(v*65536))))
+	}
+
+	type tag struct {
+		sig  string
+		data []byte
+	}
+	var tags []tag
+
+	mluc := []byte("mluc\x00\x00\x00\x00")
+	mluc = binary.BigEndian.AppendUint32(mluc, 1)
+	mluc = binary.BigEndian.AppendUint32(mluc, 12)
+	mluc = append(mluc, "enUS"...)
+	mluc = binary.BigEndian.AppendUint32(mluc, uint32(2*len(desc)))
+	mluc = binary.BigEndian.AppendUint32(mluc, 28)
+	for _, r := range desc {
+		mluc = binary.BigEndian.AppendUint16(mluc, uint16(r))
+	}
+	tags = append(tags, tag{"desc", mluc})
+
+	for i, sig := range []string{"rXYZ", "gXYZ", "bXYZ"} {
+		xyz := []byte("XYZ \x00\x00\x00\x00")
+		for _, v := range colorants[i] {
+			xyz = append(xyz, fixed(v)...)
+		}
+		tags = append(tags, tag{sig, xyz})
+	}
+
+	para := []byte("para\x00\x00\x00\x00\x00\x03\x00\x00")
+	for _, v := range []float64{2.4, 1 / 1.055, 0.055 / 1.055, 1 / 12.92, 0.04045} {
+		para = append(para, fixed(v)...)
+	}
+	for _, sig := range []string{"rTRC", "gTRC", "bTRC"} {
+		tags = append(tags, tag{sig, para})
+	}
+
+	if padding > 0 {
+		tags = append(tags, tag{"zzzz", make([]byte, padding)})
+	}
+
+	header := make([]byte, 128)
+	copy(header[12:], "mntr")
+	copy(header[16:], "RGB XYZ ")
+	copy(header[36:], "acsp")
+
+	table := binary.BigEndian.AppendUint32(nil, uint32(len(tags)))
+	offset := 128 + 4 + 12*len(tags)
+	var data []byte
+	for _, t := range tags {
+		table = append(table, t.sig...)
+		table = binary.BigEndian.AppendUint32(table, uint32(offset+len(data)))
+		table = binary.BigEndian.AppendUint32(table, uint32(len(t.data)))
+		data = append(data, t.data...)
+	}
+
+	profile := append(append(header, table...), data...)
+	binary.BigEndian.PutUint32(profile, uint32(len(profile)))
+	return profile
+}
+
+func TestParse(t *testing.T) {
+	p, err := Parse(testProfile("Display P3", displayP3, 0))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if p.ColorSpace() != "RGB" {
+		t.Errorf("expected RGB, got %q", p.ColorSpace())
+	}
+	if p.Description() != "Display P3" {
+		t.Errorf("expected Display P3, got %q", p.Description())
+	}
+	if string(p.name()) != "Display P3" {
+		t.Errorf("expected name Display P3, got %q", p.name())
+	}
+
+	v, err := p.xyz("gXYZ")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := range v {
+		if math.Abs(v[i]-displayP3[1][i]) > 1e-4 {
+			t.Errorf("expected gXYZ %v, got %v", displayP3[1], v)
+		}
+	}
+
+	f, err := p.trc("rTRC")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, x := range []float64{0, 0.02, 0.5, 1} {
+		want := x / 12.92
+		if x >= 0.04045 {
+			want = math.Pow((x+0.055)/1.055, 2.4)
+		}
+		if got := f(x); math.Abs(got-want) > 1e-4 {
+			t.Errorf("trc(%v): expected %v, got %v", x, want, got)
+		}
+	}
+}
+
+func TestParseMalformed(t *testing.T) {
+	data := testProfile("Display P3", displayP3, 0)
+
+	for i := range data {
+		if p, err := Parse(data[:i]); err == nil {
+			// the tag table is intact, but tags may be cut short
+			p.Description()
+			p.toSRGB()
+		}
+	}
+
+	bad := append([]byte{}, data...)
+	binary.BigEndian.PutUint32(bad[128:], 0xffffff)
+	if _, err := Parse(bad); err == nil {
+		t.Error("expected error for overlong tag table")
+	}
+
+	bad = append([]byte{}, data...)
+	binary.BigEndian.PutUint32(bad[132+8:], 0xffffff)
+	if _, err := Parse(bad); err == nil {
+		t.Error("expected error for overlong tag")
+	}
+}
+
+func TestEmbed(t *testing.T) {
+	img := image.NewGray(image.Rect(0, 0, 4, 4))
+
+	var jpg, pngb bytes.Buffer
+	jpeg.Encode(&jpg, img, nil)
+	png.Encode(&pngb, img)
+
+	for name, b := range map[string][]byte{"jpeg": jpg.Bytes(), "png": pngb.Bytes()} {
+		// the large profile must be split over several JPEG segments
+		for _, padding := range []int{0, 3 * maxPart} {
+			data := testProfile("Display P3", displayP3, padding)
+			p, _ := Parse(data)
+
+			var buf bytes.Buffer
+			if err := Embed(&buf, bytes.NewReader(b), p); err != nil {
+				t.Fatal(name, err)
+			}
+
+			got, err := Decode(bytes.NewReader(buf.Bytes()))
+			if err != nil {
+				t.Fatal(name, err)
+			}
+			if got == nil || !bytes.Equal(got.Data, data) {
+				t.Errorf("%s: expected profile to round trip with %d bytes padding", name, padding)
+			}
+
+			if _, _, err := image.Decode(bytes.NewReader(buf.Bytes())); err != nil {
+				t.Error(name, err)
+			}
+
+			var removed bytes.Buffer
+			if err := Embed(&removed, bytes.NewReader(buf.Bytes()), nil); err != nil {
+				t.Fatal(name, err)
+			}
+			if got, _ := Decode(&removed); got != nil {
+				t.Errorf("%s: expected profile to be removed", name)
+			}
+		}
+	}
+}
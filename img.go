@@ -1,20 +1,28 @@
 package main
 
 import (
-	"bytes"
+	"context"
 	"flag"
+	"fmt"
 	"os"
 	"os/exec"
 	"path/filepath"
 	"strings"
+	"time"
 
 	"hawx.me/code/hadfield"
+	"hawx.me/code/img/cache"
 	"hawx.me/code/img/cmd"
+	"hawx.me/code/img/plugin"
 	"hawx.me/code/img/utils"
 )
 
 type External struct {
-	Path, Usage, Short, Long string
+	Path string
+
+	// desc is set by describe, along with warning if there was a problem.
+	desc    *plugin.Description
+	warning string
 }
 
 func (e External) String() string {
@@ -26,14 +34,116 @@ func (e *External) Name() string {
 }
 
 func (e *External) Data() interface{} {
+	e.describe()
+
 	return map[string]interface{}{
-		"Callable": e.Callable(),
-		"Category": e.Category(),
-		"Usage":    e.Usage,
-		"Short":    e.Short,
-		"Long":     e.Long,
-		"Name":     e.Name(),
+		"Callable":   e.Callable(),
+		"Category":   e.Category(),
+		"Usage":      e.desc.Usage,
+		"Short":      e.desc.Short,
+		"Long":       e.long(),
+		"Name":       e.Name(),
+		"Version":    e.desc.Version,
+		"Categories": e.desc.Categories,
+		"Warning":    e.warning,
+	}
+}
+
+// describeTimeout is the longest an external command is given to describe
+// itself.
+const describeTimeout = 2 * time.Second
+
+// describe finds out about the command, unless it already has. The description
+// is taken from the cache if the command has not changed since it was stored.
+func (e *External) describe() {
+	if e.desc != nil {
+		return
+	}
+
+	info, err := os.Stat(e.Path)
+	if err != nil {
+		e.desc = &plugin.Description{Name: e.Name()}
+		e.warning = err.Error()
+		return
+	}
+
+	cache := descriptionCache()
+	if cache != nil {
+		if desc, warning, ok := cache.Get(e.Path, info); ok {
+			e.desc, e.warning = desc, warning
+			return
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), describeTimeout)
+	defer cancel()
+
+	// The command may not understand the current output argument, but it can't
+	// be known until it has been described.
+	desc, err := plugin.Describe(ctx, e.Path, utils.LegacyOutputArg())
+	e.desc = desc
+	if err != nil {
+		e.warning = err.Error()
+	}
+
+	// A command that timed out may only have been slow this time, so is tried
+	// again next time. The cache only saves time, so it doesn't matter if it
+	// can't be written.
+	if cache != nil && ctx.Err() == nil {
+		cache.Put(e.Path, info, desc, err)
+	}
+}
+
+var pluginCache *plugin.Cache
+
+// descriptionCache returns the cache of descriptions of external commands, kept
+// in the user's cache directory, or nil if there isn't one.
+func descriptionCache() *plugin.Cache {
+	if pluginCache == nil {
+		dir, err := os.UserCacheDir()
+		if err != nil {
+			return nil
+		}
+		pluginCache = plugin.OpenCache(filepath.Join(dir, "img", "plugins.json"))
 	}
+
+	return pluginCache
+}
+
+// long returns the help for the command, followed by its options and version if
+// they were described, and any problem describing it.
+func (e *External) long() string {
+	long := e.desc.Long
+
+	if len(e.desc.Flags) > 0 {
+		long = strings.TrimRight(long, "\n") + "\n\n  Options:\n"
+
+		for _, f := range e.desc.Flags {
+			name := "--" + f.Name
+			if f.Type != "bool" {
+				name += " <" + f.Type + ">"
+			}
+
+			line := fmt.Sprintf("    %-24s", name)
+			if f.Usage != "" {
+				line += " # " + f.Usage
+			}
+			if f.Default != "" && f.Type != "bool" {
+				line += " (default " + f.Default + ")"
+			}
+			long += strings.TrimRight(line, " ") + "\n"
+		}
+	}
+
+	if e.desc.Version != "" {
+		long = strings.TrimRight(long, "\n") + "\n\n  Version " + e.desc.Version + "\n"
+	}
+
+	if e.warning != "" {
+		long = strings.TrimRight(long, "\n") + "\n\n  Warning: " + e.warning + "\n"
+	}
+
+	return long
 }
 
 func (e *External) Category() string {
@@ -50,21 +160,36 @@ func (e *External) Call(cmd hadfield.Interface, templates hadfield.Templates, ar
 	}
 
 	// args[0] is set to the executable's name, so we can safely replace it with
-	// the output type. This is always going to be something, so needs to be
-	// checked for, removed, and respected!
-	args[0] = string(utils.Output)
+	// the output type and options. This is always going to be something, so
+	// needs to be checked for, removed, and respected!
+	args[0] = e.outputArg()
 
 	ex := exec.Command(e.Path, args...)
 	ex.Stdin = os.Stdin
 	ex.Stdout = os.Stdout
 	ex.Stderr = os.Stderr
 	err := ex.Run()
+	if exitErr, ok := err.(*exec.ExitError); ok {
+		os.Exit(exitErr.ExitCode())
+	}
 	if err != nil {
 		os.Exit(2)
 	}
 	return
 }
 
+// outputArg returns the output argument for the command. Commands that don't
+// use the --describe protocol were built before the output could be "same" or
+// have options, so are given a bare format they understand.
+func (e *External) outputArg() string {
+	e.describe()
+
+	if e.desc.Protocol >= 1 {
+		return utils.OutputArg()
+	}
+	return utils.LegacyOutputArg()
+}
+
 func findExternalsIn(dir string) ([]string, error) {
 	found := []string{}
 
@@ -78,21 +203,19 @@ func findExternalsIn(dir string) ([]string, error) {
 	return found, nil
 }
 
-func runExternal(ext string, flags ...string) string {
-	cmd := exec.Command(ext, flags...)
-	var out bytes.Buffer
-	cmd.Stdout = &out
-	err := cmd.Run()
-	if err != nil {
-		// handle
-	}
-	return out.String()
-}
+// externals holds the commands found by lookupExternals.
+var externals hadfield.Commands
 
+// lookupExternals finds the external commands on the PATH. They are not run
+// until their help is needed, see describe.
 func lookupExternals() hadfield.Commands {
+	if externals != nil {
+		return externals
+	}
+
 	found := hadfield.Commands{}
+	seen := map[string]bool{}
 	pathenv := os.Getenv("PATH")
-	output := string(utils.Output)
 
 	for _, dir := range strings.Split(pathenv, ":") {
 		if dir == "" {
@@ -100,33 +223,48 @@ func lookupExternals() hadfield.Commands {
 		}
 
 		if exts, err := findExternalsIn(dir); err == nil {
-			for _, ext := range exts {
-				usage := runExternal(ext, output, "--usage")
-				short := runExternal(ext, output, "--short")
-				long := runExternal(ext, output, "--long")
-
-				found = append(found, &External{ext, usage, short, long})
+			for _, path := range exts {
+				// As with the shell, the first command found on the PATH is used.
+				ext := &External{Path: path}
+				if seen[ext.Name()] {
+					continue
+				}
+				seen[ext.Name()] = true
+
+				found = append(found, ext)
 			}
 		}
 	}
 
+	externals = found
 	return found
 }
 
 // Commands list the available commands and help topics. The order here is the
 // order in which they are printed by 'img help'.
 var commands = hadfield.Commands{
+	cmd.Batch(),
 	cmd.Blend(),
 	cmd.Blur(),
+	cmd.Cache(),
+	cmd.Carve(),
 	cmd.Channel(),
 	cmd.Contrast(),
+	cmd.ConvertProfile(),
 	cmd.Crop(),
+	cmd.Flip(),
 	cmd.Gamma(),
 	cmd.Greyscale(),
 	cmd.Hxl(),
 	cmd.Levels(),
+	cmd.Orient(),
+	cmd.Pipe(),
 	cmd.Pixelate(),
 	cmd.Pxl(),
+	cmd.Recipe(),
+	cmd.Resize(),
+	cmd.Rotate(),
+	cmd.Serve(),
 	cmd.Sharpen(),
 	cmd.Shuffle(),
 	cmd.Tint(),
@@ -141,6 +279,32 @@ var templates = hadfield.Templates{
   and print the result to STDOUT (in some cases they may also require a second
   image, consult the help for the particular command).
 
+  The result is written in the same format as the input (or as a PNG if that
+  format cannot be written), unless one of the following is given before the
+  command,
+
+    --png, --jpeg, --tiff, --gif, --bmp or --webp
+
+  GIFs are written using a palette chosen to suit the image. To use a fixed
+  palette instead give --palette plan9 or --palette websafe. Commands are
+  applied to every frame of an animated GIF, which stays animated if written as
+  a GIF.
+
+  The size of the output can be controlled with the following,
+
+    --quality 1-100                          # for JPEG, default 75
+    --png-compression default|best|fast|none
+    --tiff-compression none|deflate|lzw
+
+  Results can be stored, so that running a command again on the same image is
+  faster, with the following (see "img help cache"),
+
+    --cache-dir <dir>
+    --cache-size <n>                         # default 1G
+
+  Photos that are stored on their side, with an exif Orientation, are turned
+  the right way up before the command is run if --auto-orient is given.
+
   An example usage,
 
     $ img greyscale < input.png > output.png
@@ -154,7 +318,7 @@ var templates = hadfield.Templates{
     {{.Name | printf "%-15s"}} # {{.Short | trim}}{{end}}{{end}}
 
   External Commands: {{range .}}{{if eq .Category "External"}}
-    {{.Name | printf "%-15s"}} # {{.Short | trim}}{{end}}{{end}}
+    {{.Name | printf "%-15s"}} # {{if .Warning}}warning: {{.Warning}}{{else}}{{.Short | trim}}{{end}}{{end}}{{end}}
 
 Use "img help [command]" for more information about a command.
 `,
@@ -164,8 +328,10 @@ Use "img help [command]" for more information about a command.
 }
 
 var builtIn = []string{
-	"blend", "blur", "channel", "contrast", "crop", "gamma", "greyscale", "hxl",
-	"levels", "pixelate", "pxl", "sharpen", "shuffle", "tint", "vxl",
+	"batch", "blend", "blur", "cache", "carve", "channel", "contrast",
+	"convert-profile", "crop", "flip", "gamma", "greyscale", "hxl", "levels",
+	"orient", "pipe", "pixelate", "pxl", "recipe", "resize", "rotate", "serve",
+	"sharpen", "shuffle", "tint", "vibrance", "vxl",
 }
 
 func isRunningBuiltin(args []string) bool {
@@ -188,14 +354,32 @@ func main() {
 		hadfield.Usage(append(commands, externals...), templates)
 	}
 
-	var jpeg, png, tiff bool
+	var same, jpeg, png, tiff, gif, bmp, webp bool
+	flag.BoolVar(&same, "same", false, "")
 	flag.BoolVar(&jpeg, "jpg", false, "")
 	flag.BoolVar(&jpeg, "jpeg", false, "")
 	flag.BoolVar(&png, "png", false, "")
 	flag.BoolVar(&tiff, "tiff", false, "")
 	flag.BoolVar(&tiff, "tif", false, "")
+	flag.BoolVar(&gif, "gif", false, "")
+	flag.BoolVar(&bmp, "bmp", false, "")
+	flag.BoolVar(&webp, "webp", false, "")
+
+	flag.BoolVar(&cmd.AutoOrient, "auto-orient", false, "")
+
+	var cacheDir, cacheSize string
+	flag.StringVar(&cacheDir, "cache-dir", "", "")
+	flag.StringVar(&cacheSize, "cache-size", "1G", "")
+
+	options := []string{"quality", "png-compression", "tiff-compression", "palette"}
+	for _, name := range options {
+		flag.String(name, "", "")
+	}
 
 	flag.Parse()
+	if same {
+		utils.Output = utils.SAME
+	}
 	if jpeg {
 		utils.Output = utils.JPEG
 	}
@@ -205,6 +389,35 @@ func main() {
 	if tiff {
 		utils.Output = utils.TIFF
 	}
+	if gif {
+		utils.Output = utils.GIF
+	}
+	if bmp {
+		utils.Output = utils.BMP
+	}
+	if webp {
+		utils.Output = utils.WEBP
+	}
+
+	for _, name := range options {
+		if !utils.FlagVisited(name, *flag.CommandLine) {
+			continue
+		}
+
+		if err := utils.SetOption(name, flag.Lookup(name).Value.String()); err != nil {
+			utils.Warn("img: --" + err.Error())
+			os.Exit(2)
+		}
+	}
+
+	if cacheDir != "" {
+		size, err := cache.ParseSize(cacheSize)
+		if err != nil {
+			utils.Warn("img: --cache-size:", err)
+			os.Exit(2)
+		}
+		cmd.ResultCache = cache.New(cacheDir, size)
+	}
 
 	if !isRunningBuiltin(flag.Args()) {
 		externals := lookupExternals()
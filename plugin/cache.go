@@ -0,0 +1,104 @@
+package plugin
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// A Cache stores the Descriptions of commands in a file, so that each command
+// does not need to be run whenever img starts. Entries are found by the path of
+// the command and its modification time, so a command is described again after
+// it changes.
+type Cache struct {
+	path string
+
+	mu      sync.Mutex
+	entries map[string]cacheEntry
+}
+
+type cacheEntry struct {
+	ModTime     time.Time    `json:"modTime"`
+	Size        int64        `json:"size"`
+	Description *Description `json:"description"`
+
+	// Err is set if describing the command failed, so that a broken command is
+	// not run again until it changes.
+	Err string `json:"error,omitempty"`
+}
+
+// OpenCache reads the cache stored in the file at path. If the file does not
+// exist, or cannot be read, the cache starts empty.
+func OpenCache(path string) *Cache {
+	c := &Cache{path: path, entries: map[string]cacheEntry{}}
+
+	if data, err := ioutil.ReadFile(path); err == nil {
+		json.Unmarshal(data, &c.entries)
+	}
+
+	return c
+}
+
+// Get returns the Description stored for the command at path, and the error
+// that describing it returned, if the command has not changed since.
+func (c *Cache) Get(path string, info os.FileInfo) (*Description, string, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	entry, ok := c.entries[path]
+	if !ok || entry.Description == nil || !entry.ModTime.Equal(info.ModTime()) || entry.Size != info.Size() {
+		return nil, "", false
+	}
+
+	return entry.Description, entry.Err, true
+}
+
+// Put stores the Description, and any error from describing it, for the
+// command at path then writes the cache to its file.
+func (c *Cache) Put(path string, info os.FileInfo, d *Description, err error) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	entry := cacheEntry{ModTime: info.ModTime(), Size: info.Size(), Description: d}
+	if err != nil {
+		entry.Err = err.Error()
+	}
+	c.entries[path] = entry
+
+	// Remove the entries of commands that no longer exist.
+	for p := range c.entries {
+		if _, err := os.Stat(p); err != nil {
+			delete(c.entries, p)
+		}
+	}
+
+	data, err := json.Marshal(c.entries)
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(c.path), 0755); err != nil {
+		return err
+	}
+
+	// Write to a temporary file first so that another img running at the same
+	// time never reads a partly written cache.
+	tmp, err := ioutil.TempFile(filepath.Dir(c.path), filepath.Base(c.path)+".tmp*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp.Name(), c.path)
+}
@@ -0,0 +1,89 @@
+package plugin
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestCache(t *testing.T) {
+	dir := t.TempDir()
+	cachePath := filepath.Join(dir, "cache", "plugins.json")
+
+	command := writeScript(t, dir, "img-fake", `echo '{"protocol": 1}'`)
+	info, err := os.Stat(command)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	c := OpenCache(cachePath)
+	if _, _, ok := c.Get(command, info); ok {
+		t.Fatal("expected empty cache")
+	}
+
+	d := &Description{Protocol: 1, Name: "fake", Short: "do nothing"}
+	if err := c.Put(command, info, d, errors.New("--long: exit status 1")); err != nil {
+		t.Fatal(err)
+	}
+
+	// A new Cache reads what was written by the last.
+	c = OpenCache(cachePath)
+	got, warning, ok := c.Get(command, info)
+	if !ok {
+		t.Fatal("expected description to be cached")
+	}
+	if got.Name != "fake" || got.Short != "do nothing" || warning != "--long: exit status 1" {
+		t.Errorf("unexpected cached description %+v, %q", got, warning)
+	}
+
+	// Changing the command makes the entry stale.
+	later := info.ModTime().Add(time.Minute)
+	if err := os.Chtimes(command, later, later); err != nil {
+		t.Fatal(err)
+	}
+	changed, _ := os.Stat(command)
+	if _, _, ok := c.Get(command, changed); ok {
+		t.Error("expected entry to be invalidated by a new modification time")
+	}
+
+	writeScript(t, dir, "img-fake", `echo '{"protocol": 1, "name": "longer"}'`)
+	os.Chtimes(command, info.ModTime(), info.ModTime())
+	resized, _ := os.Stat(command)
+	if _, _, ok := c.Get(command, resized); ok {
+		t.Error("expected entry to be invalidated by a new size")
+	}
+}
+
+func TestCacheRemovesMissing(t *testing.T) {
+	dir := t.TempDir()
+	cachePath := filepath.Join(dir, "plugins.json")
+
+	a := writeScript(t, dir, "img-a", "")
+	b := writeScript(t, dir, "img-b", "")
+	infoA, _ := os.Stat(a)
+	infoB, _ := os.Stat(b)
+
+	c := OpenCache(cachePath)
+	c.Put(a, infoA, &Description{Name: "a"}, nil)
+	os.Remove(a)
+	c.Put(b, infoB, &Description{Name: "b"}, nil)
+
+	c = OpenCache(cachePath)
+	if _, ok := c.entries[a]; ok {
+		t.Error("expected entry for removed command to be dropped")
+	}
+	if _, _, ok := c.Get(b, infoB); !ok {
+		t.Error("expected entry for b")
+	}
+}
+
+func TestOpenCacheCorrupt(t *testing.T) {
+	cachePath := filepath.Join(t.TempDir(), "plugins.json")
+	os.WriteFile(cachePath, []byte("{not json"), 0644)
+
+	if c := OpenCache(cachePath); len(c.entries) != 0 {
+		t.Errorf("expected corrupt cache to start empty, got %v", c.entries)
+	}
+}
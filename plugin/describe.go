@@ -0,0 +1,82 @@
+package plugin
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// Describe runs the external command at path to find out about it. The output
+// argument is passed first, as it is whenever the command is run. If the command
+// does not understand --describe the Description is made from the text printed
+// for --usage, --short and --long instead, and has a Protocol of 0.
+//
+// If an error is returned the Description holds as much as could be found,
+// which is at least the Name. The commands are stopped if ctx is done before
+// they finish.
+func Describe(ctx context.Context, path, output string) (*Description, error) {
+	name := strings.TrimPrefix(filepath.Base(path), "img-")
+
+	if out, err := command(ctx, path, output, "--describe").Output(); err == nil {
+		d := &Description{IO: IO{Stdin: true, Stdout: true}}
+
+		if json.Unmarshal(bytes.TrimSpace(out), d) == nil && d.Protocol > 0 {
+			if d.Name == "" {
+				d.Name = name
+			}
+			if d.Protocol > ProtocolVersion {
+				return &Description{Name: name}, fmt.Errorf("protocol version %d is not supported", d.Protocol)
+			}
+			return d, nil
+		}
+	}
+
+	d := &Description{Name: name, IO: IO{Stdin: true, Stdout: true}}
+
+	var firstErr error
+	for _, part := range []struct {
+		flag string
+		dst  *string
+	}{
+		{"--usage", &d.Usage},
+		{"--short", &d.Short},
+		{"--long", &d.Long},
+	} {
+		if ctx.Err() != nil {
+			break
+		}
+
+		var out bytes.Buffer
+		cmd := command(ctx, path, output, part.flag)
+		cmd.Stdout = &out
+
+		if err := cmd.Run(); err != nil && firstErr == nil {
+			firstErr = errors.New(part.flag + ": " + err.Error())
+		}
+		*part.dst = out.String()
+	}
+
+	if ctx.Err() == context.DeadlineExceeded {
+		return d, errors.New("timed out")
+	}
+
+	return d, firstErr
+}
+
+// command returns the command to run the plugin at path with args, which is
+// killed if ctx is done before it finishes.
+func command(ctx context.Context, path string, args ...string) *exec.Cmd {
+	cmd := exec.CommandContext(ctx, path, args...)
+
+	// Don't wait long for the output to close once the command is killed, it may
+	// have been passed on to a process that is still running.
+	cmd.WaitDelay = 100 * time.Millisecond
+
+	return cmd
+}
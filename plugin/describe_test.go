@@ -0,0 +1,140 @@
+package plugin
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// writeScript creates an executable shell script named name in dir. The script
+// is given the output format then the flag, as a command is by img.
+func writeScript(t *testing.T, dir, name, body string) string {
+	t.Helper()
+
+	path := filepath.Join(dir, name)
+	if err := os.WriteFile(path, []byte("#!/bin/sh\n"+body), 0755); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestDescribe(t *testing.T) {
+	dir := t.TempDir()
+
+	path := writeScript(t, dir, "img-fake", `
+case "$2" in
+  --describe) echo '{"protocol": 1, "usage": "fake [options]", "short": "do nothing", "flags": [{"name": "amount", "type": "float"}], "io": {"stdin": true, "stdout": true, "images": 1}}' ;;
+  *) exit 1 ;;
+esac
+`)
+
+	d, err := Describe(context.Background(), path, "png")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if d.Name != "fake" || d.Protocol != 1 || d.Usage != "fake [options]" || d.Short != "do nothing" {
+		t.Errorf("unexpected description: %+v", d)
+	}
+	if len(d.Flags) != 1 || d.Flags[0].Name != "amount" || d.Flags[0].Type != "float" {
+		t.Errorf("unexpected flags: %+v", d.Flags)
+	}
+	if d.IO != (IO{Stdin: true, Stdout: true, Images: 1}) {
+		t.Errorf("unexpected io: %+v", d.IO)
+	}
+}
+
+func TestDescribeOutputArg(t *testing.T) {
+	dir := t.TempDir()
+
+	path := writeScript(t, dir, "img-output", `
+[ "$1" = "jpeg" ] || exit 1
+echo '{"protocol": 1, "name": "renamed"}'
+`)
+
+	d, err := Describe(context.Background(), path, "jpeg")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if d.Name != "renamed" {
+		t.Errorf("expected name from description, got %q", d.Name)
+	}
+}
+
+func TestDescribeFallback(t *testing.T) {
+	dir := t.TempDir()
+
+	for _, describe := range []string{
+		`echo 'not json'`,
+		`echo '{"protocol": 1'`,
+		`echo '{"usage": "no protocol"}'`,
+		`exit 2`,
+	} {
+		path := writeScript(t, dir, "img-old", `
+case "$2" in
+  --describe) `+describe+` ;;
+  --usage) echo 'old [options]' ;;
+  --short) echo 'an old command' ;;
+  --long) echo 'Old takes an image.' ;;
+esac
+`)
+
+		d, err := Describe(context.Background(), path, "png")
+		if err != nil {
+			t.Fatal(describe, err)
+		}
+
+		if d.Name != "old" || d.Protocol != 0 || !d.IO.Stdin || !d.IO.Stdout {
+			t.Errorf("%s: unexpected description: %+v", describe, d)
+		}
+		if strings.TrimSpace(d.Usage) != "old [options]" || strings.TrimSpace(d.Short) != "an old command" || strings.TrimSpace(d.Long) != "Old takes an image." {
+			t.Errorf("%s: expected text from flags, got %+v", describe, d)
+		}
+	}
+}
+
+func TestDescribeErrors(t *testing.T) {
+	dir := t.TempDir()
+
+	newer := writeScript(t, dir, "img-newer", `echo '{"protocol": 99, "name": "newer"}'`)
+	d, err := Describe(context.Background(), newer, "png")
+	if err == nil {
+		t.Error("expected error for unsupported protocol")
+	}
+	if d.Name != "newer" {
+		t.Errorf("expected name to be kept, got %q", d.Name)
+	}
+
+	broken := writeScript(t, dir, "img-broken", `
+case "$2" in
+  --usage) echo 'broken' ;;
+  *) exit 1 ;;
+esac
+`)
+	d, err = Describe(context.Background(), broken, "png")
+	if err == nil || !strings.HasPrefix(err.Error(), "--short") {
+		t.Errorf("expected error from --short, got %v", err)
+	}
+	if d.Name != "broken" || strings.TrimSpace(d.Usage) != "broken" {
+		t.Errorf("expected partial description, got %+v", d)
+	}
+
+	slow := writeScript(t, dir, "img-slow", `exec sleep 10`)
+	ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer cancel()
+
+	start := time.Now()
+	d, err = Describe(ctx, slow, "png")
+	if err == nil || err.Error() != "timed out" {
+		t.Errorf("expected timeout, got %v", err)
+	}
+	if d.Name != "slow" {
+		t.Errorf("expected name to be kept, got %q", d.Name)
+	}
+	if time.Since(start) > 5*time.Second {
+		t.Error("expected command to be stopped")
+	}
+}
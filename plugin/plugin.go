@@ -0,0 +1,255 @@
+// Package plugin helps to write external commands for img, and describes the
+// protocol that img uses to talk to them.
+//
+// An external command is any executable named img-<name> on the PATH, it is run
+// by img as
+//
+//	img-<name> <output> [arguments]
+//
+// where <output> is the output format and options selected, to be read with
+// utils.GetOutput, and the arguments are those given to 'img <name>'. It should
+// read an image from STDIN and print the result to STDOUT, as the builtin
+// commands do.
+//
+// To find out about the command img runs it with the single argument
+// --describe, after <output>, and expects a Description to be printed as JSON,
+// for example
+//
+//	{
+//	  "protocol": 1,
+//	  "name": "posterise",
+//	  "version": "1.2.0",
+//	  "usage": "posterise [options]",
+//	  "short": "reduces the number of colours",
+//	  "long": "  Posterise takes an image from STDIN...",
+//	  "flags": [
+//	    {"name": "levels", "type": "int", "default": "4", "usage": "levels per channel"}
+//	  ],
+//	  "categories": ["colour"],
+//	  "io": {"stdin": true, "stdout": true, "images": 0}
+//	}
+//
+// Commands written before --describe existed are instead run three times, with
+// --usage, --short and --long, each printing the text for that part of the
+// help. New commands should print their help for these too, so that older
+// versions of img can use them.
+//
+// Using Main, as below, handles all of this,
+//
+//	func main() {
+//		p := plugin.New("posterise", "1.2.0")
+//		p.Short = "reduces the number of colours"
+//		levels := p.Flag.Int("levels", 4, "levels per channel")
+//
+//		p.Main(func(img image.Image, args []string) (image.Image, error) {
+//			return posterise(img, *levels), nil
+//		})
+//	}
+package plugin
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"image"
+	"io/ioutil"
+	"os"
+	"time"
+
+	"hawx.me/code/img/utils"
+)
+
+// ProtocolVersion is the version of the --describe protocol described by this
+// package. It is increased when a change is made that older versions of img
+// would not understand.
+const ProtocolVersion = 1
+
+// A Description is printed as JSON by a command given --describe.
+type Description struct {
+	// Protocol is the ProtocolVersion the command was written for.
+	Protocol int `json:"protocol"`
+
+	// Name is the name of the command, without the img- prefix.
+	Name string `json:"name"`
+
+	// Version is the version of the command, for example "1.2.0".
+	Version string `json:"version,omitempty"`
+
+	// Usage, Short and Long are the text shown by 'img help'. Usage starts with
+	// the name of the command, Short is a single line and Long is the full
+	// explanation of the command.
+	Usage string `json:"usage"`
+	Short string `json:"short"`
+	Long  string `json:"long,omitempty"`
+
+	Flags []Flag `json:"flags,omitempty"`
+
+	// Categories are words that group similar commands, such as "colour" or
+	// "blur".
+	Categories []string `json:"categories,omitempty"`
+
+	IO IO `json:"io"`
+}
+
+// A Flag is an option accepted by a command.
+type Flag struct {
+	Name string `json:"name"`
+
+	// Type is one of "bool", "int", "float", "duration" or "string".
+	Type string `json:"type"`
+
+	Default string `json:"default,omitempty"`
+	Usage   string `json:"usage,omitempty"`
+}
+
+// IO describes what a command reads and writes.
+type IO struct {
+	// Stdin is true if an image is read from STDIN.
+	Stdin bool `json:"stdin"`
+
+	// Stdout is true if an image is written to STDOUT.
+	Stdout bool `json:"stdout"`
+
+	// Images is the number of other images, given as the first arguments, that
+	// the command needs. For example blend would need 1.
+	Images int `json:"images,omitempty"`
+}
+
+// A Plugin is an external command written in Go.
+type Plugin struct {
+	Description
+
+	// Flag holds the flags of the command, they are listed in the Description
+	// automatically.
+	Flag *flag.FlagSet
+
+	// Composited is true if the command must be given whole frames of an
+	// animation, rather than just the part that changes, because it moves pixels
+	// or looks at their neighbours.
+	Composited bool
+}
+
+// New returns a Plugin, with the name and version given, that reads an image
+// from STDIN and writes one to STDOUT.
+func New(name, version string) *Plugin {
+	return &Plugin{
+		Description: Description{
+			Protocol: ProtocolVersion,
+			Name:     name,
+			Version:  version,
+			Usage:    name + " [options]",
+			IO:       IO{Stdin: true, Stdout: true},
+		},
+		Flag: flag.NewFlagSet(name, flag.ContinueOnError),
+	}
+}
+
+// Describe returns the Description of the plugin, including its flags.
+func (p *Plugin) Describe() Description {
+	d := p.Description
+	d.Protocol = ProtocolVersion
+	d.Flags = nil
+
+	p.Flag.VisitAll(func(f *flag.Flag) {
+		d.Flags = append(d.Flags, Flag{
+			Name:    f.Name,
+			Type:    flagType(f),
+			Default: f.DefValue,
+			Usage:   f.Usage,
+		})
+	})
+
+	return d
+}
+
+func flagType(f *flag.Flag) string {
+	getter, ok := f.Value.(flag.Getter)
+	if !ok {
+		return "string"
+	}
+
+	switch getter.Get().(type) {
+	case bool:
+		return "bool"
+	case int, int64, uint, uint64:
+		return "int"
+	case float64:
+		return "float"
+	case time.Duration:
+		return "duration"
+	}
+	return "string"
+}
+
+// Main runs the command. It answers --describe, and the older --usage, --short
+// and --long, otherwise it parses the flags then reads an image from STDIN,
+// calls f on it, or each frame of an animation, and writes the result to
+// STDOUT. The arguments left after the flags are passed to f.
+func (p *Plugin) Main(f func(img image.Image, args []string) (image.Image, error)) {
+	args := os.Args
+	if len(args) > 1 {
+		args = utils.GetOutput(args)
+	}
+	args = args[1:]
+
+	if len(args) == 1 {
+		switch args[0] {
+		case "--describe":
+			data, err := json.MarshalIndent(p.Describe(), "", "  ")
+			if err != nil {
+				utils.Fatal(err)
+			}
+			fmt.Printf("%s\n", data)
+			os.Exit(0)
+		case "--usage":
+			fmt.Println(p.Usage)
+			os.Exit(0)
+		case "--short":
+			fmt.Println(p.Short)
+			os.Exit(0)
+		case "--long":
+			fmt.Println(p.Long)
+			os.Exit(0)
+		}
+	}
+
+	p.Flag.SetOutput(ioutil.Discard)
+	if err := p.Flag.Parse(args); err != nil {
+		utils.Warn(p.Name+":", err)
+		os.Exit(2)
+	}
+
+	if n := p.Flag.NArg(); n < p.IO.Images {
+		utils.Warn(fmt.Sprintf("%s: expected %d images, got %d", p.Name, p.IO.Images, n))
+		os.Exit(2)
+	}
+
+	i, data, err := utils.ReadStdin()
+	if err != nil {
+		utils.Fatal(err)
+	}
+
+	apply := data.Apply
+	if p.Composited {
+		apply = data.ApplyComposited
+	}
+
+	i = apply(i, func(frame image.Image) image.Image {
+		if err != nil {
+			return frame
+		}
+
+		var out image.Image
+		if out, err = f(frame, p.Flag.Args()); err != nil {
+			return frame
+		}
+		return out
+	})
+	if err != nil {
+		utils.Fatal(err)
+	}
+
+	if err := utils.WriteStdout(i, data); err != nil {
+		utils.Fatal(err)
+	}
+}
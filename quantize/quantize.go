@@ -0,0 +1,167 @@
+// Package quantize provides functions for reducing the number of colours used
+// in an image, which is needed when writing paletted formats such as GIF.
+package quantize
+
+import (
+	"image"
+	"image/color"
+	"image/draw"
+	"sort"
+)
+
+// maxSamples is the greatest number of pixels considered when building a
+// palette, larger images are sampled evenly.
+const maxSamples = 1 << 18
+
+// Fixed returns a Quantizer that always uses the palette given, for example
+// palette.WebSafe.
+func Fixed(p color.Palette) draw.Quantizer {
+	return fixed(p)
+}
+
+type fixed color.Palette
+
+func (f fixed) Quantize(p color.Palette, m image.Image) color.Palette {
+	for _, c := range f {
+		if len(p) == cap(p) {
+			break
+		}
+		p = append(p, c)
+	}
+	return p
+}
+
+// MedianCut is a Quantizer that builds a palette by repeatedly splitting the
+// box of colours with the largest range at its median, then taking the average
+// of each box. If the image has transparent pixels a transparent colour is
+// added to the palette.
+type MedianCut struct{}
+
+type box []color.NRGBA
+
+// channel returns the value of the channel, 0 for red, 1 for green and 2 for
+// blue.
+func channel(c color.NRGBA, ch int) uint8 {
+	switch ch {
+	case 0:
+		return c.R
+	case 1:
+		return c.G
+	}
+	return c.B
+}
+
+// widest returns the channel with the largest range of values in the box, and
+// the size of that range.
+func (b box) widest() (ch int, size int) {
+	for i := 0; i < 3; i++ {
+		lo, hi := uint8(255), uint8(0)
+		for _, c := range b {
+			v := channel(c, i)
+			if v < lo {
+				lo = v
+			}
+			if v > hi {
+				hi = v
+			}
+		}
+		if int(hi)-int(lo) > size {
+			ch, size = i, int(hi)-int(lo)
+		}
+	}
+	return
+}
+
+func (b box) average() color.Color {
+	var r, g, bl int
+	for _, c := range b {
+		r += int(c.R)
+		g += int(c.G)
+		bl += int(c.B)
+	}
+	n := len(b)
+	return color.NRGBA{uint8(r / n), uint8(g / n), uint8(bl / n), 255}
+}
+
+// split returns the index nearest the middle of the sorted box b at which the
+// value of the channel changes. b must contain at least two distinct values.
+func split(b box, ch int) int {
+	mid := len(b) / 2
+	for d := 0; ; d++ {
+		if i := mid - d; i > 0 && channel(b[i-1], ch) != channel(b[i], ch) {
+			return i
+		}
+		if i := mid + d; i < len(b) && channel(b[i-1], ch) != channel(b[i], ch) {
+			return i
+		}
+	}
+}
+
+func (q MedianCut) Quantize(p color.Palette, m image.Image) color.Palette {
+	bounds := m.Bounds()
+	step := 1
+	if n := bounds.Dx() * bounds.Dy(); n > maxSamples {
+		step = n / maxSamples
+	}
+
+	colors := box{}
+	transparent := false
+	i := 0
+
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			if i%step == 0 {
+				c := color.NRGBAModel.Convert(m.At(x, y)).(color.NRGBA)
+				if c.A < 128 {
+					transparent = true
+				} else {
+					colors = append(colors, c)
+				}
+			}
+			i++
+		}
+	}
+
+	if transparent && len(p) < cap(p) {
+		p = append(p, color.NRGBA{})
+	}
+
+	n := cap(p) - len(p)
+	if n <= 0 || len(colors) == 0 {
+		return p
+	}
+
+	boxes := []box{colors}
+	for len(boxes) < n {
+		// Split the box with the widest range
+		best, bestSize, bestCh := -1, 0, 0
+		for j, b := range boxes {
+			if len(b) < 2 {
+				continue
+			}
+			if ch, size := b.widest(); size > bestSize {
+				best, bestSize, bestCh = j, size, ch
+			}
+		}
+		if best < 0 {
+			break
+		}
+
+		b := boxes[best]
+		sort.Slice(b, func(i, j int) bool {
+			return channel(b[i], bestCh) < channel(b[j], bestCh)
+		})
+
+		// Split between distinct values nearest the median, so that a box of
+		// mostly one colour doesn't give duplicates in the palette.
+		mid := split(b, bestCh)
+		boxes[best] = b[:mid]
+		boxes = append(boxes, b[mid:])
+	}
+
+	for _, b := range boxes {
+		p = append(p, b.average())
+	}
+
+	return p
+}
@@ -0,0 +1,75 @@
+package quantize
+
+import (
+	"image"
+	"image/color"
+	"image/color/palette"
+	"testing"
+)
+
+func testImage(transparent bool) *image.NRGBA {
+	img := image.NewNRGBA(image.Rect(0, 0, 64, 64))
+	for y := 0; y < 64; y++ {
+		for x := 0; x < 64; x++ {
+			c := color.NRGBA{uint8(x * 4), uint8(y * 4), uint8((x + y) * 2), 255}
+			if transparent && x < 8 {
+				c = color.NRGBA{}
+			}
+			img.SetNRGBA(x, y, c)
+		}
+	}
+	return img
+}
+
+func TestMedianCut(t *testing.T) {
+	for _, size := range []int{2, 16, 256} {
+		p := MedianCut{}.Quantize(make(color.Palette, 0, size), testImage(false))
+		if len(p) != size {
+			t.Errorf("expected %d colours, got %d", size, len(p))
+		}
+	}
+}
+
+func TestMedianCutTransparent(t *testing.T) {
+	p := MedianCut{}.Quantize(make(color.Palette, 0, 16), testImage(true))
+	if len(p) != 16 {
+		t.Fatalf("expected 16 colours, got %d", len(p))
+	}
+	if _, _, _, a := p[0].RGBA(); a != 0 {
+		t.Errorf("expected first colour to be transparent, got %v", p[0])
+	}
+}
+
+func TestMedianCutFewColours(t *testing.T) {
+	img := image.NewNRGBA(image.Rect(0, 0, 4, 4))
+	for i := range img.Pix {
+		img.Pix[i] = 255
+	}
+	img.SetNRGBA(0, 0, color.NRGBA{255, 0, 0, 255})
+
+	p := MedianCut{}.Quantize(make(color.Palette, 0, 256), img)
+	if len(p) != 2 {
+		t.Errorf("expected 2 colours, got %d: %v", len(p), p)
+	}
+}
+
+func TestMedianCutKeepsExisting(t *testing.T) {
+	p := make(color.Palette, 1, 8)
+	p[0] = color.Black
+
+	p = MedianCut{}.Quantize(p, testImage(false))
+	if len(p) != 8 || p[0] != color.Black {
+		t.Errorf("expected existing colour kept and 8 colours, got %v", p)
+	}
+}
+
+func TestFixed(t *testing.T) {
+	q := Fixed(palette.WebSafe)
+
+	if p := q.Quantize(make(color.Palette, 0, 256), testImage(false)); len(p) != len(palette.WebSafe) {
+		t.Errorf("expected %d colours, got %d", len(palette.WebSafe), len(p))
+	}
+	if p := q.Quantize(make(color.Palette, 0, 16), testImage(false)); len(p) != 16 {
+		t.Errorf("expected palette to be limited to 16, got %d", len(p))
+	}
+}
@@ -0,0 +1,102 @@
+package recipe
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
+	"strconv"
+)
+
+// parseJSON reads the JSON in data, keeping the line that each value is on.
+func parseJSON(data []byte) (*node, error) {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+
+	lineAt := func(offset int64) int {
+		if offset > int64(len(data)) {
+			offset = int64(len(data))
+		}
+		return bytes.Count(data[:offset], []byte("\n")) + 1
+	}
+
+	wrap := func(err error) error {
+		var syntax *json.SyntaxError
+		if errors.As(err, &syntax) {
+			return &Error{lineAt(syntax.Offset), err}
+		}
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		return &Error{lineAt(dec.InputOffset()), err}
+	}
+
+	var parseValue func() (*node, error)
+	parseValue = func() (*node, error) {
+		tok, err := dec.Token()
+		if err != nil {
+			return nil, wrap(err)
+		}
+		line := lineAt(dec.InputOffset())
+
+		switch v := tok.(type) {
+		case json.Delim:
+			if v == '{' {
+				n := newMapping(line)
+				for dec.More() {
+					key, err := dec.Token()
+					if err != nil {
+						return nil, wrap(err)
+					}
+					keyLine := lineAt(dec.InputOffset())
+
+					value, err := parseValue()
+					if err != nil {
+						return nil, err
+					}
+					if err := n.set(key.(string), keyLine, value); err != nil {
+						return nil, err
+					}
+				}
+				if _, err := dec.Token(); err != nil {
+					return nil, wrap(err)
+				}
+				return n, nil
+			}
+
+			n := &node{kind: sequenceNode, line: line}
+			for dec.More() {
+				item, err := parseValue()
+				if err != nil {
+					return nil, err
+				}
+				n.items = append(n.items, item)
+			}
+			if _, err := dec.Token(); err != nil {
+				return nil, wrap(err)
+			}
+			return n, nil
+
+		case string:
+			return &node{kind: scalarNode, line: line, value: v}, nil
+		case json.Number:
+			return &node{kind: scalarNode, line: line, value: v.String()}, nil
+		case bool:
+			return &node{kind: scalarNode, line: line, value: strconv.FormatBool(v)}, nil
+		}
+
+		// null is the same as giving no value.
+		return &node{kind: scalarNode, line: line}, nil
+	}
+
+	root, err := parseValue()
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err := dec.Token(); err != io.EOF {
+		return nil, &Error{lineAt(dec.InputOffset()), errors.New("unexpected data after recipe")}
+	}
+
+	return root, nil
+}
@@ -0,0 +1,67 @@
+package recipe
+
+import "errors"
+
+type nodeKind int
+
+const (
+	scalarNode nodeKind = iota
+	sequenceNode
+	mappingNode
+)
+
+// A node is a value read from a recipe, either YAML or JSON, along with the
+// line it was found on.
+type node struct {
+	kind nodeKind
+	line int
+
+	// value is set for a scalarNode.
+	value string
+
+	// items is set for a sequenceNode.
+	items []*node
+
+	// keys, in the order they were given, values and the lines that each key
+	// is on are set for a mappingNode.
+	keys     []string
+	values   map[string]*node
+	keyLines map[string]int
+}
+
+func newMapping(line int) *node {
+	return &node{kind: mappingNode, line: line, values: map[string]*node{}, keyLines: map[string]int{}}
+}
+
+// set adds the key, found on line, to a mapping, returning an error if it is
+// already present.
+func (n *node) set(key string, line int, value *node) error {
+	if _, ok := n.values[key]; ok {
+		return errorf(line, "duplicate key %q", key)
+	}
+
+	n.keys = append(n.keys, key)
+	n.values[key] = value
+	n.keyLines[key] = line
+	return nil
+}
+
+// strings returns the value of a scalar, or the values of a list of scalars.
+func (n *node) strings() ([]string, error) {
+	switch n.kind {
+	case scalarNode:
+		return []string{n.value}, nil
+
+	case sequenceNode:
+		values := make([]string, len(n.items))
+		for i, item := range n.items {
+			if item.kind != scalarNode {
+				return nil, errors.New("must be a value or list of values")
+			}
+			values[i] = item.value
+		}
+		return values, nil
+	}
+
+	return nil, errors.New("must be a value or list of values")
+}
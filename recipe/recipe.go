@@ -0,0 +1,246 @@
+// Package recipe reads recipes, which list the commands to run on an image so
+// that a set of edits can be kept in a file and repeated. A recipe is written in
+// YAML or JSON, for example
+//
+//	vars:
+//	  amount: 0.4
+//
+//	steps:
+//	  - op: levels
+//	    red: true
+//	    curve: "0,0 50,60 100,100"
+//	  - op: vibrance
+//	    by: $amount
+//
+// Each step names the command to run with op, and gives its options by the
+// names of the command's flags. Arguments that are not flags, such as the image
+// for blend, are given as a list with args. Variables are declared with vars
+// and used in values as $name or ${name}; a literal $ is written as $$.
+package recipe
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+)
+
+// A Recipe is a list of steps, along with the variables they use.
+type Recipe struct {
+	// Vars are the default values of the variables.
+	Vars map[string]string
+
+	Steps []Step
+}
+
+// A Step is a command to run as part of a recipe.
+type Step struct {
+	// Op is the name of the command.
+	Op string
+
+	// Params are the options of the command, by name. A boolean option may
+	// have the value "true" or "false", an option given with no value has the
+	// value "".
+	Params map[string][]string
+
+	// Args are the arguments given after the options.
+	Args []string
+
+	// Line is the line of the file that the step starts on.
+	Line int
+
+	// Lines are the lines of the file that each key of the step, such as "op",
+	// "args" or the name of an option, is given on.
+	Lines map[string]int
+}
+
+// An Error is a problem with a recipe, found on the given line.
+type Error struct {
+	Line int
+	Err  error
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("line %d: %v", e.Line, e.Err)
+}
+
+func errorf(line int, format string, args ...interface{}) error {
+	return &Error{line, fmt.Errorf(format, args...)}
+}
+
+// Parse reads a recipe written in JSON, if it starts with '{' or '[', or
+// otherwise YAML. Only the simpler parts of YAML are understood: mappings,
+// lists and values on a single line. Anchors, tags and multi-line values can't
+// be used.
+func Parse(data []byte) (*Recipe, error) {
+	var root *node
+	var err error
+
+	if trimmed := bytes.TrimSpace(data); len(trimmed) > 0 && (trimmed[0] == '{' || trimmed[0] == '[') {
+		root, err = parseJSON(data)
+	} else {
+		root, err = parseYAML(data)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return build(root)
+}
+
+// build creates the Recipe described by root, which is either a mapping with
+// vars and steps, or a list of steps.
+func build(root *node) (*Recipe, error) {
+	r := &Recipe{Vars: map[string]string{}}
+
+	if root == nil {
+		return r, nil
+	}
+
+	steps := root
+	if root.kind == mappingNode {
+		steps = nil
+
+		for _, key := range root.keys {
+			value := root.values[key]
+
+			switch key {
+			case "vars":
+				if value.kind != mappingNode {
+					return nil, errorf(value.line, "vars must be a mapping")
+				}
+				for _, name := range value.keys {
+					v := value.values[name]
+					if v.kind != scalarNode {
+						return nil, errorf(v.line, "variable %s must be a single value", name)
+					}
+					r.Vars[name] = v.value
+				}
+
+			case "steps":
+				steps = value
+
+			default:
+				return nil, errorf(root.keyLines[key], "unknown key %q", key)
+			}
+		}
+
+		if steps == nil {
+			return nil, errorf(root.line, "no steps")
+		}
+	}
+
+	if steps.kind != sequenceNode {
+		return nil, errorf(steps.line, "steps must be a list")
+	}
+
+	for _, item := range steps.items {
+		step, err := buildStep(item)
+		if err != nil {
+			return nil, err
+		}
+		r.Steps = append(r.Steps, step)
+	}
+
+	return r, nil
+}
+
+func buildStep(n *node) (Step, error) {
+	step := Step{Params: map[string][]string{}, Line: n.line, Lines: map[string]int{}}
+
+	if n.kind != mappingNode {
+		return step, errorf(n.line, "step must be a mapping")
+	}
+
+	for _, key := range n.keys {
+		value := n.values[key]
+		step.Lines[key] = n.keyLines[key]
+
+		values, err := value.strings()
+		if err != nil {
+			return step, errorf(value.line, "%s: %v", key, err)
+		}
+
+		switch key {
+		case "op":
+			if len(values) != 1 || values[0] == "" {
+				return step, errorf(value.line, "op must name a command")
+			}
+			step.Op = values[0]
+
+		case "args":
+			step.Args = values
+
+		default:
+			step.Params[key] = values
+		}
+	}
+
+	if step.Op == "" {
+		return step, errorf(n.line, "step has no op")
+	}
+
+	return step, nil
+}
+
+// Expand returns the steps of the recipe with each variable replaced by its
+// value. The values in vars are used in place of those given in the recipe, it
+// is an error to give a value for a variable the recipe does not declare.
+func (r *Recipe) Expand(vars map[string]string) ([]Step, error) {
+	values := map[string]string{}
+	for name, value := range r.Vars {
+		values[name] = value
+	}
+
+	names := make([]string, 0, len(vars))
+	for name := range vars {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		if _, ok := r.Vars[name]; !ok {
+			return nil, fmt.Errorf("unknown variable %q", name)
+		}
+		values[name] = vars[name]
+	}
+
+	steps := make([]Step, len(r.Steps))
+	for i, step := range r.Steps {
+		var missing string
+		expand := func(s string) string {
+			return os.Expand(s, func(name string) string {
+				if name == "$" {
+					return "$"
+				}
+				value, ok := values[name]
+				if !ok && missing == "" {
+					missing = name
+				}
+				return value
+			})
+		}
+
+		steps[i] = Step{
+			Op:     step.Op,
+			Params: map[string][]string{},
+			Line:   step.Line,
+			Lines:  step.Lines,
+		}
+		for key, params := range step.Params {
+			for _, param := range params {
+				steps[i].Params[key] = append(steps[i].Params[key], expand(param))
+			}
+		}
+		for _, arg := range step.Args {
+			steps[i].Args = append(steps[i].Args, expand(arg))
+		}
+
+		if missing != "" {
+			return nil, &Error{step.Line, errors.New("undefined variable " + missing)}
+		}
+	}
+
+	return steps, nil
+}
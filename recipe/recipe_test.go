@@ -0,0 +1,190 @@
+package recipe
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParse(t *testing.T) {
+	blur := Step{
+		Op:     "blur",
+		Params: map[string][]string{"radius": {"3"}, "box": {""}},
+		Line:   4,
+		Lines:  map[string]int{"op": 4, "radius": 5, "box": 6},
+	}
+
+	testCases := []struct {
+		name string
+		data string
+		vars map[string]string
+		want []Step
+	}{
+		{
+			name: "block",
+			data: `# a comment
+vars:
+  amount: 0.4
+steps:
+  - op: vibrance
+    by: $amount
+  - op: blend
+    args:
+      - other.png
+    fade: [0.5]
+`,
+			want: []Step{
+				{Op: "vibrance", Params: map[string][]string{"by": {"0.4"}}, Line: 5, Lines: map[string]int{"op": 5, "by": 6}},
+				{Op: "blend", Params: map[string][]string{"fade": {"0.5"}}, Args: []string{"other.png"}, Line: 7, Lines: map[string]int{"op": 7, "args": 8, "fade": 10}},
+			},
+		},
+		{
+			name: "list at same indent as key",
+			data: `---
+steps:
+- op: blur
+  radius: 3 # comment after value
+  box:
+`,
+			want: []Step{
+				{Op: "blur", Params: map[string][]string{"radius": {"3"}, "box": {""}}, Line: 3, Lines: map[string]int{"op": 3, "radius": 4, "box": 5}},
+			},
+		},
+		{
+			name: "bare list",
+			data: "\n\n\n- op: blur\n  radius: 3\n  box: ~\n",
+			want: []Step{blur},
+		},
+		{
+			name: "flow",
+			data: "steps:\n  - {op: blur, radius: 3, box: null}\n  - {op: tint, with: '#ff0000', alpha: [1, \"2\"]}\n",
+			want: []Step{
+				{Op: "blur", Params: map[string][]string{"radius": {"3"}, "box": {""}}, Line: 2, Lines: map[string]int{"op": 2, "radius": 2, "box": 2}},
+				{Op: "tint", Params: map[string][]string{"with": {"#ff0000"}, "alpha": {"1", "2"}}, Line: 3, Lines: map[string]int{"op": 3, "with": 3, "alpha": 3}},
+			},
+		},
+		{
+			name: "quoting",
+			data: `steps:
+  - op: "levels"
+    'curve': "0,0 50,60 # not a comment"
+    with: 'it''s'
+    escaped: "a\tb"
+    "quoted key": x # comment
+    cost: $$5
+`,
+			want: []Step{
+				{Op: "levels", Params: map[string][]string{
+					"curve":      {"0,0 50,60 # not a comment"},
+					"with":       {"it's"},
+					"escaped":    {"a\tb"},
+					"quoted key": {"x"},
+					"cost":       {"$5"},
+				}, Line: 2, Lines: map[string]int{"op": 2, "curve": 3, "with": 4, "escaped": 5, "quoted key": 6, "cost": 7}},
+			},
+		},
+		{
+			name: "json",
+			data: `{
+  "vars": {"r": "3"},
+  "steps": [
+    {"op": "blur",
+     "radius": "$r",
+     "box": ""}
+  ]
+}`,
+			want: []Step{
+				{Op: "blur", Params: map[string][]string{"radius": {"3"}, "box": {""}}, Line: 4, Lines: map[string]int{"op": 4, "radius": 5, "box": 6}},
+			},
+		},
+		{
+			name: "json list",
+			data: `[{"op": "blur", "radius": 3}]`,
+			want: []Step{
+				{Op: "blur", Params: map[string][]string{"radius": {"3"}}, Line: 1, Lines: map[string]int{"op": 1, "radius": 1}},
+			},
+		},
+		{
+			name: "vars override",
+			data: "vars:\n  r: 1\nsteps:\n  - op: blur\n    radius: ${r}\n",
+			vars: map[string]string{"r": "3"},
+			want: []Step{
+				{Op: "blur", Params: map[string][]string{"radius": {"3"}}, Line: 4, Lines: map[string]int{"op": 4, "radius": 5}},
+			},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			r, err := Parse([]byte(tc.data))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			steps, err := r.Expand(tc.vars)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if !reflect.DeepEqual(steps, tc.want) {
+				t.Errorf("expected\n%+v\ngot\n%+v", tc.want, steps)
+			}
+		})
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	testCases := []struct {
+		name string
+		data string
+		line int
+	}{
+		{"tab indent", "steps:\n\t- op: blur\n", 2},
+		{"bad indent", "steps:\n  - op: blur\n      radius: 3\n", 3},
+		{"dedent", "steps:\n    - op: blur\n  - op: tint\n", 3},
+		{"not key value", "steps:\n  - op: blur\n    radius\n", 3},
+		{"duplicate key", "steps:\n  - op: blur\n    radius: 1\n    radius: 2\n", 4},
+		{"unknown key", "vars: {}\nstep:\n  - op: blur\n", 2},
+		{"no steps", "vars:\n  a: 1\n", 1},
+		{"no op", "steps:\n  - radius: 3\n", 2},
+		{"empty op", "steps:\n  - op:\n", 2},
+		{"step not mapping", "steps:\n  - blur\n", 2},
+		{"nested value", "steps:\n  - op: blur\n    radius:\n      a: b\n", 4},
+		{"unclosed flow", "steps:\n  - {op: blur, radius: 3\n", 2},
+		{"after flow", "steps:\n  - [a] b\n", 2},
+		{"unclosed quote", "steps:\n  - op: \"blur\n", 2},
+		{"after quote", "steps:\n  - op: 'blur' x\n", 2},
+		{"multi-line", "steps:\n  - op: blur\n    radius: |\n", 3},
+		{"anchor", "steps:\n  - op: &a blur\n", 2},
+		{"undefined variable", "steps:\n  - op: blur\n    radius: $r\n", 2},
+		{"json syntax", "{\n  \"steps\": [\n    {\"op\": \"blur\",,}\n  ]\n}", 3},
+		{"json truncated", "{\n  \"steps\": [\n", 3},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			r, err := Parse([]byte(tc.data))
+			if err == nil {
+				_, err = r.Expand(nil)
+			}
+
+			e, ok := err.(*Error)
+			if !ok {
+				t.Fatalf("expected *Error, got %v", err)
+			}
+			if e.Line != tc.line {
+				t.Errorf("expected error on line %d, got %v", tc.line, e)
+			}
+		})
+	}
+}
+
+func TestExpandUnknownVariable(t *testing.T) {
+	r, err := Parse([]byte("steps:\n  - op: blur\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := r.Expand(map[string]string{"r": "1"}); err == nil {
+		t.Error("expected error for unknown variable")
+	}
+}
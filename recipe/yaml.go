@@ -0,0 +1,431 @@
+package recipe
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+)
+
+// A yamlLine is a line of YAML without its indentation or comment.
+type yamlLine struct {
+	line   int
+	indent int
+	text   string
+}
+
+type yamlParser struct {
+	lines []yamlLine
+	pos   int
+}
+
+// parseYAML reads the YAML in data, keeping the line that each value is on.
+func parseYAML(data []byte) (*node, error) {
+	p := &yamlParser{}
+
+	for i, raw := range strings.Split(string(data), "\n") {
+		text := strings.TrimRight(stripComment(strings.TrimRight(raw, "\r")), " \t")
+		trimmed := strings.TrimLeft(text, " ")
+
+		if trimmed == "" || text == "---" {
+			continue
+		}
+		if text == "..." {
+			break
+		}
+		if trimmed[0] == '\t' {
+			return nil, errorf(i+1, "tabs can't be used for indentation")
+		}
+
+		p.lines = append(p.lines, yamlLine{
+			line:   i + 1,
+			indent: len(text) - len(trimmed),
+			text:   trimmed,
+		})
+	}
+
+	if len(p.lines) == 0 {
+		return nil, nil
+	}
+
+	root, err := p.block()
+	if err != nil {
+		return nil, err
+	}
+
+	if p.pos < len(p.lines) {
+		return nil, errorf(p.lines[p.pos].line, "unexpected indentation")
+	}
+
+	return root, nil
+}
+
+// stripComment removes a comment, started by a # that is not in a quoted value,
+// from the end of s.
+func stripComment(s string) string {
+	var quote byte
+
+	for i := 0; i < len(s); i++ {
+		switch c := s[i]; {
+		case quote != 0:
+			if c == '\\' && quote == '"' {
+				i++
+			} else if c == quote {
+				quote = 0
+			}
+		case c == '"' || c == '\'':
+			quote = c
+		case c == '#' && (i == 0 || s[i-1] == ' ' || s[i-1] == '\t'):
+			return s[:i]
+		}
+	}
+
+	return s
+}
+
+func isItem(text string) bool {
+	return text == "-" || strings.HasPrefix(text, "- ")
+}
+
+// splitKey splits a line of a mapping into its key and value.
+func splitKey(text string) (key, value string, ok bool) {
+	if text[0] == '{' || text[0] == '[' {
+		return "", "", false
+	}
+
+	if text[0] == '"' || text[0] == '\'' {
+		end := closingQuote(text)
+		if end < 0 || end+1 >= len(text) || text[end+1] != ':' {
+			return "", "", false
+		}
+		key, err := unquote(text[:end+1])
+		if err != nil {
+			return "", "", false
+		}
+		return key, strings.TrimSpace(text[end+2:]), true
+	}
+
+	for i := 0; i < len(text); i++ {
+		if text[i] == ':' && (i+1 == len(text) || text[i+1] == ' ') {
+			return strings.TrimSpace(text[:i]), strings.TrimSpace(text[i+1:]), true
+		}
+	}
+
+	return "", "", false
+}
+
+// block reads the mapping, list or value starting at the current line.
+func (p *yamlParser) block() (*node, error) {
+	l := p.lines[p.pos]
+
+	if isItem(l.text) {
+		return p.sequence(l.indent)
+	}
+	if _, _, ok := splitKey(l.text); ok {
+		return p.mapping(l.indent)
+	}
+
+	p.pos++
+	return inline(l.text, l.line)
+}
+
+// child reads the value of a key or list item that was given on the following
+// lines, if any. A list can be given at the same indentation as the key it is
+// the value of.
+func (p *yamlParser) child(indent, line int, inMapping bool) (*node, error) {
+	if p.pos < len(p.lines) {
+		next := p.lines[p.pos]
+
+		if next.indent > indent || (inMapping && next.indent == indent && isItem(next.text)) {
+			return p.block()
+		}
+	}
+
+	return &node{kind: scalarNode, line: line}, nil
+}
+
+func (p *yamlParser) sequence(indent int) (*node, error) {
+	n := &node{kind: sequenceNode, line: p.lines[p.pos].line}
+
+	for p.pos < len(p.lines) {
+		l := p.lines[p.pos]
+		if l.indent != indent || !isItem(l.text) {
+			break
+		}
+
+		rest := strings.TrimLeft(l.text[1:], " ")
+
+		var item *node
+		var err error
+		if rest == "" {
+			p.pos++
+			item, err = p.child(indent, l.line, false)
+		} else {
+			// The item starts on the same line as the "-", so read it as though
+			// the "-" were part of the indentation.
+			p.lines[p.pos] = yamlLine{
+				line:   l.line,
+				indent: indent + len(l.text) - len(rest),
+				text:   rest,
+			}
+			item, err = p.block()
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		n.items = append(n.items, item)
+	}
+
+	return n, nil
+}
+
+func (p *yamlParser) mapping(indent int) (*node, error) {
+	n := newMapping(p.lines[p.pos].line)
+
+	for p.pos < len(p.lines) {
+		l := p.lines[p.pos]
+		if l.indent != indent || isItem(l.text) {
+			break
+		}
+
+		key, rest, ok := splitKey(l.text)
+		if !ok {
+			return nil, errorf(l.line, "expected key: value")
+		}
+		p.pos++
+
+		var value *node
+		var err error
+		if rest == "" {
+			value, err = p.child(indent, l.line, true)
+		} else {
+			value, err = inline(rest, l.line)
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		if err := n.set(key, l.line, value); err != nil {
+			return nil, err
+		}
+	}
+
+	return n, nil
+}
+
+// inline reads a value given on a single line, which may be a list or mapping
+// in the flow style, such as [a, b] or {a: b}.
+func inline(s string, line int) (*node, error) {
+	if s[0] == '{' || s[0] == '[' {
+		f := &flow{s: s, line: line}
+
+		n, err := f.value(false)
+		if err != nil {
+			return nil, err
+		}
+
+		f.skipSpace()
+		if f.i < len(f.s) {
+			return nil, errorf(line, "unexpected %q after value", f.s[f.i:])
+		}
+		return n, nil
+	}
+
+	value, err := scalar(s)
+	if err != nil {
+		return nil, &Error{line, err}
+	}
+
+	return &node{kind: scalarNode, line: line, value: value}, nil
+}
+
+// scalar returns the value written as s.
+func scalar(s string) (string, error) {
+	if s == "" {
+		return "", nil
+	}
+
+	switch s[0] {
+	case '"', '\'':
+		if closingQuote(s) != len(s)-1 {
+			return "", errors.New("unexpected characters after quoted value")
+		}
+		return unquote(s)
+	case '|', '>':
+		return "", errors.New("values over multiple lines are not supported")
+	case '&', '*', '!':
+		return "", errors.New("anchors, aliases and tags are not supported")
+	}
+
+	if s == "~" || s == "null" {
+		return "", nil
+	}
+
+	return s, nil
+}
+
+// closingQuote returns the index of the quote that ends the quoted value at the
+// start of s, or -1 if it is not closed.
+func closingQuote(s string) int {
+	quote := s[0]
+
+	for i := 1; i < len(s); i++ {
+		switch {
+		case quote == '"' && s[i] == '\\':
+			i++
+		case s[i] == quote:
+			// In single quotes a quote is escaped by repeating it.
+			if quote == '\'' && i+1 < len(s) && s[i+1] == '\'' {
+				i++
+				continue
+			}
+			return i
+		}
+	}
+
+	return -1
+}
+
+func unquote(s string) (string, error) {
+	if s[0] == '\'' {
+		return strings.Replace(s[1:len(s)-1], "''", "'", -1), nil
+	}
+
+	value, err := strconv.Unquote(s)
+	if err != nil {
+		return "", errors.New("invalid quoted value " + s)
+	}
+	return value, nil
+}
+
+// A flow reads a value written in the flow style.
+type flow struct {
+	s    string
+	i    int
+	line int
+}
+
+func (f *flow) skipSpace() {
+	for f.i < len(f.s) && f.s[f.i] == ' ' {
+		f.i++
+	}
+}
+
+func (f *flow) expect(c byte) error {
+	f.skipSpace()
+	if f.i >= len(f.s) {
+		return errorf(f.line, "expected %q before end of line", c)
+	}
+	if f.s[f.i] != c {
+		return errorf(f.line, "expected %q but found %q", c, f.s[f.i])
+	}
+	f.i++
+	return nil
+}
+
+// value reads the value at the current position, if key is true it is the key
+// of a mapping so ends at a ':'.
+func (f *flow) value(key bool) (*node, error) {
+	f.skipSpace()
+	if f.i >= len(f.s) {
+		return nil, errorf(f.line, "expected value before end of line")
+	}
+
+	switch f.s[f.i] {
+	case '{':
+		f.i++
+		n := newMapping(f.line)
+
+		for {
+			f.skipSpace()
+			if f.i < len(f.s) && f.s[f.i] == '}' {
+				f.i++
+				return n, nil
+			}
+
+			k, err := f.value(true)
+			if err != nil {
+				return nil, err
+			}
+			if k.kind != scalarNode {
+				return nil, errorf(f.line, "key must be a single value")
+			}
+			if err := f.expect(':'); err != nil {
+				return nil, err
+			}
+
+			v, err := f.value(false)
+			if err != nil {
+				return nil, err
+			}
+			if err := n.set(k.value, k.line, v); err != nil {
+				return nil, err
+			}
+
+			if err := f.next('}'); err != nil {
+				return nil, err
+			}
+		}
+
+	case '[':
+		f.i++
+		n := &node{kind: sequenceNode, line: f.line}
+
+		for {
+			f.skipSpace()
+			if f.i < len(f.s) && f.s[f.i] == ']' {
+				f.i++
+				return n, nil
+			}
+
+			v, err := f.value(false)
+			if err != nil {
+				return nil, err
+			}
+			n.items = append(n.items, v)
+
+			if err := f.next(']'); err != nil {
+				return nil, err
+			}
+		}
+
+	case '"', '\'':
+		end := closingQuote(f.s[f.i:])
+		if end < 0 {
+			return nil, errorf(f.line, "unterminated quote")
+		}
+
+		value, err := unquote(f.s[f.i : f.i+end+1])
+		if err != nil {
+			return nil, &Error{f.line, err}
+		}
+		f.i += end + 1
+
+		return &node{kind: scalarNode, line: f.line, value: value}, nil
+	}
+
+	start := f.i
+	for f.i < len(f.s) && !strings.ContainsRune(",]}", rune(f.s[f.i])) {
+		if key && f.s[f.i] == ':' {
+			break
+		}
+		f.i++
+	}
+
+	value, err := scalar(strings.TrimSpace(f.s[start:f.i]))
+	if err != nil {
+		return nil, &Error{f.line, err}
+	}
+
+	return &node{kind: scalarNode, line: f.line, value: value}, nil
+}
+
+// next moves past the ',' between values, leaving the closing bracket end to be
+// read by the caller.
+func (f *flow) next(end byte) error {
+	f.skipSpace()
+	if f.i < len(f.s) && f.s[f.i] == end {
+		return nil
+	}
+	return f.expect(',')
+}
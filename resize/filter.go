@@ -0,0 +1,77 @@
+package resize
+
+import "math"
+
+// A Filter decides how much each pixel of the original image contributes to a
+// pixel of the result, depending on the distance between their centres.
+type Filter struct {
+	// Support is the distance, in pixels, beyond which Kernel is zero. A
+	// Support of zero means that only the nearest pixel is used.
+	Support float64
+
+	// Kernel returns the weight of a pixel at distance x.
+	Kernel func(x float64) float64
+}
+
+var (
+	// Nearest uses the value of the nearest pixel, so is fast and keeps hard
+	// edges, but looks blocky when enlarging and jagged when reducing.
+	Nearest = Filter{0, nil}
+
+	// Bilinear interpolates linearly between the closest pixels.
+	Bilinear = Filter{1, triangle}
+
+	// Bicubic uses the Catmull-Rom spline, which is sharper than Bilinear.
+	Bicubic = Filter{2, cubic(0, 0.5)}
+
+	// Mitchell uses the cubic filter recommended by Mitchell and Netravali,
+	// which balances sharpness against ringing around edges.
+	Mitchell = Filter{2, cubic(1.0/3, 1.0/3)}
+
+	// Lanczos2 and Lanczos3 use a windowed sinc function, over 2 and 3 pixels.
+	// They are the sharpest filters, but may cause ringing around edges.
+	Lanczos2 = Filter{2, lanczos(2)}
+	Lanczos3 = Filter{3, lanczos(3)}
+)
+
+func triangle(x float64) float64 {
+	x = math.Abs(x)
+	if x < 1 {
+		return 1 - x
+	}
+	return 0
+}
+
+// cubic returns the family of cubic filters described by Mitchell and Netravali
+// in "Reconstruction Filters in Computer Graphics", with parameters b and c.
+func cubic(b, c float64) func(float64) float64 {
+	return func(x float64) float64 {
+		x = math.Abs(x)
+
+		switch {
+		case x < 1:
+			return ((12-9*b-6*c)*x*x*x + (-18+12*b+6*c)*x*x + (6 - 2*b)) / 6
+		case x < 2:
+			return ((-b-6*c)*x*x*x + (6*b+30*c)*x*x + (-12*b-48*c)*x + (8*b + 24*c)) / 6
+		}
+		return 0
+	}
+}
+
+func sinc(x float64) float64 {
+	if x == 0 {
+		return 1
+	}
+	x *= math.Pi
+	return math.Sin(x) / x
+}
+
+// lanczos returns the sinc function windowed over a pixels.
+func lanczos(a float64) func(float64) float64 {
+	return func(x float64) float64 {
+		if math.Abs(x) < a {
+			return sinc(x) * sinc(x/a)
+		}
+		return 0
+	}
+}
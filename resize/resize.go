@@ -0,0 +1,248 @@
+// Package resize provides functions for changing the size of an image.
+package resize
+
+import (
+	"image"
+	"image/color"
+	"image/draw"
+	"math"
+
+	"hawx.me/code/img/utils"
+)
+
+// Resize returns the image scaled to width by height pixels using the filter
+// given. If either width or height is 0 it is chosen to keep the aspect ratio of
+// the image. If img is a *utils.Linear image the result is also, so that it is
+// resized in linear light.
+func Resize(img image.Image, width, height int, filter Filter) image.Image {
+	b := img.Bounds()
+	if b.Empty() {
+		return img
+	}
+
+	width, height = size(b, width, height)
+
+	// The image is resized in two passes, first horizontally then vertically,
+	// which needs far fewer calculations than doing both at once.
+	src := read(img)
+	cols := contributions(b.Dx(), width, filter)
+	rows := contributions(b.Dy(), height, filter)
+
+	wide := make([]float64, 4*width*b.Dy())
+	utils.Parallel(b.Dy(), func(y int) {
+		for x, c := range cols {
+			out := wide[4*(y*width+x) : 4*(y*width+x)+4]
+
+			for i, weight := range c.weights {
+				p := 4 * (y*b.Dx() + clamp(c.start+i, b.Dx()))
+				for j := range out {
+					out[j] += src[p+j] * weight
+				}
+			}
+		}
+	})
+
+	dst := make([]float64, 4*width*height)
+	utils.Parallel(height, func(y int) {
+		c := rows[y]
+
+		for x := 0; x < width; x++ {
+			out := dst[4*(y*width+x) : 4*(y*width+x)+4]
+
+			for i, weight := range c.weights {
+				p := 4 * (clamp(c.start+i, b.Dy())*width + x)
+				for j := range out {
+					out[j] += wide[p+j] * weight
+				}
+			}
+		}
+	})
+
+	return write(img, dst, width, height)
+}
+
+// Fit scales the image, keeping its aspect ratio, so that it is as large as
+// possible while fitting within width by height pixels.
+func Fit(img image.Image, width, height int, filter Filter) image.Image {
+	b := img.Bounds()
+
+	if float64(width)/float64(b.Dx()) < float64(height)/float64(b.Dy()) {
+		return Resize(img, width, 0, filter)
+	}
+	return Resize(img, 0, height, filter)
+}
+
+// Fill scales the image, keeping its aspect ratio, so that it covers width by
+// height pixels, then crops it to that size. The part of the image kept is
+// chosen by direction, so Top keeps the top of a tall image.
+func Fill(img image.Image, width, height int, direction utils.Direction, filter Filter) image.Image {
+	b := img.Bounds()
+
+	var scaled image.Image
+	if float64(width)/float64(b.Dx()) > float64(height)/float64(b.Dy()) {
+		scaled = Resize(img, width, 0, filter)
+	} else {
+		scaled = Resize(img, 0, height, filter)
+	}
+
+	return crop(scaled, utils.Anchor(scaled.Bounds(), width, height, direction))
+}
+
+// size returns the width and height to resize an image with bounds b to,
+// replacing a 0 so that the aspect ratio is kept.
+func size(b image.Rectangle, width, height int) (int, int) {
+	switch {
+	case width <= 0 && height <= 0:
+		return b.Dx(), b.Dy()
+	case width <= 0:
+		width = int(math.Max(1, math.Round(float64(height*b.Dx())/float64(b.Dy()))))
+	case height <= 0:
+		height = int(math.Max(1, math.Round(float64(width*b.Dy())/float64(b.Dx()))))
+	}
+
+	return width, height
+}
+
+// A contribution lists the weights of the pixels, from start, used for a pixel
+// of the result.
+type contribution struct {
+	start   int
+	weights []float64
+}
+
+// contributions returns the contribution for each of the out pixels of a row,
+// or column, resized from in pixels.
+func contributions(in, out int, filter Filter) []contribution {
+	scale := float64(in) / float64(out)
+
+	// When reducing, the filter is stretched so that every pixel of the
+	// original contributes to the result.
+	stretch := math.Max(1, scale)
+	support := filter.Support * stretch
+
+	cs := make([]contribution, out)
+	for i := range cs {
+		centre := (float64(i)+0.5)*scale - 0.5
+
+		if filter.Support == 0 {
+			cs[i] = contribution{int(math.Floor(centre + 0.5)), []float64{1}}
+			continue
+		}
+
+		start := int(math.Ceil(centre - support))
+		end := int(math.Floor(centre + support))
+
+		weights := make([]float64, 0, end-start+1)
+		total := 0.0
+		for j := start; j <= end; j++ {
+			w := filter.Kernel((float64(j) - centre) / stretch)
+			weights = append(weights, w)
+			total += w
+		}
+
+		if total != 0 {
+			for j := range weights {
+				weights[j] /= total
+			}
+		}
+
+		cs[i] = contribution{start, weights}
+	}
+
+	return cs
+}
+
+// clamp returns i if it is within [0, n), otherwise the closest value that is,
+// so that the pixels at the edge are repeated.
+func clamp(i, n int) int {
+	if i < 0 {
+		return 0
+	}
+	if i >= n {
+		return n - 1
+	}
+	return i
+}
+
+// read returns the premultiplied red, green, blue and alpha values of each pixel
+// of the image, from 0 to 1, row by row.
+func read(img image.Image) []float64 {
+	b := img.Bounds()
+	pix := make([]float64, 4*b.Dx()*b.Dy())
+
+	if l, ok := img.(*utils.Linear); ok {
+		utils.Parallel(b.Dy(), func(y int) {
+			row := l.Pix[l.PixOffset(b.Min.X, b.Min.Y+y):]
+			for i := 0; i < 4*b.Dx(); i++ {
+				pix[4*y*b.Dx()+i] = float64(row[i])
+			}
+		})
+		return pix
+	}
+
+	utils.Parallel(b.Dy(), func(y int) {
+		for x := 0; x < b.Dx(); x++ {
+			r, g, bl, a := img.At(b.Min.X+x, b.Min.Y+y).RGBA()
+			p := pix[4*(y*b.Dx()+x) : 4*(y*b.Dx()+x)+4]
+			p[0], p[1], p[2], p[3] = float64(r)/0xffff, float64(g)/0xffff, float64(bl)/0xffff, float64(a)/0xffff
+		}
+	})
+	return pix
+}
+
+// write returns an image, of the same kind as like, with the pixels given. The
+// filters can give values outside of the valid range, so these are clamped.
+func write(like image.Image, pix []float64, width, height int) image.Image {
+	rect := image.Rect(0, 0, width, height)
+
+	valid := func(p []float64) (r, g, b, a float64) {
+		a = math.Max(0, math.Min(1, p[3]))
+		r = math.Max(0, math.Min(a, p[0]))
+		g = math.Max(0, math.Min(a, p[1]))
+		b = math.Max(0, math.Min(a, p[2]))
+		return
+	}
+
+	if _, ok := like.(*utils.Linear); ok {
+		out := utils.NewLinear(rect)
+		utils.Parallel(height, func(y int) {
+			for x := 0; x < width; x++ {
+				r, g, b, a := valid(pix[4*(y*width+x):])
+				out.SetLinear(x, y, utils.LinearColor{R: float32(r), G: float32(g), B: float32(b), A: float32(a)})
+			}
+		})
+		return out
+	}
+
+	out := utils.NewImageFor(like, rect)
+	utils.Parallel(height, func(y int) {
+		for x := 0; x < width; x++ {
+			r, g, b, a := valid(pix[4*(y*width+x):])
+			out.Set(x, y, color.RGBA64{
+				uint16(r*0xffff + 0.5),
+				uint16(g*0xffff + 0.5),
+				uint16(b*0xffff + 0.5),
+				uint16(a*0xffff + 0.5),
+			})
+		}
+	})
+	return out
+}
+
+// crop returns a copy of the part of img within r, moved to the origin.
+func crop(img image.Image, r image.Rectangle) image.Image {
+	bounds := r.Sub(r.Min)
+
+	if l, ok := img.(*utils.Linear); ok {
+		out := utils.NewLinear(bounds)
+		for y := 0; y < bounds.Dy(); y++ {
+			from := l.PixOffset(r.Min.X, r.Min.Y+y)
+			copy(out.Pix[out.PixOffset(0, y):out.PixOffset(0, y+1)], l.Pix[from:])
+		}
+		return out
+	}
+
+	out := utils.NewImageFor(img, bounds)
+	draw.Draw(out, bounds, img, r.Min, draw.Src)
+	return out
+}
@@ -0,0 +1,165 @@
+package resize
+
+import (
+	"image"
+	"image/color"
+	"math"
+	"testing"
+
+	"hawx.me/code/img/utils"
+)
+
+var filters = map[string]Filter{
+	"nearest":  Nearest,
+	"bilinear": Bilinear,
+	"bicubic":  Bicubic,
+	"mitchell": Mitchell,
+	"lanczos2": Lanczos2,
+	"lanczos3": Lanczos3,
+}
+
+func testImage() *image.RGBA {
+	img := image.NewRGBA(image.Rect(0, 0, 30, 20))
+	for y := 0; y < 20; y++ {
+		for x := 0; x < 30; x++ {
+			a := uint8(255 - x*4)
+			img.SetRGBA(x, y, color.RGBA{uint8(x*8) & a, uint8(y*12) & a, uint8(x*y) & a, a})
+		}
+	}
+	return img
+}
+
+func TestContributionsNormalised(t *testing.T) {
+	for name, filter := range filters {
+		for _, size := range [][2]int{{30, 30}, {30, 7}, {7, 30}, {5, 1}, {1, 5}} {
+			for i, c := range contributions(size[0], size[1], filter) {
+				total := 0.0
+				for _, w := range c.weights {
+					total += w
+				}
+				if math.Abs(total-1) > 1e-9 {
+					t.Errorf("%s %d->%d: weights for %d sum to %v", name, size[0], size[1], i, total)
+				}
+			}
+		}
+	}
+}
+
+func TestResizeIdentity(t *testing.T) {
+	img := testImage()
+
+	// Mitchell is not an interpolating filter, so blurs slightly even when the
+	// size is unchanged.
+	for _, name := range []string{"nearest", "bilinear", "bicubic", "lanczos2", "lanczos3"} {
+		out := Resize(img, 30, 20, filters[name])
+
+		for y := 0; y < 20; y++ {
+			for x := 0; x < 30; x++ {
+				if got, want := color.RGBAModel.Convert(out.At(x, y)), img.At(x, y); got != want {
+					t.Fatalf("%s: at (%d,%d) expected %v, got %v", name, x, y, want, got)
+				}
+			}
+		}
+	}
+}
+
+func TestResizeSize(t *testing.T) {
+	img := testImage()
+
+	for _, tc := range []struct {
+		width, height int
+		want          image.Point
+	}{
+		{15, 10, image.Pt(15, 10)},
+		{45, 0, image.Pt(45, 30)},
+		{0, 5, image.Pt(8, 5)},
+		{0, 0, image.Pt(30, 20)},
+		{1, 0, image.Pt(1, 1)},
+		{100, 3, image.Pt(100, 3)},
+	} {
+		for name, filter := range filters {
+			if got := Resize(img, tc.width, tc.height, filter).Bounds(); got != (image.Rectangle{Max: tc.want}) {
+				t.Errorf("%s Resize(%d, %d): expected %v, got %v", name, tc.width, tc.height, tc.want, got)
+			}
+		}
+	}
+}
+
+func TestFitFill(t *testing.T) {
+	img := testImage()
+
+	for _, tc := range []struct {
+		width, height int
+		fit, fill     image.Point
+	}{
+		{15, 15, image.Pt(15, 10), image.Pt(15, 15)},
+		{60, 10, image.Pt(15, 10), image.Pt(60, 10)},
+		{10, 60, image.Pt(10, 7), image.Pt(10, 60)},
+		{300, 200, image.Pt(300, 200), image.Pt(300, 200)},
+	} {
+		if got := Fit(img, tc.width, tc.height, Bilinear).Bounds(); got != (image.Rectangle{Max: tc.fit}) {
+			t.Errorf("Fit(%d, %d): expected %v, got %v", tc.width, tc.height, tc.fit, got)
+		}
+		if got := Fill(img, tc.width, tc.height, utils.Centre, Bilinear).Bounds(); got != (image.Rectangle{Max: tc.fill}) {
+			t.Errorf("Fill(%d, %d): expected %v, got %v", tc.width, tc.height, tc.fill, got)
+		}
+	}
+}
+
+func TestFillDirection(t *testing.T) {
+	// A tall image, white at the top and black at the bottom.
+	img := image.NewGray(image.Rect(0, 0, 10, 40))
+	for y := 0; y < 20; y++ {
+		for x := 0; x < 10; x++ {
+			img.SetGray(x, y, color.Gray{255})
+		}
+	}
+
+	top := Fill(img, 10, 10, utils.Top, Nearest)
+	bottom := Fill(img, 10, 10, utils.Bottom, Nearest)
+
+	if r, _, _, _ := top.At(5, 5).RGBA(); r != 0xffff {
+		t.Errorf("expected top to be kept, got %v", top.At(5, 5))
+	}
+	if r, _, _, _ := bottom.At(5, 5).RGBA(); r != 0 {
+		t.Errorf("expected bottom to be kept, got %v", bottom.At(5, 5))
+	}
+}
+
+func TestResizeKeepsType(t *testing.T) {
+	linear := utils.ToLinear(testImage())
+	if _, ok := Resize(linear, 10, 10, Lanczos3).(*utils.Linear); !ok {
+		t.Error("expected Resize of Linear to give Linear")
+	}
+	if _, ok := Fill(linear, 10, 10, utils.Centre, Lanczos3).(*utils.Linear); !ok {
+		t.Error("expected Fill of Linear to give Linear")
+	}
+	if _, ok := Fit(linear, 10, 10, Lanczos3).(*utils.Linear); !ok {
+		t.Error("expected Fit of Linear to give Linear")
+	}
+
+	deep := image.NewRGBA64(image.Rect(0, 0, 10, 10))
+	if !utils.Deep(Resize(deep, 5, 5, Bilinear)) {
+		t.Error("expected Resize of 16-bit image to keep 16 bits")
+	}
+}
+
+func TestResizeFlat(t *testing.T) {
+	// Filters with negative lobes must not ring, or go outside the valid
+	// range, on a flat image.
+	img := image.NewRGBA(image.Rect(0, 0, 13, 9))
+	for i := range img.Pix {
+		img.Pix[i] = 200
+	}
+
+	for name, filter := range filters {
+		out := Resize(img, 31, 4, filter)
+		for y := 0; y < 4; y++ {
+			for x := 0; x < 31; x++ {
+				if c := color.RGBAModel.Convert(out.At(x, y)).(color.RGBA); c != (color.RGBA{200, 200, 200, 200}) {
+					t.Fatalf("%s: at (%d,%d) expected flat colour, got %v", name, x, y, c)
+				}
+			}
+		}
+	}
+}
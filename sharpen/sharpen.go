@@ -6,14 +6,13 @@ import (
 	"hawx.me/code/img/utils"
 
 	"image"
-	"image/color"
 	"math"
 )
 
 // Sharpen takes an image and sharpens it by, essentially, unblurring it. It is
 // currently extremely slow, so you are probably better off sticking to
-// UnsharpMask.
-func Sharpen(in image.Image, radius int, sigma float64) image.Image {
+// UnsharpMask. An error is returned if radius is negative.
+func Sharpen(in image.Image, radius int, sigma float64) (image.Image, error) {
 	// Copied from ImageMagick, obvs.
 	//
 	// Sharpens the image. Convolve the image with a Gaussian operator of the
@@ -36,28 +35,41 @@ func Sharpen(in image.Image, radius int, sigma float64) image.Image {
 		return val
 	}
 
-	k := blur.NewKernel(radius*2+1, radius*2+1, f)
+	k, err := blur.NewKernel(radius*2+1, radius*2+1, f)
+	if err != nil {
+		return nil, err
+	}
 	k[radius+1][radius+1] = -2.0 * normalize
 
-	return blur.Convolve(in, k, blur.CLAMP)
+	return blur.Convolve(in, k, blur.CLAMP), nil
+}
+
+// Absolute difference between a and b, returns float64 between 0 and 1.
+func diff(a, b float64) float64 {
+	if a > b {
+		return a - b
+	}
+	return b - a
 }
 
 // UnsharpMask sharpens the given Image using the unsharp mask technique.
 // Basically the image is blurred, then subtracted from the original for
-// differences above the threshold value.
-func UnsharpMask(in image.Image, radius int, sigma, amount, threshold float64) image.Image {
-	blurred := blur.Gaussian(in, radius, sigma, blur.IGNORE)
-	bounds := in.Bounds()
-	out := image.NewRGBA(bounds)
+// differences above the threshold value. If in is a *utils.Linear image this
+// is done in linear light, and a *utils.Linear image is returned. An error is
+// returned if radius is negative.
+func UnsharpMask(in image.Image, radius int, sigma, amount, threshold float64) (image.Image, error) {
+	blurred, err := blur.Gaussian(in, radius, sigma, blur.IGNORE)
+	if err != nil {
+		return nil, err
+	}
 
-	// Absolute difference between a and b, returns float64 between 0 and 1.
-	diff := func(a, b float64) float64 {
-		if a > b {
-			return a - b
-		}
-		return b - a
+	if l, ok := in.(*utils.Linear); ok {
+		return unsharpMaskLinear(l, blurred.(*utils.Linear), amount, threshold), nil
 	}
 
+	bounds := in.Bounds()
+	out := utils.NewImageFor(in, bounds)
+
 	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
 		for x := bounds.Min.X; x < bounds.Max.X; x++ {
 			ar, ag, ab, aa := utils.RatioRGBA(in.At(x, y))
@@ -75,11 +87,45 @@ func UnsharpMask(in image.Image, radius int, sigma, amount, threshold float64) i
 				ab = amount*(ab-bb) + ab
 			}
 
-			out.Set(x, y, color.NRGBA{
-				uint8(utils.Truncatef(ar * 255)),
-				uint8(utils.Truncatef(ag * 255)),
-				uint8(utils.Truncatef(ab * 255)),
-				uint8(aa * 255),
+			out.Set(x, y, utils.RatioNRGBA(ar, ag, ab, aa))
+		}
+	}
+
+	return out, nil
+}
+
+func unsharpMaskLinear(in, blurred *utils.Linear, amount, threshold float64) *utils.Linear {
+	bounds := in.Bounds()
+	out := utils.NewLinear(bounds)
+
+	// The mask is found using non-premultiplied values, as the blur may have
+	// changed the alpha.
+	sharpen := func(a, b, aa, ba float32) float32 {
+		if aa == 0 {
+			return 0
+		}
+		av := float64(a / aa)
+		bv := 0.0
+		if ba != 0 {
+			bv = float64(b / ba)
+		}
+
+		if diff(av, bv) >= threshold {
+			av = amount*(av-bv) + av
+		}
+		return float32(math.Max(0, math.Min(1, av))) * aa
+	}
+
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			a := in.LinearAt(x, y)
+			b := blurred.LinearAt(x, y)
+
+			out.SetLinear(x, y, utils.LinearColor{
+				R: sharpen(a.R, b.R, a.A, b.A),
+				G: sharpen(a.G, b.G, a.A, b.A),
+				B: sharpen(a.B, b.B, a.A, b.A),
+				A: a.A,
 			})
 		}
 	}
@@ -0,0 +1,80 @@
+package tiff
+
+import "io"
+
+const (
+	lzwClear   = 256
+	lzwEOI     = 257
+	lzwMaxCode = 4093
+	lzwMaxBits = 12
+)
+
+// lzwWriter writes codes most-significant bit first, as TIFF requires.
+type lzwWriter struct {
+	buf   []byte
+	acc   uint32
+	nbits uint
+
+	width uint
+	hi    int
+	table map[uint32]int
+}
+
+// emit writes a code, then updates the code width in the same way that a
+// decoder will. TIFF's LZW increases the width one code earlier than GIF's.
+func (l *lzwWriter) emit(code int) {
+	l.acc = l.acc<<l.width | uint32(code)
+	l.nbits += l.width
+	for l.nbits >= 8 {
+		l.buf = append(l.buf, byte(l.acc>>(l.nbits-8)))
+		l.nbits -= 8
+	}
+
+	if code == lzwClear {
+		l.width = 9
+		l.hi = lzwEOI
+		l.table = map[uint32]int{}
+		return
+	}
+
+	l.hi++
+	if l.hi+1 >= 1<<l.width && l.width < lzwMaxBits {
+		l.width++
+	}
+}
+
+// compressLZW writes data to w compressed using TIFF's variant of LZW.
+func compressLZW(w io.Writer, data []byte) error {
+	l := &lzwWriter{width: 9}
+	l.emit(lzwClear)
+
+	if len(data) > 0 {
+		prefix := int(data[0])
+
+		for _, c := range data[1:] {
+			key := uint32(prefix)<<8 | uint32(c)
+			if code, ok := l.table[key]; ok {
+				prefix = code
+				continue
+			}
+
+			l.emit(prefix)
+			if l.hi >= lzwMaxCode {
+				l.emit(lzwClear)
+			} else {
+				l.table[key] = l.hi
+			}
+			prefix = int(c)
+		}
+
+		l.emit(prefix)
+	}
+
+	l.emit(lzwEOI)
+	if l.nbits > 0 {
+		l.buf = append(l.buf, byte(l.acc<<(8-l.nbits)))
+	}
+
+	_, err := w.Write(l.buf)
+	return err
+}
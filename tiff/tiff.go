@@ -0,0 +1,277 @@
+// Package tiff implements a TIFF encoder, which unlike golang.org/x/image/tiff
+// can use LZW compression. Decoding is provided by golang.org/x/image/tiff.
+package tiff
+
+import (
+	"bytes"
+	"compress/zlib"
+	"encoding/binary"
+	"errors"
+	"image"
+	"image/color"
+	"io"
+)
+
+// Compression is the type of compression used for the pixel data.
+type Compression int
+
+const (
+	Uncompressed Compression = iota
+	Deflate
+	LZW
+)
+
+// Options are the encoding parameters.
+type Options struct {
+	Compression Compression
+}
+
+// Values from the TIFF specification.
+const (
+	tImageWidth                = 256
+	tImageLength               = 257
+	tBitsPerSample             = 258
+	tCompression               = 259
+	tPhotometricInterpretation = 262
+	tStripOffsets              = 273
+	tSamplesPerPixel           = 277
+	tRowsPerStrip              = 278
+	tStripByteCounts           = 279
+	tXResolution               = 282
+	tYResolution               = 283
+	tPlanarConfiguration       = 284
+	tResolutionUnit            = 296
+	tPredictor                 = 317
+	tExtraSamples              = 338
+
+	dtShort    = 3
+	dtLong     = 4
+	dtRational = 5
+
+	cNone    = 1
+	cLZW     = 5
+	cDeflate = 8
+
+	pBlackIsZero = 1
+	pRGB         = 2
+
+	prHorizontal = 2
+
+	// Unassociated alpha, that is not premultiplied.
+	esUnassociatedAlpha = 2
+)
+
+var enc = binary.LittleEndian
+
+// pixels returns the samples of m, one row after another, along with the
+// number of samples per pixel and the bits in each sample.
+func pixels(m image.Image) (data []byte, samples, bits int) {
+	b := m.Bounds()
+
+	switch m := m.(type) {
+	case *image.Gray:
+		data = make([]byte, 0, b.Dx()*b.Dy())
+		for y := b.Min.Y; y < b.Max.Y; y++ {
+			i := m.PixOffset(b.Min.X, y)
+			data = append(data, m.Pix[i:i+b.Dx()]...)
+		}
+		return data, 1, 8
+
+	case *image.Gray16:
+		data = make([]byte, 0, b.Dx()*b.Dy()*2)
+		for y := b.Min.Y; y < b.Max.Y; y++ {
+			for x := b.Min.X; x < b.Max.X; x++ {
+				data = enc.AppendUint16(data, m.Gray16At(x, y).Y)
+			}
+		}
+		return data, 1, 16
+
+	case *image.RGBA64, *image.NRGBA64:
+		data = make([]byte, 0, b.Dx()*b.Dy()*8)
+		for y := b.Min.Y; y < b.Max.Y; y++ {
+			for x := b.Min.X; x < b.Max.X; x++ {
+				c := color.NRGBA64Model.Convert(m.At(x, y)).(color.NRGBA64)
+				data = enc.AppendUint16(data, c.R)
+				data = enc.AppendUint16(data, c.G)
+				data = enc.AppendUint16(data, c.B)
+				data = enc.AppendUint16(data, c.A)
+			}
+		}
+		return data, 4, 16
+	}
+
+	data = make([]byte, 0, b.Dx()*b.Dy()*4)
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		for x := b.Min.X; x < b.Max.X; x++ {
+			c := color.NRGBAModel.Convert(m.At(x, y)).(color.NRGBA)
+			data = append(data, c.R, c.G, c.B, c.A)
+		}
+	}
+	return data, 4, 8
+}
+
+// predict applies the horizontal differencing predictor to data in place, each
+// sample is replaced by its difference from the same sample of the pixel to
+// its left.
+func predict(data []byte, width, samples, bits int) {
+	bytesPerSample := bits / 8
+	rowLen := width * samples * bytesPerSample
+	step := samples * bytesPerSample
+
+	for row := 0; row+rowLen <= len(data); row += rowLen {
+		line := data[row : row+rowLen]
+
+		for i := len(line) - bytesPerSample; i >= step; i -= bytesPerSample {
+			if bytesPerSample == 2 {
+				v := enc.Uint16(line[i:]) - enc.Uint16(line[i-step:])
+				enc.PutUint16(line[i:], v)
+			} else {
+				line[i] -= line[i-step]
+			}
+		}
+	}
+}
+
+type ifdEntry struct {
+	tag, datatype uint16
+	data          []uint32
+}
+
+// Encode writes the image m to w. opt determines the options used for
+// encoding, such as the compression type. If opt is nil, an uncompressed image
+// is written.
+func Encode(w io.Writer, m image.Image, opt *Options) error {
+	b := m.Bounds()
+	if b.Dx() < 1 || b.Dy() < 1 {
+		return errors.New("tiff: image is empty")
+	}
+
+	compression := Uncompressed
+	if opt != nil {
+		compression = opt.Compression
+	}
+
+	data, samples, bits := pixels(m)
+
+	var strip bytes.Buffer
+	var compressionValue uint32 = cNone
+
+	switch compression {
+	case Uncompressed:
+		strip.Write(data)
+
+	case Deflate:
+		compressionValue = cDeflate
+		predict(data, b.Dx(), samples, bits)
+		zw := zlib.NewWriter(&strip)
+		if _, err := zw.Write(data); err != nil {
+			return err
+		}
+		if err := zw.Close(); err != nil {
+			return err
+		}
+
+	case LZW:
+		compressionValue = cLZW
+		predict(data, b.Dx(), samples, bits)
+		if err := compressLZW(&strip, data); err != nil {
+			return err
+		}
+
+	default:
+		return errors.New("tiff: unsupported compression")
+	}
+
+	if strip.Len()%2 == 1 {
+		strip.WriteByte(0)
+	}
+
+	photometric := uint32(pRGB)
+	if samples == 1 {
+		photometric = pBlackIsZero
+	}
+
+	bitsPerSample := make([]uint32, samples)
+	for i := range bitsPerSample {
+		bitsPerSample[i] = uint32(bits)
+	}
+
+	entries := []ifdEntry{
+		{tImageWidth, dtLong, []uint32{uint32(b.Dx())}},
+		{tImageLength, dtLong, []uint32{uint32(b.Dy())}},
+		{tBitsPerSample, dtShort, bitsPerSample},
+		{tCompression, dtShort, []uint32{compressionValue}},
+		{tPhotometricInterpretation, dtShort, []uint32{photometric}},
+		{tStripOffsets, dtLong, []uint32{8}},
+		{tSamplesPerPixel, dtShort, []uint32{uint32(samples)}},
+		{tRowsPerStrip, dtLong, []uint32{uint32(b.Dy())}},
+		{tStripByteCounts, dtLong, []uint32{uint32(strip.Len())}},
+		{tXResolution, dtRational, []uint32{72, 1}},
+		{tYResolution, dtRational, []uint32{72, 1}},
+		{tPlanarConfiguration, dtShort, []uint32{1}},
+		{tResolutionUnit, dtShort, []uint32{2}},
+	}
+	if compression != Uncompressed {
+		entries = append(entries, ifdEntry{tPredictor, dtShort, []uint32{prHorizontal}})
+	}
+	if samples == 4 {
+		entries = append(entries, ifdEntry{tExtraSamples, dtShort, []uint32{esUnassociatedAlpha}})
+	}
+
+	// The strip is written directly after the header, and the IFD after that.
+	ifdOffset := uint32(8 + strip.Len())
+
+	var out bytes.Buffer
+	out.WriteString("II\x2a\x00")
+	binary.Write(&out, enc, ifdOffset)
+	out.Write(strip.Bytes())
+	writeIFD(&out, ifdOffset, entries)
+
+	_, err := w.Write(out.Bytes())
+	return err
+}
+
+// writeIFD writes the entries to buf, which must have length offset.
+func writeIFD(buf *bytes.Buffer, offset uint32, entries []ifdEntry) {
+	dataAt := offset + uint32(2+12*len(entries)+4)
+	var data bytes.Buffer
+
+	binary.Write(buf, enc, uint16(len(entries)))
+
+	for _, e := range entries {
+		var value bytes.Buffer
+		count := uint32(len(e.data))
+
+		switch e.datatype {
+		case dtShort:
+			for _, d := range e.data {
+				binary.Write(&value, enc, uint16(d))
+			}
+		case dtLong:
+			for _, d := range e.data {
+				binary.Write(&value, enc, d)
+			}
+		case dtRational:
+			count /= 2
+			for _, d := range e.data {
+				binary.Write(&value, enc, d)
+			}
+		}
+
+		binary.Write(buf, enc, e.tag)
+		binary.Write(buf, enc, e.datatype)
+		binary.Write(buf, enc, count)
+
+		if value.Len() <= 4 {
+			var inline [4]byte
+			copy(inline[:], value.Bytes())
+			buf.Write(inline[:])
+		} else {
+			binary.Write(buf, enc, dataAt+uint32(data.Len()))
+			data.Write(value.Bytes())
+		}
+	}
+
+	binary.Write(buf, enc, uint32(0))
+	buf.Write(data.Bytes())
+}
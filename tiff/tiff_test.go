@@ -0,0 +1,86 @@
+package tiff
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"testing"
+
+	"golang.org/x/image/tiff"
+)
+
+func TestRoundTrip(t *testing.T) {
+	r := image.Rect(0, 0, 29, 17)
+
+	gray := image.NewGray(r)
+	gray16 := image.NewGray16(r)
+	nrgba := image.NewNRGBA(r)
+	nrgba64 := image.NewNRGBA64(r)
+	for y := 0; y < r.Dy(); y++ {
+		for x := 0; x < r.Dx(); x++ {
+			gray.SetGray(x, y, color.Gray{uint8(x * y)})
+			gray16.SetGray16(x, y, color.Gray16{uint16(x*y*997 + x)})
+			nrgba.SetNRGBA(x, y, color.NRGBA{uint8(x * 9), uint8(y * 15), 100, uint8(255 - x*3)})
+			nrgba64.SetNRGBA64(x, y, color.NRGBA64{uint16(x * 2000), uint16(y * 3001), 40000, uint16(65535 - x*1000)})
+		}
+	}
+
+	images := map[string]image.Image{
+		"gray":    gray,
+		"gray16":  gray16,
+		"nrgba":   nrgba,
+		"nrgba64": nrgba64,
+	}
+	compressions := map[string]Compression{
+		"none":    Uncompressed,
+		"deflate": Deflate,
+		"lzw":     LZW,
+	}
+
+	for iname, img := range images {
+		for cname, c := range compressions {
+			t.Run(iname+"/"+cname, func(t *testing.T) {
+				var buf bytes.Buffer
+				if err := Encode(&buf, img, &Options{Compression: c}); err != nil {
+					t.Fatal(err)
+				}
+
+				out, err := tiff.Decode(&buf)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if out.Bounds() != r {
+					t.Fatalf("expected bounds %v, got %v", r, out.Bounds())
+				}
+
+				for y := 0; y < r.Dy(); y++ {
+					for x := 0; x < r.Dx(); x++ {
+						want := color.NRGBA64Model.Convert(img.At(x, y))
+						got := color.NRGBA64Model.Convert(out.At(x, y))
+						if got != want {
+							t.Fatalf("at (%d,%d): expected %v, got %v", x, y, want, got)
+						}
+					}
+				}
+			})
+		}
+	}
+}
+
+func TestEncodeNilOptions(t *testing.T) {
+	img := image.NewGray(image.Rect(0, 0, 3, 3))
+
+	var buf bytes.Buffer
+	if err := Encode(&buf, img, nil); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := tiff.Decode(&buf); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestEncodeEmpty(t *testing.T) {
+	if err := Encode(&bytes.Buffer{}, image.NewGray(image.Rect(0, 0, 4, 0)), nil); err == nil {
+		t.Error("expected error")
+	}
+}
@@ -7,6 +7,7 @@ import (
 	"image/color"
 
 	"hawx.me/code/img/blend"
+	"hawx.me/code/img/utils"
 )
 
 // Tint adds a colored tint to the image.
@@ -14,3 +15,8 @@ func Tint(img image.Image, with color.Color) image.Image {
 	blendLayer := image.NewUniform(with)
 	return blend.LinearLight(img, blendLayer)
 }
+
+// TintC returns a function that tints each colour it is given.
+func TintC(with color.Color) utils.Composable {
+	return blend.LinearLightC(with)
+}
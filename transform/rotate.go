@@ -0,0 +1,134 @@
+package transform
+
+import (
+	"image"
+	"image/color"
+	"math"
+
+	"hawx.me/code/img/resize"
+	"hawx.me/code/img/utils"
+)
+
+// Rotate turns the image clockwise by the angle given, in degrees. The result is
+// large enough to hold the whole of the rotated image, and the corners left
+// uncovered are filled with background. Each pixel is interpolated from those
+// of the original using filter, for example resize.Bilinear.
+//
+// Rotating by a multiple of 90 degrees does not need interpolation, so is exact.
+func Rotate(img image.Image, angle float64, background color.Color, filter resize.Filter) image.Image {
+	angle = math.Mod(angle, 360)
+	if angle < 0 {
+		angle += 360
+	}
+
+	switch angle {
+	case 0:
+		return remap(img, img.Bounds().Dx(), img.Bounds().Dy(), func(x, y int) (int, int) { return x, y })
+	case 90:
+		return Rotate90(img)
+	case 180:
+		return Rotate180(img)
+	case 270:
+		return Rotate270(img)
+	}
+
+	b := img.Bounds()
+	w, h := float64(b.Dx()), float64(b.Dy())
+
+	rad := angle * math.Pi / 180
+	sin, cos := math.Sin(rad), math.Cos(rad)
+
+	width := int(math.Ceil(math.Abs(w*cos) + math.Abs(h*sin) - 1e-9))
+	height := int(math.Ceil(math.Abs(w*sin) + math.Abs(h*cos) - 1e-9))
+	out := newLike(img, image.Rect(0, 0, width, height))
+
+	_, linear := img.(*utils.Linear)
+	bg := colour(background, linear)
+
+	// The colour of each pixel of the result is found by rotating its centre
+	// back the other way, around the centre of the image, then interpolating
+	// the colours around that point.
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			dx := float64(x) + 0.5 - float64(width)/2
+			dy := float64(y) + 0.5 - float64(height)/2
+
+			u := dx*cos + dy*sin + w/2 - 0.5
+			v := -dx*sin + dy*cos + h/2 - 0.5
+
+			set(out, x, y, sample(img, linear, u, v, bg, filter))
+		}
+	}
+
+	return out
+}
+
+// colour returns c as premultiplied values from 0 to 1, in linear light if
+// linear is true.
+func colour(c color.Color, linear bool) [4]float64 {
+	if linear {
+		l := utils.LinearModel.Convert(c).(utils.LinearColor)
+		return [4]float64{float64(l.R), float64(l.G), float64(l.B), float64(l.A)}
+	}
+
+	r, g, b, a := c.RGBA()
+	return [4]float64{float64(r) / 0xffff, float64(g) / 0xffff, float64(b) / 0xffff, float64(a) / 0xffff}
+}
+
+// sample returns the colour at (u, v), relative to the top-left pixel of img,
+// interpolated with filter. Points outside of the image take the background
+// colour, so that the edges of the image blend into it.
+func sample(img image.Image, linear bool, u, v float64, bg [4]float64, filter resize.Filter) color.Color {
+	b := img.Bounds()
+
+	at := func(x, y int) [4]float64 {
+		if x < 0 || y < 0 || x >= b.Dx() || y >= b.Dy() {
+			return bg
+		}
+		return colour(img.At(b.Min.X+x, b.Min.Y+y), linear)
+	}
+
+	var sum [4]float64
+
+	if filter.Support == 0 {
+		sum = at(int(math.Floor(u+0.5)), int(math.Floor(v+0.5)))
+	} else {
+		total := 0.0
+
+		for y := int(math.Ceil(v - filter.Support)); y <= int(math.Floor(v+filter.Support)); y++ {
+			wy := filter.Kernel(float64(y) - v)
+			if wy == 0 {
+				continue
+			}
+
+			for x := int(math.Ceil(u - filter.Support)); x <= int(math.Floor(u+filter.Support)); x++ {
+				weight := wy * filter.Kernel(float64(x)-u)
+				c := at(x, y)
+				for i := range sum {
+					sum[i] += c[i] * weight
+				}
+				total += weight
+			}
+		}
+
+		if total != 0 {
+			for i := range sum {
+				sum[i] /= total
+			}
+		}
+	}
+
+	a := math.Max(0, math.Min(1, sum[3]))
+	clamp := func(v float64) float64 { return math.Max(0, math.Min(a, v)) }
+
+	if linear {
+		return utils.LinearColor{R: float32(clamp(sum[0])), G: float32(clamp(sum[1])), B: float32(clamp(sum[2])), A: float32(a)}
+	}
+
+	return color.RGBA64{
+		uint16(clamp(sum[0])*0xffff + 0.5),
+		uint16(clamp(sum[1])*0xffff + 0.5),
+		uint16(clamp(sum[2])*0xffff + 0.5),
+		uint16(a*0xffff + 0.5),
+	}
+}
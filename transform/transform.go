@@ -0,0 +1,134 @@
+// Package transform provides functions for rotating and flipping images.
+package transform
+
+import (
+	"image"
+	"image/color"
+	"image/draw"
+
+	"hawx.me/code/img/utils"
+)
+
+// newLike returns a new image, with the bounds given, that can hold the pixels
+// of img without losing precision. Linear images stay Linear.
+func newLike(img image.Image, bounds image.Rectangle) draw.Image {
+	if _, ok := img.(*utils.Linear); ok {
+		return utils.NewLinear(bounds)
+	}
+	return utils.NewImageFor(img, bounds)
+}
+
+// set sets the pixel of out to c, without losing precision if both are Linear.
+func set(out draw.Image, x, y int, c color.Color) {
+	if l, ok := out.(*utils.Linear); ok {
+		if lc, ok := c.(utils.LinearColor); ok {
+			l.SetLinear(x, y, lc)
+			return
+		}
+	}
+	out.Set(x, y, c)
+}
+
+// remap returns an image of width by height pixels, where each pixel (x, y) is
+// taken from the pixel of img that f returns, relative to the top-left corner
+// of img.
+func remap(img image.Image, width, height int, f func(x, y int) (int, int)) image.Image {
+	b := img.Bounds()
+	out := newLike(img, image.Rect(0, 0, width, height))
+
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			sx, sy := f(x, y)
+			set(out, x, y, img.At(b.Min.X+sx, b.Min.Y+sy))
+		}
+	}
+
+	return out
+}
+
+// Rotate90 rotates the image a quarter turn clockwise.
+func Rotate90(img image.Image) image.Image {
+	b := img.Bounds()
+	return remap(img, b.Dy(), b.Dx(), func(x, y int) (int, int) {
+		return y, b.Dy() - 1 - x
+	})
+}
+
+// Rotate180 rotates the image a half turn.
+func Rotate180(img image.Image) image.Image {
+	b := img.Bounds()
+	return remap(img, b.Dx(), b.Dy(), func(x, y int) (int, int) {
+		return b.Dx() - 1 - x, b.Dy() - 1 - y
+	})
+}
+
+// Rotate270 rotates the image a quarter turn anticlockwise.
+func Rotate270(img image.Image) image.Image {
+	b := img.Bounds()
+	return remap(img, b.Dy(), b.Dx(), func(x, y int) (int, int) {
+		return b.Dx() - 1 - y, x
+	})
+}
+
+// FlipHorizontal mirrors the image from left to right.
+func FlipHorizontal(img image.Image) image.Image {
+	b := img.Bounds()
+	return remap(img, b.Dx(), b.Dy(), func(x, y int) (int, int) {
+		return b.Dx() - 1 - x, y
+	})
+}
+
+// FlipVertical mirrors the image from top to bottom.
+func FlipVertical(img image.Image) image.Image {
+	b := img.Bounds()
+	return remap(img, b.Dx(), b.Dy(), func(x, y int) (int, int) {
+		return x, b.Dy() - 1 - y
+	})
+}
+
+// Transpose mirrors the image along the diagonal from the top-left to the
+// bottom-right corner, so rows become columns.
+func Transpose(img image.Image) image.Image {
+	b := img.Bounds()
+	return remap(img, b.Dy(), b.Dx(), func(x, y int) (int, int) {
+		return y, x
+	})
+}
+
+// Transverse mirrors the image along the diagonal from the top-right to the
+// bottom-left corner.
+func Transverse(img image.Image) image.Image {
+	b := img.Bounds()
+	return remap(img, b.Dy(), b.Dx(), func(x, y int) (int, int) {
+		return b.Dx() - 1 - y, b.Dy() - 1 - x
+	})
+}
+
+// Orient transforms an image stored with the exif orientation given, from 1 to
+// 8, so that it is the right way up. Any other orientation leaves the image
+// unchanged.
+func Orient(img image.Image, orientation int) image.Image {
+	switch orientation {
+	case 2:
+		return FlipHorizontal(img)
+	case 3:
+		return Rotate180(img)
+	case 4:
+		return FlipVertical(img)
+	case 5:
+		return Transpose(img)
+	case 6:
+		return Rotate90(img)
+	case 7:
+		return Transverse(img)
+	case 8:
+		return Rotate270(img)
+	}
+	return img
+}
+
+// Swaps reports whether Orient, given the orientation, swaps the width and
+// height of the image.
+func Swaps(orientation int) bool {
+	return orientation >= 5 && orientation <= 8
+}
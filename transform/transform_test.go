@@ -0,0 +1,91 @@
+package transform
+
+import (
+	"image"
+	"image/color"
+	"testing"
+)
+
+// labelled returns an image with each pixel's grey value set to the index of
+// its label in rows, which are given top to bottom.
+func labelled(rows ...string) *image.Gray {
+	img := image.NewGray(image.Rect(0, 0, len(rows[0]), len(rows)))
+	for y, row := range rows {
+		for x, label := range row {
+			img.SetGray(x, y, color.Gray{uint8(label)})
+		}
+	}
+	return img
+}
+
+func labels(img image.Image) []string {
+	b := img.Bounds()
+	rows := make([]string, b.Dy())
+	for y := 0; y < b.Dy(); y++ {
+		for x := 0; x < b.Dx(); x++ {
+			g := color.GrayModel.Convert(img.At(b.Min.X+x, b.Min.Y+y)).(color.Gray)
+			rows[y] += string(rune(g.Y))
+		}
+	}
+	return rows
+}
+
+func TestOrient(t *testing.T) {
+	// The image as stored is 2 wide and 3 tall.
+	stored := labelled(
+		"ab",
+		"cd",
+		"ef",
+	)
+
+	for _, tc := range []struct {
+		orientation int
+		want        []string
+	}{
+		{0, []string{"ab", "cd", "ef"}},
+		{1, []string{"ab", "cd", "ef"}},
+		{2, []string{"ba", "dc", "fe"}},
+		{3, []string{"fe", "dc", "ba"}},
+		{4, []string{"ef", "cd", "ab"}},
+		{5, []string{"ace", "bdf"}},
+		{6, []string{"eca", "fdb"}},
+		{7, []string{"fdb", "eca"}},
+		{8, []string{"bdf", "ace"}},
+		{9, []string{"ab", "cd", "ef"}},
+	} {
+		out := Orient(stored, tc.orientation)
+
+		got := labels(out)
+		if len(got) != len(tc.want) {
+			t.Errorf("orientation %d: expected %v, got %v", tc.orientation, tc.want, got)
+			continue
+		}
+		for i := range got {
+			if got[i] != tc.want[i] {
+				t.Errorf("orientation %d: expected %v, got %v", tc.orientation, tc.want, got)
+				break
+			}
+		}
+
+		if swapped := out.Bounds().Dx() == 3; swapped != Swaps(tc.orientation) {
+			t.Errorf("orientation %d: Swaps is %v, but size is %v", tc.orientation, Swaps(tc.orientation), out.Bounds().Size())
+		}
+	}
+}
+
+func TestOrientOffset(t *testing.T) {
+	stored := labelled(
+		"xxx",
+		"xab",
+		"xcd",
+		"xef",
+	).SubImage(image.Rect(1, 1, 3, 4))
+
+	out := Orient(stored, 6)
+	if out.Bounds().Min != (image.Point{}) {
+		t.Errorf("expected result at origin, got %v", out.Bounds())
+	}
+	if got := labels(out); got[0] != "eca" || got[1] != "fdb" {
+		t.Errorf("expected [eca fdb], got %v", got)
+	}
+}
@@ -0,0 +1,174 @@
+package utils
+
+import (
+	"image"
+	"image/color"
+	colorpalette "image/color/palette"
+	"image/draw"
+	"image/gif"
+)
+
+// Apply returns the result of f on img. If meta holds an animation f is also
+// applied to each of its frames, which are then re-quantised. The frames are
+// changed in place so that delays, disposal methods and the loop count are kept.
+//
+// As the frames of a GIF can cover only part of the image, Apply should only be
+// used where each pixel of the result depends on the same pixel of the input,
+// for example functions built with MapColor. Otherwise use ApplyComposited.
+func (meta Meta) Apply(img image.Image, f func(image.Image) image.Image) image.Image {
+	anim := meta.Animation
+	if anim == nil {
+		return f(img)
+	}
+
+	for i, frame := range anim.Image {
+		anim.Image[i] = requantize(f(frame), frame.Bounds(), transparentMask(frame))
+	}
+
+	return f(img)
+}
+
+// ApplyComposited is like Apply, but each frame of an animation is first drawn
+// over the frames before it, as it would be displayed, so that f is given the
+// whole image. The frames that are written cover the whole image, so their
+// disposal methods are changed to gif.DisposalBackground.
+func (meta Meta) ApplyComposited(img image.Image, f func(image.Image) image.Image) image.Image {
+	anim := meta.Animation
+	if anim == nil {
+		return f(img)
+	}
+
+	var result image.Image
+	for i, frame := range composite(anim) {
+		out := f(frame)
+		if i == 0 {
+			result = out
+		}
+
+		bounds := out.Bounds().Sub(out.Bounds().Min)
+		anim.Image[i] = requantize(out, bounds, nil)
+		anim.Disposal[i] = gif.DisposalBackground
+	}
+
+	anim.Config.Width = result.Bounds().Dx()
+	anim.Config.Height = result.Bounds().Dy()
+
+	return result
+}
+
+// composite returns each frame of the animation as it would be displayed.
+func composite(anim *gif.GIF) []image.Image {
+	canvas := image.NewNRGBA(image.Rect(0, 0, anim.Config.Width, anim.Config.Height))
+	frames := make([]image.Image, len(anim.Image))
+
+	for i, frame := range anim.Image {
+		var previous *image.NRGBA
+		if anim.Disposal[i] == gif.DisposalPrevious {
+			previous = image.NewNRGBA(canvas.Bounds())
+			copy(previous.Pix, canvas.Pix)
+		}
+
+		draw.Draw(canvas, frame.Bounds(), frame, frame.Bounds().Min, draw.Over)
+
+		shown := image.NewNRGBA(canvas.Bounds())
+		copy(shown.Pix, canvas.Pix)
+		frames[i] = shown
+
+		switch anim.Disposal[i] {
+		case gif.DisposalBackground:
+			draw.Draw(canvas, frame.Bounds(), image.Transparent, image.Point{}, draw.Src)
+		case gif.DisposalPrevious:
+			canvas = previous
+		}
+	}
+
+	return frames
+}
+
+// transparentMask returns a function reporting whether the pixel of frame is
+// transparent, or nil if the frame has no transparent colour.
+func transparentMask(frame *image.Paletted) func(x, y int) bool {
+	transparent := -1
+	for i, c := range frame.Palette {
+		if _, _, _, a := c.RGBA(); a == 0 {
+			transparent = i
+			break
+		}
+	}
+	if transparent < 0 {
+		return nil
+	}
+
+	return func(x, y int) bool {
+		return frame.ColorIndexAt(x, y) == uint8(transparent)
+	}
+}
+
+// requantize converts img to a paletted image with the bounds given, using the
+// selected Palette. Pixels for which transparent returns true, or that are less
+// than half opaque, are given a transparent palette entry which the gif encoder
+// marks as the transparent index. Dithering is not used, as it causes the frames
+// to flicker.
+func requantize(img image.Image, bounds image.Rectangle, transparent func(x, y int) bool) *image.Paletted {
+	src := image.NewNRGBA(bounds)
+	offset := img.Bounds().Min.Sub(bounds.Min)
+	hasTransparent := false
+
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			if transparent != nil && transparent(x, y) {
+				hasTransparent = true
+				continue
+			}
+			c := color.NRGBAModel.Convert(img.At(x+offset.X, y+offset.Y)).(color.NRGBA)
+			if c.A < 128 {
+				hasTransparent = true
+				continue
+			}
+			c.A = 255
+			src.SetNRGBA(x, y, c)
+		}
+	}
+
+	// Leave room for the transparent colour, as neither of the fixed palettes
+	// have one.
+	size := 256
+	if hasTransparent {
+		size--
+	}
+
+	p := make(color.Palette, 0, size)
+	if q := quantizer(Palette); q != nil {
+		p = q.Quantize(p, src)
+	} else {
+		p = append(p, colorpalette.Plan9[:size]...)
+	}
+
+	transparentIndex := -1
+	if hasTransparent {
+		for i, c := range p {
+			if _, _, _, a := c.RGBA(); a == 0 {
+				transparentIndex = i
+				break
+			}
+		}
+		if transparentIndex < 0 {
+			transparentIndex = len(p)
+			p = append(p, color.Transparent)
+		}
+	}
+
+	dst := image.NewPaletted(bounds, p)
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			c := src.NRGBAAt(x, y)
+			if c.A == 0 {
+				dst.SetColorIndex(x, y, uint8(transparentIndex))
+			} else {
+				dst.SetColorIndex(x, y, uint8(p.Index(c)))
+			}
+		}
+	}
+
+	return dst
+}
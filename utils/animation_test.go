@@ -0,0 +1,75 @@
+package utils
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/gif"
+	"testing"
+)
+
+// transparentGIF returns a two frame animation of a red square moving over a
+// transparent background.
+func transparentGIF() *gif.GIF {
+	p := color.Palette{color.Transparent, color.RGBA{255, 0, 0, 255}}
+	anim := &gif.GIF{
+		Config: image.Config{ColorModel: p, Width: 8, Height: 8},
+	}
+
+	for i := 0; i < 2; i++ {
+		frame := image.NewPaletted(image.Rect(0, 0, 8, 8), p)
+		for y := 2; y < 5; y++ {
+			for x := 2 + i; x < 5+i; x++ {
+				frame.SetColorIndex(x, y, 1)
+			}
+		}
+		anim.Image = append(anim.Image, frame)
+		anim.Delay = append(anim.Delay, 10)
+		anim.Disposal = append(anim.Disposal, gif.DisposalBackground)
+	}
+
+	return anim
+}
+
+func invert(img image.Image) image.Image {
+	return MapColor(img, func(c color.Color) color.Color {
+		r, g, b, a := RatioRGBA(c)
+		return RatioNRGBA(1-r, 1-g, 1-b, a)
+	})
+}
+
+func TestApplyKeepsTransparency(t *testing.T) {
+	defer func(p palette) { Palette = p }(Palette)
+
+	for _, p := range []palette{MEDIAN, PLAN9, WEBSAFE} {
+		for name, apply := range map[string]func(Meta, image.Image, func(image.Image) image.Image) image.Image{
+			"Apply":           Meta.Apply,
+			"ApplyComposited": Meta.ApplyComposited,
+		} {
+			t.Run(string(p)+"/"+name, func(t *testing.T) {
+				Palette = p
+
+				anim := transparentGIF()
+				apply(Meta{Animation: anim}, anim.Image[0], invert)
+
+				var buf bytes.Buffer
+				if err := gif.EncodeAll(&buf, anim); err != nil {
+					t.Fatal(err)
+				}
+				out, err := gif.DecodeAll(&buf)
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				for i, frame := range out.Image {
+					if _, _, _, a := frame.At(0, 0).RGBA(); a != 0 {
+						t.Errorf("frame %d: expected background to be transparent, got %v", i, frame.At(0, 0))
+					}
+					if r, g, b, a := frame.At(3, 3).RGBA(); a != 0xffff || r > 0x1000 || g < 0xe000 || b < 0xe000 {
+						t.Errorf("frame %d: expected square to be cyan, got %v", i, frame.At(3, 3))
+					}
+				}
+			})
+		}
+	}
+}
@@ -0,0 +1,85 @@
+package utils
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"os"
+)
+
+// MaxMemoryBuffer is the number of bytes of input that a Buffer will hold in
+// memory. Larger inputs are spilled to a temporary file.
+var MaxMemoryBuffer int64 = 32 << 20
+
+// A Buffer holds the contents of a stream so that it can be read more than
+// once, even if the stream was a pipe or socket. It should be closed once
+// finished with, to remove any temporary file that was created.
+type Buffer struct {
+	r     io.ReadSeeker
+	start int64
+	spill *os.File
+}
+
+// NewBuffer reads r into a Buffer. If r is already seekable, for instance when
+// standard input is redirected from a file, or is a Buffer it is used directly.
+func NewBuffer(r io.Reader) (*Buffer, error) {
+	if b, ok := r.(*Buffer); ok {
+		r = b.r
+	}
+
+	if s, ok := r.(io.ReadSeeker); ok {
+		if start, err := s.Seek(0, io.SeekCurrent); err == nil {
+			return &Buffer{r: s, start: start}, nil
+		}
+	}
+
+	var mem bytes.Buffer
+	n, err := io.Copy(&mem, io.LimitReader(r, MaxMemoryBuffer+1))
+	if err != nil {
+		return nil, err
+	}
+
+	if n <= MaxMemoryBuffer {
+		return &Buffer{r: bytes.NewReader(mem.Bytes())}, nil
+	}
+
+	spill, err := ioutil.TempFile("", "img-utils-buffer-")
+	if err != nil {
+		return nil, err
+	}
+
+	b := &Buffer{r: spill, spill: spill}
+	if _, err = io.Copy(spill, io.MultiReader(&mem, r)); err != nil {
+		b.Close()
+		return nil, err
+	}
+
+	if err = b.Rewind(); err != nil {
+		b.Close()
+		return nil, err
+	}
+
+	return b, nil
+}
+
+// Read reads from the buffered stream.
+func (b *Buffer) Read(p []byte) (int, error) {
+	return b.r.Read(p)
+}
+
+// Rewind returns to the start of the buffered stream, so that it can be read
+// again.
+func (b *Buffer) Rewind() error {
+	_, err := b.r.Seek(b.start, io.SeekStart)
+	return err
+}
+
+// Close removes any temporary file used by the Buffer.
+func (b *Buffer) Close() error {
+	if b.spill == nil {
+		return nil
+	}
+
+	b.spill.Close()
+	return os.Remove(b.spill.Name())
+}
@@ -40,10 +40,39 @@ func NormalisedRGBAf(c color.Color) (float64, float64, float64, float64) {
 }
 
 // RatioRGBA returns the RGBA colour channel values as floating point numbers
-// with values from 0 to 1.
+// with values from 0 to 1. The values are in non-premultiplied form, and keep
+// the full 16 bits of precision given by the Color.
 func RatioRGBA(c color.Color) (float64, float64, float64, float64) {
-	r, g, b, a := NormalisedRGBAf(c)
-	return r / 255, g / 255, b / 255, a / 255
+	r, g, b, a := c.RGBA()
+	if a == 0 {
+		return 0, 0, 0, 0
+	}
+
+	fa := float64(a)
+	return float64(r) / fa, float64(g) / fa, float64(b) / fa, fa / 0xffff
+}
+
+// RatioNRGBA returns a Color with the non-premultiplied channel values given as
+// floating point numbers from 0 to 1, values outside of this range are
+// truncated. It is the reverse of RatioRGBA, and keeps 16 bits of precision.
+func RatioNRGBA(r, g, b, a float64) color.Color {
+	return color.NRGBA64{
+		uint16(Ratio16(r)),
+		uint16(Ratio16(g)),
+		uint16(Ratio16(b)),
+		uint16(Ratio16(a)),
+	}
+}
+
+// Ratio16 scales a value from the range 0 to 1 to the range 0 to 0xffff used
+// by Color.RGBA, values outside of the range are truncated.
+func Ratio16(v float64) uint32 {
+	if v < 0 {
+		return 0
+	} else if v > 1 {
+		return 0xffff
+	}
+	return uint32(v*0xffff + 0.5)
 }
 
 // Truncate takes a colour channel value and forces it into the range 0 to 255
@@ -14,7 +14,7 @@ type Dimension struct {
 }
 
 func (d *Dimension) String() string {
-	return fmt.Sprint("%vx%v", *d)
+	return fmt.Sprintf("%vx%v", d.H, d.W)
 }
 
 // Set takes a string representing a Dimension (ie., in the format HxW, where H
@@ -22,6 +22,9 @@ func (d *Dimension) String() string {
 // value. It returns an error string if a problem occurs.
 func (d *Dimension) Set(value string) error {
 	parts := strings.Split(value, "x")
+	if len(parts) != 2 {
+		return errors.New("Error parsing dimension: expect HxW where H and W are integers")
+	}
 
 	h, e := strconv.Atoi(parts[0])
 	if e != nil {
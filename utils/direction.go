@@ -1,5 +1,7 @@
 package utils
 
+import "image"
+
 // Direction represents one of 9 directions. these being the 4 vertices, the 4
 // sides, and the Centre of a square.
 type Direction int
@@ -15,3 +17,26 @@ const (
 	Left
 	TopLeft
 )
+
+// Anchor returns the rectangle of width by height within b that is placed at the
+// side or corner of b given by direction, or in the centre.
+func Anchor(b image.Rectangle, width, height int, direction Direction) image.Rectangle {
+	x := b.Min.X + (b.Dx()-width)/2
+	y := b.Min.Y + (b.Dy()-height)/2
+
+	switch direction {
+	case TopLeft, Top, TopRight:
+		y = b.Min.Y
+	case BottomLeft, Bottom, BottomRight:
+		y = b.Max.Y - height
+	}
+
+	switch direction {
+	case TopLeft, Left, BottomLeft:
+		x = b.Min.X
+	case TopRight, Right, BottomRight:
+		x = b.Max.X - width
+	}
+
+	return image.Rect(x, y, x+width, y+height)
+}
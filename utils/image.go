@@ -2,6 +2,8 @@ package utils
 
 import (
 	"image"
+	"image/color"
+	"image/draw"
 )
 
 // ExcessMode specifies how excess space is dealt with for tools that may
@@ -114,3 +116,23 @@ func ChopRectangleToSizes(rect image.Rectangle, rowHeight, colWidth int, mode Ex
 
 	return chopRectangle(rect, rows, cols, rowHeight, colWidth, mode)
 }
+
+// Deep returns true if the Image has more than 8 bits for each channel, for
+// example a 16-bit PNG or TIFF.
+func Deep(img image.Image) bool {
+	switch img.ColorModel() {
+	case color.RGBA64Model, color.NRGBA64Model, color.Gray16Model:
+		return true
+	}
+	return false
+}
+
+// NewImageFor returns a new Image with the bounds given that can hold the
+// result of processing img without losing precision. This is an *image.NRGBA64
+// if img is Deep, or an *image.RGBA otherwise.
+func NewImageFor(img image.Image, bounds image.Rectangle) draw.Image {
+	if Deep(img) {
+		return image.NewNRGBA64(bounds)
+	}
+	return image.NewRGBA(bounds)
+}
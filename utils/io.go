@@ -0,0 +1,259 @@
+package utils
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"image"
+	colorpalette "image/color/palette"
+	"image/draw"
+	"image/gif"
+	"image/jpeg"
+	"image/png"
+	"io"
+	"os"
+
+	"golang.org/x/image/bmp"
+	_ "golang.org/x/image/tiff"
+	_ "golang.org/x/image/webp"
+	"hawx.me/code/img/exif"
+	"hawx.me/code/img/icc"
+	"hawx.me/code/img/quantize"
+	"hawx.me/code/img/tiff"
+	"hawx.me/code/img/webp"
+)
+
+// Errors returned by Read and Write, they are wrapped so use errors.Is to check
+// for them.
+var (
+	ErrUnsupportedFormat = errors.New("unsupported format")
+	ErrTruncated         = errors.New("truncated input")
+	ErrEncode            = errors.New("encode failure")
+)
+
+// Exit codes used by Fatal. Exit code 2 is used for incorrect usage, and 1 for
+// any other error.
+const (
+	ExitUnsupportedFormat = 3
+	ExitTruncated         = 4
+	ExitEncode            = 5
+)
+
+// Meta holds the information, other than the pixels, that is read with an
+// image and should be written back out with it.
+type Meta struct {
+	Exif *exif.Exif
+
+	// ICC is the colour profile embedded in the image, or nil if there is not
+	// one. It is written back out for JPEG and PNG output, if it describes the
+	// colour space that the output is written in.
+	ICC *icc.Profile
+
+	// Format is the name of the format the image was decoded from, as returned
+	// by image.Decode.
+	Format string
+
+	// Animation holds every frame of an animated GIF, and is nil for any other
+	// image. Use Apply or ApplyComposited so that changes are made to each
+	// frame.
+	Animation *gif.GIF
+}
+
+// Read decodes an image (either PNG, JPEG, GIF, TIFF, BMP or WebP) from r, along
+// with its exif data and colour profile. The input is buffered, so r does not
+// need to be seekable.
+func Read(r io.Reader) (image.Image, Meta, error) {
+	meta := Meta{Exif: exif.New()}
+
+	buf, err := NewBuffer(r)
+	if err != nil {
+		return nil, meta, err
+	}
+	defer buf.Close()
+
+	img, format, err := image.Decode(buf)
+	if err != nil {
+		return nil, meta, decodeError(err)
+	}
+	meta.Format = format
+
+	if err = buf.Rewind(); err != nil {
+		return nil, meta, err
+	}
+	meta.Exif = exif.Decode(buf)
+
+	if err = buf.Rewind(); err != nil {
+		return nil, meta, err
+	}
+	// A profile that cannot be read is dropped, rather than failing.
+	meta.ICC, _ = icc.Decode(buf)
+
+	if format == "gif" {
+		if err = buf.Rewind(); err != nil {
+			return nil, meta, err
+		}
+
+		anim, err := gif.DecodeAll(buf)
+		if err != nil {
+			return nil, meta, decodeError(err)
+		}
+		if len(anim.Image) > 1 {
+			meta.Animation = anim
+		}
+	}
+
+	return img, meta, nil
+}
+
+// ReadFile reads an image from the file at path, see Read.
+func ReadFile(path string) (image.Image, Meta, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, Meta{Exif: exif.New()}, err
+	}
+	defer file.Close()
+
+	return Read(file)
+}
+
+func decodeError(err error) error {
+	switch {
+	case err == image.ErrFormat:
+		return ErrUnsupportedFormat
+	case err == io.EOF, err == io.ErrUnexpectedEOF:
+		return fmt.Errorf("%w: %v", ErrTruncated, err)
+	}
+	return fmt.Errorf("decode failure: %v", err)
+}
+
+// Write encodes the image to w, in the selected Output format using the
+// selected options, along with the metadata given. If the Output is SAME the
+// format recorded in meta is used. When writing a GIF any animation in meta is
+// written, instead of img.
+func Write(w io.Writer, img image.Image, meta Meta) error {
+	var buf bytes.Buffer
+	var err error
+
+	format := outputFor(meta)
+	switch format {
+	case JPEG:
+		err = jpeg.Encode(&buf, img, &jpeg.Options{Quality: Quality})
+	case PNG:
+		encoder := png.Encoder{CompressionLevel: pngCompressions[PNGCompression]}
+		err = encoder.Encode(&buf, img)
+	case TIFF:
+		err = tiff.Encode(&buf, img, &tiff.Options{
+			Compression: tiffCompressions[TIFFCompression],
+		})
+	case GIF:
+		if meta.Animation != nil {
+			err = gif.EncodeAll(&buf, meta.Animation)
+			break
+		}
+		err = gif.Encode(&buf, img, &gif.Options{
+			NumColors: 256,
+			Quantizer: quantizer(Palette),
+			Drawer:    draw.FloydSteinberg,
+		})
+	case BMP:
+		err = bmp.Encode(&buf, img)
+	case WEBP:
+		err = webp.Encode(&buf, img)
+	default:
+		err = fmt.Errorf("unknown output %q", Output)
+	}
+
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrEncode, err)
+	}
+
+	data := meta.Exif
+	if data == nil {
+		data = exif.New()
+	}
+
+	var withExif bytes.Buffer
+	if err = data.Embed(&withExif, &buf); err != nil {
+		return fmt.Errorf("%w: %v", ErrEncode, err)
+	}
+
+	if err = icc.Embed(w, &withExif, profileFor(img, format, meta.ICC)); err != nil {
+		return fmt.Errorf("%w: %v", ErrEncode, err)
+	}
+
+	return nil
+}
+
+// outputFor returns the format to write an image with the metadata given in.
+func outputFor(meta Meta) output {
+	if Output != SAME {
+		return Output
+	}
+
+	switch format := output(meta.Format); format {
+	case PNG, JPEG, TIFF, GIF, BMP, WEBP:
+		return format
+	}
+	return PNG
+}
+
+// profileFor returns p if it describes the colour space that img is written in
+// for the format given, otherwise nil. For example a CMYK profile read from a
+// JPEG no longer describes the image once it is written as RGB.
+func profileFor(img image.Image, format output, p *icc.Profile) *icc.Profile {
+	if p == nil {
+		return nil
+	}
+
+	// Only PNG and JPEG can hold a profile. Both write gray images as gray,
+	// except that JPEG has no 16-bit gray.
+	space := "RGB"
+	switch img.(type) {
+	case *image.Gray:
+		space = "GRAY"
+	case *image.Gray16:
+		if format == PNG {
+			space = "GRAY"
+		}
+	}
+
+	if p.ColorSpace() != space {
+		return nil
+	}
+	return p
+}
+
+// OutputFormat returns the name of the format, for example "png", that Write
+// uses for an image with the metadata given.
+func OutputFormat(meta Meta) string {
+	return string(outputFor(meta))
+}
+
+// quantizer returns the Quantizer to use for the palette given, nil means the
+// gif package's default of Plan 9.
+func quantizer(p palette) draw.Quantizer {
+	switch p {
+	case MEDIAN:
+		return quantize.MedianCut{}
+	case WEBSAFE:
+		return quantize.Fixed(colorpalette.WebSafe)
+	}
+	return nil
+}
+
+// Fatal prints the error to standard error, then exits with a code depending on
+// the type of error.
+func Fatal(err error) {
+	Warn("img:", err)
+
+	switch {
+	case errors.Is(err, ErrUnsupportedFormat):
+		os.Exit(ExitUnsupportedFormat)
+	case errors.Is(err, ErrTruncated):
+		os.Exit(ExitTruncated)
+	case errors.Is(err, ErrEncode):
+		os.Exit(ExitEncode)
+	}
+
+	os.Exit(1)
+}
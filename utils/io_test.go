@@ -0,0 +1,72 @@
+package utils
+
+import (
+	"bytes"
+	"image"
+	"testing"
+
+	"hawx.me/code/img/icc"
+)
+
+// testProfile returns a profile, with no tags, for the colour space given.
+func testProfile(t *testing.T, space string) *icc.Profile {
+	data := make([]byte, 132)
+	data[3] = 132
+	copy(data[16:20], space+"    ")
+	copy(data[20:24], "XYZ ")
+	copy(data[36:40], "acsp")
+
+	p, err := icc.Parse(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return p
+}
+
+func TestWriteProfile(t *testing.T) {
+	rgba := image.NewRGBA(image.Rect(0, 0, 4, 4))
+	gray := image.NewGray(image.Rect(0, 0, 4, 4))
+	gray16 := image.NewGray16(image.Rect(0, 0, 4, 4))
+
+	testCases := []struct {
+		name     string
+		format   output
+		img      image.Image
+		space    string
+		embedded bool
+	}{
+		{"rgb png", PNG, rgba, "RGB", true},
+		{"rgb jpeg", JPEG, rgba, "RGB", true},
+		{"cmyk png", PNG, rgba, "CMYK", false},
+		{"cmyk jpeg", JPEG, rgba, "CMYK", false},
+		{"gray profile for rgb", PNG, rgba, "GRAY", false},
+		{"gray png", PNG, gray, "GRAY", true},
+		{"gray jpeg", JPEG, gray, "GRAY", true},
+		{"rgb profile for gray", JPEG, gray, "RGB", false},
+		{"gray16 png", PNG, gray16, "GRAY", true},
+		{"gray16 jpeg", JPEG, gray16, "GRAY", false},
+		{"rgb profile for gray16 jpeg", JPEG, gray16, "RGB", true},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			withOptions(t, tc.format, 75)
+
+			var buf bytes.Buffer
+			if err := Write(&buf, tc.img, Meta{ICC: testProfile(t, tc.space)}); err != nil {
+				t.Fatal(err)
+			}
+
+			p, err := icc.Decode(&buf)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if tc.embedded && (p == nil || p.ColorSpace() != tc.space) {
+				t.Errorf("expected %s profile to be embedded, got %v", tc.space, p)
+			}
+			if !tc.embedded && p != nil {
+				t.Errorf("expected no profile, got %s", p.ColorSpace())
+			}
+		})
+	}
+}
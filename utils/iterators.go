@@ -5,13 +5,64 @@ import (
 	"image/color"
 	"image/draw"
 	"runtime"
+	"sync"
 )
 
+// Parallel calls f for each of 0 to n-1, splitting them between the available
+// CPUs, and returns once all have finished. If any call panics the panic is
+// raised again in the calling goroutine, so that it can be recovered there.
+func Parallel(n int, f func(i int)) {
+	parts := runtime.NumCPU()
+	if parts > n {
+		parts = n
+	}
+
+	var (
+		wg       sync.WaitGroup
+		once     sync.Once
+		panicked interface{}
+	)
+
+	for p := 0; p < parts; p++ {
+		wg.Add(1)
+		go func(from, to int) {
+			defer wg.Done()
+			defer func() {
+				if r := recover(); r != nil {
+					once.Do(func() { panicked = r })
+				}
+			}()
+
+			for i := from; i < to; i++ {
+				f(i)
+			}
+		}(p*n/parts, (p+1)*n/parts)
+	}
+
+	wg.Wait()
+	if panicked != nil {
+		panic(panicked)
+	}
+}
+
+// splitRectangle splits b into at most the number of parts given, the
+// Rectangles returned are within b even if it does not start at the origin.
 func splitRectangle(b image.Rectangle, parts int) []image.Rectangle {
+	if b.Empty() {
+		return nil
+	}
+
+	var rs []image.Rectangle
 	if b.Dx() > b.Dy() {
-		return ChopRectangle(b, parts, 1, ADD)
+		rs = ChopRectangle(b, int(Min(uint32(parts), uint32(b.Dy()))), 1, ADD)
+	} else {
+		rs = ChopRectangle(b, 1, int(Min(uint32(parts), uint32(b.Dx()))), ADD)
+	}
+
+	for i := range rs {
+		rs[i] = rs[i].Add(b.Min)
 	}
-	return ChopRectangle(b, 1, parts, ADD)
+	return rs
 }
 
 // EachColor iterates through each pixel of the Image, applying the function
@@ -29,25 +80,10 @@ func EachColor(img image.Image, f func(c color.Color)) {
 // PEachColor is like EachColor, but runs in parallel. This means that order can
 // not be guaranteed.
 func PEachColor(img image.Image, f func(c color.Color)) {
-	nCPU := runtime.NumCPU()
-	runtime.GOMAXPROCS(nCPU)
-
-	c := make(chan int, nCPU)
-
-	for _, r := range splitRectangle(img.Bounds(), nCPU) {
-		go peachColorWorker(img, r, f, c)
-	}
-
-	// wait until work is done
-	for i := 0; i < nCPU; i++ {
-		<-c
-	}
-}
-
-func peachColorWorker(img image.Image, b image.Rectangle, f func(c color.Color), c chan int) {
-
-	EachColorInRectangle(img, b, f)
-	c <- 1
+	rs := splitRectangle(img.Bounds(), runtime.NumCPU())
+	Parallel(len(rs), func(i int) {
+		EachColorInRectangle(img, rs[i], f)
+	})
 }
 
 // EachColorInRectangle is a helper function for working on a part of an image.
@@ -61,33 +97,18 @@ func EachColorInRectangle(img image.Image, b image.Rectangle, f func(c color.Col
 
 // MapColor iterates through each pixel of the Image and applies the given
 // function, drawing the returned colour to a new Image which is then returned.
+// The new Image has 16 bits per channel if img does, see NewImageFor.
 func MapColor(img image.Image, f Composable) image.Image {
-	// Use maximum number of CPUs available
-	nCPU := runtime.NumCPU()
-	runtime.GOMAXPROCS(nCPU)
+	o := NewImageFor(img, img.Bounds())
 
-	c := make(chan int, nCPU)
-	o := image.NewRGBA(img.Bounds())
-
-	for _, r := range splitRectangle(img.Bounds(), nCPU) {
-		go mapColorWorker(img, r, o, f, c)
-	}
-
-	// wait until work is done
-	for i := 0; i < nCPU; i++ {
-		<-c
-	}
+	rs := splitRectangle(img.Bounds(), runtime.NumCPU())
+	Parallel(len(rs), func(i int) {
+		MapColorInRectangle(img, rs[i], o, f)
+	})
 
 	return o
 }
 
-func mapColorWorker(img image.Image, bounds image.Rectangle, dest draw.Image,
-	f Composable, c chan int) {
-
-	MapColorInRectangle(img, bounds, dest, f)
-	c <- 1
-}
-
 // MapColorInRectangle is a helper function for working on part of an image. It
 // takes the original image, a function to use, a image to write to, and the
 // bounds of the original (and therefore the final image) to act upon.
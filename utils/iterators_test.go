@@ -0,0 +1,29 @@
+package utils
+
+import "testing"
+
+func TestParallel(t *testing.T) {
+	var seen [100]int32
+	Parallel(len(seen), func(i int) { seen[i]++ })
+
+	for i, n := range seen {
+		if n != 1 {
+			t.Errorf("expected %d to be called once, got %d", i, n)
+		}
+	}
+}
+
+func TestParallelPanic(t *testing.T) {
+	defer func() {
+		if r := recover(); r != "stop" {
+			t.Errorf("expected panic to be raised again, got %v", r)
+		}
+	}()
+
+	Parallel(10, func(i int) {
+		if i == 7 {
+			panic("stop")
+		}
+	})
+	t.Error("expected panic")
+}
@@ -0,0 +1,220 @@
+package utils
+
+import (
+	"image"
+	"image/color"
+	"math"
+	"runtime"
+	"sync"
+)
+
+// LinearColor is a colour in linear light, with premultiplied alpha. Each
+// channel has a value from 0 to 1.
+type LinearColor struct {
+	R, G, B, A float32
+}
+
+// RGBA returns the colour encoded as sRGB, as is expected of a color.Color.
+func (c LinearColor) RGBA() (r, g, b, a uint32) {
+	if c.A <= 0 {
+		return 0, 0, 0, 0
+	}
+
+	alpha := float64(c.A)
+	r = Ratio16(encodeSRGB(float64(c.R)/alpha) * alpha)
+	g = Ratio16(encodeSRGB(float64(c.G)/alpha) * alpha)
+	b = Ratio16(encodeSRGB(float64(c.B)/alpha) * alpha)
+	a = Ratio16(alpha)
+	return
+}
+
+// LinearModel converts any Color to a LinearColor.
+var LinearModel color.Model = color.ModelFunc(linearModel)
+
+func linearModel(c color.Color) color.Color {
+	if _, ok := c.(LinearColor); ok {
+		return c
+	}
+	return toLinearColor(c)
+}
+
+func toLinearColor(c color.Color) LinearColor {
+	r, g, b, a := c.RGBA()
+	if a == 0 {
+		return LinearColor{}
+	}
+
+	table := decodeTable()
+	alpha := float32(a) / 0xffff
+
+	// Find the non-premultiplied value, decode that, then premultiply again. A
+	// channel can only be larger than alpha in an invalid colour, but one is
+	// treated as fully on rather than reading past the table.
+	unmultiply := func(v uint32) float32 {
+		if v > a {
+			v = a
+		}
+		return table[v*0xffff/a] * alpha
+	}
+
+	return LinearColor{unmultiply(r), unmultiply(g), unmultiply(b), alpha}
+}
+
+var (
+	decodeOnce sync.Once
+	decoded    []float32
+)
+
+// decodeTable returns a table of the linear value for each 16-bit sRGB value.
+func decodeTable() []float32 {
+	decodeOnce.Do(func() {
+		decoded = make([]float32, 0x10000)
+		for i := range decoded {
+			decoded[i] = float32(decodeSRGB(float64(i) / 0xffff))
+		}
+	})
+	return decoded
+}
+
+func decodeSRGB(v float64) float64 {
+	if v <= 0.04045 {
+		return v / 12.92
+	}
+	return math.Pow((v+0.055)/1.055, 2.4)
+}
+
+func encodeSRGB(v float64) float64 {
+	if v <= 0.0031308 {
+		return v * 12.92
+	}
+	return 1.055*math.Pow(v, 1/2.4) - 0.055
+}
+
+// Linear is an in-memory image of LinearColors. Arithmetic on the values, for
+// example averaging them to blur the image, is physically correct unlike
+// arithmetic on the gamma-encoded values of other images.
+type Linear struct {
+	// Pix holds the image's channels, in R, G, B, A order. The pixel at (x, y)
+	// starts at Pix[(y-Rect.Min.Y)*Stride + (x-Rect.Min.X)*4].
+	Pix []float32
+	// Stride is the Pix stride between vertically adjacent pixels.
+	Stride int
+	// Rect is the image's bounds.
+	Rect image.Rectangle
+}
+
+// NewLinear returns a new Linear image with the bounds given.
+func NewLinear(r image.Rectangle) *Linear {
+	return &Linear{
+		Pix:    make([]float32, 4*r.Dx()*r.Dy()),
+		Stride: 4 * r.Dx(),
+		Rect:   r,
+	}
+}
+
+func (p *Linear) ColorModel() color.Model { return LinearModel }
+
+func (p *Linear) Bounds() image.Rectangle { return p.Rect }
+
+func (p *Linear) At(x, y int) color.Color {
+	return p.LinearAt(x, y)
+}
+
+// LinearAt returns the colour of the pixel at (x, y).
+func (p *Linear) LinearAt(x, y int) LinearColor {
+	if !(image.Point{x, y}.In(p.Rect)) {
+		return LinearColor{}
+	}
+	i := p.PixOffset(x, y)
+	s := p.Pix[i : i+4 : i+4]
+	return LinearColor{s[0], s[1], s[2], s[3]}
+}
+
+// PixOffset returns the index of the first element of Pix that corresponds to
+// the pixel at (x, y).
+func (p *Linear) PixOffset(x, y int) int {
+	return (y-p.Rect.Min.Y)*p.Stride + (x-p.Rect.Min.X)*4
+}
+
+func (p *Linear) Set(x, y int, c color.Color) {
+	p.SetLinear(x, y, toLinearColor(c))
+}
+
+// SetLinear sets the colour of the pixel at (x, y).
+func (p *Linear) SetLinear(x, y int, c LinearColor) {
+	if !(image.Point{x, y}.In(p.Rect)) {
+		return
+	}
+	i := p.PixOffset(x, y)
+	s := p.Pix[i : i+4 : i+4]
+	s[0], s[1], s[2], s[3] = c.R, c.G, c.B, c.A
+}
+
+// eachRectangle calls f for parts of the bounds given in parallel, returning
+// once all have finished.
+func eachRectangle(bounds image.Rectangle, f func(image.Rectangle)) {
+	rs := splitRectangle(bounds, runtime.NumCPU())
+	Parallel(len(rs), func(i int) {
+		f(rs[i])
+	})
+}
+
+// ToLinear converts the Image to a Linear image. If img is already Linear it is
+// returned unchanged.
+func ToLinear(img image.Image) *Linear {
+	if l, ok := img.(*Linear); ok {
+		return l
+	}
+
+	out := NewLinear(img.Bounds())
+	eachRectangle(img.Bounds(), func(r image.Rectangle) {
+		for y := r.Min.Y; y < r.Max.Y; y++ {
+			for x := r.Min.X; x < r.Max.X; x++ {
+				out.SetLinear(x, y, toLinearColor(img.At(x, y)))
+			}
+		}
+	})
+
+	return out
+}
+
+// FromLinear converts the Linear image back to sRGB, with the same depth as
+// like; see NewImageFor.
+func FromLinear(img *Linear, like image.Image) image.Image {
+	out := NewImageFor(like, img.Bounds())
+	eachRectangle(img.Bounds(), func(r image.Rectangle) {
+		for y := r.Min.Y; y < r.Max.Y; y++ {
+			for x := r.Min.X; x < r.Max.X; x++ {
+				out.Set(x, y, img.LinearAt(x, y))
+			}
+		}
+	})
+
+	return out
+}
+
+// MapLinear is like MapColor but for Linear images, it applies the function to
+// each pixel returning a new Linear image.
+func MapLinear(img *Linear, f func(LinearColor) LinearColor) *Linear {
+	out := NewLinear(img.Bounds())
+	eachRectangle(img.Bounds(), func(r image.Rectangle) {
+		for y := r.Min.Y; y < r.Max.Y; y++ {
+			for x := r.Min.X; x < r.Max.X; x++ {
+				out.SetLinear(x, y, f(img.LinearAt(x, y)))
+			}
+		}
+	})
+
+	return out
+}
+
+// WithLinear converts img to a Linear image, passes it to f, then converts the
+// result back. Functions that support Linear images, such as blur.Convolve,
+// will then work in linear light.
+func WithLinear(img image.Image, f func(image.Image) image.Image) image.Image {
+	out := f(ToLinear(img))
+	if l, ok := out.(*Linear); ok {
+		return FromLinear(l, img)
+	}
+	return out
+}
@@ -0,0 +1,66 @@
+package utils
+
+import (
+	"image"
+	"image/color"
+	"testing"
+)
+
+func TestToLinearColorAboveAlpha(t *testing.T) {
+	// Not valid premultiplied colours, but ones that can be made by clamping
+	// each channel on its own.
+	for _, c := range []color.RGBA{
+		{255, 0, 0, 128},
+		{200, 255, 10, 1},
+		{255, 255, 255, 254},
+	} {
+		l := toLinearColor(c)
+		a := float32(c.A) / 0xff
+
+		if l.A != a {
+			t.Errorf("%v: expected alpha %v, got %v", c, a, l.A)
+		}
+		for _, v := range []float32{l.R, l.G, l.B} {
+			if v < 0 || v > l.A {
+				t.Errorf("%v: expected channels from 0 to alpha, got %v", c, l)
+			}
+		}
+	}
+}
+
+func TestToLinearAboveAlpha(t *testing.T) {
+	img := image.NewRGBA(image.Rect(0, 0, 4, 4))
+	for i := range img.Pix {
+		img.Pix[i] = 200
+		if i%4 == 3 {
+			img.Pix[i] = 100
+		}
+	}
+
+	l := ToLinear(img)
+	if c := l.LinearAt(1, 1); c.R != c.A || c.G != c.A || c.B != c.A {
+		t.Errorf("expected channels to be clamped to alpha, got %v", c)
+	}
+}
+
+func TestLinearRoundTrip(t *testing.T) {
+	img := image.NewNRGBA(image.Rect(2, 3, 10, 9))
+	for y := 3; y < 9; y++ {
+		for x := 2; x < 10; x++ {
+			img.SetNRGBA(x, y, color.NRGBA{uint8(x * 25), uint8(y * 28), 90, uint8(40 + x*20)})
+		}
+	}
+
+	out := FromLinear(ToLinear(img), img)
+	for y := 3; y < 9; y++ {
+		for x := 2; x < 10; x++ {
+			want := color.RGBAModel.Convert(img.At(x, y)).(color.RGBA)
+			got := color.RGBAModel.Convert(out.At(x, y)).(color.RGBA)
+			for i, v := range [][2]uint8{{got.R, want.R}, {got.G, want.G}, {got.B, want.B}, {got.A, want.A}} {
+				if d := int(v[0]) - int(v[1]); d < -1 || d > 1 {
+					t.Fatalf("at (%d, %d) channel %d: expected %v, got %v", x, y, i, want, got)
+				}
+			}
+		}
+	}
+}
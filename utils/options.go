@@ -0,0 +1,130 @@
+package utils
+
+import (
+	"fmt"
+	"image/jpeg"
+	"image/png"
+	"net/url"
+	"strconv"
+
+	"hawx.me/code/img/tiff"
+)
+
+// A compression names the type, or level, of compression used when writing PNG
+// or TIFF output.
+type compression string
+
+// Compressions for PNG output are DEFAULT, BEST, FAST and NONE. Compressions
+// for TIFF output are NONE, DEFLATE and LZW.
+const (
+	DEFAULT compression = "default"
+	BEST                = "best"
+	FAST                = "fast"
+	NONE                = "none"
+	DEFLATE             = "deflate"
+	LZW                 = "lzw"
+)
+
+var pngCompressions = map[compression]png.CompressionLevel{
+	DEFAULT: png.DefaultCompression,
+	BEST:    png.BestCompression,
+	FAST:    png.BestSpeed,
+	NONE:    png.NoCompression,
+}
+
+var tiffCompressions = map[compression]tiff.Compression{
+	NONE:    tiff.Uncompressed,
+	DEFLATE: tiff.Deflate,
+	LZW:     tiff.LZW,
+}
+
+// Options used when encoding the output. Like Output they shouldn't be modified
+// by anything other than GetOutput, or SetOption.
+var (
+	// Quality is used for JPEG output, and ranges from 1 to 100.
+	Quality = jpeg.DefaultQuality
+
+	// PNGCompression is the compression level used for PNG output.
+	PNGCompression = DEFAULT
+
+	// TIFFCompression is the type of compression used for TIFF output.
+	TIFFCompression compression = NONE
+)
+
+// SetOption sets the named encoding option, one of "quality",
+// "png-compression", "tiff-compression" or "palette", to the value given. An
+// error is returned if the name or value is not valid.
+func SetOption(name, value string) error {
+	switch name {
+	case "quality":
+		n, err := strconv.Atoi(value)
+		if err != nil || n < 1 || n > 100 {
+			return fmt.Errorf("quality must be between 1 and 100, got %q", value)
+		}
+		Quality = n
+
+	case "png-compression":
+		if _, ok := pngCompressions[compression(value)]; !ok {
+			return fmt.Errorf("png-compression must be one of 'default', 'best', 'fast' or 'none', got %q", value)
+		}
+		PNGCompression = compression(value)
+
+	case "tiff-compression":
+		if _, ok := tiffCompressions[compression(value)]; !ok {
+			return fmt.Errorf("tiff-compression must be one of 'none', 'deflate' or 'lzw', got %q", value)
+		}
+		TIFFCompression = compression(value)
+
+	case "palette":
+		switch palette(value) {
+		case MEDIAN, PLAN9, WEBSAFE:
+			Palette = palette(value)
+		default:
+			return fmt.Errorf("palette must be one of 'median', 'plan9' or 'websafe', got %q", value)
+		}
+
+	default:
+		return fmt.Errorf("unknown option %q", name)
+	}
+
+	return nil
+}
+
+// OutputArg returns the argument that GetOutput expects. This is the name of the
+// Output format, followed by any options that are not their default value in
+// the form of a URL query, for example
+//
+//	jpeg?quality=60
+func OutputArg() string {
+	query := url.Values{}
+
+	if Quality != jpeg.DefaultQuality {
+		query.Set("quality", strconv.Itoa(Quality))
+	}
+	if PNGCompression != DEFAULT {
+		query.Set("png-compression", string(PNGCompression))
+	}
+	if TIFFCompression != NONE {
+		query.Set("tiff-compression", string(TIFFCompression))
+	}
+	if Palette != MEDIAN {
+		query.Set("palette", string(Palette))
+	}
+
+	if len(query) == 0 {
+		return string(Output)
+	}
+	return string(Output) + "?" + query.Encode()
+}
+
+// LegacyOutputArg returns the argument that GetOutput expects in commands built
+// with an older version of this package, which only understand a bare png, jpeg
+// or tiff. Any other Output, including SAME, is given as png, and the options
+// are left out.
+func LegacyOutputArg() string {
+	switch Output {
+	case PNG, JPEG, TIFF:
+		return string(Output)
+	}
+	return string(PNG)
+}
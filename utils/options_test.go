@@ -0,0 +1,67 @@
+package utils
+
+import "testing"
+
+// withOptions sets the output options for the length of the test.
+func withOptions(t *testing.T, format output, quality int) {
+	oldOutput, oldQuality := Output, Quality
+	t.Cleanup(func() { Output, Quality = oldOutput, oldQuality })
+
+	Output, Quality = format, quality
+}
+
+func TestOutputArg(t *testing.T) {
+	testCases := []struct {
+		format  output
+		quality int
+		arg     string
+	}{
+		{SAME, 75, "same"},
+		{PNG, 75, "png"},
+		{GIF, 75, "gif"},
+		{JPEG, 60, "jpeg?quality=60"},
+	}
+
+	for _, tc := range testCases {
+		withOptions(t, tc.format, tc.quality)
+		if arg := OutputArg(); arg != tc.arg {
+			t.Errorf("expected %q, got %q", tc.arg, arg)
+		}
+	}
+}
+
+func TestLegacyOutputArg(t *testing.T) {
+	testCases := []struct {
+		format  output
+		quality int
+		arg     string
+	}{
+		{SAME, 75, "png"},
+		{PNG, 75, "png"},
+		{JPEG, 75, "jpeg"},
+		{JPEG, 60, "jpeg"},
+		{TIFF, 75, "tiff"},
+		{GIF, 75, "png"},
+		{BMP, 75, "png"},
+		{WEBP, 75, "png"},
+	}
+
+	for _, tc := range testCases {
+		withOptions(t, tc.format, tc.quality)
+		if arg := LegacyOutputArg(); arg != tc.arg {
+			t.Errorf("%s: expected %q, got %q", tc.format, tc.arg, arg)
+		}
+	}
+}
+
+func TestGetOutput(t *testing.T) {
+	withOptions(t, SAME, 75)
+
+	args := GetOutput([]string{"img-test", "jpeg?quality=40", "--flag"})
+	if len(args) != 2 || args[0] != "img-test" || args[1] != "--flag" {
+		t.Errorf("expected output argument to be removed, got %v", args)
+	}
+	if Output != JPEG || Quality != 40 {
+		t.Errorf("expected jpeg with quality 40, got %s with %d", Output, Quality)
+	}
+}
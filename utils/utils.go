@@ -6,16 +6,9 @@ import (
 	"flag"
 	"fmt"
 	"image"
-	_ "image/gif"
-	"image/jpeg"
-	"image/png"
-	"io"
-	"io/ioutil"
-	"log"
+	"net/url"
 	"os"
-
-	"golang.org/x/image/tiff"
-	"hawx.me/code/img/exif"
+	"strings"
 )
 
 // This is a string, and not an int of some kind, so that it is easy to find out
@@ -23,86 +16,78 @@ import (
 // names. Easy.
 type output string
 
-// Formats that can be created by img.
+// Formats that can be created by img. SAME is not a format, instead it selects
+// the format of the input image, or PNG if that format cannot be written.
 const (
-	PNG  output = "png"
+	SAME output = "same"
+	PNG         = "png"
 	JPEG        = "jpeg"
 	TIFF        = "tiff"
+	GIF         = "gif"
+	BMP         = "bmp"
+	WEBP        = "webp"
 )
 
 // Output is the currently selected output type, and shouldn't be modified by
 // anything other than GetOutput.
-var Output = PNG
+var Output = SAME
+
+// A palette names a method of choosing the colours to use when writing GIF
+// output.
+type palette string
 
-// GetOutput takes the os.Args array as input, uses it to set the output format,
-// then returns the new os.Args array.
+// Palettes that can be used for GIF output. MEDIAN chooses colours to suit the
+// image, whilst PLAN9 and WEBSAFE use fixed palettes.
+const (
+	MEDIAN  palette = "median"
+	PLAN9           = "plan9"
+	WEBSAFE         = "websafe"
+)
+
+// Palette is the currently selected palette for GIF output.
+var Palette = MEDIAN
+
+// GetOutput takes the os.Args array as input, uses it to set the output format
+// and encoding options, then returns the new os.Args array.
 //
 //   os.Args = utils.GetOutput(os.Args)
 //   flag.Parse()
 //
+// The argument is created by OutputArg, invalid options are warned about and
+// then ignored.
 func GetOutput(args []string) []string {
-	Output = output(args[1])
-	return append(args[:1], args[2:]...)
-}
-
-// ReadStdin reads an image file (either PNG, JPEG or GIF) from standard input.
-func ReadStdin() (image.Image, *exif.Exif) {
-	img, _, _ := image.Decode(os.Stdin)
-	os.Stdin.Seek(0, 0)
-	data := exif.Decode(os.Stdin)
-	return img, data
-}
+	parts := strings.SplitN(args[1], "?", 2)
+	Output = output(parts[0])
 
-// WriteStdout writes an Image to standard output as a PNG file.
-func WriteStdout(img image.Image, data *exif.Exif) {
-	switch Output {
-	case JPEG:
-		// Create a temporary file for exiftool to use
-		tmp, _ := ioutil.TempFile("", "img-utils-exif-")
-		path := tmp.Name()
-
-		// Encode the jpeg to this temp file
-		err := jpeg.Encode(tmp, img, nil)
+	if len(parts) == 2 {
+		query, err := url.ParseQuery(parts[1])
 		if err != nil {
-			log.Fatal(err)
-			return
+			Warn("img:", err)
 		}
 
-		// Write the exif data to the temp file
-		err = data.Write(path)
-		if err != nil {
-			// // This will generally return an error, and it still works, so can
-			// // probably be ignored.
-			// log.Println(err)
+		for name, values := range query {
+			for _, value := range values {
+				if err := SetOption(name, value); err != nil {
+					Warn("img:", err)
+				}
+			}
 		}
+	}
 
-		// Reopen the temp file. Yes, really. This is due to the fact that, even if
-		// I seek to 0, problems still occur. So this works, I'm leaving it.
-		f, err := os.Open(path)
-		if err != nil {
-			log.Fatal(err)
-			return
-		}
-
-		io.Copy(os.Stdout, f)
-
-		// Make sure the temp file is deleted after
-		defer func() { os.Remove(path) }()
+	return append(args[:1], args[2:]...)
+}
 
-	case PNG:
-		err := png.Encode(os.Stdout, img)
-		if err != nil {
-			log.Fatal(err)
-			return
-		}
+// ReadStdin reads an image file (either PNG, JPEG, GIF, TIFF, BMP or WebP) from
+// standard input.
+func ReadStdin() (image.Image, Meta, error) {
+	return Read(os.Stdin)
+}
 
-	case TIFF:
-		err := tiff.Encode(os.Stdout, img, nil)
-		if err != nil {
-			log.Fatal(err)
-			return
-		}
-	}
+// WriteStdout writes an Image to standard output, in the selected Output
+// format, along with the metadata given. If the Output is SAME the format is
+// taken from the metadata.
+func WriteStdout(img image.Image, meta Meta) error {
+	return Write(os.Stdout, img, meta)
 }
 
 // Warn prints a message to standard error
@@ -0,0 +1,266 @@
+package webp
+
+import "container/heap"
+
+// A bitWriter writes values least-significant bit first, as required by VP8L.
+type bitWriter struct {
+	buf   []byte
+	acc   uint64
+	nbits uint
+}
+
+func (w *bitWriter) write(value uint32, n uint) {
+	w.acc |= uint64(value) << w.nbits
+	w.nbits += n
+	for w.nbits >= 8 {
+		w.buf = append(w.buf, byte(w.acc))
+		w.acc >>= 8
+		w.nbits -= 8
+	}
+}
+
+func (w *bitWriter) bytes() []byte {
+	if w.nbits > 0 {
+		w.buf = append(w.buf, byte(w.acc))
+		w.acc = 0
+		w.nbits = 0
+	}
+	return w.buf
+}
+
+// A prefixCode is a canonical Huffman code. The codes are stored with their
+// bits reversed so that they can be written directly by a bitWriter.
+type prefixCode struct {
+	lengths []uint8
+	codes   []uint32
+}
+
+func (p prefixCode) write(w *bitWriter, symbol int) {
+	w.write(p.codes[symbol], uint(p.lengths[symbol]))
+}
+
+type node struct {
+	count       int
+	symbol      int
+	left, right *node
+}
+
+type nodeHeap []*node
+
+func (h nodeHeap) Len() int { return len(h) }
+func (h nodeHeap) Less(i, j int) bool {
+	if h[i].count == h[j].count {
+		return h[i].symbol < h[j].symbol
+	}
+	return h[i].count < h[j].count
+}
+func (h nodeHeap) Swap(i, j int)       { h[i], h[j] = h[j], h[i] }
+func (h *nodeHeap) Push(x interface{}) { *h = append(*h, x.(*node)) }
+func (h *nodeHeap) Pop() interface{} {
+	old := *h
+	n := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return n
+}
+
+// codeLengths calculates the length of the code for each symbol from their
+// counts, no length will be greater than limit. At least two symbols are always
+// given a code, so that the code is a complete tree.
+func codeLengths(counts []int, limit uint8) []uint8 {
+	counts = append([]int{}, counts...)
+
+	used := 0
+	for _, c := range counts {
+		if c > 0 {
+			used++
+		}
+	}
+	for i := 0; used < 2 && i < len(counts); i++ {
+		if counts[i] == 0 {
+			counts[i] = 1
+			used++
+		}
+	}
+
+	for {
+		lengths := make([]uint8, len(counts))
+		h := nodeHeap{}
+		for i, c := range counts {
+			if c > 0 {
+				h = append(h, &node{count: c, symbol: i})
+			}
+		}
+		heap.Init(&h)
+
+		for h.Len() > 1 {
+			a := heap.Pop(&h).(*node)
+			b := heap.Pop(&h).(*node)
+			heap.Push(&h, &node{count: a.count + b.count, symbol: a.symbol, left: a, right: b})
+		}
+
+		max := uint8(0)
+		var walk func(n *node, depth uint8)
+		walk = func(n *node, depth uint8) {
+			if n.left == nil {
+				lengths[n.symbol] = depth
+				if depth > max {
+					max = depth
+				}
+				return
+			}
+			walk(n.left, depth+1)
+			walk(n.right, depth+1)
+		}
+		walk(h[0], 0)
+
+		if max <= limit {
+			return lengths
+		}
+
+		// Flatten the distribution and try again, this converges on a balanced
+		// tree.
+		for i, c := range counts {
+			if c > 0 {
+				counts[i] = (c + 1) / 2
+			}
+		}
+	}
+}
+
+// newPrefixCode assigns canonical codes to the lengths given.
+func newPrefixCode(lengths []uint8) prefixCode {
+	var count [16]uint32
+	for _, l := range lengths {
+		count[l]++
+	}
+	count[0] = 0
+
+	var next [16]uint32
+	code := uint32(0)
+	for bits := 1; bits < 16; bits++ {
+		code = (code + count[bits-1]) << 1
+		next[bits] = code
+	}
+
+	codes := make([]uint32, len(lengths))
+	for i, l := range lengths {
+		if l == 0 {
+			continue
+		}
+		codes[i] = reverse(next[l], l)
+		next[l]++
+	}
+
+	return prefixCode{lengths, codes}
+}
+
+func reverse(code uint32, n uint8) uint32 {
+	r := uint32(0)
+	for i := uint8(0); i < n; i++ {
+		r = (r << 1) | (code & 1)
+		code >>= 1
+	}
+	return r
+}
+
+// The order in which code length code lengths are written.
+var codeLengthOrder = [19]int{17, 18, 0, 1, 2, 3, 4, 5, 16, 6, 7, 8, 9, 10, 11, 12, 13, 14, 15}
+
+// writePrefixCode chooses a code for symbols with the counts given, writes it
+// to w and returns it.
+func writePrefixCode(w *bitWriter, counts []int) prefixCode {
+	symbols := []int{}
+	for i, c := range counts {
+		if c > 0 {
+			symbols = append(symbols, i)
+		}
+	}
+
+	// A simple code can be used when there are only one or two symbols, and
+	// they are small enough.
+	if len(symbols) <= 2 && (len(symbols) == 0 || symbols[len(symbols)-1] < 256) {
+		lengths := make([]uint8, len(counts))
+		if len(symbols) == 0 {
+			symbols = []int{0}
+		}
+
+		w.write(1, 1)
+		w.write(uint32(len(symbols)-1), 1)
+		if symbols[0] < 2 {
+			w.write(0, 1)
+			w.write(uint32(symbols[0]), 1)
+		} else {
+			w.write(1, 1)
+			w.write(uint32(symbols[0]), 8)
+		}
+		if len(symbols) == 2 {
+			w.write(uint32(symbols[1]), 8)
+			lengths[symbols[0]] = 1
+			lengths[symbols[1]] = 1
+		}
+
+		return newPrefixCode(lengths)
+	}
+
+	lengths := codeLengths(counts, 15)
+	code := newPrefixCode(lengths)
+
+	// Lengths are written as literal values (0-15), with runs of zeros written
+	// using symbols 17 and 18.
+	type token struct{ symbol, extra, extraBits int }
+	tokens := []token{}
+
+	for i := 0; i < len(lengths); {
+		if lengths[i] != 0 {
+			tokens = append(tokens, token{int(lengths[i]), 0, 0})
+			i++
+			continue
+		}
+
+		run := 0
+		for i+run < len(lengths) && lengths[i+run] == 0 && run < 138 {
+			run++
+		}
+
+		switch {
+		case run < 3:
+			for j := 0; j < run; j++ {
+				tokens = append(tokens, token{0, 0, 0})
+			}
+		case run <= 10:
+			tokens = append(tokens, token{17, run - 3, 3})
+		default:
+			tokens = append(tokens, token{18, run - 11, 7})
+		}
+		i += run
+	}
+
+	lengthCounts := make([]int, 19)
+	for _, t := range tokens {
+		lengthCounts[t.symbol]++
+	}
+	lengthCode := newPrefixCode(codeLengths(lengthCounts, 7))
+
+	n := 19
+	for n > 4 && lengthCode.lengths[codeLengthOrder[n-1]] == 0 {
+		n--
+	}
+
+	w.write(0, 1)
+	w.write(uint32(n-4), 4)
+	for _, s := range codeLengthOrder[:n] {
+		w.write(uint32(lengthCode.lengths[s]), 3)
+	}
+
+	// Use all symbols, rather than giving a maximum.
+	w.write(0, 1)
+
+	for _, t := range tokens {
+		lengthCode.write(w, t.symbol)
+		if t.extraBits > 0 {
+			w.write(uint32(t.extra), uint(t.extraBits))
+		}
+	}
+
+	return code
+}
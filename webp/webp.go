@@ -0,0 +1,217 @@
+// Package webp implements a lossless WebP encoder. Decoding is provided by
+// golang.org/x/image/webp.
+//
+// The encoder is kept simple: it applies the subtract green transform, then
+// encodes each pixel either as a literal or, for runs, as a backward reference
+// to the pixel to the left or above. A single set of prefix codes is used for
+// the whole image.
+package webp
+
+import (
+	"encoding/binary"
+	"errors"
+	"image"
+	"image/color"
+	"io"
+)
+
+const (
+	maxDimension = 1 << 14
+	maxLength    = 4096
+	minLength    = 3
+
+	transformSubtractGreen = 2
+)
+
+// Distance codes for the pixel above and the pixel to the left, these are the
+// first two entries in the distance map of the specification.
+const (
+	distanceAbove = 1
+	distanceLeft  = 2
+)
+
+// Encode writes the Image m to w in lossless WebP format.
+func Encode(w io.Writer, m image.Image) error {
+	b := m.Bounds()
+	width, height := b.Dx(), b.Dy()
+
+	if width < 1 || height < 1 {
+		return errors.New("webp: image is empty")
+	}
+	if width > maxDimension || height > maxDimension {
+		return errors.New("webp: image is too large")
+	}
+
+	pixels := make([]uint32, 0, width*height)
+	hasAlpha := false
+
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		for x := b.Min.X; x < b.Max.X; x++ {
+			c := color.NRGBAModel.Convert(m.At(x, y)).(color.NRGBA)
+			if c.A != 0xff {
+				hasAlpha = true
+			}
+			pixels = append(pixels, argb(c))
+		}
+	}
+
+	data := encodeVP8L(pixels, width, height, hasAlpha)
+
+	size := len(data)
+	padded := size + size%2
+
+	header := make([]byte, 20)
+	copy(header, "RIFF")
+	binary.LittleEndian.PutUint32(header[4:], uint32(4+8+padded))
+	copy(header[8:], "WEBPVP8L")
+	binary.LittleEndian.PutUint32(header[16:], uint32(size))
+
+	if _, err := w.Write(header); err != nil {
+		return err
+	}
+	if _, err := w.Write(data); err != nil {
+		return err
+	}
+	if padded != size {
+		_, err := w.Write([]byte{0})
+		return err
+	}
+	return nil
+}
+
+// argb packs a colour with the green channel subtracted from red and blue.
+func argb(c color.NRGBA) uint32 {
+	r := c.R - c.G
+	b := c.B - c.G
+	return uint32(c.A)<<24 | uint32(r)<<16 | uint32(c.G)<<8 | uint32(b)
+}
+
+// A symbol is either a literal pixel, or a backward reference of length
+// pixels.
+type symbol struct {
+	pixel    uint32
+	length   int
+	distance int
+}
+
+// prefixEncode splits a length or distance into a prefix code, and the extra
+// bits that follow it.
+func prefixEncode(value int) (code int, extraBits uint, extra uint32) {
+	d := value - 1
+	if d < 4 {
+		return d, 0, 0
+	}
+
+	high := 0
+	for (d >> uint(high+1)) > 0 {
+		high++
+	}
+	second := (d >> uint(high-1)) & 1
+
+	extraBits = uint(high - 1)
+	return 2*high + second, extraBits, uint32(d) & (1<<extraBits - 1)
+}
+
+// matchLength returns how many pixels from i are the same as those offset
+// pixels earlier.
+func matchLength(pixels []uint32, i, offset int) int {
+	if offset > i {
+		return 0
+	}
+
+	n := 0
+	for i+n < len(pixels) && n < maxLength && pixels[i+n] == pixels[i+n-offset] {
+		n++
+	}
+	return n
+}
+
+func encodeVP8L(pixels []uint32, width, height int, hasAlpha bool) []byte {
+	symbols := []symbol{}
+
+	for i := 0; i < len(pixels); {
+		left := matchLength(pixels, i, 1)
+		above := matchLength(pixels, i, width)
+
+		switch {
+		case left >= minLength && left >= above:
+			symbols = append(symbols, symbol{length: left, distance: distanceLeft})
+			i += left
+		case above >= minLength:
+			symbols = append(symbols, symbol{length: above, distance: distanceAbove})
+			i += above
+		default:
+			symbols = append(symbols, symbol{pixel: pixels[i]})
+			i++
+		}
+	}
+
+	green := make([]int, 256+24)
+	red := make([]int, 256)
+	blue := make([]int, 256)
+	alpha := make([]int, 256)
+	dist := make([]int, 40)
+
+	for _, s := range symbols {
+		if s.length > 0 {
+			code, _, _ := prefixEncode(s.length)
+			green[256+code]++
+			code, _, _ = prefixEncode(s.distance)
+			dist[code]++
+			continue
+		}
+
+		alpha[s.pixel>>24]++
+		red[(s.pixel>>16)&0xff]++
+		green[(s.pixel>>8)&0xff]++
+		blue[s.pixel&0xff]++
+	}
+
+	w := &bitWriter{}
+
+	// Header
+	w.write(0x2f, 8)
+	w.write(uint32(width-1), 14)
+	w.write(uint32(height-1), 14)
+	if hasAlpha {
+		w.write(1, 1)
+	} else {
+		w.write(0, 1)
+	}
+	w.write(0, 3)
+
+	// Transforms
+	w.write(1, 1)
+	w.write(transformSubtractGreen, 2)
+	w.write(0, 1)
+
+	// No colour cache, and no meta prefix codes
+	w.write(0, 1)
+	w.write(0, 1)
+
+	greenCode := writePrefixCode(w, green)
+	redCode := writePrefixCode(w, red)
+	blueCode := writePrefixCode(w, blue)
+	alphaCode := writePrefixCode(w, alpha)
+	distCode := writePrefixCode(w, dist)
+
+	for _, s := range symbols {
+		if s.length > 0 {
+			code, n, extra := prefixEncode(s.length)
+			greenCode.write(w, 256+code)
+			w.write(extra, n)
+
+			code, n, extra = prefixEncode(s.distance)
+			distCode.write(w, code)
+			w.write(extra, n)
+			continue
+		}
+
+		greenCode.write(w, int((s.pixel>>8)&0xff))
+		redCode.write(w, int((s.pixel>>16)&0xff))
+		blueCode.write(w, int(s.pixel&0xff))
+		alphaCode.write(w, int(s.pixel>>24))
+	}
+
+	return w.bytes()
+}
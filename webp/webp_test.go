@@ -0,0 +1,76 @@
+package webp
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"testing"
+
+	"golang.org/x/image/webp"
+)
+
+func testImage(w, h int, alpha bool) *image.NRGBA {
+	img := image.NewNRGBA(image.Rect(0, 0, w, h))
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			c := color.NRGBA{uint8(x * 7), uint8(y * 13), uint8(x * y), 255}
+			if x < w/2 {
+				// a flat area, so that backward references are used
+				c = color.NRGBA{10, 200, 30, 255}
+			}
+			if alpha {
+				c.A = uint8(x * 11)
+				if c.A == 0 {
+					c = color.NRGBA{}
+				}
+			}
+			img.SetNRGBA(x, y, c)
+		}
+	}
+	return img
+}
+
+func TestRoundTrip(t *testing.T) {
+	for _, tc := range []struct {
+		name string
+		img  *image.NRGBA
+	}{
+		{"opaque", testImage(37, 23, false)},
+		{"alpha", testImage(37, 23, true)},
+		{"pixel", testImage(1, 1, false)},
+		{"offset", testImage(40, 30, false).SubImage(image.Rect(3, 5, 20, 29)).(*image.NRGBA)},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			if err := Encode(&buf, tc.img); err != nil {
+				t.Fatal(err)
+			}
+
+			out, err := webp.Decode(&buf)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			b := tc.img.Bounds()
+			if out.Bounds().Size() != b.Size() {
+				t.Fatalf("expected size %v, got %v", b.Size(), out.Bounds().Size())
+			}
+
+			for y := 0; y < b.Dy(); y++ {
+				for x := 0; x < b.Dx(); x++ {
+					want := tc.img.NRGBAAt(b.Min.X+x, b.Min.Y+y)
+					got := color.NRGBAModel.Convert(out.At(out.Bounds().Min.X+x, out.Bounds().Min.Y+y))
+					if got != want {
+						t.Fatalf("at (%d,%d): expected %v, got %v", x, y, want, got)
+					}
+				}
+			}
+		})
+	}
+}
+
+func TestEncodeEmpty(t *testing.T) {
+	if err := Encode(&bytes.Buffer{}, image.NewNRGBA(image.Rect(0, 0, 0, 4))); err == nil {
+		t.Error("expected error")
+	}
+}